@@ -1,117 +1,66 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata" // Time zone database for validating and applying user time zones
 
-	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-
-	"github.com/ristep/um_starter_jwt_go/internal/auth"
-	"github.com/ristep/um_starter_jwt_go/internal/handlers"
-	"github.com/ristep/um_starter_jwt_go/internal/middleware"
-	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/app"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: .env file not found, using environment variables")
-	}
-
-	// Get configuration from environment
-	dbDSN := os.Getenv("DB_DSN")
-	if dbDSN == "" {
-		log.Fatal("DB_DSN environment variable is required")
-	}
-
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is required")
+	if err := run(); err != nil {
+		slog.Error("api failed", "error", err)
+		os.Exit(1)
 	}
+}
 
-	serverPort := os.Getenv("SERVER_PORT")
-	if serverPort == "" {
-		serverPort = "8080"
+func run() error {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
 	}
 
-	// Initialize database
-	db, err := gorm.Open(postgres.Open(dbDSN), &gorm.Config{})
+	// Wire the database, services and routes
+	application, err := app.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return fmt.Errorf("start: %w", err)
 	}
+	logger := application.Logger
 
-	// Auto-migrate models
-	if err := db.AutoMigrate(&models.User{}, &models.Role{}); err != nil {
-		log.Fatalf("Failed to auto-migrate models: %v", err)
+	// Start background jobs and the server
+	if err := application.Start(); err != nil {
+		return fmt.Errorf("start: %w", err)
 	}
 
-	log.Println("Database migration completed successfully")
-
-	// Create default roles if they don't exist
-	db.FirstOrCreate(&models.Role{}, models.Role{Name: "user"})
-	db.FirstOrCreate(&models.Role{}, models.Role{Name: "admin"})
-
-	// Initialize JWT service
-	jwtService := auth.NewJWTService(jwtSecret)
-
-	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, jwtService)
-	userHandler := handlers.NewUserHandler(db)
-
-	// Create Gin router
-	router := gin.Default()
-
-	// Apply global middleware
-	router.Use(middleware.CORSMiddleware())
-
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
-
-	// Public routes
-	api := router.Group("/api")
-	{
-		// Authentication routes (public)
-		auth := api.Group("/auth")
-		{
-			auth.POST("/register", authHandler.RegisterHandler)
-			auth.POST("/login", authHandler.LoginHandler)
-			auth.POST("/refresh", authHandler.RefreshHandler)
-		}
+	// Wait for a termination signal or a listener to fail
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	var serveErr error
+	select {
+	case <-quit:
+	case serveErr = <-application.Err():
+		logger.Error("listener failed", "error", serveErr)
 	}
 
-	// Protected routes (requires authentication)
-	protectedAPI := router.Group("/api")
-	protectedAPI.Use(middleware.AuthMiddleware(jwtService, db))
-	{
-		// User profile routes
-		profile := protectedAPI.Group("/profile")
-		{
-			profile.GET("", authHandler.ProfileHandler)
-		}
-
-		// User management routes (admin only)
-		users := protectedAPI.Group("/users")
-		users.Use(middleware.RoleMiddleware("admin"))
-		{
-			users.GET("", userHandler.GetAllUsersHandler)
-			users.GET("/:id", userHandler.GetUserByIDHandler)
-			users.PUT("/:id", userHandler.UpdateUserHandler)
-			users.DELETE("/:id", userHandler.DeleteUserHandler)
-			users.POST("/:id/roles", userHandler.AssignRoleHandler)
-			users.DELETE("/:id/roles", userHandler.RemoveRoleHandler)
-		}
+	// In-flight requests get 30 seconds after the drain delay
+	logger.Info("shutting down server")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownDrainDelay+30*time.Second)
+	defer cancel()
+	if err := application.Stop(ctx); err != nil {
+		return fmt.Errorf("shut down: %w", err)
 	}
-
-	// Start server
-	addr := fmt.Sprintf(":%s", serverPort)
-	log.Printf("Starting server on %s", addr)
-	if err := router.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if serveErr != nil {
+		return serveErr
 	}
+
+	logger.Info("server stopped")
+	return nil
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ristep/um_starter_jwt_go/internal/fieldcrypt"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// encryptedColumns are the user columns stored with the encrypted serializer
+var encryptedColumns = []string{"tel", "address", "date_of_birth"}
+
+func newGenerateDataKeyCmd(a *app) *cobra.Command {
+	var id string
+	var index bool
+	cmd := &cobra.Command{
+		Use:   "generate-data-key",
+		Short: "Create a key wrapped by the configured key provider, for ENCRYPTION_DATA_KEYS or ENCRYPTION_INDEX_KEY",
+		Args:  cobra.NoArgs,
+		// The key is needed before the database can be opened with encryption on
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return a.configure(cmd.Context())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if a.cfg.Encryption.KeyProvider == "" {
+				return errors.New("ENCRYPTION_KEY_PROVIDER is not set")
+			}
+			if id == "" && !index {
+				return errors.New("--id is required for data keys")
+			}
+			wrapper, err := fieldcrypt.NewWrapper(a.cfg.Encryption, a.cfg.Secrets)
+			if err != nil {
+				return err
+			}
+			key, err := fieldcrypt.NewDataKey()
+			if err != nil {
+				return err
+			}
+			wrapped, err := wrapper.Wrap(cmd.Context(), key)
+			if err != nil {
+				return fmt.Errorf("wrap data key: %w", err)
+			}
+			if index {
+				fmt.Fprintln(cmd.OutOrStdout(), wrapped)
+				return nil
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s:%s\n", id, wrapped)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&id, "id", "", "key ID stored with every value it encrypts (required for data keys)")
+	cmd.Flags().BoolVar(&index, "index", false, "create the email blind index key instead of a data key")
+	return cmd
+}
+
+func newReencryptCmd(a *app) *cobra.Command {
+	var batchSize int
+	cmd := &cobra.Command{
+		Use:   "reencrypt",
+		Short: "Encrypt plain text and rotated values of encrypted columns with the current data key",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if a.keyring == nil {
+				return errors.New("ENCRYPTION_KEY_PROVIDER is not set")
+			}
+
+			// Stored values are read without the serializer to see which key they use
+			type stored struct {
+				ID          uint
+				Email       string
+				Tel         string
+				Address     string
+				DateOfBirth *string
+			}
+			var lastID uint
+			updated := 0
+			for {
+				var rows []stored
+				if err := a.db.Table("users").Select("id", "email", encryptedColumns).
+					Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&rows).Error; err != nil {
+					return err
+				}
+				if len(rows) == 0 {
+					break
+				}
+				lastID = rows[len(rows)-1].ID
+
+				for _, row := range rows {
+					dob := ""
+					if row.DateOfBirth != nil {
+						dob = *row.DateOfBirth
+					}
+					// Emails are decrypted again when their encryption was turned off
+					emailCurrent := !fieldcrypt.Encrypted(row.Email)
+					if a.keyring.EncryptsEmail() {
+						emailCurrent = a.keyring.Current(row.Email)
+					}
+					if emailCurrent && a.keyring.Current(row.Tel) && a.keyring.Current(row.Address) && a.keyring.Current(dob) {
+						continue
+					}
+					if err := a.reencryptUser(row.ID); err != nil {
+						return fmt.Errorf("user %d: %w", row.ID, err)
+					}
+					updated++
+				}
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Re-encrypted %d users\n", updated)
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&batchSize, "batch-size", 500, "users read per query")
+	return cmd
+}
+
+// reencryptUser rewrites a user's encrypted columns and email index, locking the row
+// so concurrent profile updates aren't overwritten. Deleted users are included.
+func (a *app) reencryptUser(id uint) error {
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "email", encryptedColumns).First(&user, id).Error; err != nil {
+			return err
+		}
+		columns := append([]string{"email"}, encryptedColumns...)
+		if index := fieldcrypt.BlindIndex(user.Email); index != "" {
+			user.EmailIndex = &index
+			columns = append(columns, "email_index")
+		}
+		return tx.Unscoped().Model(&user).Select(columns).UpdateColumns(&user).Error
+	})
+}
+
+func newIndexEmailsCmd(a *app) *cobra.Command {
+	var all bool
+	var batchSize int
+	cmd := &cobra.Command{
+		Use:   "index-emails",
+		Short: "Store the blind index of users' emails, for lookups once emails are encrypted",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if a.keyring == nil || !a.keyring.HasIndexKey() {
+				return errors.New("ENCRYPTION_INDEX_KEY is not set")
+			}
+
+			var lastID uint
+			indexed := 0
+			for {
+				query := a.db.Unscoped().Select("id", "email", "email_index").Where("id > ?", lastID)
+				if !all {
+					query = query.Where("email_index IS NULL")
+				}
+				var users []models.User
+				if err := query.Order("id").Limit(batchSize).Find(&users).Error; err != nil {
+					return err
+				}
+				if len(users) == 0 {
+					break
+				}
+				lastID = users[len(users)-1].ID
+
+				for _, user := range users {
+					index := fieldcrypt.BlindIndex(user.Email)
+					if user.EmailIndex != nil && *user.EmailIndex == index {
+						continue
+					}
+					if err := a.db.Unscoped().Model(&user).UpdateColumn("email_index", index).Error; err != nil {
+						return fmt.Errorf("user %d: %w", user.ID, err)
+					}
+					indexed++
+				}
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Indexed %d users\n", indexed)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "recompute every index, e.g. after changing ENCRYPTION_INDEX_KEY")
+	cmd.Flags().IntVar(&batchSize, "batch-size", 500, "users read per query")
+	return cmd
+}
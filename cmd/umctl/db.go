@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ristep/um_starter_jwt_go/internal/accounts"
+	"github.com/ristep/um_starter_jwt_go/internal/database"
+	"github.com/ristep/um_starter_jwt_go/internal/retention"
+	"github.com/ristep/um_starter_jwt_go/internal/seed"
+	"github.com/ristep/um_starter_jwt_go/internal/storage"
+)
+
+func newMigrateCmd(a *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Create or update the database schema",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := database.WithMigrationLock(cmd.Context(), a.db, func() error {
+				return database.Migrate(a.db)
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Database schema is up to date")
+			return nil
+		},
+	}
+}
+
+func newSeedCmd(a *app) *cobra.Command {
+	var demoUsers int
+	var password string
+	var fake seed.Options
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Create the default roles and, optionally, demo or fake users",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := database.WithMigrationLock(cmd.Context(), a.db, func() error {
+				return database.Seed(a.db)
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Default roles created")
+
+			for i := 1; i <= demoUsers; i++ {
+				email := fmt.Sprintf("demo%d@example.com", i)
+				user, err := accounts.Create(a.db, email, fmt.Sprintf("Demo User %d", i), password, "user")
+				if err == accounts.ErrEmailTaken {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Created %s (id %d)\n", user.Email, user.ID)
+			}
+
+			if fake.Users > 0 {
+				fake.Password = password
+				n, err := seed.FakeUsers(cmd.Context(), a.db, fake)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Created %d fake users\n", n)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&demoUsers, "demo-users", 0, "number of demo users (demoN@example.com) to create")
+	cmd.Flags().StringVar(&password, "password", "password123", "password of the demo and fake users")
+	cmd.Flags().IntVar(&fake.Users, "fake", 0, "number of fake users with random profiles and login history to create")
+	cmd.Flags().Float64Var(&fake.AdminRatio, "admin-ratio", 0.02, "fraction of fake users given the admin role")
+	cmd.Flags().Float64Var(&fake.VerifiedRatio, "verified-ratio", 0.8, "fraction of fake users with a verified email")
+	cmd.Flags().IntVar(&fake.MaxLogins, "max-logins", 20, "maximum login history entries per fake user")
+	cmd.Flags().Uint64Var(&fake.Seed, "random-seed", 0, "seed for reproducible fake data (0 is random)")
+	return cmd
+}
+
+func newPurgeCmd(a *app) *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Delete activity, login history and deleted users past their retention period",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !a.cfg.Retention.Enabled() {
+				return errors.New("no retention period is configured (RETENTION_*_DAYS)")
+			}
+			store, err := storage.NewStorage(a.cfg.Storage)
+			if err != nil {
+				return fmt.Errorf("initialize storage: %w", err)
+			}
+			report, err := retention.NewJob(a.db, store, a.cfg.Retention).Purge(cmd.Context(), time.Now(), dryRun)
+			if err != nil {
+				return err
+			}
+
+			verb := "Deleted"
+			if dryRun {
+				verb = "Would delete"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %d activity entries, %d login events and %d deleted users\n",
+				verb, report.Activities, report.LoginEvents, report.DeletedUsers)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only count what would be deleted")
+	return cmd
+}
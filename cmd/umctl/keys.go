@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/secrets"
+)
+
+// minSecretBytes is the shortest secret generate-secret creates
+const minSecretBytes = 32
+
+func newGenerateSecretCmd(a *app) *cobra.Command {
+	var size int
+	var store string
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "generate-secret",
+		Short: "Create a random hex secret for JWT_SECRET, LINK_SIGNING_KEY or a paseto-local PASETO_KEY",
+		Args:  cobra.NoArgs,
+		// Printing a secret needs neither the configuration nor the database
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if size < minSecretBytes {
+				return fmt.Errorf("--bytes must be at least %d", minSecretBytes)
+			}
+			secret, err := auth.GenerateSecret(size)
+			if err != nil {
+				return err
+			}
+			if store == "" {
+				fmt.Fprintln(cmd.OutOrStdout(), secret)
+				return nil
+			}
+			if err := a.storeSecrets(cmd.Context(), map[string]string{store: secret}, force); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Stored a new %s in the %s secret store\n", store, a.cfg.Secrets.Provider)
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&size, "bytes", minSecretBytes, "random bytes in the secret (printed as twice as many hex digits)")
+	cmd.Flags().StringVar(&store, "store", "", "store the secret under this name in the configured secret store instead of printing it")
+	cmd.Flags().BoolVar(&force, "force", false, "replace a secret the store already holds (for JWT_SECRET this signs everyone out; see rotate-jwt-secret)")
+	return cmd
+}
+
+func newGenerateKeyPairCmd(a *app) *cobra.Command {
+	var store, force bool
+	cmd := &cobra.Command{
+		Use:   "generate-key-pair",
+		Short: "Create an Ed25519 key pair for TOKEN_FORMAT=paseto-public",
+		Args:  cobra.NoArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			seed, publicKey, err := auth.GenerateKeyPair()
+			if err != nil {
+				return err
+			}
+			if !store {
+				fmt.Fprintf(cmd.OutOrStdout(), "PASETO_KEY=%s\nPublic key: %s\n", seed, publicKey)
+				return nil
+			}
+			if err := a.storeSecrets(cmd.Context(), map[string]string{secrets.PasetoKey: seed}, force); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Stored a new PASETO_KEY in the %s secret store\nPublic key: %s\n", a.cfg.Secrets.Provider, publicKey)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&store, "store", false, "store the private key as PASETO_KEY in the configured secret store instead of printing it")
+	cmd.Flags().BoolVar(&force, "force", false, "replace a PASETO_KEY the store already holds")
+	return cmd
+}
+
+func newRotateJWTSecretCmd(a *app) *cobra.Command {
+	var finish bool
+	cmd := &cobra.Command{
+		Use:   "rotate-jwt-secret",
+		Short: "Replace JWT_SECRET in the secret store, keeping the old one valid as JWT_SECRET_PREVIOUS",
+		Args:  cobra.NoArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			store, err := a.secretStore()
+			if err != nil {
+				return err
+			}
+			if finish {
+				if err := store.SetSecrets(ctx, map[string]string{secrets.JWTPrevious: ""}); err != nil {
+					return fmt.Errorf("remove %s: %w", secrets.JWTPrevious, err)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "JWT_SECRET_PREVIOUS removed; tokens signed with it are no longer accepted")
+				return nil
+			}
+
+			current, err := store.GetSecret(ctx, secrets.JWTSecret)
+			if errors.Is(err, secrets.ErrNotFound) {
+				return errors.New("the secret store holds no JWT_SECRET; store one with generate-secret --store JWT_SECRET")
+			}
+			if err != nil {
+				return err
+			}
+			// Another rotation would drop a secret that tokens may still be signed with
+			if _, err := store.GetSecret(ctx, secrets.JWTPrevious); err == nil {
+				return errors.New("a rotation is in progress; once REFRESH_TOKEN_TTL has passed since it started, end it with --finish")
+			} else if !errors.Is(err, secrets.ErrNotFound) {
+				return err
+			}
+
+			next, err := auth.GenerateSecret(minSecretBytes)
+			if err != nil {
+				return err
+			}
+			if err := store.SetSecrets(ctx, map[string]string{secrets.JWTSecret: next, secrets.JWTPrevious: current}); err != nil {
+				return fmt.Errorf("store the new secret: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "JWT_SECRET rotated; the old secret stays valid as JWT_SECRET_PREVIOUS.\n"+
+				"Servers pick it up within SECRETS_REFRESH_INTERVAL or on restart. After REFRESH_TOKEN_TTL (%s), run rotate-jwt-secret --finish.\n",
+				a.cfg.JWT.RefreshTTL)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&finish, "finish", false, "end the rotation by removing JWT_SECRET_PREVIOUS")
+	return cmd
+}
+
+// secretStore loads the configuration and returns the configured secret store, which
+// must be writable. Secrets aren't resolved, so this works before they exist.
+func (a *app) secretStore() (secrets.Writer, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("load configuration: %w", err)
+	}
+	provider, err := secrets.NewProvider(cfg.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("initialize secrets provider: %w", err)
+	}
+	store, ok := provider.(secrets.Writer)
+	if !ok {
+		return nil, fmt.Errorf("SECRETS_PROVIDER=%s can't be written; use file, vault or aws, or set the values yourself", cfg.Secrets.Provider)
+	}
+	a.cfg = cfg
+	return store, nil
+}
+
+// storeSecrets writes values to the secret store. Unless force is set, secrets the
+// store already holds are left alone and an error is returned.
+func (a *app) storeSecrets(ctx context.Context, values map[string]string, force bool) error {
+	store, err := a.secretStore()
+	if err != nil {
+		return err
+	}
+	if !force {
+		for name := range values {
+			_, err := store.GetSecret(ctx, name)
+			if err == nil {
+				return fmt.Errorf("the secret store already holds %s; replacing it invalidates what was signed or encrypted with it, use --force to do so anyway", name)
+			}
+			if !errors.Is(err, secrets.ErrNotFound) {
+				return err
+			}
+		}
+	}
+	if err := store.SetSecrets(ctx, values); err != nil {
+		return fmt.Errorf("store secrets: %w", err)
+	}
+	return nil
+}
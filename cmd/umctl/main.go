@@ -0,0 +1,137 @@
+// Command umctl manages users and the database directly, without going through the
+// HTTP API. It reads the same configuration (environment, .env, CONFIG_FILE) as the
+// server.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/buildinfo"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/database"
+	"github.com/ristep/um_starter_jwt_go/internal/fieldcrypt"
+	"github.com/ristep/um_starter_jwt_go/internal/secrets"
+	"github.com/ristep/um_starter_jwt_go/internal/usercache"
+)
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// app holds what the subcommands share; db is opened before any subcommand runs
+type app struct {
+	cfg     *config.Config
+	db      *gorm.DB
+	keyring *fieldcrypt.Keyring
+}
+
+func newRootCmd() *cobra.Command {
+	a := &app{}
+	root := &cobra.Command{
+		Use:           "umctl",
+		Short:         "Administer the user management API",
+		Version:       buildinfo.Get().Version,
+		SilenceUsage:  true,
+		SilenceErrors: false,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return a.connect(cmd.Context())
+		},
+	}
+
+	root.AddCommand(
+		newCreateAdminCmd(a),
+		newBootstrapAdminCmd(a),
+		newResetPasswordCmd(a),
+		newListUsersCmd(a),
+		newAssignRoleCmd(a),
+		newRevokeTokensCmd(a),
+		newSuspendCmd(a),
+		newUnsuspendCmd(a),
+		newMigrateCmd(a),
+		newSeedCmd(a),
+		newPurgeCmd(a),
+		newGenerateSecretCmd(a),
+		newGenerateKeyPairCmd(a),
+		newRotateJWTSecretCmd(a),
+		newGenerateDataKeyCmd(a),
+		newReencryptCmd(a),
+		newIndexEmailsCmd(a),
+	)
+	return root
+}
+
+// configure loads the configuration and resolves secrets
+func (a *app) configure(ctx context.Context) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+	provider, err := secrets.NewProvider(cfg.Secrets)
+	if err != nil {
+		return fmt.Errorf("initialize secrets provider: %w", err)
+	}
+	if err := secrets.Resolve(ctx, provider, cfg); err != nil {
+		return fmt.Errorf("resolve secrets: %w", err)
+	}
+	a.cfg = cfg
+	return nil
+}
+
+// connect configures the app, loads the encryption keys and opens the database
+func (a *app) connect(ctx context.Context) error {
+	if err := a.configure(ctx); err != nil {
+		return err
+	}
+	cfg := a.cfg
+
+	keyring, err := fieldcrypt.Load(ctx, cfg.Encryption, cfg.Secrets)
+	if err != nil {
+		return fmt.Errorf("load encryption keys: %w", err)
+	}
+	fieldcrypt.Use(keyring)
+
+	db, err := database.Open(cfg.Database, nil)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+
+	// Changes made here must not be hidden by users the servers have cached in Redis
+	if cfg.UserCache.Backend == "redis" {
+		opts, err := redis.ParseURL(cfg.Redis.URL)
+		if err != nil {
+			return fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		cache := usercache.NewRedis(redis.NewClient(opts), cfg.UserCache.TTL)
+		if err := usercache.InvalidateOnWrite(db, cache); err != nil {
+			return err
+		}
+	}
+
+	a.db, a.keyring = db, keyring
+	return nil
+}
+
+// readPassword returns the --password flag value, or reads the password from the
+// first line of stdin so it does not end up in the shell history
+func readPassword(cmd *cobra.Command, flag string) (string, error) {
+	if flag != "" {
+		return flag, nil
+	}
+	fmt.Fprint(cmd.ErrOrStderr(), "Password: ")
+	line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("no password given; use --password or pipe it to stdin")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ristep/um_starter_jwt_go/internal/accounts"
+	"github.com/ristep/um_starter_jwt_go/internal/database"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+func newCreateAdminCmd(a *app) *cobra.Command {
+	var email, name, password string
+	cmd := &cobra.Command{
+		Use:   "create-admin",
+		Short: "Create a user with the admin role",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := readPassword(cmd, password)
+			if err != nil {
+				return err
+			}
+			user, err := accounts.Create(a.db, email, name, password, "user", "admin")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Created admin %s (id %d)\n", user.Email, user.ID)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&email, "email", "", "email address (required)")
+	cmd.Flags().StringVar(&name, "name", "Administrator", "display name")
+	cmd.Flags().StringVar(&password, "password", "", "password; read from stdin when omitted")
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func newBootstrapAdminCmd(a *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "bootstrap-admin",
+		Short: "Create the admin from ADMIN_EMAIL/ADMIN_PASSWORD if no admin exists",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if a.cfg.Admin.Email == "" {
+				return errors.New("ADMIN_EMAIL is not set")
+			}
+			var user *models.User
+			err := database.WithMigrationLock(cmd.Context(), a.db, func() (err error) {
+				user, err = accounts.BootstrapAdmin(a.db, a.cfg.Admin.Email, a.cfg.Admin.Name, a.cfg.Admin.Password)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if user == nil {
+				fmt.Fprintln(cmd.OutOrStdout(), "An admin already exists; nothing to do")
+				return nil
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Created admin %s (id %d)\n", user.Email, user.ID)
+			return nil
+		},
+	}
+}
+
+func newResetPasswordCmd(a *app) *cobra.Command {
+	var password string
+	cmd := &cobra.Command{
+		Use:   "reset-password <id|email>",
+		Short: "Set a new password and revoke the user's tokens",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := accounts.Find(a.db, args[0])
+			if err != nil {
+				return err
+			}
+			password, err := readPassword(cmd, password)
+			if err != nil {
+				return err
+			}
+			if err := accounts.ResetPassword(a.db, user, password); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Password of %s reset; existing tokens revoked\n", user.Email)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&password, "password", "", "new password; read from stdin when omitted")
+	return cmd
+}
+
+func newListUsersCmd(a *app) *cobra.Command {
+	var role string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "list-users",
+		Short: "List users, newest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := a.db.Preload("Roles").Order("id DESC").Limit(limit)
+			if role != "" {
+				query = query.Where("id IN (?)", a.db.Table("user_roles").
+					Select("user_roles.user_id").
+					Joins("JOIN roles ON roles.id = user_roles.role_id").
+					Where("roles.name = ?", strings.ToLower(role)))
+			}
+			var users []models.User
+			if err := query.Find(&users).Error; err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tEMAIL\tNAME\tROLES\tCREATED")
+			for _, user := range users {
+				roles := make([]string, len(user.Roles))
+				for i, r := range user.Roles {
+					roles[i] = r.Name
+				}
+				created := time.UnixMilli(user.CreatedAt).UTC().Format(time.DateTime)
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", user.ID, user.Email, user.Name, strings.Join(roles, ","), created)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&role, "role", "", "only users with this role")
+	cmd.Flags().IntVar(&limit, "limit", 50, "maximum number of users to list")
+	return cmd
+}
+
+func newAssignRoleCmd(a *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "assign-role <id|email> <role>",
+		Short: "Give a user a role, creating the role if needed",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := accounts.Find(a.db, args[0])
+			if err != nil {
+				return err
+			}
+			if err := accounts.AssignRole(a.db, user, args[1]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Assigned role %s to %s\n", args[1], user.Email)
+			return nil
+		},
+	}
+}
+
+func newSuspendCmd(a *app) *cobra.Command {
+	var reason string
+	cmd := &cobra.Command{
+		Use:   "suspend <id|email>",
+		Short: "Block a user from logging in and revoke their tokens",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := accounts.Find(a.db, args[0])
+			if err != nil {
+				return err
+			}
+			if err := accounts.Suspend(a.db, user, reason); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Suspended %s\n", user.Email)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "", "why the account is suspended")
+	return cmd
+}
+
+func newUnsuspendCmd(a *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "unsuspend <id|email>",
+		Short: "Lift a user's suspension",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := accounts.Find(a.db, args[0])
+			if err != nil {
+				return err
+			}
+			if err := accounts.Unsuspend(a.db, user); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Unsuspended %s\n", user.Email)
+			return nil
+		},
+	}
+}
+
+func newRevokeTokensCmd(a *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke-tokens <id|email>",
+		Short: "Invalidate every access and refresh token issued to a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := accounts.Find(a.db, args[0])
+			if err != nil {
+				return err
+			}
+			if err := accounts.RevokeTokens(a.db, user); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Revoked all tokens of %s\n", user.Email)
+			return nil
+		},
+	}
+}
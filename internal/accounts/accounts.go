@@ -0,0 +1,209 @@
+// Package accounts implements user administration tasks shared by the API and the
+// umctl admin tool: creating users, resetting passwords, assigning roles and
+// revoking tokens.
+package accounts
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// MinPasswordLength is the shortest accepted password
+const MinPasswordLength = 8
+
+// Errors returned by the account operations
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrEmailTaken          = errors.New("a user with this email already exists")
+	ErrPasswordTooShort    = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	ErrRoleAlreadyAssigned = errors.New("user already has this role")
+)
+
+// HashPassword hashes a password with bcrypt
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Find loads a user with roles by numeric ID or email
+func Find(db *gorm.DB, idOrEmail string) (*models.User, error) {
+	query := db.Preload("Roles")
+	if id, err := strconv.ParseUint(idOrEmail, 10, 64); err == nil {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Scopes(models.WhereEmail(idOrEmail))
+	}
+
+	var user models.User
+	if err := query.First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Create creates a verified user with the given roles, creating missing roles
+func Create(db *gorm.DB, email, name, password string, roleNames ...string) (*models.User, error) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := db.Model(&models.User{}).Scopes(models.WhereEmail(email)).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrEmailTaken
+	}
+
+	now := time.Now().UnixMilli()
+	user := models.User{Email: email, Name: name, Password: hash, PasswordSetAt: now, LastActiveAt: now, EmailVerified: true}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, roleName := range roleNames {
+			var role models.Role
+			if err := tx.FirstOrCreate(&role, models.Role{Name: normalizeRole(roleName)}).Error; err != nil {
+				return err
+			}
+			user.Roles = append(user.Roles, role)
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ResetPassword sets a new password and revokes the user's tokens
+func ResetPassword(db *gorm.DB, user *models.User, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	return db.Model(user).Updates(map[string]any{
+		"password":            hash,
+		"password_changed_at": now,
+		"token_version":       gorm.Expr("token_version + 1"),
+		"updated_at":          now,
+		"version":             gorm.Expr("version + 1"),
+	}).Error
+}
+
+// AssignRole gives the user a role, creating the role if needed, and revokes the
+// user's tokens so that none carries the old roles
+func AssignRole(db *gorm.DB, user *models.User, roleName string) error {
+	var role models.Role
+	if err := db.FirstOrCreate(&role, models.Role{Name: normalizeRole(roleName)}).Error; err != nil {
+		return err
+	}
+	for _, r := range user.Roles {
+		if r.ID == role.ID {
+			return ErrRoleAlreadyAssigned
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Association("Roles").Append(&role); err != nil {
+			return err
+		}
+		return RevokeTokens(tx, user)
+	})
+}
+
+// RevokeTokens invalidates every access and refresh token issued to the user
+func RevokeTokens(db *gorm.DB, user *models.User) error {
+	return db.Model(user).Updates(map[string]any{
+		"token_version": gorm.Expr("token_version + 1"),
+		"updated_at":    time.Now().UnixMilli(),
+		"version":       gorm.Expr("version + 1"),
+	}).Error
+}
+
+// AdminExists reports whether any active user has the admin role
+func AdminExists(db *gorm.DB) (bool, error) {
+	var count int64
+	err := db.Model(&models.User{}).
+		Where("id IN (?)", db.Table("user_roles").
+			Select("user_roles.user_id").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("roles.name = ?", "admin")).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// BootstrapAdmin creates an admin account unless an admin already exists. It returns
+// nil, nil when there was nothing to do. An existing user with the email is not
+// promoted, since anyone could have registered it; ErrEmailTaken is returned instead.
+func BootstrapAdmin(db *gorm.DB, email, name, password string) (*models.User, error) {
+	exists, err := AdminExists(db)
+	if err != nil || exists {
+		return nil, err
+	}
+	return Create(db, email, name, password, "user", "admin")
+}
+
+// Suspend blocks the user from logging in and revokes their tokens. Suspending a
+// suspended user only updates the reason.
+func Suspend(db *gorm.DB, user *models.User, reason string) error {
+	updates := map[string]any{
+		"suspend_reason": reason,
+		"token_version":  gorm.Expr("token_version + 1"),
+		"updated_at":     time.Now().UnixMilli(),
+		"version":        gorm.Expr("version + 1"),
+	}
+	if user.SuspendedAt == nil {
+		updates["suspended_at"] = time.Now().UnixMilli()
+	}
+	return db.Model(user).Updates(updates).Error
+}
+
+// Unsuspend lets the user log in again. Accounts suspended for inactivity get a new
+// warning and grace period before they are suspended again.
+func Unsuspend(db *gorm.DB, user *models.User) error {
+	return db.Model(user).Updates(map[string]any{
+		"suspended_at":         nil,
+		"suspend_reason":       "",
+		"inactivity_warned_at": nil,
+		"updated_at":           time.Now().UnixMilli(),
+		"version":              gorm.Expr("version + 1"),
+	}).Error
+}
+
+// activityResolution is how stale the recorded activity may get before it is updated,
+// so frequent token refreshes don't each write to the users table
+const activityResolution = time.Hour
+
+// RecordActivity notes that the user just signed in or refreshed a session, which
+// also withdraws a pending inactivity warning
+func RecordActivity(db *gorm.DB, userID uint) error {
+	now := time.Now()
+	return db.Model(&models.User{ID: userID}).
+		Where("last_active_at < ? OR inactivity_warned_at IS NOT NULL", now.Add(-activityResolution).UnixMilli()).
+		UpdateColumns(map[string]any{
+			"last_active_at":       now.UnixMilli(),
+			"inactivity_warned_at": nil,
+		}).Error
+}
+
+// normalizeRole lower-cases and trims a role name
+func normalizeRole(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
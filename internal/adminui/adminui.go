@@ -0,0 +1,54 @@
+// Package adminui serves a small admin web UI for browsing users, editing their roles,
+// suspending them and reading their login history. It is a static single-page app
+// embedded in the binary; it signs in through the API like any other client and calls
+// the admin routes with the resulting access token, so the API enforces the admin role.
+package adminui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed static
+var static embed.FS
+
+// files are the UI's assets by name
+var files = func() fs.FS {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}()
+
+// contentSecurityPolicy only lets the page load its own assets and call its own API
+const contentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; img-src 'self' data:; form-action 'none'; frame-ancestors 'none'; base-uri 'none'"
+
+// Handler serves the UI under prefix, e.g. "/admin". Paths that name no asset get the
+// page itself, so the app's own routes survive a reload.
+func Handler(prefix string) gin.HandlerFunc {
+	index, err := fs.ReadFile(files, "index.html")
+	if err != nil {
+		panic(err)
+	}
+	assets := http.FS(files)
+
+	return func(c *gin.Context) {
+		c.Header("Content-Security-Policy", contentSecurityPolicy)
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Referrer-Policy", "no-referrer")
+		c.Header("Cache-Control", "no-cache")
+
+		name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(c.Request.URL.Path, prefix)), "/")
+		if info, err := fs.Stat(files, name); err == nil && !info.IsDir() && name != "index.html" {
+			c.FileFromFS(name, assets)
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index)
+	}
+}
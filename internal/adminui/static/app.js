@@ -0,0 +1,470 @@
+// Admin UI: signs in through the API and calls the admin routes with the access token.
+// Tokens live in sessionStorage, so closing the tab ends the session.
+'use strict';
+
+const API = '/api';
+const BASE = '/admin';
+const PER_PAGE = 20;
+
+const $ = (id) => document.getElementById(id);
+
+const session = {
+  get: () => JSON.parse(sessionStorage.getItem('um-admin') || 'null'),
+  set: (s) => sessionStorage.setItem('um-admin', JSON.stringify(s)),
+  clear: () => sessionStorage.removeItem('um-admin'),
+};
+
+class APIError extends Error {
+  constructor(status, problem) {
+    super(problem.detail || problem.title || `HTTP ${status}`);
+    this.status = status;
+    this.code = problem.code;
+  }
+}
+
+// send calls the API and returns the parsed envelope
+async function send(method, path, body, token) {
+  const headers = { Accept: 'application/json' };
+  if (body !== undefined) headers['Content-Type'] = 'application/json';
+  if (token) headers.Authorization = `Bearer ${token}`;
+  const resp = await fetch(API + path, {
+    method,
+    headers,
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  if (resp.status === 204) return {};
+  const doc = await resp.json().catch(() => ({}));
+  if (!resp.ok) throw new APIError(resp.status, doc);
+  return doc;
+}
+
+function keepTokens(data, user) {
+  const s = session.get() || {};
+  session.set({
+    access: data.access_token,
+    refresh: data.refresh_token,
+    user: user || s.user,
+  });
+}
+
+// api calls an authenticated route, refreshing an expired access token and asking
+// for the password when the route needs a recent login
+async function api(method, path, body) {
+  const s = session.get();
+  if (!s) throw new APIError(401, { title: 'Not signed in' });
+  try {
+    return await send(method, path, body, s.access);
+  } catch (err) {
+    if (err.code === 'token_expired') {
+      const refreshed = await send('POST', '/auth/refresh', { refresh_token: s.refresh });
+      keepTokens(refreshed.data);
+      return api(method, path, body);
+    }
+    if (err.code === 'reauthentication_required') {
+      await reauthenticate();
+      return api(method, path, body);
+    }
+    if (err.status === 401) signOut();
+    throw err;
+  }
+}
+
+function reauthenticate() {
+  const dialog = $('reauth');
+  const form = $('reauth-form');
+  form.reset();
+  dialog.showModal();
+  return new Promise((resolve, reject) => {
+    form.onsubmit = async (e) => {
+      e.preventDefault();
+      try {
+        const resp = await send('POST', '/auth/reauthenticate', {
+          refresh_token: session.get().refresh,
+          password: form.password.value,
+        });
+        keepTokens(resp.data);
+        dialog.close();
+        resolve();
+      } catch (err) {
+        dialog.close();
+        reject(err);
+      }
+    };
+    $('reauth-cancel').onclick = () => {
+      dialog.close();
+      reject(new Error('Password confirmation cancelled'));
+    };
+  });
+}
+
+function showError(err) {
+  const el = $('error');
+  el.textContent = err ? err.message : '';
+  el.hidden = !err;
+}
+
+function show(view) {
+  for (const id of ['login-view', 'users-view', 'user-view']) $(id).hidden = id !== view;
+  const s = session.get();
+  $('whoami').textContent = s ? s.user.email : '';
+  $('logout').hidden = !s;
+}
+
+function cell(row, text, className) {
+  const td = row.insertCell();
+  td.textContent = text ?? '';
+  if (className) td.className = className;
+  return td;
+}
+
+const formatTime = (ms) => (ms ? new Date(ms).toLocaleString() : '');
+const roleNames = (user) => (user.roles || []).map((r) => r.name);
+
+function navigate(path) {
+  history.pushState(null, '', BASE + path);
+  route();
+}
+
+// Login
+
+async function signIn(e) {
+  e.preventDefault();
+  const form = e.target;
+  const login = form.login.value.trim();
+  const body = { password: form.password.value };
+  body[login.includes('@') ? 'email' : 'username'] = login;
+  if (form.otp.value) body.otp = form.otp.value.trim();
+  try {
+    const resp = await send('POST', '/auth/login', body);
+    const user = resp.data.user;
+    if (!roleNames(user).includes('admin')) {
+      await send('POST', '/auth/logout', { refresh_token: resp.data.refresh_token }, resp.data.access_token);
+      throw new Error('This account is not an administrator');
+    }
+    keepTokens(resp.data, user);
+    form.reset();
+    showError(null);
+    route();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+function signOut() {
+  const s = session.get();
+  session.clear();
+  stopEvents();
+  if (s) send('POST', '/auth/logout', { refresh_token: s.refresh }, s.access).catch(() => {});
+  history.replaceState(null, '', BASE + '/');
+  show('login-view');
+}
+
+// User list
+
+let usersPage = 1;
+let usersTags = [];
+
+async function showUsers() {
+  show('users-view');
+  streamEvents();
+  const tags = usersTags.map((t) => `&tag=${encodeURIComponent(t)}`).join('');
+  const resp = await api('GET', `/users?page=${usersPage}&per_page=${PER_PAGE}${tags}`);
+  const tbody = $('users');
+  tbody.replaceChildren();
+  for (const user of resp.data) {
+    const row = tbody.insertRow();
+    row.className = 'link';
+    row.onclick = () => navigate(`/users/${user.id}`);
+    cell(row, user.id);
+    cell(row, user.email);
+    cell(row, user.name);
+    cell(row, roleNames(user).join(', '));
+    cell(row, (user.tags || []).join(', '));
+    cell(row, user.suspended_at ? 'Suspended' : 'Active', user.suspended_at ? 'suspended' : '');
+  }
+  const p = resp.meta.pagination;
+  $('page').textContent = `Page ${p.page} of ${Math.max(p.total_pages, 1)} (${p.total} users)`;
+  $('prev').disabled = p.page <= 1;
+  $('next').disabled = p.page >= p.total_pages;
+}
+
+// Live activity
+
+const LIVE_MAX = 50;
+let liveLastID = 0;
+let liveAbort = null;
+
+function describeEvent(event) {
+  const user = `user #${event.user_id}`;
+  const d = event.details || {};
+  switch (event.type) {
+    case 'user_registered': return `${d.email || user} registered`;
+    case 'failed_login_burst': return `${d.failures} failed logins for ${user} within ${d.window}`;
+    case 'role_assigned': return `${user} was given the ${d.role} role`;
+    case 'role_removed': return `${user} lost the ${d.role} role`;
+    default: return `${event.type} (${user})`;
+  }
+}
+
+function addLiveEvent(event) {
+  liveLastID = event.id;
+  const li = document.createElement('li');
+  li.className = event.type === 'failed_login_burst' ? 'suspicious' : '';
+  const meta = document.createElement('span');
+  meta.className = 'meta';
+  meta.textContent = formatTime(event.created_at);
+  const link = document.createElement('a');
+  link.href = `${BASE}/users/${event.user_id}`;
+  link.textContent = describeEvent(event);
+  link.onclick = (e) => {
+    e.preventDefault();
+    navigate(`/users/${event.user_id}`);
+  };
+  li.append(meta, link);
+  const list = $('live');
+  list.prepend(li);
+  while (list.children.length > LIVE_MAX) list.lastChild.remove();
+}
+
+// streamEvents follows the admin event stream while signed in, reconnecting after
+// errors and catching up on the events missed in between. EventSource can't send the
+// access token, so the stream is read with fetch.
+async function streamEvents() {
+  if (liveAbort) return;
+  liveAbort = new AbortController();
+  while (session.get() && !liveAbort.signal.aborted) {
+    try {
+      const headers = { Accept: 'text/event-stream', Authorization: `Bearer ${session.get().access}` };
+      if (liveLastID) headers['Last-Event-ID'] = String(liveLastID);
+      const resp = await fetch(`${API}/admin/events`, { headers, signal: liveAbort.signal });
+      if (!resp.ok) {
+        const doc = await resp.json().catch(() => ({}));
+        // A short call refreshes an expired token the same way as everywhere else
+        if (doc.code === 'token_expired') await api('GET', '/admin/tags');
+        else throw new APIError(resp.status, doc);
+        continue;
+      }
+      const reader = resp.body.pipeThrough(new TextDecoderStream()).getReader();
+      let buffer = '';
+      for (;;) {
+        const { value, done } = await reader.read();
+        if (done) break;
+        buffer += value;
+        let end;
+        while ((end = buffer.indexOf('\n\n')) >= 0) {
+          const data = buffer.slice(0, end).split('\n').filter((l) => l.startsWith('data: '));
+          buffer = buffer.slice(end + 2);
+          if (data.length) addLiveEvent(JSON.parse(data.map((l) => l.slice(6)).join('\n')));
+        }
+      }
+    } catch (err) {
+      if (liveAbort.signal.aborted) break;
+      if (err.status === 401 || err.status === 403) break;
+    }
+    await new Promise((resolve) => setTimeout(resolve, 5000));
+  }
+  liveAbort = null;
+}
+
+function stopEvents() {
+  if (liveAbort) liveAbort.abort();
+}
+
+// User details
+
+let currentUser = null;
+let loginsPage = 1;
+
+async function showUser(id) {
+  show('user-view');
+  if (!currentUser || currentUser.id !== id) loginsPage = 1;
+  const resp = await api('GET', `/users/${id}`);
+  renderUser(resp.data);
+  await Promise.all([showNotes(), showLogins(), loadKnownTags()]);
+}
+
+function renderUser(user) {
+  currentUser = user;
+  $('user-title').textContent = `${user.name} <${user.email}>`;
+
+  const details = $('user-details');
+  details.replaceChildren();
+  const add = (term, value) => {
+    const dt = document.createElement('dt');
+    dt.textContent = term;
+    const dd = document.createElement('dd');
+    dd.textContent = value ?? '';
+    details.append(dt, dd);
+  };
+  add('ID', user.id);
+  add('Username', user.username);
+  add('Email verified', user.email_verified ? 'yes' : 'no');
+  add('Phone', user.tel ? `${user.tel}${user.phone_verified ? ' (verified)' : ''}` : '');
+  add('Two-factor', user.totp_enabled ? 'enabled' : 'off');
+  add('Created', formatTime(user.created_at));
+  add('Last active', formatTime(user.last_active_at));
+
+  const roles = $('roles');
+  roles.replaceChildren();
+  for (const name of roleNames(user)) {
+    const li = document.createElement('li');
+    li.textContent = name;
+    const remove = document.createElement('button');
+    remove.type = 'button';
+    remove.textContent = 'Remove';
+    remove.onclick = () => act(() => api('DELETE', `/users/${user.id}/roles`, { role_name: name }));
+    li.append(remove);
+    roles.append(li);
+  }
+
+  const tags = $('tags');
+  tags.replaceChildren();
+  for (const tag of user.tags || []) {
+    const li = document.createElement('li');
+    li.textContent = tag;
+    const remove = document.createElement('button');
+    remove.type = 'button';
+    remove.textContent = 'Remove';
+    remove.onclick = () => act(() => api('DELETE', `/users/${user.id}/tags/${encodeURIComponent(tag)}`));
+    li.append(remove);
+    tags.append(li);
+  }
+
+  const suspended = Boolean(user.suspended_at);
+  $('suspension').textContent = suspended
+    ? `Suspended since ${formatTime(user.suspended_at)}${user.suspend_reason ? `: ${user.suspend_reason}` : ''}`
+    : 'Not suspended';
+  $('suspension').className = suspended ? 'suspended' : '';
+  $('unsuspend').hidden = !suspended;
+}
+
+async function showNotes() {
+  const resp = await api('GET', `/users/${currentUser.id}/notes?per_page=100`);
+  const list = $('notes');
+  list.replaceChildren();
+  for (const note of resp.data) {
+    const li = document.createElement('li');
+    const meta = document.createElement('div');
+    meta.className = 'meta';
+    meta.textContent = `${formatTime(note.created_at)} by ${note.author ? note.author.email : `admin #${note.author_id}`}`;
+    const remove = document.createElement('button');
+    remove.type = 'button';
+    remove.textContent = 'Delete';
+    remove.onclick = async () => {
+      try {
+        await api('DELETE', `/users/${currentUser.id}/notes/${note.id}`);
+        await showNotes();
+      } catch (err) {
+        showError(err);
+      }
+    };
+    meta.append(remove);
+    li.append(meta, document.createTextNode(note.body));
+    list.append(li);
+  }
+}
+
+// loadKnownTags offers the allowed tags, or the tags in use, as suggestions
+async function loadKnownTags() {
+  const resp = await api('GET', '/admin/tags');
+  const names = resp.data.allowed.length ? resp.data.allowed : resp.data.in_use.map((t) => t.tag);
+  $('known-tags').replaceChildren(...names.map((name) => new Option(name)));
+}
+
+async function showLogins() {
+  const resp = await api('GET', `/users/${currentUser.id}/logins?page=${loginsPage}&per_page=${PER_PAGE}`);
+  const tbody = $('logins');
+  tbody.replaceChildren();
+  for (const event of resp.data) {
+    const row = tbody.insertRow();
+    cell(row, formatTime(event.created_at));
+    cell(row, event.success ? 'Success' : 'Failed');
+    cell(row, event.ip);
+    cell(row, event.country);
+    cell(row, event.user_agent);
+    cell(row, event.suspicious ? event.risk_reasons || 'suspicious' : '', event.suspicious ? 'suspicious' : '');
+  }
+  const p = resp.meta.pagination;
+  $('logins-page').textContent = `Page ${p.page} of ${Math.max(p.total_pages, 1)}`;
+  $('logins-prev').disabled = p.page <= 1;
+  $('logins-next').disabled = p.page >= p.total_pages;
+}
+
+// act runs a change of the current user and shows the updated user
+async function act(change) {
+  try {
+    const resp = await change();
+    renderUser(resp.data);
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+// Routing
+
+async function route() {
+  if (!session.get()) {
+    show('login-view');
+    return;
+  }
+  const match = location.pathname.match(/^\/admin\/users\/(\d+)\/?$/);
+  try {
+    if (match) await showUser(Number(match[1]));
+    else await showUsers();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+  $('login-form').onsubmit = signIn;
+  $('logout').onclick = signOut;
+  $('back').onclick = (e) => {
+    e.preventDefault();
+    navigate('/');
+  };
+  $('prev').onclick = () => { usersPage--; route(); };
+  $('next').onclick = () => { usersPage++; route(); };
+  $('logins-prev').onclick = () => { loginsPage--; showLogins().catch(showError); };
+  $('logins-next').onclick = () => { loginsPage++; showLogins().catch(showError); };
+  $('role-form').onsubmit = (e) => {
+    e.preventDefault();
+    const role = e.target.role.value.trim();
+    e.target.reset();
+    act(() => api('POST', `/users/${currentUser.id}/roles`, { role_name: role }));
+  };
+  $('filter-form').onsubmit = (e) => {
+    e.preventDefault();
+    usersTags = e.target.tags.value.split(/[\s,]+/).filter(Boolean);
+    usersPage = 1;
+    route();
+  };
+  $('tag-form').onsubmit = (e) => {
+    e.preventDefault();
+    const tag = e.target.tag.value.trim();
+    e.target.reset();
+    act(() => api('POST', `/users/${currentUser.id}/tags`, { tag }));
+  };
+  $('suspend-form').onsubmit = (e) => {
+    e.preventDefault();
+    const reason = e.target.reason.value.trim();
+    e.target.reset();
+    act(() => api('PUT', `/users/${currentUser.id}/suspension`, { reason }));
+  };
+  $('note-form').onsubmit = async (e) => {
+    e.preventDefault();
+    const form = e.target;
+    try {
+      await api('POST', `/users/${currentUser.id}/notes`, { body: form.body.value });
+      form.reset();
+      await showNotes();
+      showError(null);
+    } catch (err) {
+      showError(err);
+    }
+  };
+  $('unsuspend').onclick = () => act(() => api('DELETE', `/users/${currentUser.id}/suspension`));
+  window.addEventListener('popstate', route);
+  route();
+});
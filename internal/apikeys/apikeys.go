@@ -0,0 +1,263 @@
+// Package apikeys resolves the API keys sent by integrations and meters their use.
+// Requests are counted in memory and added to daily rollups in the database on every
+// sync; monthly quotas are checked against the totals of all instances as of the last
+// sync plus the requests counted here since.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// ErrNotFound is returned for unknown key IDs
+var ErrNotFound = errors.New("API key not found")
+
+// keyPrefix starts every generated key, so leaked keys are easy to recognise
+const keyPrefix = "umk_"
+
+// dayFormat is the format of APIKeyUsage.Day
+const dayFormat = "2006-01-02"
+
+// Generate returns a new random API key and the hash it is stored under
+func Generate() (key, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, Hash(key), nil
+}
+
+// Hash returns the hex-encoded SHA-256 hash of a key
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Prefix returns the start of a key shown to recognise it
+func Prefix(key string) string {
+	return key[:len(keyPrefix)+8]
+}
+
+// usageKey identifies the requests of one key on one day
+type usageKey struct {
+	id  uint
+	day string
+}
+
+// Registry holds the active API keys and counts their requests
+type Registry struct {
+	db *gorm.DB
+
+	mu   sync.Mutex
+	keys map[string]*models.APIKey // Active keys by hash
+	// month is the month (YYYY-MM) monthly holds totals of
+	month   string
+	monthly map[uint]int64
+	pending map[usageKey]int64
+}
+
+// NewRegistry creates an empty registry; call Sync to load the keys
+func NewRegistry(db *gorm.DB) *Registry {
+	return &Registry{
+		db:      db,
+		keys:    make(map[string]*models.APIKey),
+		monthly: make(map[uint]int64),
+		pending: make(map[usageKey]int64),
+	}
+}
+
+// Lookup returns the active key with the given value
+func (r *Registry) Lookup(key string) (*models.APIKey, bool) {
+	if key == "" {
+		return nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	apiKey, ok := r.keys[Hash(key)]
+	return apiKey, ok
+}
+
+// Use counts a request made with the key, unless the key's monthly quota is used up
+func (r *Registry) Use(apiKey *models.APIKey, now time.Time) bool {
+	now = now.UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if apiKey.MonthlyQuota > 0 && r.monthToDate(apiKey.ID, now) >= apiKey.MonthlyQuota {
+		return false
+	}
+	r.pending[usageKey{id: apiKey.ID, day: now.Format(dayFormat)}]++
+	return true
+}
+
+// MonthToDate returns the requests made with the key this month, as far as known here
+func (r *Registry) MonthToDate(id uint, now time.Time) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.monthToDate(id, now.UTC())
+}
+
+// monthToDate adds the requests counted here since the last sync to the synced total.
+// Call it with r.mu held.
+func (r *Registry) monthToDate(id uint, now time.Time) int64 {
+	month := now.Format("2006-01")
+	total := int64(0)
+	if r.month == month {
+		total = r.monthly[id]
+	}
+	for k, n := range r.pending {
+		if k.id == id && k.day[:7] == month {
+			total += n
+		}
+	}
+	return total
+}
+
+// List returns the keys of a user, or every key for userID 0, revoked ones included
+func (r *Registry) List(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	query := r.db.WithContext(ctx).Order("id")
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	keys := []models.APIKey{}
+	err := query.Find(&keys).Error
+	return keys, err
+}
+
+// Get loads a key, revoked or not
+func (r *Registry) Get(ctx context.Context, id uint) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	if err := r.db.WithContext(ctx).First(&apiKey, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// Create stores a new key. Like the other changes, it takes effect on the next Sync.
+func (r *Registry) Create(ctx context.Context, apiKey *models.APIKey) error {
+	return r.db.WithContext(ctx).Create(apiKey).Error
+}
+
+// SetQuota sets the monthly request quota of a key; 0 removes it
+func (r *Registry) SetQuota(ctx context.Context, apiKey *models.APIKey, quota int64) error {
+	return r.db.WithContext(ctx).Model(apiKey).Update("monthly_quota", quota).Error
+}
+
+// Revoke revokes a key
+func (r *Registry) Revoke(ctx context.Context, apiKey *models.APIKey) error {
+	return r.db.WithContext(ctx).Model(apiKey).Update("revoked_at", time.Now().UnixMilli()).Error
+}
+
+// Usage returns the daily rollups of a key between two days (YYYY-MM-DD), inclusive
+func (r *Registry) Usage(ctx context.Context, id uint, from, to string) ([]models.APIKeyUsage, error) {
+	days := []models.APIKeyUsage{}
+	err := r.db.WithContext(ctx).Where("api_key_id = ? AND day BETWEEN ? AND ?", id, from, to).
+		Order("day").Find(&days).Error
+	return days, err
+}
+
+// Sync writes the counted requests to the daily rollups, then reloads the active keys
+// and this month's totals
+func (r *Registry) Sync(ctx context.Context) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[usageKey]int64)
+	r.mu.Unlock()
+
+	if err := r.flush(ctx, pending); err != nil {
+		// Keep the counts for the next sync
+		r.mu.Lock()
+		for k, n := range pending {
+			r.pending[k] += n
+		}
+		r.mu.Unlock()
+		return err
+	}
+
+	var active []models.APIKey
+	if err := r.db.WithContext(ctx).Where("revoked_at IS NULL").Find(&active).Error; err != nil {
+		return err
+	}
+	keys := make(map[string]*models.APIKey, len(active))
+	for i := range active {
+		keys[active[i].Hash] = &active[i]
+	}
+
+	now := time.Now().UTC()
+	var totals []struct {
+		APIKeyID uint
+		Requests int64
+	}
+	err := r.db.WithContext(ctx).Model(&models.APIKeyUsage{}).
+		Select("api_key_id, SUM(requests) AS requests").
+		Where("day >= ?", now.Format("2006-01")+"-01").
+		Group("api_key_id").Scan(&totals).Error
+	if err != nil {
+		return err
+	}
+	monthly := make(map[uint]int64, len(totals))
+	for _, t := range totals {
+		monthly[t.APIKeyID] = t.Requests
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.month = now.Format("2006-01")
+	r.monthly = monthly
+	r.mu.Unlock()
+	return nil
+}
+
+// flush adds counted requests to the daily rollups
+func (r *Registry) flush(ctx context.Context, pending map[usageKey]int64) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	rows := make([]models.APIKeyUsage, 0, len(pending))
+	for k, n := range pending {
+		rows = append(rows, models.APIKeyUsage{APIKeyID: k.id, Day: k.day, Requests: n})
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "api_key_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]any{"requests": gorm.Expr("api_key_usages.requests + excluded.requests")}),
+	}).Create(&rows).Error
+}
+
+// Run syncs every interval until ctx is cancelled, and a last time after. Failures
+// are logged and retried on the next sync.
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	syncUsage := func(ctx context.Context) {
+		if err := r.Sync(ctx); err != nil {
+			logging.Error(ctx, "failed to sync API key usage", "error", err)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// Don't lose the last counts on shutdown
+			syncUsage(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			syncUsage(ctx)
+		}
+	}
+}
@@ -0,0 +1,757 @@
+// Package app assembles the API server from its configuration: it opens the database,
+// wires the stores, services and handlers, registers the routes and runs the
+// background jobs. cmd/api is a thin wrapper around it; tests and other binaries can
+// build the same application with New and serve Handler or call Start and Stop, or
+// Mount its routes on a router of their own.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/ristep/um_starter_jwt_go/internal/accounts"
+	"github.com/ristep/um_starter_jwt_go/internal/apikeys"
+	"github.com/ristep/um_starter_jwt_go/internal/audit"
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/bruteforce"
+	"github.com/ristep/um_starter_jwt_go/internal/buildinfo"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/consent"
+	"github.com/ristep/um_starter_jwt_go/internal/database"
+	"github.com/ristep/um_starter_jwt_go/internal/disposable"
+	"github.com/ristep/um_starter_jwt_go/internal/events"
+	"github.com/ristep/um_starter_jwt_go/internal/fieldcrypt"
+	"github.com/ristep/um_starter_jwt_go/internal/geoip"
+	"github.com/ristep/um_starter_jwt_go/internal/handlers"
+	"github.com/ristep/um_starter_jwt_go/internal/i18n"
+	"github.com/ristep/um_starter_jwt_go/internal/inactivity"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/loginrisk"
+	"github.com/ristep/um_starter_jwt_go/internal/mail"
+	"github.com/ristep/um_starter_jwt_go/internal/maintenance"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/notify"
+	"github.com/ristep/um_starter_jwt_go/internal/onetime"
+	"github.com/ristep/um_starter_jwt_go/internal/phone"
+	"github.com/ristep/um_starter_jwt_go/internal/push"
+	"github.com/ristep/um_starter_jwt_go/internal/queue"
+	"github.com/ristep/um_starter_jwt_go/internal/ratelimit"
+	"github.com/ristep/um_starter_jwt_go/internal/redact"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/retention"
+	"github.com/ristep/um_starter_jwt_go/internal/secrets"
+	"github.com/ristep/um_starter_jwt_go/internal/selfcheck"
+	"github.com/ristep/um_starter_jwt_go/internal/server"
+	"github.com/ristep/um_starter_jwt_go/internal/service"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+	"github.com/ristep/um_starter_jwt_go/internal/signedurl"
+	"github.com/ristep/um_starter_jwt_go/internal/sms"
+	"github.com/ristep/um_starter_jwt_go/internal/storage"
+	"github.com/ristep/um_starter_jwt_go/internal/usercache"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// App is the assembled API server
+type App struct {
+	Config *config.Config
+	Logger *slog.Logger
+	DB     *gorm.DB
+	// Redis is the shared Redis client, nil when REDIS_URL is not set
+	Redis *redis.Client
+
+	Users       repository.UserRepository
+	Roles       repository.RoleRepository
+	Tokens      repository.TokenRepository
+	Activity    repository.ActivityRepository
+	Notes       repository.NoteRepository
+	Devices     repository.DeviceRepository
+	AuthService *service.AuthService
+	UserService *service.UserService
+
+	logLevel       *slog.LevelVar
+	secretProvider secrets.Provider
+	tokenService   auth.TokenService
+	revocations    sessions.RevocationList
+	locator        *geoip.MaxMindLocator
+	auditExporter  *audit.Exporter
+	events         *events.Broker
+	notify         *notify.Hub
+	jobQueue       *queue.Queue
+	blocklist      *disposable.Blocklist
+	inactivity     *inactivity.Job
+	retention      *retention.Job
+	apiKeys        *apikeys.Registry
+	oneTime        *onetime.Service
+	watcher        *config.Watcher
+	health         *handlers.HealthHandler
+	components     *components
+	router         *gin.Engine
+	server         *server.Server
+
+	// Background loops run between Start and Stop; jobs waits for those that must
+	// finish their work before the process exits
+	stopWatching context.CancelFunc
+	stopJobs     context.CancelFunc
+	jobs         sync.WaitGroup
+}
+
+// Option customizes how New assembles the application
+type Option func(*App)
+
+// WithDB uses an existing database connection instead of opening one from the
+// configuration. The schema is still migrated and seeded.
+func WithDB(db *gorm.DB) Option {
+	return func(a *App) {
+		a.DB = db
+	}
+}
+
+// WithLogger logs to logger instead of a JSON logger on stdout. The default slog
+// logger and its level are left alone.
+func WithLogger(logger *slog.Logger) Option {
+	return func(a *App) {
+		a.Logger = logger
+	}
+}
+
+// New connects to the database and the other backing services, migrates and seeds
+// the schema, and assembles the handlers and routes. Nothing is served and no
+// background job runs until Start.
+func New(cfg *config.Config, opts ...Option) (_ *App, err error) {
+	a := &App{Config: cfg, logLevel: new(slog.LevelVar)}
+	for _, opt := range opts {
+		opt(a)
+	}
+	defer func() {
+		if err != nil {
+			a.close()
+		}
+	}()
+
+	// Initialize structured logging; the level can be changed at runtime
+	var redactor *redact.Redactor
+	if cfg.Log.Redact {
+		if redactor, err = redact.New(cfg.Log.RedactRules, cfg.Log.RedactPatterns); err != nil {
+			return nil, err
+		}
+	}
+	if a.Logger == nil {
+		a.logLevel.Set(cfg.Log.SlogLevel())
+		var handler slog.Handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: a.logLevel})
+		if redactor != nil {
+			// Standalone, the process' other log outputs are ours to redact too
+			handler = redact.NewHandler(handler, redactor)
+			redactOutputs(redactor)
+		}
+		a.Logger = slog.New(handler)
+		slog.SetDefault(a.Logger)
+	} else if redactor != nil {
+		a.Logger = slog.New(redact.NewHandler(a.Logger.Handler(), redactor))
+	}
+
+	// Resolve secrets from the configured secret store
+	a.secretProvider, err = secrets.NewProvider(cfg.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("initialize secrets provider: %w", err)
+	}
+	if err := secrets.Resolve(context.Background(), a.secretProvider, cfg); err != nil {
+		return nil, fmt.Errorf("resolve secrets: %w", err)
+	}
+	// Encrypted columns are read during migration and seeding, so keys come first
+	keyring, err := fieldcrypt.Load(context.Background(), cfg.Encryption, cfg.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("load encryption keys: %w", err)
+	}
+	fieldcrypt.Use(keyring)
+
+	if err := a.openDatabase(); err != nil {
+		return nil, err
+	}
+	// Find configuration mistakes now rather than at the first request
+	if err := a.checkStartup(context.Background()); err != nil {
+		return nil, err
+	}
+	if err := a.prepareDatabase(); err != nil {
+		return nil, err
+	}
+	db := a.DB
+
+	// Shared Redis, when configured
+	if cfg.Redis.URL != "" {
+		opts, err := redis.ParseURL(cfg.Redis.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		a.Redis = redis.NewClient(opts)
+	}
+
+	// Initialize the token service for the configured format. Opaque tokens are kept
+	// next to the sessions.
+	var opaqueStore auth.OpaqueStore = sessions.NewGormOpaqueStore(db)
+	if cfg.Session.Store == "redis" {
+		opaqueStore = sessions.NewRedisOpaqueStore(a.Redis)
+	}
+	a.tokenService, err = auth.NewTokenService(cfg.JWT, opaqueStore)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token configuration: %w", err)
+	}
+
+	// Cache authenticated users, dropping entries whenever a user is written
+	var userCache usercache.Cache
+	switch cfg.UserCache.Backend {
+	case "memory":
+		userCache = usercache.NewMemory(cfg.UserCache.Size, cfg.UserCache.TTL)
+	case "redis":
+		userCache = usercache.NewRedis(a.Redis, cfg.UserCache.TTL)
+	}
+	if userCache != nil {
+		if err := usercache.InvalidateOnWrite(db, userCache); err != nil {
+			return nil, fmt.Errorf("register user cache invalidation: %w", err)
+		}
+	}
+
+	// Initialize upload storage
+	fileStore, err := storage.NewStorage(cfg.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("initialize storage: %w", err)
+	}
+
+	// Initialize SMS delivery for phone verification
+	smsSender, err := sms.NewSender(cfg.SMS)
+	if err != nil {
+		return nil, fmt.Errorf("initialize SMS provider: %w", err)
+	}
+	if cfg.SMS.Provider == "log" && cfg.IsProduction() {
+		a.Logger.Warn("SMS_PROVIDER=log writes verification codes to the log; configure twilio in production")
+	}
+
+	// Initialize email delivery
+	mailer, err := mail.NewSender(cfg.Mail)
+	if err != nil {
+		return nil, fmt.Errorf("initialize mail provider: %w", err)
+	}
+	if cfg.Mail.Provider == "log" && cfg.IsProduction() {
+		a.Logger.Warn("MAIL_PROVIDER=log writes emails to the log; configure smtp in production")
+	}
+
+	// Initialize push notifications
+	pushProvider, err := push.NewSender(cfg.Push)
+	if err != nil {
+		return nil, fmt.Errorf("initialize push provider: %w", err)
+	}
+	if cfg.Push.Provider == "log" && cfg.IsProduction() {
+		a.Logger.Warn("PUSH_PROVIDER=log writes push notifications to the log; configure fcm or apns in production")
+	}
+
+	// Background jobs; emails go through the queue so slow mail servers don't hold up
+	// requests and failed deliveries are retried
+	a.jobQueue = queue.New(db, cfg.Queue)
+	if cfg.Queue.Enabled {
+		a.jobQueue.Handle(queue.KindEmail, queue.HandleEmail(mailer))
+		mailer = queue.NewMailSender(a.jobQueue)
+	}
+
+	// Emails requests trigger are capped per account and client IP, against floods
+	var throttleStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if a.Redis != nil {
+		throttleStore = ratelimit.NewFallbackStore(ratelimit.NewRedisStore(a.Redis))
+	}
+	mailThrottle := ratelimit.NewThrottle(throttleStore, "mail",
+		ratelimit.Limit{Count: cfg.Mail.ThrottlePerMinute, Window: time.Minute},
+		ratelimit.Limit{Count: cfg.Mail.ThrottlePerHour, Window: time.Hour})
+
+	// Links mailed to users, signed when LINK_SIGNING_KEY is set
+	links, err := signedurl.New([]byte(cfg.Links.SigningKey), cfg.Links.FrontendURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FRONTEND_URL: %w", err)
+	}
+
+	// Suspicious login detection compares where users log in from with their history
+	loginRisk := handlers.LoginRiskPolicy{
+		Confirm:    cfg.LoginRisk.Action == "confirm",
+		Mailer:     mailer,
+		Throttle:   mailThrottle,
+		ConfirmTTL: cfg.LoginRisk.ConfirmTTL,
+		ConfirmURL: cfg.LoginRisk.ConfirmURL,
+		Links:      links,
+	}
+	registrationMail := handlers.RegistrationMail{
+		Mailer:     mailer,
+		Throttle:   mailThrottle,
+		ConfirmTTL: cfg.Registration.ConfirmTTL,
+		ConfirmURL: cfg.Registration.ConfirmURL,
+		Links:      links,
+	}
+	if cfg.LoginRisk.Enabled() {
+		a.locator, err = geoip.Open(cfg.LoginRisk.GeoIPDB, cfg.LoginRisk.GeoIPASNDB)
+		if err != nil {
+			return nil, fmt.Errorf("open GeoIP database: %w", err)
+		}
+		loginRisk.Detector = loginrisk.NewDetector(db, a.locator, cfg.LoginRisk.MaxTravelSpeed)
+	}
+
+	// Region assumed for phone numbers entered without a country code
+	if err := phone.SetDefaultRegion(cfg.Phone.DefaultRegion); err != nil {
+		return nil, fmt.Errorf("invalid PHONE_DEFAULT_REGION: %w", err)
+	}
+
+	// Deployment-specific profile fields and the accepted age range
+	validation.SetAgeLimits(cfg.Profile.MinAge, cfg.Profile.MaxAge)
+	validation.SetAddressNormalization(cfg.Profile.NormalizeAddresses)
+	validation.SetGenderOptions(cfg.Profile.Genders)
+	profileFields, err := validation.ParseFieldSchema(cfg.Profile.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROFILE_FIELDS: %w", err)
+	}
+
+	// Disposable email domains, optionally kept up to date from a remote list
+	a.blocklist = disposable.NewBlocklist(cfg.Disposable.Allow)
+
+	// Accounts unused for too long are warned about and then suspended or deleted
+	if cfg.Inactivity.Enabled() {
+		a.inactivity = inactivity.NewJob(db, mailer, cfg.Inactivity)
+	}
+
+	// Activity, login history and deleted users are purged once they expire
+	if cfg.Retention.Enabled() {
+		a.retention = retention.NewJob(db, fileStore, cfg.Retention)
+	}
+
+	// Terms of service and privacy policy versions users must accept
+	consentPolicy := consent.NewPolicy(cfg.Consent)
+
+	// Refresh tokens are stored hashed, one per device session. Individually revoked
+	// access tokens are only seen by other instances through Redis.
+	var sessionStore sessions.Store = sessions.NewGormStore(db)
+	if cfg.Session.Store == "redis" {
+		sessionStore = sessions.NewRedisStore(a.Redis)
+	}
+	var revocations sessions.RevocationList = sessions.NewMemoryRevocations()
+	if a.Redis != nil {
+		revocations = sessions.NewRedisRevocations(a.Redis)
+	}
+	a.revocations = revocations
+	// Refreshes with a just-used token share its result, across instances through Redis
+	var graceStore sessions.GraceStore = sessions.NewMemoryGraceStore()
+	if a.Redis != nil {
+		graceStore = sessions.NewRedisGraceStore(a.Redis)
+	}
+	refreshGrace := sessions.NewGrace(graceStore, cfg.Session.RefreshGracePeriod)
+
+	// Sign-in routes slow down IPs that keep failing, across all accounts. Like the
+	// rate limits, the counts are shared through Redis and kept locally while it fails.
+	var ipTracker *bruteforce.Tracker
+	if cfg.BruteForce.Enabled {
+		var ipStore bruteforce.Store = bruteforce.NewMemoryStore()
+		if a.Redis != nil {
+			ipStore = bruteforce.NewFallbackStore(bruteforce.NewRedisStore(a.Redis))
+		}
+		ipTracker = bruteforce.NewTracker(ipStore, bruteforce.Policy{
+			FreeAttempts: cfg.BruteForce.FreeAttempts,
+			Window:       cfg.BruteForce.Window,
+			BaseDelay:    cfg.BruteForce.BaseDelay,
+			MaxDelay:     cfg.BruteForce.MaxDelay,
+			BanThreshold: cfg.BruteForce.BanThreshold,
+			BanDuration:  cfg.BruteForce.BanDuration,
+		})
+	}
+
+	// Request quotas per caller tier: anonymous IPs, users by role, API keys
+	policy, err := rateLimitPolicy(cfg.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if a.Redis != nil {
+		limitStore = ratelimit.NewFallbackStore(ratelimit.NewRedisStore(a.Redis))
+	}
+	limiter := ratelimit.NewLimiter(limitStore, policy)
+
+	// API keys managed through /api/apikeys, metered in daily rollups with optional
+	// monthly quotas
+	a.apiKeys = apikeys.NewRegistry(db)
+	if err := a.apiKeys.Sync(context.Background()); err != nil {
+		return nil, fmt.Errorf("load API keys: %w", err)
+	}
+
+	// Repositories the handlers and middleware reach the database through. New users,
+	// role changes and failed login bursts are published to the admin event stream;
+	// users are notified of new device logins, password changes and granted roles, and
+	// security alerts are pushed to their devices. Like emails, push notifications are
+	// sent through the queue when it is enabled.
+	a.Devices = repository.NewGormDeviceRepository(db)
+	pushSender := push.ForgetInvalidTokens(pushProvider, a.Devices)
+	if cfg.Queue.Enabled {
+		a.jobQueue.Handle(queue.KindPush, queue.HandlePush(pushSender))
+		pushSender = queue.NewPushSender(a.jobQueue)
+	}
+	a.events = events.NewBroker(a.Redis, cfg.Admin.EventsHistory)
+	a.notify = notify.NewHub(a.Redis)
+	notifiers := notify.Notifiers{a.notify, push.NewAlerter(a.Devices, pushSender)}
+	a.Users = notify.WrapUsers(events.WrapUsers(repository.NewGormUserRepository(db), a.events), notifiers)
+	a.Roles = notify.WrapRoles(repository.NewGormRoleRepository(db), notifiers)
+	a.Tokens = repository.NewGormTokenRepository(db)
+	// Expired one-time tokens are deleted in the background
+	a.oneTime = onetime.NewService(a.Tokens)
+	// Activity is also streamed to the SIEM when AUDIT_EXPORT is set
+	a.auditExporter, err = audit.New(cfg.Audit, a.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("start audit export: %w", err)
+	}
+	a.Activity = events.WrapActivity(audit.Wrap(repository.NewGormActivityRepository(db), a.auditExporter), a.events, events.BurstPolicy{
+		Failures: cfg.Admin.FailedLoginBurst,
+		Window:   cfg.Admin.FailedLoginBurstWindow,
+	})
+	a.Notes = repository.NewGormNoteRepository(db)
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("access the database pool: %w", err)
+	}
+
+	// Business rules shared by the handlers
+	registration := service.RegistrationPolicy{
+		AllowedDomains: cfg.Registration.AllowedDomains,
+		Disposable:     a.blocklist,
+		DisposableMode: cfg.Disposable.Mode,
+		Consent:        consentPolicy,
+	}
+	a.AuthService = service.NewAuthService(a.Users, a.Roles, a.Tokens, a.tokenService, sessionStore, a.Activity, registration, cfg.Session, cfg.Auth)
+	a.UserService = service.NewUserService(a.Users, a.Roles, a.Tokens, a.Activity, revocations, registration)
+
+	// Initialize handlers
+	a.health = handlers.NewHealthHandler(sqlDB)
+	if a.Redis != nil {
+		a.health.AddCheck("redis", func(ctx context.Context) error {
+			return a.Redis.Ping(ctx).Err()
+		})
+	}
+	maintenanceMode := maintenance.NewMode(cfg.Maintenance.Enabled, cfg.Maintenance.RetryAfter)
+	a.components = &components{
+		auth:        handlers.NewAuthHandler(a.AuthService, a.Users, a.Tokens, a.tokenService, profileFields, sessionStore, revocations, refreshGrace, cfg.Auth, loginRisk, registrationMail),
+		user:        handlers.NewUserHandler(a.UserService, a.Users, profileFields),
+		session:     handlers.NewSessionHandler(a.UserService, sessionStore, a.tokenService, revocations),
+		exchange:    handlers.NewExchangeHandler(a.Users, a.tokenService, revocations, cfg.Exchange),
+		avatar:      handlers.NewAvatarHandler(a.Users, fileStore, cfg.Avatar),
+		phone:       handlers.NewPhoneHandler(a.Users, a.Tokens, smsSender, cfg.SMS),
+		consent:     handlers.NewConsentHandler(a.Users, consentPolicy),
+		twoFactor:   handlers.NewTwoFactorHandler(a.Users, cfg.Auth),
+		maintenance: handlers.NewMaintenanceHandler(maintenanceMode),
+		jobs:        handlers.NewJobHandler(a.jobQueue),
+		apiKeys:     handlers.NewAPIKeyHandler(a.Users, a.apiKeys, limiter),
+		activity:    handlers.NewActivityHandler(a.Activity),
+		notes:       handlers.NewNoteHandler(a.Notes, a.Users),
+		tags:        handlers.NewTagHandler(a.Users, cfg.Admin.UserTags),
+		events:      handlers.NewEventHandler(a.events, cfg.Admin.EventsHeartbeat),
+		devices:     handlers.NewDeviceHandler(a.Devices),
+		email:       handlers.NewEmailHandler(a.UserService, mailer, mailThrottle, links, cfg.EmailChange, cfg.Auth.EnumerationProtection),
+		notify:      handlers.NewNotificationHandler(a.notify, a.Users, a.tokenService, revocations, cfg.Notify),
+
+		cors:            middleware.NewCORS(cfg.CORS),
+		maintenanceMode: maintenanceMode,
+		consentPolicy:   consentPolicy,
+		fileStore:       fileStore,
+		authenticate:    middleware.AuthMiddleware(a.tokenService, a.Users, userCache, cfg.Auth.ClaimsOnly(), revocations),
+		ipBackoff:       middleware.BruteForceMiddleware(ipTracker),
+		rateLimit:       middleware.RateLimitMiddleware(limiter),
+		apiKeyUsage:     middleware.APIKeyMiddleware(a.apiKeys),
+	}
+
+	// Hot-apply reloadable settings on SIGHUP or config file changes
+	a.watcher = config.NewWatcher(cfg, os.Getenv("CONFIG_FILE"), a.Logger, func(cfg *config.Config) error {
+		if err := secrets.Resolve(context.Background(), a.secretProvider, cfg); err != nil {
+			return fmt.Errorf("resolve secrets: %w", err)
+		}
+		return nil
+	})
+	maintenanceConfigured := cfg.Maintenance.Enabled
+	a.watcher.OnReload(func(cfg *config.Config) {
+		a.logLevel.Set(cfg.Log.SlogLevel())
+		a.components.cors.Update(cfg.CORS)
+		if policy, err := rateLimitPolicy(cfg.RateLimit); err != nil {
+			a.Logger.Error("rate limits not reloaded", "error", err)
+		} else {
+			limiter.Update(policy)
+		}
+		if ttl, ok := a.tokenService.(auth.TTLSetter); ok {
+			ttl.SetTTL(cfg.JWT.AccessTTL, cfg.JWT.RefreshTTL)
+		}
+		consentPolicy.Update(cfg.Consent)
+		// Only a changed flag overrides a toggle made through the admin endpoint
+		if cfg.Maintenance.Enabled != maintenanceConfigured {
+			maintenanceConfigured = cfg.Maintenance.Enabled
+			maintenanceMode.Set(cfg.Maintenance.Enabled, cfg.Maintenance.RetryAfter, "")
+		}
+	})
+
+	// Load extra message catalogs and pick the fallback language
+	if cfg.I18n.LocalesDir != "" {
+		if err := i18n.LoadDir(cfg.I18n.LocalesDir); err != nil {
+			return nil, fmt.Errorf("load message catalogs: %w", err)
+		}
+	}
+	if err := i18n.SetDefault(cfg.I18n.DefaultLanguage); err != nil {
+		return nil, fmt.Errorf("set default language: %w", err)
+	}
+
+	a.router, err = a.routes()
+	if err != nil {
+		return nil, err
+	}
+	a.server = server.New(cfg.Server, cfg.TLS, a.router, a.Logger)
+	return a, nil
+}
+
+// rateLimitPolicy builds the limiter policy from the rate limit configuration
+func rateLimitPolicy(cfg config.RateLimitConfig) (ratelimit.Policy, error) {
+	limits, err := cfg.TierLimits()
+	if err != nil {
+		return ratelimit.Policy{}, fmt.Errorf("invalid RATE_LIMIT_TIERS: %w", err)
+	}
+	apiKeyTiers, err := cfg.APIKeyTiers()
+	if err != nil {
+		return ratelimit.Policy{}, fmt.Errorf("invalid RATE_LIMIT_API_KEYS: %w", err)
+	}
+	return ratelimit.Policy{Enabled: cfg.Enabled, Window: cfg.Window, Limits: limits, APIKeys: apiKeyTiers}, nil
+}
+
+// redactOutputs masks sensitive data in the logs written outside slog: the standard
+// logger, Gin's debug and recovery output, and GORM's slow query and error log
+func redactOutputs(r *redact.Redactor) {
+	log.SetOutput(r.Writer(os.Stderr))
+	gin.DefaultWriter = r.Writer(os.Stdout)
+	gin.DefaultErrorWriter = r.Writer(os.Stderr)
+	gormlogger.Default = gormlogger.New(log.New(r.Writer(os.Stdout), "\r\n", log.LstdFlags), gormlogger.Config{
+		SlowThreshold: 200 * time.Millisecond,
+		LogLevel:      gormlogger.Warn,
+	})
+}
+
+// openDatabase connects to the database unless WithDB supplied one
+func (a *App) openDatabase() error {
+	if a.DB != nil {
+		return nil
+	}
+	db, err := database.Open(a.Config.Database, a.Logger)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	a.DB = db
+	return nil
+}
+
+// checkStartup runs the startup self-checks. Their findings stop the service when
+// STARTUP_CHECKS is strict, or auto in production, and are logged as warnings
+// otherwise.
+func (a *App) checkStartup(ctx context.Context) error {
+	if a.Config.Startup.Checks == selfcheck.ModeOff {
+		return nil
+	}
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		return fmt.Errorf("access the database pool: %w", err)
+	}
+	findings := selfcheck.Run(ctx, a.Config, sqlDB.PingContext)
+	if len(findings) == 0 {
+		return nil
+	}
+	if selfcheck.Strict(a.Config) {
+		errs := make([]error, len(findings))
+		for i, finding := range findings {
+			errs[i] = errors.New(finding.String())
+		}
+		return fmt.Errorf("startup checks failed (STARTUP_CHECKS=warn starts anyway):\n%w", errors.Join(errs...))
+	}
+	for _, finding := range findings {
+		a.Logger.Warn("startup check failed", "check", finding.Check, "problem", finding.Message)
+	}
+	return nil
+}
+
+// prepareDatabase migrates and seeds the database and creates the first admin of a
+// fresh deployment, holding the migration lock meanwhile
+func (a *App) prepareDatabase() error {
+	cfg := a.Config
+	db := a.DB
+
+	// Instances starting together take turns, so only the first one migrates and seeds
+	return database.WithMigrationLock(logging.With(context.Background(), a.Logger), db, func() error {
+		// Auto-migrate models
+		if err := database.Migrate(db); err != nil {
+			return fmt.Errorf("migrate database: %w", err)
+		}
+
+		a.Logger.Info("database migration completed")
+
+		// Create default roles if they don't exist
+		if err := database.Seed(db); err != nil {
+			return fmt.Errorf("create default roles: %w", err)
+		}
+
+		// Give a fresh deployment its first admin
+		if cfg.Admin.Email != "" {
+			admin, err := accounts.BootstrapAdmin(db, cfg.Admin.Email, cfg.Admin.Name, cfg.Admin.Password)
+			switch {
+			case errors.Is(err, accounts.ErrEmailTaken):
+				a.Logger.Warn("no admin exists and ADMIN_EMAIL belongs to an existing user; grant the role with umctl assign-role", "email", cfg.Admin.Email)
+			case err != nil:
+				return fmt.Errorf("create the initial admin from ADMIN_EMAIL/ADMIN_PASSWORD: %w", err)
+			case admin != nil:
+				a.Logger.Info("initial admin created", "email", admin.Email, "user_id", admin.ID)
+			}
+		}
+		return nil
+	})
+}
+
+// Handler returns the router, for serving the API without Start, e.g. with httptest
+func (a *App) Handler() http.Handler {
+	return a.router
+}
+
+// TokenService returns the service issuing and validating the API's tokens
+func (a *App) TokenService() auth.TokenService {
+	return a.tokenService
+}
+
+// Revocations returns the list of individually revoked access tokens
+func (a *App) Revocations() sessions.RevocationList {
+	return a.revocations
+}
+
+// Authenticate returns the middleware the protected routes authenticate requests with
+func (a *App) Authenticate() gin.HandlerFunc {
+	return a.components.authenticate
+}
+
+// Start runs the background jobs, watches the configuration for changes and starts
+// serving. It returns an error when the listeners cannot be bound; listeners that
+// fail later are reported on Err.
+func (a *App) Start() error {
+	build := buildinfo.Get()
+	a.Logger.Info("starting user management API", "version", build.Version, "commit", build.Commit, "build_date", build.BuildDate, "go_version", build.GoVersion)
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	a.stopWatching = stopWatching
+	go a.watcher.Run(watchCtx)
+
+	a.StartJobs()
+	if err := a.server.Start(); err != nil {
+		stopWatching()
+		a.StopJobs()
+		return err
+	}
+	return nil
+}
+
+// Err reports a listener that stopped serving after Start; the application should
+// then be stopped
+func (a *App) Err() <-chan error {
+	return a.server.Err()
+}
+
+// StartJobs runs the background jobs without serving, for applications that Mount
+// the routes on their own server
+func (a *App) StartJobs() {
+	cfg := a.Config
+	// Jobs log through the application's logger, which they find in their context
+	ctx, stopJobs := context.WithCancel(logging.With(context.Background(), a.Logger))
+	a.stopJobs = stopJobs
+
+	// Pick up rotated secrets from the secret store; only JWTs use JWT_SECRET
+	onJWTSecrets := func(string, string) {}
+	if jwtService, ok := a.tokenService.(*auth.JWTService); ok {
+		onJWTSecrets = jwtService.SetSecrets
+	}
+	go secrets.Refresh(ctx, a.secretProvider, cfg.Secrets.RefreshInterval, cfg, onJWTSecrets)
+
+	if cfg.Disposable.Mode != "off" && cfg.Disposable.ListURL != "" {
+		go a.blocklist.Refresh(ctx, cfg.Disposable.ListURL, cfg.Disposable.RefreshInterval)
+	}
+	if a.inactivity != nil {
+		go a.inactivity.Run(ctx)
+	}
+	if a.retention != nil {
+		go a.retention.Run(ctx)
+	}
+	go a.oneTime.Run(ctx, cfg.OneTime.CleanupInterval)
+	go a.events.Run(ctx)
+	go a.notify.Run(ctx)
+	if cfg.Queue.Enabled {
+		a.jobs.Add(1)
+		go func() {
+			defer a.jobs.Done()
+			a.jobQueue.Run(ctx)
+		}()
+	}
+	a.jobs.Add(1)
+	go func() {
+		defer a.jobs.Done()
+		a.apiKeys.Run(ctx, cfg.APIKeys.SyncInterval)
+	}()
+}
+
+// Stop shuts the application down gracefully: it reports unready, waits the drain
+// delay, lets in-flight requests and running jobs finish and closes the connections
+// to backing services. ctx bounds the whole shutdown.
+func (a *App) Stop(ctx context.Context) error {
+	// Report unready first so load balancers stop routing new traffic here
+	a.health.SetShuttingDown()
+	// Event streams and notification sockets never finish on their own
+	a.events.Close()
+	a.notify.Close()
+	if a.stopWatching != nil {
+		a.stopWatching()
+	}
+	select {
+	case <-time.After(a.Config.Server.ShutdownDrainDelay):
+	case <-ctx.Done():
+	}
+
+	err := a.server.Shutdown(ctx)
+	a.StopJobs()
+	return err
+}
+
+// StopJobs stops the background jobs started by StartJobs and closes the connections
+// to backing services
+func (a *App) StopJobs() {
+	// Let running jobs finish and write the last API key usage counts; queued jobs
+	// wait for the next start or another instance
+	if a.stopJobs != nil {
+		a.stopJobs()
+	}
+	a.jobs.Wait()
+
+	a.close()
+}
+
+// close releases the connections to backing services
+func (a *App) close() {
+	if a.locator != nil {
+		a.locator.Close()
+	}
+	if a.auditExporter != nil {
+		a.auditExporter.Close()
+	}
+	if a.events != nil {
+		a.events.Close()
+	}
+	if a.notify != nil {
+		a.notify.Close()
+	}
+	if a.Redis != nil {
+		a.Redis.Close()
+	}
+}
@@ -0,0 +1,105 @@
+package app
+
+import "github.com/ristep/um_starter_jwt_go/internal/authz"
+
+// Permissions of the restricted routes
+const (
+	// PermissionReadUsers lets admins look up accounts, their history and notes
+	PermissionReadUsers authz.Permission = "users:read"
+	// PermissionManageUsers lets admins change, suspend and delete accounts
+	PermissionManageUsers authz.Permission = "users:manage"
+	// PermissionManageAPIKeys lets admins issue and revoke API keys
+	PermissionManageAPIKeys authz.Permission = "apikeys:manage"
+	// PermissionOperate lets admins run the service: maintenance, jobs and events
+	PermissionOperate authz.Permission = "system:operate"
+)
+
+// rolePermissions are the permissions each role grants
+var rolePermissions = map[string][]authz.Permission{
+	"admin": {PermissionReadUsers, PermissionManageUsers, PermissionManageAPIKeys, PermissionOperate},
+}
+
+// routePermissions are the permissions the restricted routes require, relative to the
+// API group. Every /users and /admin route must be listed; routes not listed only
+// need an authenticated user. Together with publicRoutes and userRoutes it covers
+// every API route, which the route tests check.
+var routePermissions = []authz.Rule{
+	{Method: "GET", Path: "/users", Permission: PermissionReadUsers},
+	{Method: "GET", Path: "/users/:id", Permission: PermissionReadUsers},
+	{Method: "PUT", Path: "/users/:id", Permission: PermissionManageUsers},
+	{Method: "PATCH", Path: "/users/:id", Permission: PermissionManageUsers},
+	{Method: "DELETE", Path: "/users/:id", Permission: PermissionManageUsers},
+	{Method: "GET", Path: "/users/:id/metadata", Permission: PermissionReadUsers},
+	{Method: "PUT", Path: "/users/:id/metadata", Permission: PermissionManageUsers},
+	{Method: "POST", Path: "/users/:id/roles", Permission: PermissionManageUsers},
+	{Method: "DELETE", Path: "/users/:id/roles", Permission: PermissionManageUsers},
+	{Method: "PUT", Path: "/users/:id/suspension", Permission: PermissionManageUsers},
+	{Method: "DELETE", Path: "/users/:id/suspension", Permission: PermissionManageUsers},
+	{Method: "POST", Path: "/users/:id/revoke-tokens", Permission: PermissionManageUsers},
+	{Method: "GET", Path: "/users/:id/logins", Permission: PermissionReadUsers},
+	{Method: "GET", Path: "/users/:id/notes", Permission: PermissionReadUsers},
+	{Method: "POST", Path: "/users/:id/notes", Permission: PermissionManageUsers},
+	{Method: "DELETE", Path: "/users/:id/notes/:noteId", Permission: PermissionManageUsers},
+	{Method: "POST", Path: "/users/:id/tags", Permission: PermissionManageUsers},
+	{Method: "DELETE", Path: "/users/:id/tags/:tag", Permission: PermissionManageUsers},
+
+	{Method: "POST", Path: "/apikeys", Permission: PermissionManageAPIKeys},
+	{Method: "PUT", Path: "/apikeys/:id/quota", Permission: PermissionManageAPIKeys},
+	{Method: "DELETE", Path: "/apikeys/:id", Permission: PermissionManageAPIKeys},
+
+	{Method: "GET", Path: "/admin/maintenance", Permission: PermissionOperate},
+	{Method: "PUT", Path: "/admin/maintenance", Permission: PermissionOperate},
+	{Method: "GET", Path: "/admin/tags", Permission: PermissionReadUsers},
+	{Method: "GET", Path: "/admin/jobs", Permission: PermissionOperate},
+	{Method: "POST", Path: "/admin/jobs/:id/retry", Permission: PermissionOperate},
+	{Method: "DELETE", Path: "/admin/jobs/:id", Permission: PermissionOperate},
+	{Method: "GET", Path: "/admin/events", Permission: PermissionOperate},
+}
+
+// publicRoutes need no access token, relative to the API group
+var publicRoutes = []string{
+	"POST /auth/register",
+	"POST /auth/confirm-registration",
+	"POST /auth/login",
+	"POST /auth/refresh",
+	"POST /auth/logout",
+	"POST /auth/reauthenticate",
+	"POST /auth/confirm-login",
+	"POST /auth/confirm-email-change",
+	"POST /auth/revert-email-change",
+	"GET /auth/username-available",
+	"POST /auth/token-exchange",  // Authenticates the client with HTTP Basic
+	"GET /profile/notifications", // Authenticates itself on the WebSocket
+}
+
+// userRoutes need an authenticated user and no permission, relative to the API group;
+// they act on the caller's own account or scope what they return to the caller
+var userRoutes = []string{
+	"GET /profile",
+	"PUT /profile",
+	"PATCH /profile",
+	"DELETE /profile",
+	"POST /profile/password",
+	"PUT /profile/email",
+	"POST /profile/avatar",
+	"GET /profile/metadata",
+	"PUT /profile/metadata",
+	"POST /profile/phone/send-code",
+	"POST /profile/phone/verify",
+	"GET /profile/preferences",
+	"PUT /profile/preferences",
+	"GET /profile/consents",
+	"POST /profile/consents",
+	"GET /profile/activity",
+	"GET /profile/sessions",
+	"DELETE /profile/sessions",
+	"DELETE /profile/sessions/:id",
+	"GET /profile/devices",
+	"POST /profile/devices",
+	"DELETE /profile/devices/:id",
+	"POST /profile/2fa/setup",
+	"POST /profile/2fa/enable",
+	"DELETE /profile/2fa",
+	"GET /apikeys",
+	"GET /apikeys/:id/usage",
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+)
+
+// apiRoutes registers the API routes on a bare router and returns them as
+// "METHOD /path" relative to the API group
+func apiRoutes(t *testing.T) []string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	cfg.Exchange.Clients = []string{"client:secret"} // Registers the token exchange too
+	a := &App{Config: cfg, components: &components{}}
+
+	router := gin.New()
+	if err := a.mount(router.Group(apiBase)); err != nil {
+		t.Fatal(err)
+	}
+	var routes []string
+	for _, route := range router.Routes() {
+		routes = append(routes, route.Method+" "+strings.TrimPrefix(route.Path, apiBase))
+	}
+	return routes
+}
+
+func TestEveryRouteHasAnAccessRule(t *testing.T) {
+	tables := make(map[string][]string)
+	for _, rule := range routePermissions {
+		route := rule.Method + " " + rule.Path
+		tables[route] = append(tables[route], "routePermissions")
+	}
+	for _, route := range publicRoutes {
+		tables[route] = append(tables[route], "publicRoutes")
+	}
+	for _, route := range userRoutes {
+		tables[route] = append(tables[route], "userRoutes")
+	}
+
+	registered := make(map[string]bool)
+	for _, route := range apiRoutes(t) {
+		registered[route] = true
+		switch in := tables[route]; {
+		case len(in) == 0:
+			t.Errorf("%s is in none of routePermissions, publicRoutes and userRoutes", route)
+		case len(in) > 1:
+			t.Errorf("%s is in more than one table: %v", route, in)
+		}
+
+		_, path, _ := strings.Cut(route, " ")
+		restricted := strings.HasPrefix(path, "/users") || strings.HasPrefix(path, "/admin")
+		if restricted && !slices.Contains(tables[route], "routePermissions") {
+			t.Errorf("%s is restricted but has no permission rule", route)
+		}
+	}
+	for route := range tables {
+		if !registered[route] {
+			t.Errorf("%s is listed but not registered", route)
+		}
+	}
+}
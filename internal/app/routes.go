@@ -0,0 +1,306 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/adminui"
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/authz"
+	"github.com/ristep/um_starter_jwt_go/internal/consent"
+	"github.com/ristep/um_starter_jwt_go/internal/handlers"
+	"github.com/ristep/um_starter_jwt_go/internal/idempotency"
+	"github.com/ristep/um_starter_jwt_go/internal/maintenance"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/openapi"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/spa"
+	"github.com/ristep/um_starter_jwt_go/internal/storage"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// apiBase is the path the API routes are served under by the standalone router
+const apiBase = "/api"
+
+// components are the handlers and shared middleware state the routes are built from
+type components struct {
+	auth        *handlers.AuthHandler
+	user        *handlers.UserHandler
+	session     *handlers.SessionHandler
+	exchange    *handlers.ExchangeHandler
+	avatar      *handlers.AvatarHandler
+	phone       *handlers.PhoneHandler
+	consent     *handlers.ConsentHandler
+	twoFactor   *handlers.TwoFactorHandler
+	maintenance *handlers.MaintenanceHandler
+	jobs        *handlers.JobHandler
+	apiKeys     *handlers.APIKeyHandler
+	activity    *handlers.ActivityHandler
+	notes       *handlers.NoteHandler
+	tags        *handlers.TagHandler
+	events      *handlers.EventHandler
+	devices     *handlers.DeviceHandler
+	email       *handlers.EmailHandler
+	notify      *handlers.NotificationHandler
+
+	cors            *middleware.CORS
+	maintenanceMode *maintenance.Mode
+	consentPolicy   *consent.Policy
+	fileStore       storage.Storage
+	authenticate    gin.HandlerFunc
+	ipBackoff       gin.HandlerFunc
+	rateLimit       gin.HandlerFunc
+	apiKeyUsage     gin.HandlerFunc
+}
+
+// routes creates the router with the global middleware and every API route
+func (a *App) routes() (*gin.Engine, error) {
+	cfg := a.Config
+	c := a.components
+
+	validation.Setup()
+	router := gin.New()
+	// Only believe forwarded client IPs from our own proxies; gin trusts everyone by default
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	// Apply global middleware
+	router.Use(middleware.LoggerMiddleware(a.Logger))
+	router.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		problem.Abort(c, apperr.ErrInternal)
+	}))
+	router.HandleMethodNotAllowed = true
+	notFound := func(c *gin.Context) {
+		problem.Write(c, apperr.ErrRouteNotFound)
+	}
+	router.NoRoute(notFound)
+	router.NoMethod(func(c *gin.Context) {
+		problem.Write(c, apperr.ErrMethodNotAllowed)
+	})
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(middleware.VersionMiddleware())
+	router.Use(middleware.AccessLogMiddleware(a.Logger, cfg.AccessLog))
+	router.Use(middleware.LocaleMiddleware())
+	router.Use(c.cors.CORSMiddleware())
+	router.Use(middleware.MaintenanceMiddleware(c.maintenanceMode, a.tokenService, apiBase))
+	router.Use(middleware.BodyLimitMiddleware(cfg.BodyLimit, apiBase))
+	router.Use(middleware.RequestTimeoutMiddleware(cfg.Server.RequestTimeout))
+	router.Use(middleware.CompressionMiddleware(cfg.Compression))
+	router.Use(middleware.IdempotencyMiddleware(idempotency.NewGormStore(a.DB), cfg.Idempotency))
+
+	// Health check endpoints
+	router.GET("/healthz", a.health.LivenessHandler)
+	router.GET("/readyz", a.health.ReadinessHandler)
+	router.GET("/version", a.health.VersionHandler)
+
+	// Locally stored uploads are served by the API itself
+	if local, ok := c.fileStore.(*storage.LocalStorage); ok && strings.HasPrefix(local.BaseURL, "/") {
+		router.Static(local.BaseURL, local.Dir)
+	}
+
+	// API documentation
+	if cfg.Docs.Enabled {
+		router.GET("/api/docs", openapi.UIHandler("User Management API", "/api/docs/openapi.json"))
+		router.GET("/api/docs/openapi.json", openapi.DocumentHandler(handlers.APISpec(), router))
+	}
+
+	// Admin web UI; the admin routes it calls enforce the route permissions
+	if cfg.Admin.UIEnabled {
+		adminPrefixes, err := cfg.Admin.AllowedPrefixes()
+		if err != nil {
+			return nil, fmt.Errorf("invalid ADMIN_ALLOWED_IPS: %w", err)
+		}
+		ui := router.Group("/admin", middleware.IPAllowlistMiddleware(adminPrefixes))
+		ui.GET("", adminui.Handler("/admin"))
+		ui.GET("/*path", adminui.Handler("/admin"))
+	}
+
+	// A frontend build takes every path no route claims
+	if cfg.Static.Dir != "" {
+		frontend, err := spa.New(cfg.Static, notFound)
+		if err != nil {
+			return nil, err
+		}
+		router.NoRoute(frontend.Handler)
+	}
+
+	if err := a.mount(router.Group(apiBase)); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// Mount registers the API routes on a group of another router, for applications
+// that embed the API in their own server. The group gets the logger, request ID,
+// locale, maintenance, body limit, request timeout and idempotency middleware the
+// standalone router applies globally; recovery, access logging, CORS and compression
+// are left to the host router.
+func (a *App) Mount(group *gin.RouterGroup) error {
+	cfg := a.Config
+	base := group.BasePath()
+	group.Use(middleware.LoggerMiddleware(a.Logger))
+	group.Use(middleware.RequestIDMiddleware())
+	group.Use(middleware.LocaleMiddleware())
+	group.Use(middleware.MaintenanceMiddleware(a.components.maintenanceMode, a.tokenService, base))
+	group.Use(middleware.BodyLimitMiddleware(cfg.BodyLimit, base))
+	group.Use(middleware.RequestTimeoutMiddleware(cfg.Server.RequestTimeout))
+	group.Use(middleware.IdempotencyMiddleware(idempotency.NewGormStore(a.DB), cfg.Idempotency))
+	return a.mount(group)
+}
+
+// mount registers the public and protected API routes on a group
+func (a *App) mount(group *gin.RouterGroup) error {
+	cfg := a.Config
+	c := a.components
+
+	// Public routes
+	api := group.Group("")
+	api.Use(c.apiKeyUsage, c.rateLimit)
+	{
+		// Authentication routes (public)
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", c.auth.RegisterHandler)
+			auth.POST("/confirm-registration", c.auth.ConfirmRegistrationHandler)
+			auth.POST("/login", c.ipBackoff, c.auth.LoginHandler)
+			auth.POST("/refresh", c.auth.RefreshHandler)
+			auth.POST("/logout", c.auth.LogoutHandler)
+			auth.POST("/reauthenticate", c.ipBackoff, c.auth.ReauthenticateHandler)
+			auth.POST("/confirm-login", c.auth.ConfirmLoginHandler)
+			auth.POST("/confirm-email-change", c.email.ConfirmEmailChangeHandler)
+			auth.POST("/revert-email-change", c.email.RevertEmailChangeHandler)
+			auth.GET("/username-available", c.auth.UsernameAvailableHandler)
+			if cfg.Exchange.Enabled() {
+				auth.POST("/token-exchange", c.ipBackoff, c.exchange.TokenExchangeHandler)
+			}
+		}
+
+		// Browsers can't send the Authorization header on a WebSocket, so the
+		// notification socket authenticates itself
+		api.GET("/profile/notifications", c.notify.NotificationsHandler)
+	}
+
+	// Admin routes can be limited to trusted networks
+	adminPrefixes, err := cfg.Admin.AllowedPrefixes()
+	if err != nil {
+		return fmt.Errorf("invalid ADMIN_ALLOWED_IPS: %w", err)
+	}
+	adminAllowlist := middleware.IPAllowlistMiddleware(adminPrefixes)
+
+	// Protected routes (requires authentication); the exemptions below name routes
+	// relative to the group
+	base := strings.TrimSuffix(group.BasePath(), "/")
+	route := func(method, path string) string {
+		return method + " " + base + path
+	}
+	// Who may call which route is declared in routePermissions
+	policy, err := authz.NewPolicy(base, routePermissions, rolePermissions)
+	if err != nil {
+		return err
+	}
+	protectedAPI := group.Group("")
+	protectedAPI.Use(c.apiKeyUsage)
+	protectedAPI.Use(c.authenticate)
+	protectedAPI.Use(c.rateLimit)
+	protectedAPI.Use(policy.Middleware())
+	protectedAPI.Use(middleware.UserLocaleMiddleware())
+	protectedAPI.Use(middleware.TwoFactorSetupMiddleware(
+		route("GET", "/profile"), route("POST", "/profile/2fa/setup"), route("POST", "/profile/2fa/enable")))
+	protectedAPI.Use(middleware.PasswordExpiryMiddleware(cfg.Auth.PasswordMaxAge, cfg.Auth.PasswordExpiryWarning,
+		route("GET", "/profile"), route("POST", "/profile/password")))
+	protectedAPI.Use(middleware.ConsentMiddleware(c.consentPolicy,
+		route("GET", "/profile"), route("GET", "/profile/consents"), route("POST", "/profile/consents"),
+		route("POST", "/profile/2fa/setup"), route("POST", "/profile/2fa/enable"), route("POST", "/profile/password")))
+	if len(cfg.Auth.VerifiedEmailRoutes) > 0 {
+		protectedAPI.Use(middleware.RequireVerifiedEmail(cfg.Auth.VerifiedEmailRoutes...))
+	}
+	{
+		// Changing emails or roles, deleting accounts and turning off two-factor
+		// authentication need a recently entered password
+		recentAuth := middleware.RequireRecentAuth(cfg.Auth.StepUpMaxAge)
+
+		// User profile routes
+		profile := protectedAPI.Group("/profile")
+		profile.Use(middleware.LoadUser())
+		{
+			profile.GET("", c.auth.ProfileHandler)
+			profile.PUT("", c.user.UpdateProfileHandler)
+			profile.PATCH("", c.user.PatchProfileHandler)
+			profile.DELETE("", recentAuth, c.user.DeleteProfileHandler)
+			profile.POST("/password", c.ipBackoff, c.auth.ChangePasswordHandler)
+			profile.PUT("/email", recentAuth, c.email.ChangeEmailHandler)
+			profile.POST("/avatar", c.avatar.UploadAvatarHandler)
+			profile.GET("/metadata", c.user.GetProfileMetadataHandler)
+			profile.PUT("/metadata", c.user.PutProfileMetadataHandler)
+			profile.POST("/phone/send-code", c.phone.SendPhoneCodeHandler)
+			profile.POST("/phone/verify", c.phone.VerifyPhoneHandler)
+			profile.GET("/preferences", c.user.GetPreferencesHandler)
+			profile.PUT("/preferences", c.user.PutPreferencesHandler)
+			profile.GET("/consents", c.consent.GetConsentsHandler)
+			profile.POST("/consents", c.consent.AcceptConsentHandler)
+			profile.GET("/activity", c.activity.ListActivityHandler)
+			profile.GET("/sessions", c.session.ListSessionsHandler)
+			profile.DELETE("/sessions", c.session.RevokeAllSessionsHandler)
+			profile.DELETE("/sessions/:id", c.session.RevokeSessionHandler)
+			profile.GET("/devices", c.devices.ListDevicesHandler)
+			profile.POST("/devices", c.devices.RegisterDeviceHandler)
+			profile.DELETE("/devices/:id", c.devices.DeleteDeviceHandler)
+			profile.POST("/2fa/setup", c.twoFactor.SetupTwoFactorHandler)
+			profile.POST("/2fa/enable", c.twoFactor.EnableTwoFactorHandler)
+			profile.DELETE("/2fa", recentAuth, c.twoFactor.DisableTwoFactorHandler)
+		}
+
+		// User management routes (admin only)
+		users := protectedAPI.Group("/users")
+		users.Use(adminAllowlist, policy.Restricted())
+		{
+			users.GET("", c.user.GetAllUsersHandler)
+			users.GET("/:id", c.user.GetUserByIDHandler)
+			users.PUT("/:id", recentAuth, c.user.UpdateUserHandler)
+			users.PATCH("/:id", recentAuth, c.user.PatchUserHandler)
+			users.DELETE("/:id", recentAuth, c.user.DeleteUserHandler)
+			users.GET("/:id/metadata", c.user.GetUserMetadataHandler)
+			users.PUT("/:id/metadata", c.user.PutUserMetadataHandler)
+			users.POST("/:id/roles", recentAuth, c.user.AssignRoleHandler)
+			users.DELETE("/:id/roles", recentAuth, c.user.RemoveRoleHandler)
+			users.PUT("/:id/suspension", recentAuth, c.user.SuspendUserHandler)
+			users.DELETE("/:id/suspension", c.user.UnsuspendUserHandler)
+			users.POST("/:id/revoke-tokens", c.session.RevokeUserTokensHandler)
+			users.GET("/:id/logins", c.user.GetUserLoginsHandler)
+			users.GET("/:id/notes", c.notes.ListNotesHandler)
+			users.POST("/:id/notes", c.notes.CreateNoteHandler)
+			users.DELETE("/:id/notes/:noteId", c.notes.DeleteNoteHandler)
+			users.POST("/:id/tags", c.tags.AddTagHandler)
+			users.DELETE("/:id/tags/:tag", c.tags.RemoveTagHandler)
+		}
+
+		// API keys; owners see their keys and usage, admins manage all keys
+		keys := protectedAPI.Group("/apikeys")
+		keys.Use(middleware.LoadUser())
+		{
+			keys.GET("", c.apiKeys.ListAPIKeysHandler)
+			keys.GET("/:id/usage", c.apiKeys.APIKeyUsageHandler)
+			keys.POST("", adminAllowlist, c.apiKeys.CreateAPIKeyHandler)
+			keys.PUT("/:id/quota", adminAllowlist, c.apiKeys.SetAPIKeyQuotaHandler)
+			keys.DELETE("/:id", adminAllowlist, c.apiKeys.RevokeAPIKeyHandler)
+		}
+
+		// Operational routes (admin only)
+		admin := protectedAPI.Group("/admin")
+		admin.Use(adminAllowlist, policy.Restricted())
+		{
+			admin.GET("/maintenance", c.maintenance.GetMaintenanceHandler)
+			admin.PUT("/maintenance", c.maintenance.SetMaintenanceHandler)
+			admin.GET("/tags", c.tags.ListTagsHandler)
+			admin.GET("/jobs", c.jobs.ListJobsHandler)
+			admin.POST("/jobs/:id/retry", c.jobs.RetryJobHandler)
+			admin.DELETE("/jobs/:id", c.jobs.DiscardJobHandler)
+			admin.GET("/events", c.events.StreamEventsHandler)
+		}
+	}
+
+	return nil
+}
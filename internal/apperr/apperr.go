@@ -0,0 +1,90 @@
+// Package apperr defines the catalog of API errors. Every error carries a stable,
+// machine-readable code that clients can branch on; codes must never be renamed.
+package apperr
+
+import "sort"
+
+// Error is a catalogued API error
+type Error struct {
+	Code   string       // Stable machine-readable identifier
+	Status int          // HTTP status code
+	Title  string       // Default human-readable summary
+	Detail string       // Optional occurrence-specific explanation
+	Fields []FieldError // Optional per-field validation failures
+	Err    error        // Optional underlying cause, never exposed to clients
+}
+
+// FieldError describes why a single request field failed validation
+type FieldError struct {
+	Field   string `json:"field"`           // JSON name of the field
+	Rule    string `json:"rule"`            // Validation rule that failed (e.g. required, email, min)
+	Param   string `json:"param,omitempty"` // Rule parameter, e.g. 8 for min=8
+	Message string `json:"message"`         // Human-readable explanation
+}
+
+var catalog = make(map[string]*Error)
+
+// New registers a catalog entry; codes must be unique
+func New(code string, status int, title string) *Error {
+	if _, exists := catalog[code]; exists {
+		panic("apperr: duplicate error code " + code)
+	}
+	e := &Error{Code: code, Status: status, Title: title}
+	catalog[code] = e
+	return e
+}
+
+// Error returns the code and title (and detail when set)
+func (e *Error) Error() string {
+	msg := e.Code + ": " + e.Title
+	if e.Detail != "" {
+		msg += " (" + e.Detail + ")"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any error with the same code, so errors.Is(err, apperr.ErrUserNotFound)
+// holds for copies created by WithDetail or Wrap
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetail returns a copy of the error carrying an occurrence-specific detail
+func (e *Error) WithDetail(detail string) *Error {
+	cp := *e
+	cp.Detail = detail
+	return &cp
+}
+
+// WithFields returns a copy of the error carrying per-field validation failures
+func (e *Error) WithFields(fields []FieldError) *Error {
+	cp := *e
+	cp.Fields = fields
+	return &cp
+}
+
+// Wrap returns a copy of the error recording the underlying cause
+func (e *Error) Wrap(err error) *Error {
+	cp := *e
+	cp.Err = err
+	return &cp
+}
+
+// Catalog returns all registered errors ordered by code
+func Catalog() []*Error {
+	list := make([]*Error, 0, len(catalog))
+	for _, e := range catalog {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
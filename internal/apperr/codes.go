@@ -0,0 +1,148 @@
+package apperr
+
+import "net/http"
+
+// Generic errors
+var (
+	ErrInvalidInput         = New("invalid_input", http.StatusBadRequest, "Invalid input")
+	ErrValidation           = New("validation_failed", http.StatusBadRequest, "Validation failed")
+	ErrRouteNotFound        = New("route_not_found", http.StatusNotFound, "Route not found")
+	ErrMethodNotAllowed     = New("method_not_allowed", http.StatusMethodNotAllowed, "Method not allowed")
+	ErrRequestTooLarge      = New("request_too_large", http.StatusRequestEntityTooLarge, "Request body too large")
+	ErrUnsupportedMediaType = New("unsupported_media_type", http.StatusUnsupportedMediaType, "Unsupported content type")
+	ErrInternal             = New("internal_error", http.StatusInternalServerError, "Internal server error")
+	ErrDatabase             = New("database_error", http.StatusInternalServerError, "Database error")
+	ErrDatabaseUnavailable  = New("database_unavailable", http.StatusServiceUnavailable, "Database is temporarily unavailable")
+	ErrRequestTimeout       = New("request_timeout", http.StatusServiceUnavailable, "Request took too long")
+	ErrMaintenance          = New("maintenance", http.StatusServiceUnavailable, "Service is under maintenance")
+	ErrPreconditionFailed   = New("precondition_failed", http.StatusPreconditionFailed, "Resource was modified since it was last fetched")
+)
+
+// Authentication errors
+var (
+	ErrMissingToken              = New("missing_token", http.StatusUnauthorized, "Missing authorization header")
+	ErrMalformedToken            = New("malformed_authorization_header", http.StatusUnauthorized, "Invalid authorization header format")
+	ErrTokenExpired              = New("token_expired", http.StatusUnauthorized, "Token has expired")
+	ErrTokenInvalid              = New("token_invalid", http.StatusUnauthorized, "Invalid token")
+	ErrTokenRevoked              = New("token_revoked", http.StatusUnauthorized, "Token has been revoked")
+	ErrInvalidRefreshToken       = New("invalid_refresh_token", http.StatusUnauthorized, "Invalid refresh token")
+	ErrTokenUserNotFound         = New("token_user_not_found", http.StatusUnauthorized, "User not found")
+	ErrUnauthorized              = New("unauthorized", http.StatusUnauthorized, "Unauthorized")
+	ErrInvalidCredentials        = New("invalid_credentials", http.StatusUnauthorized, "Invalid email or password")
+	ErrAccountNotFound           = New("account_not_found", http.StatusUnauthorized, "No account with this email or username")
+	ErrTooManyFailedAttempts     = New("too_many_failed_attempts", http.StatusTooManyRequests, "Too many failed sign-ins from your network, try again later")
+	ErrRateLimited               = New("rate_limited", http.StatusTooManyRequests, "Too many requests, try again later")
+	ErrIPNotAllowed              = New("ip_not_allowed", http.StatusForbidden, "Access is not allowed from this network")
+	ErrInsufficientPermissions   = New("insufficient_permissions", http.StatusForbidden, "Insufficient permissions")
+	ErrAccountSuspended          = New("account_suspended", http.StatusForbidden, "Account is suspended")
+	ErrLoginConfirmationRequired = New("login_confirmation_required", http.StatusForbidden, "Unusual sign-in, confirm it with the link sent to your email and sign in again")
+	ErrInvalidLoginConfirmation  = New("invalid_login_confirmation", http.StatusBadRequest, "Invalid or expired sign-in confirmation")
+	ErrInvalidEmailRevert        = New("invalid_email_revert", http.StatusBadRequest, "Invalid or expired email change revert link")
+	ErrInvalidEmailChange        = New("invalid_email_change", http.StatusBadRequest, "Invalid or expired email change confirmation link")
+	ErrInvalidRegistration       = New("invalid_registration", http.StatusBadRequest, "Invalid or expired registration confirmation link")
+	ErrMailDelivery              = New("mail_delivery_failed", http.StatusBadGateway, "Failed to send email")
+	ErrTooManyEmails             = New("too_many_emails", http.StatusTooManyRequests, "Too many emails were sent recently, try again later")
+	ErrTokenGeneration           = New("token_generation_failed", http.StatusInternalServerError, "Failed to generate tokens")
+	ErrSessionNotFound           = New("session_not_found", http.StatusNotFound, "Session not found")
+	ErrReauthenticationRequired  = New("reauthentication_required", http.StatusUnauthorized, "Confirm your password to continue")
+	ErrPasswordExpired           = New("password_expired", http.StatusForbidden, "Your password has expired, change it to continue")
+)
+
+// Token exchange errors, named after the OAuth 2.0 error codes
+var (
+	ErrInvalidClient        = New("invalid_client", http.StatusUnauthorized, "Client authentication failed")
+	ErrUnsupportedGrantType = New("unsupported_grant_type", http.StatusBadRequest, "Unsupported grant type")
+	ErrInvalidGrant         = New("invalid_grant", http.StatusBadRequest, "Subject token is invalid, expired or revoked")
+	ErrInvalidTarget        = New("invalid_target", http.StatusBadRequest, "Tokens cannot be issued for this audience")
+	ErrInvalidScope         = New("invalid_scope", http.StatusBadRequest, "Requested scope exceeds the subject token")
+)
+
+// User errors
+var (
+	ErrEmailTaken            = New("email_taken", http.StatusBadRequest, "User already exists")
+	ErrEmailNotVerified      = New("email_not_verified", http.StatusForbidden, "Email address is not verified")
+	ErrEmailDomainNotAllowed = New("email_domain_not_allowed", http.StatusForbidden, "Registration is not open to this email domain")
+	ErrDisposableEmail       = New("disposable_email", http.StatusBadRequest, "Disposable email addresses are not allowed")
+	ErrUsernameTaken         = New("username_taken", http.StatusBadRequest, "Username is already taken")
+	ErrPasswordUnchanged     = New("password_unchanged", http.StatusBadRequest, "The new password must differ from the current one")
+	ErrEmailUnchanged        = New("email_unchanged", http.StatusBadRequest, "The new email must differ from the current one")
+	ErrUserNotFound          = New("user_not_found", http.StatusNotFound, "User not found")
+	ErrRoleAlreadyAssigned   = New("role_already_assigned", http.StatusBadRequest, "User already has this role")
+	ErrRoleNotAssigned       = New("role_not_assigned", http.StatusBadRequest, "User doesn't have this role")
+	ErrVersionConflict       = New("version_conflict", http.StatusConflict, "User was modified by another request")
+	ErrCannotSuspendSelf     = New("cannot_suspend_self", http.StatusBadRequest, "You cannot suspend your own account")
+	ErrInvalidImage          = New("invalid_image", http.StatusBadRequest, "File is not a supported image")
+	ErrImageTooLarge         = New("image_too_large", http.StatusBadRequest, "Image dimensions are too large")
+	ErrAvatarStorage         = New("avatar_storage_failed", http.StatusInternalServerError, "Failed to store avatar")
+)
+
+// Consent errors
+var (
+	ErrConsentRequired        = New("consent_required", http.StatusForbidden, "The current terms must be accepted first")
+	ErrConsentVersionOutdated = New("consent_version_outdated", http.StatusConflict, "This is not the current version of the document")
+)
+
+// Phone verification errors
+var (
+	ErrPhoneMissing         = New("phone_missing", http.StatusBadRequest, "No phone number on the profile")
+	ErrInvalidPhone         = New("invalid_phone", http.StatusBadRequest, "Phone number must be in international format, e.g. +38970123456")
+	ErrPhoneAlreadyVerified = New("phone_already_verified", http.StatusBadRequest, "Phone number is already verified")
+	ErrPhoneNotVerified     = New("phone_not_verified", http.StatusForbidden, "Phone number is not verified")
+	ErrOTPResendTooSoon     = New("otp_resend_too_soon", http.StatusTooManyRequests, "A code was sent recently, try again later")
+	ErrOTPInvalid           = New("invalid_otp", http.StatusBadRequest, "Invalid or expired verification code")
+	ErrOTPTooManyAttempts   = New("otp_too_many_attempts", http.StatusTooManyRequests, "Too many wrong codes, request a new one")
+	ErrSMSDelivery          = New("sms_delivery_failed", http.StatusBadGateway, "Failed to send text message")
+)
+
+// Two-factor authentication errors
+var (
+	ErrTwoFactorRequired           = New("two_factor_required", http.StatusForbidden, "Enter the code from your authenticator app")
+	ErrInvalidTwoFactorCode        = New("invalid_two_factor_code", http.StatusUnauthorized, "Invalid authenticator code")
+	ErrTwoFactorEnrollmentRequired = New("two_factor_enrollment_required", http.StatusForbidden, "Set up two-factor authentication to continue")
+	ErrTwoFactorAlreadyEnabled     = New("two_factor_already_enabled", http.StatusBadRequest, "Two-factor authentication is already enabled")
+	ErrTwoFactorNotSetUp           = New("two_factor_not_set_up", http.StatusBadRequest, "Start the two-factor authentication setup first")
+	ErrTwoFactorNotEnabled         = New("two_factor_not_enabled", http.StatusBadRequest, "Two-factor authentication is not enabled")
+	ErrTwoFactorMandatory          = New("two_factor_mandatory", http.StatusForbidden, "Your role requires two-factor authentication")
+)
+
+// Idempotency errors
+var (
+	ErrIdempotencyKeyTooLong = New("idempotency_key_too_long", http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+	ErrIdempotencyInProgress = New("idempotency_in_progress", http.StatusConflict, "A request with this Idempotency-Key is already in progress")
+	ErrIdempotencyKeyReused  = New("idempotency_key_reused", http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+)
+
+// Job queue errors
+var (
+	ErrJobNotFound  = New("job_not_found", http.StatusNotFound, "Job not found")
+	ErrJobNotFailed = New("job_not_failed", http.StatusConflict, "Only failed jobs can be retried or discarded")
+)
+
+// API key errors
+var (
+	ErrAPIKeyNotFound      = New("api_key_not_found", http.StatusNotFound, "API key not found")
+	ErrAPIKeyQuotaExceeded = New("api_key_quota_exceeded", http.StatusTooManyRequests, "The monthly request quota of this API key is used up")
+	ErrUnknownTier         = New("unknown_tier", http.StatusBadRequest, "Unknown rate limit tier")
+)
+
+// Admin note errors
+var (
+	ErrNoteNotFound = New("note_not_found", http.StatusNotFound, "Note not found")
+)
+
+// Push device errors
+var (
+	ErrDeviceNotFound = New("device_not_found", http.StatusNotFound, "Device not found")
+)
+
+// User tag errors
+var (
+	ErrInvalidTag    = New("invalid_tag", http.StatusBadRequest, "Tags are 1-32 lowercase letters, digits, hyphens or underscores")
+	ErrTagNotAllowed = New("tag_not_allowed", http.StatusBadRequest, "Tag is not one of the configured user tags")
+	ErrTooManyTags   = New("too_many_tags", http.StatusBadRequest, "A user can carry at most 20 tags")
+)
+
+// Filter errors
+var (
+	ErrInvalidFilter = New("invalid_filter", http.StatusBadRequest, "Invalid filter expression")
+)
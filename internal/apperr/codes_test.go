@@ -0,0 +1,127 @@
+package apperr_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+)
+
+// catalogStatuses pins every error code to its HTTP status. Clients branch on both,
+// so a code must never be renamed and its status only changed deliberately.
+var catalogStatuses = []struct {
+	code   string
+	status int
+}{
+	{"account_not_found", http.StatusUnauthorized},
+	{"account_suspended", http.StatusForbidden},
+	{"api_key_not_found", http.StatusNotFound},
+	{"api_key_quota_exceeded", http.StatusTooManyRequests},
+	{"avatar_storage_failed", http.StatusInternalServerError},
+	{"cannot_suspend_self", http.StatusBadRequest},
+	{"consent_required", http.StatusForbidden},
+	{"consent_version_outdated", http.StatusConflict},
+	{"database_error", http.StatusInternalServerError},
+	{"database_unavailable", http.StatusServiceUnavailable},
+	{"device_not_found", http.StatusNotFound},
+	{"disposable_email", http.StatusBadRequest},
+	{"email_domain_not_allowed", http.StatusForbidden},
+	{"email_not_verified", http.StatusForbidden},
+	{"email_taken", http.StatusBadRequest},
+	{"email_unchanged", http.StatusBadRequest},
+	{"idempotency_in_progress", http.StatusConflict},
+	{"idempotency_key_reused", http.StatusUnprocessableEntity},
+	{"idempotency_key_too_long", http.StatusBadRequest},
+	{"image_too_large", http.StatusBadRequest},
+	{"insufficient_permissions", http.StatusForbidden},
+	{"internal_error", http.StatusInternalServerError},
+	{"invalid_client", http.StatusUnauthorized},
+	{"invalid_credentials", http.StatusUnauthorized},
+	{"invalid_email_change", http.StatusBadRequest},
+	{"invalid_email_revert", http.StatusBadRequest},
+	{"invalid_filter", http.StatusBadRequest},
+	{"invalid_grant", http.StatusBadRequest},
+	{"invalid_image", http.StatusBadRequest},
+	{"invalid_input", http.StatusBadRequest},
+	{"invalid_login_confirmation", http.StatusBadRequest},
+	{"invalid_otp", http.StatusBadRequest},
+	{"invalid_phone", http.StatusBadRequest},
+	{"invalid_refresh_token", http.StatusUnauthorized},
+	{"invalid_registration", http.StatusBadRequest},
+	{"invalid_scope", http.StatusBadRequest},
+	{"invalid_tag", http.StatusBadRequest},
+	{"invalid_target", http.StatusBadRequest},
+	{"invalid_two_factor_code", http.StatusUnauthorized},
+	{"ip_not_allowed", http.StatusForbidden},
+	{"job_not_failed", http.StatusConflict},
+	{"job_not_found", http.StatusNotFound},
+	{"login_confirmation_required", http.StatusForbidden},
+	{"mail_delivery_failed", http.StatusBadGateway},
+	{"maintenance", http.StatusServiceUnavailable},
+	{"malformed_authorization_header", http.StatusUnauthorized},
+	{"method_not_allowed", http.StatusMethodNotAllowed},
+	{"missing_token", http.StatusUnauthorized},
+	{"note_not_found", http.StatusNotFound},
+	{"otp_resend_too_soon", http.StatusTooManyRequests},
+	{"otp_too_many_attempts", http.StatusTooManyRequests},
+	{"password_expired", http.StatusForbidden},
+	{"password_unchanged", http.StatusBadRequest},
+	{"phone_already_verified", http.StatusBadRequest},
+	{"phone_missing", http.StatusBadRequest},
+	{"phone_not_verified", http.StatusForbidden},
+	{"precondition_failed", http.StatusPreconditionFailed},
+	{"rate_limited", http.StatusTooManyRequests},
+	{"reauthentication_required", http.StatusUnauthorized},
+	{"request_timeout", http.StatusServiceUnavailable},
+	{"request_too_large", http.StatusRequestEntityTooLarge},
+	{"role_already_assigned", http.StatusBadRequest},
+	{"role_not_assigned", http.StatusBadRequest},
+	{"route_not_found", http.StatusNotFound},
+	{"session_not_found", http.StatusNotFound},
+	{"sms_delivery_failed", http.StatusBadGateway},
+	{"tag_not_allowed", http.StatusBadRequest},
+	{"token_expired", http.StatusUnauthorized},
+	{"token_generation_failed", http.StatusInternalServerError},
+	{"token_invalid", http.StatusUnauthorized},
+	{"token_revoked", http.StatusUnauthorized},
+	{"token_user_not_found", http.StatusUnauthorized},
+	{"too_many_emails", http.StatusTooManyRequests},
+	{"too_many_failed_attempts", http.StatusTooManyRequests},
+	{"too_many_tags", http.StatusBadRequest},
+	{"two_factor_already_enabled", http.StatusBadRequest},
+	{"two_factor_enrollment_required", http.StatusForbidden},
+	{"two_factor_mandatory", http.StatusForbidden},
+	{"two_factor_not_enabled", http.StatusBadRequest},
+	{"two_factor_not_set_up", http.StatusBadRequest},
+	{"two_factor_required", http.StatusForbidden},
+	{"unauthorized", http.StatusUnauthorized},
+	{"unknown_tier", http.StatusBadRequest},
+	{"unsupported_grant_type", http.StatusBadRequest},
+	{"unsupported_media_type", http.StatusUnsupportedMediaType},
+	{"user_not_found", http.StatusNotFound},
+	{"username_taken", http.StatusBadRequest},
+	{"validation_failed", http.StatusBadRequest},
+	{"version_conflict", http.StatusConflict},
+}
+
+func TestCatalogStatuses(t *testing.T) {
+	want := make(map[string]int, len(catalogStatuses))
+	for _, entry := range catalogStatuses {
+		want[entry.code] = entry.status
+	}
+
+	for _, e := range apperr.Catalog() {
+		status, ok := want[e.Code]
+		if !ok {
+			t.Errorf("%s is not pinned in catalogStatuses", e.Code)
+			continue
+		}
+		if e.Status != status {
+			t.Errorf("%s has status %d, want %d", e.Code, e.Status, status)
+		}
+		delete(want, e.Code)
+	}
+	for code := range want {
+		t.Errorf("%s is pinned but no longer in the catalog", code)
+	}
+}
@@ -0,0 +1,230 @@
+// Package audit streams account activity, such as logins, failed logins, new
+// sessions and role changes, to a SIEM: a syslog server, a file or an HTTP collector,
+// as JSON or CEF records. Events are queued and sent in the background so the
+// exporter never slows down the requests it reports on.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+)
+
+// maxBatch is the most events sent to the sink at once
+const maxBatch = 100
+
+// closeTimeout bounds how long Close waits for queued events to be sent
+const closeTimeout = 5 * time.Second
+
+// Event is an exported audit record
+type Event struct {
+	Time      time.Time      `json:"time"`
+	Type      string         `json:"type"`
+	Outcome   string         `json:"outcome"` // success or failure
+	Severity  string         `json:"severity"`
+	UserID    uint           `json:"user_id"`
+	ActorID   uint           `json:"actor_id"` // The user who acted; the user themselves unless an admin did
+	IP        string         `json:"ip,omitempty"`
+	UserAgent string         `json:"user_agent,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// Severities of events
+const (
+	SeverityInfo    = "info"
+	SeverityNotice  = "notice"
+	SeverityWarning = "warning"
+)
+
+// FromActivity turns an activity feed entry into an audit event
+func FromActivity(a models.Activity) Event {
+	e := Event{
+		Time:      time.UnixMilli(a.CreatedAt).UTC(),
+		Type:      a.Type,
+		Outcome:   "success",
+		Severity:  SeverityInfo,
+		UserID:    a.UserID,
+		ActorID:   a.UserID,
+		IP:        a.IP,
+		UserAgent: a.UserAgent,
+		Details:   a.Details,
+	}
+	if a.CreatedAt == 0 {
+		e.Time = time.Now().UTC()
+	}
+	if a.ActorID != nil {
+		e.ActorID = *a.ActorID
+	}
+	switch a.Type {
+	case models.ActivityLoginFailed:
+		e.Outcome, e.Severity = "failure", SeverityWarning
+	case models.ActivityRoleAssigned, models.ActivityRoleRemoved, models.ActivityEmailChanged:
+		e.Severity = SeverityNotice
+	case models.ActivityEmailReverted, models.ActivityTokensRevoked:
+		e.Severity = SeverityWarning
+	}
+	if _, ok := a.Details["risk_reasons"]; ok {
+		e.Severity = SeverityWarning
+	}
+	return e
+}
+
+// record is a formatted event
+type record struct {
+	severity string
+	data     []byte
+}
+
+// sink delivers records
+type sink interface {
+	send(records []record) error
+	close() error
+}
+
+// Exporter queues events and sends them to the configured sink
+type Exporter struct {
+	events chan Event
+	format func(Event) []byte
+	sink   sink
+	logger *slog.Logger
+	done   chan struct{}
+	// mu guards closing the queue against concurrent Export calls
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates the exporter configured by cfg and starts sending, or returns nil when
+// exporting is off. Problems sending events are logged to logger.
+func New(cfg config.AuditConfig, logger *slog.Logger) (*Exporter, error) {
+	if cfg.Export == "" {
+		return nil, nil
+	}
+
+	var format func(Event) []byte
+	switch cfg.Format {
+	case "json":
+		format = JSON
+	case "cef":
+		format = CEF
+	default:
+		return nil, fmt.Errorf("unknown audit format %q", cfg.Format)
+	}
+
+	var s sink
+	var err error
+	switch cfg.Export {
+	case "syslog":
+		s, err = newSyslogSink(cfg.SyslogAddress)
+	case "file":
+		s, err = newFileSink(cfg.File)
+	case "http":
+		s = newHTTPSink(cfg.HTTPURL, cfg.HTTPToken, cfg.Format)
+	default:
+		return nil, fmt.Errorf("unknown audit export target %q", cfg.Export)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Exporter{
+		events: make(chan Event, cfg.BufferSize),
+		format: format,
+		sink:   s,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// Export queues an event. When the queue is full the event is dropped with a warning
+// rather than holding up the caller.
+func (e *Exporter) Export(event Event) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.events <- event:
+	default:
+		e.logger.Warn("audit export queue is full, dropping event", "type", event.Type, "user_id", event.UserID)
+	}
+}
+
+// Close sends the queued events, waiting a few seconds at most, and releases the sink
+func (e *Exporter) Close() {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	close(e.events)
+	e.mu.Unlock()
+
+	select {
+	case <-e.done:
+	case <-time.After(closeTimeout):
+		e.logger.Warn("audit export did not finish sending queued events")
+	}
+	if err := e.sink.close(); err != nil {
+		e.logger.Warn("failed to close audit sink", "error", err)
+	}
+}
+
+// run sends queued events in batches until the queue is closed
+func (e *Exporter) run() {
+	defer close(e.done)
+	for event := range e.events {
+		records := []record{e.record(event)}
+	batch:
+		for len(records) < maxBatch {
+			select {
+			case next, ok := <-e.events:
+				if !ok {
+					break batch
+				}
+				records = append(records, e.record(next))
+			default:
+				break batch
+			}
+		}
+		if err := e.sink.send(records); err != nil {
+			e.logger.Warn("failed to export audit events", "events", len(records), "error", err)
+		}
+	}
+}
+
+func (e *Exporter) record(event Event) record {
+	return record{severity: event.Severity, data: e.format(event)}
+}
+
+// activityRepository exports every recorded activity
+type activityRepository struct {
+	repository.ActivityRepository
+	exporter *Exporter
+}
+
+// Wrap returns an activity repository that also exports the events it records. A nil
+// exporter returns repo unchanged.
+func Wrap(repo repository.ActivityRepository, exporter *Exporter) repository.ActivityRepository {
+	if exporter == nil {
+		return repo
+	}
+	return &activityRepository{ActivityRepository: repo, exporter: exporter}
+}
+
+// Add records the event and exports it. Events the store fails to record are still
+// exported, so the SIEM sees them even when the database doesn't.
+func (r *activityRepository) Add(ctx context.Context, event *models.Activity) error {
+	err := r.ActivityRepository.Add(ctx, event)
+	r.exporter.Export(FromActivity(*event))
+	return err
+}
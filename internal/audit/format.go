@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CEF header fields identifying this service
+const (
+	cefVendor  = "ristep"
+	cefProduct = "um_starter_jwt_go"
+	cefVersion = "1.0"
+)
+
+// cefNames are the CEF names of event types
+var cefNames = map[string]string{
+	"login":                 "User logged in",
+	"login_failed":          "User login failed",
+	"session_created":       "Session created",
+	"profile_updated":       "Profile updated",
+	"email_changed":         "Email changed",
+	"email_change_reverted": "Email change reverted",
+	"role_assigned":         "Role assigned",
+	"role_removed":          "Role removed",
+	"tokens_revoked":        "Tokens revoked",
+}
+
+// cefSeverities map severities to the CEF scale of 0 to 10
+var cefSeverities = map[string]int{SeverityInfo: 3, SeverityNotice: 5, SeverityWarning: 7}
+
+// JSON formats an event as a JSON object
+func JSON(e Event) []byte {
+	data, err := json.Marshal(e)
+	if err != nil {
+		// Details come from JSONB, so this only happens for values it can't hold
+		data, _ = json.Marshal(Event{Time: e.Time, Type: e.Type, Outcome: e.Outcome, Severity: e.Severity, UserID: e.UserID, ActorID: e.ActorID})
+	}
+	return data
+}
+
+// CEF formats an event in ArcSight Common Event Format. The user the event is about
+// is the destination user, whoever acted the source user.
+func CEF(e Event) []byte {
+	name := cefNames[e.Type]
+	if name == "" {
+		name = e.Type
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeader(cefVendor), cefHeader(cefProduct), cefHeader(cefVersion),
+		cefHeader(e.Type), cefHeader(name), cefSeverities[e.Severity])
+
+	ext := []string{
+		"rt=" + strconv.FormatInt(e.Time.UnixMilli(), 10),
+		"outcome=" + e.Outcome,
+		"duid=" + strconv.FormatUint(uint64(e.UserID), 10),
+		"suid=" + strconv.FormatUint(uint64(e.ActorID), 10),
+	}
+	if e.IP != "" {
+		ext = append(ext, "src="+cefValue(e.IP))
+	}
+	if e.UserAgent != "" {
+		ext = append(ext, "requestClientApplication="+cefValue(e.UserAgent))
+	}
+	if len(e.Details) > 0 {
+		details, err := json.Marshal(e.Details)
+		if err == nil {
+			ext = append(ext, "cs1Label=details", "cs1="+cefValue(string(details)))
+		}
+	}
+	b.WriteString(strings.Join(ext, " "))
+	return []byte(b.String())
+}
+
+// cefHeader escapes a header field
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ").Replace(s)
+}
+
+// cefValue escapes an extension value
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
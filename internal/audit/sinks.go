@@ -0,0 +1,190 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// syslogFacility is authpriv, the facility for security and authorization messages
+const syslogFacility = 10
+
+// syslogSeverities map severities to syslog severities
+var syslogSeverities = map[string]int{SeverityInfo: 6, SeverityNotice: 5, SeverityWarning: 4}
+
+// syslogSink sends RFC 5424 messages over UDP, TCP or a Unix socket, reconnecting
+// after errors
+type syslogSink struct {
+	network, address string
+	hostname         string
+	mu               sync.Mutex
+	conn             net.Conn
+}
+
+// newSyslogSink parses an address of the form udp://host:port, tcp://host:port or
+// unix:///path
+func newSyslogSink(address string) (*syslogSink, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AUDIT_SYSLOG_ADDRESS: %w", err)
+	}
+	s := &syslogSink{network: u.Scheme, address: u.Host}
+	switch u.Scheme {
+	case "udp", "tcp":
+	case "unix":
+		// /dev/log and friends are datagram sockets
+		s.network, s.address = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("AUDIT_SYSLOG_ADDRESS must start with udp://, tcp:// or unix://, got %q", address)
+	}
+	if s.hostname, err = os.Hostname(); err != nil || s.hostname == "" {
+		s.hostname = "-"
+	}
+	return s, nil
+}
+
+func (s *syslogSink) send(records []record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		msg := s.message(record)
+		if err := s.write(msg); err != nil {
+			// Retry once on a fresh connection, e.g. after the server restarted
+			s.reset()
+			if err := s.write(msg); err != nil {
+				s.reset()
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// message wraps a record in a syslog header
+func (s *syslogSink) message(r record) []byte {
+	pri := syslogFacility*8 + syslogSeverities[r.severity]
+	header := "<" + strconv.Itoa(pri) + ">1 " + time.Now().UTC().Format(time.RFC3339Nano) +
+		" " + s.hostname + " um-api " + strconv.Itoa(os.Getpid()) + " audit - "
+	msg := append([]byte(header), r.data...)
+	if s.network == "tcp" {
+		// Octet counting framing (RFC 6587)
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	return msg
+}
+
+func (s *syslogSink) write(msg []byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+func (s *syslogSink) reset() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *syslogSink) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+	return nil
+}
+
+// fileSink appends records to a file, one per line
+type fileSink struct {
+	f *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open AUDIT_FILE: %w", err)
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (s *fileSink) send(records []record) error {
+	_, err := s.f.Write(lines(records))
+	return err
+}
+
+func (s *fileSink) close() error {
+	return s.f.Close()
+}
+
+// httpSink posts batches of records to a collector: JSON records as a JSON array,
+// CEF records as lines of text
+type httpSink struct {
+	url, token, format string
+	client             *http.Client
+}
+
+func newHTTPSink(url, token, format string) *httpSink {
+	return &httpSink{url: url, token: token, format: format, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *httpSink) send(records []record) error {
+	body, contentType := lines(records), "text/plain; charset=utf-8"
+	if s.format == "json" {
+		body, contentType = append(append([]byte("["), join(records, ",")...), ']'), "application/json"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) close() error {
+	return nil
+}
+
+// lines joins records with newlines, ending with one
+func lines(records []record) []byte {
+	return append(join(records, "\n"), '\n')
+}
+
+func join(records []record, sep string) []byte {
+	var b bytes.Buffer
+	for i, r := range records {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		b.Write(r.data)
+	}
+	return b.Bytes()
+}
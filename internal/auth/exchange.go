@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Exchange derives the claims of a token issued by token exchange (RFC 8693): the
+// same user, only the given roles, meant for audience and acted on by actor. It
+// expires after ttl or with the original token, whichever comes first.
+func (c *CustomClaims) Exchange(audience string, roles []string, ttl time.Duration, actor string) *CustomClaims {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	if c.ExpiresAt != nil && c.ExpiresAt.Time.Before(expiresAt) {
+		expiresAt = c.ExpiresAt.Time
+	}
+
+	exchanged := *c
+	exchanged.Roles = roles
+	exchanged.Type = TypeAccess
+	exchanged.Actor = &Actor{Subject: actor}
+	exchanged.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    c.Issuer,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ID:        tokenID(),
+	}
+	return &exchanged
+}
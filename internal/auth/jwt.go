@@ -3,85 +3,120 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
 	"github.com/ristep/um_starter_jwt_go/internal/models"
 )
 
 // CustomClaims represents the custom claims in the JWT token
 type CustomClaims struct {
-	UserID uint     `json:"user_id"`
-	Email  string   `json:"email"`
-	Name   string   `json:"name"`
-	Roles  []string `json:"roles"`
+	UserID   uint     `json:"user_id"`
+	Email    string   `json:"email"`
+	Username string   `json:"username,omitempty"`
+	Name     string   `json:"name"`
+	Roles    []string `json:"roles"`
+	Locale   string   `json:"locale,omitempty"`
+	// Type is TypeAccess or TypeRefresh
+	Type string `json:"typ"`
+	// TokenVersion must match the user's token version; bumping it revokes the token
+	TokenVersion uint `json:"tv"`
+	// AuthTime is when the user last proved their identity, AMR how (RFC 8176 values)
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	// Actor is set on exchanged tokens to the client acting for the user
+	Actor *Actor `json:"act,omitempty"`
+	// Scope limits a token to a few routes, e.g. ScopeTwoFactorSetup; empty allows all
+	Scope string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// AuthenticatedWithin reports whether the user proved their identity no longer than
+// maxAge ago
+func (c *CustomClaims) AuthenticatedWithin(maxAge time.Duration) bool {
+	return c.AuthTime != nil && time.Since(c.AuthTime.Time) <= maxAge
+}
+
+// Actor identifies the party acting on behalf of the subject (RFC 8693 "act")
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
 // JWTService handles JWT token generation and validation
 type JWTService struct {
-	secretKey string
+	tokenOptions
+	mu          sync.RWMutex
+	secretKey   string
+	previousKey string
 }
 
-// NewJWTService creates a new JWT service with the given secret key
-func NewJWTService(secretKey string) *JWTService {
+// NewJWTService creates a new JWT service from the JWT configuration
+func NewJWTService(cfg config.JWTConfig) *JWTService {
 	return &JWTService{
-		secretKey: secretKey,
+		tokenOptions: newTokenOptions(cfg),
+		secretKey:    cfg.Secret,
+		previousKey:  cfg.PreviousSecret,
 	}
 }
 
-// TokenPair represents both access and refresh tokens
-type TokenPair struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+// SetSecret replaces the signing key, e.g. after the secret was rotated in the secret store.
+// Tokens signed with the previous key stop validating immediately.
+func (js *JWTService) SetSecret(secretKey string) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.secretKey = secretKey
 }
 
-// GenerateTokenPair generates both access and refresh tokens for a user
-func (js *JWTService) GenerateTokenPair(user *models.User) (*TokenPair, error) {
-	// Extract role names from user roles
-	roleNames := make([]string, len(user.Roles))
-	for i, role := range user.Roles {
-		roleNames[i] = role.Name
-	}
+// SetSecrets replaces the signing key and the previous key still accepted during a
+// rotation; an empty previous key accepts only the signing key
+func (js *JWTService) SetSecrets(secretKey, previousKey string) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.secretKey = secretKey
+	js.previousKey = previousKey
+}
 
-	// Generate access token (short-lived: 15 minutes)
-	accessToken, err := js.generateToken(user, roleNames, 15*time.Minute)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
-	}
+// key returns the current signing key
+func (js *JWTService) key() []byte {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+	return []byte(js.secretKey)
+}
 
-	// Generate refresh token (long-lived: 7 days)
-	refreshToken, err := js.generateToken(user, roleNames, 7*24*time.Hour)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
-	}
+// previous returns the previous signing key, empty outside a rotation
+func (js *JWTService) previous() []byte {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+	return []byte(js.previousKey)
+}
 
-	return &TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	}, nil
-}
-
-// generateToken is a helper function to create a JWT token with the given duration
-func (js *JWTService) generateToken(user *models.User, roleNames []string, duration time.Duration) (string, error) {
-	now := time.Now()
-	expirationTime := now.Add(duration)
-
-	claims := CustomClaims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Name:   user.Name,
-		Roles:  roleNames,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(now),
-			NotBefore: jwt.NewNumericDate(now),
-			Issuer:    "um-api",
-		},
-	}
+// GenerateScopedToken generates an access token limited to scope, without a refresh token
+func (js *JWTService) GenerateScopedToken(user *models.User, authn Authentication, scope string) (*TokenPair, error) {
+	return js.scoped(user, authn, scope, js.generateToken)
+}
+
+// GenerateTokenPair generates both access and refresh tokens for a user
+func (js *JWTService) GenerateTokenPair(user *models.User, authn Authentication) (*TokenPair, error) {
+	return js.GenerateTokenPairUntil(user, authn, time.Now().Add(js.RefreshTTL()))
+}
+
+// GenerateTokenPairUntil generates a token pair whose refresh token expires at
+// refreshExpiresAt, e.g. the end of the session it continues
+func (js *JWTService) GenerateTokenPairUntil(user *models.User, authn Authentication, refreshExpiresAt time.Time) (*TokenPair, error) {
+	return js.pair(user, authn, refreshExpiresAt, js.generateToken)
+}
 
+// IssueToken signs the given claims
+func (js *JWTService) IssueToken(claims *CustomClaims) (string, error) {
+	return js.generateToken(claims)
+}
+
+// generateToken is a helper function to sign the claims as a JWT
+func (js *JWTService) generateToken(claims *CustomClaims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(js.secretKey))
+	tokenString, err := token.SignedString(js.key())
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -89,18 +124,54 @@ func (js *JWTService) generateToken(user *models.User, roleNames []string, durat
 	return tokenString, nil
 }
 
-// ValidateToken parses and validates a JWT token, returning the claims or an error
+// User builds the user the claims describe, for authentication without a database
+// lookup. Only the identity, roles, locale and token version are set.
+func (c *CustomClaims) User() *models.User {
+	user := &models.User{
+		ID:           c.UserID,
+		Email:        c.Email,
+		Name:         c.Name,
+		Locale:       c.Locale,
+		TokenVersion: c.TokenVersion,
+		Roles:        make([]models.Role, len(c.Roles)),
+	}
+	if c.Username != "" {
+		user.Username = &c.Username
+	}
+	for i, name := range c.Roles {
+		user.Roles[i] = models.Role{Name: name}
+	}
+	return user
+}
+
+// ValidateToken parses and validates a JWT access token, returning the claims or an
+// error
 func (js *JWTService) ValidateToken(tokenString string) (*CustomClaims, error) {
-	claims := &CustomClaims{}
+	claims, err := js.validate(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return claims.ofType(TypeAccess)
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Verify the signing method is the expected one
-		if token.Method != jwt.SigningMethodHS256 {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(js.secretKey), nil
-	})
+// ValidateRefreshToken parses and validates a JWT refresh token
+func (js *JWTService) ValidateRefreshToken(tokenString string) (*CustomClaims, error) {
+	claims, err := js.validate(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return claims.ofType(TypeRefresh)
+}
 
+// validate parses and validates a JWT token of any type. During a rotation tokens
+// signed with the previous key are accepted too.
+func (js *JWTService) validate(tokenString string) (*CustomClaims, error) {
+	claims, token, err := js.parse(tokenString, js.key())
+	if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		if previous := js.previous(); len(previous) > 0 {
+			claims, token, err = js.parse(tokenString, previous)
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
@@ -109,10 +180,22 @@ func (js *JWTService) ValidateToken(tokenString string) (*CustomClaims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	if !js.acceptsAudience(claims.Audience) {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+
 	return claims, nil
 }
 
-// ValidateRefreshToken is an alias for ValidateToken used for refresh tokens
-func (js *JWTService) ValidateRefreshToken(tokenString string) (*CustomClaims, error) {
-	return js.ValidateToken(tokenString)
+// parse parses a JWT token signed with key
+func (js *JWTService) parse(tokenString string, key []byte) (*CustomClaims, *jwt.Token, error) {
+	claims := &CustomClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Verify the signing method is the expected one
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key, nil
+	}, jwt.WithIssuer(js.issuer), jwt.WithIssuedAt(), jwt.WithLeeway(js.leeway))
+	return claims, token, err
 }
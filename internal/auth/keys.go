@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// GenerateSecret returns n random bytes, hex-encoded, e.g. for JWT_SECRET or a
+// paseto-local PASETO_KEY (32 bytes)
+func GenerateSecret(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateKeyPair returns a new Ed25519 key pair for paseto-public, hex-encoded: the
+// seed to set as PASETO_KEY and the public key verifiers need
+func GenerateKeyPair() (seed, publicKey string, err error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(private.Seed()), hex.EncodeToString(public), nil
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// opaqueTimeout bounds store lookups, which the TokenService methods make without a
+// request context
+const opaqueTimeout = 5 * time.Second
+
+// ErrOpaqueTokenNotFound is returned by an OpaqueStore for unknown tokens
+var ErrOpaqueTokenNotFound = errors.New("opaque token not found")
+
+// OpaqueStore keeps the claims of issued opaque tokens under the SHA-256 hash of the token
+type OpaqueStore interface {
+	Save(ctx context.Context, hash string, claims *CustomClaims) error
+	Load(ctx context.Context, hash string) (*CustomClaims, error)
+	Delete(ctx context.Context, hash string) error
+	// DeleteUser drops every token issued to the user
+	DeleteUser(ctx context.Context, userID uint) error
+}
+
+// Revoker is implemented by token services that can invalidate tokens immediately
+type Revoker interface {
+	// Revoke invalidates a single token
+	Revoke(ctx context.Context, token string) error
+	// RevokeUser invalidates every token issued to the user
+	RevokeUser(ctx context.Context, userID uint) error
+}
+
+// OpaqueService issues random tokens whose claims are kept server-side. Tokens are
+// short and reveal nothing, and deleting a token takes effect immediately.
+type OpaqueService struct {
+	tokenOptions
+	store OpaqueStore
+}
+
+// NewOpaqueService creates an opaque token service backed by store
+func NewOpaqueService(cfg config.JWTConfig, store OpaqueStore) *OpaqueService {
+	return &OpaqueService{tokenOptions: newTokenOptions(cfg), store: store}
+}
+
+// GenerateScopedToken generates an access token limited to scope, without a refresh token
+func (op *OpaqueService) GenerateScopedToken(user *models.User, authn Authentication, scope string) (*TokenPair, error) {
+	return op.scoped(user, authn, scope, op.generateToken)
+}
+
+// GenerateTokenPair generates both access and refresh tokens for a user
+func (op *OpaqueService) GenerateTokenPair(user *models.User, authn Authentication) (*TokenPair, error) {
+	return op.GenerateTokenPairUntil(user, authn, time.Now().Add(op.RefreshTTL()))
+}
+
+// GenerateTokenPairUntil generates a token pair whose refresh token expires at
+// refreshExpiresAt
+func (op *OpaqueService) GenerateTokenPairUntil(user *models.User, authn Authentication, refreshExpiresAt time.Time) (*TokenPair, error) {
+	return op.pair(user, authn, refreshExpiresAt, op.generateToken)
+}
+
+// generateToken stores the claims under a new random token
+func (op *OpaqueService) generateToken(claims *CustomClaims) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), opaqueTimeout)
+	defer cancel()
+	if err := op.store.Save(ctx, hashToken(token), claims); err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+	return token, nil
+}
+
+// IssueToken stores the given claims under a new token
+func (op *OpaqueService) IssueToken(claims *CustomClaims) (string, error) {
+	return op.generateToken(claims)
+}
+
+// ValidateToken looks up the claims of an access token
+func (op *OpaqueService) ValidateToken(token string) (*CustomClaims, error) {
+	claims, err := op.validate(token)
+	if err != nil {
+		return nil, err
+	}
+	return claims.ofType(TypeAccess)
+}
+
+// ValidateRefreshToken looks up the claims of a refresh token
+func (op *OpaqueService) ValidateRefreshToken(token string) (*CustomClaims, error) {
+	claims, err := op.validate(token)
+	if err != nil {
+		return nil, err
+	}
+	return claims.ofType(TypeRefresh)
+}
+
+// validate looks up the claims of a token of any type
+func (op *OpaqueService) validate(token string) (*CustomClaims, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opaqueTimeout)
+	defer cancel()
+	claims, err := op.store.Load(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrOpaqueTokenNotFound) {
+			return nil, jwt.ErrTokenMalformed
+		}
+		return nil, err
+	}
+
+	// Stores may keep tokens a little past their expiry
+	if claims.ExpiresAt == nil || time.Now().After(claims.ExpiresAt.Time.Add(op.leeway)) {
+		return nil, jwt.ErrTokenExpired
+	}
+	if claims.Issuer != op.issuer {
+		return nil, jwt.ErrTokenInvalidIssuer
+	}
+	if !op.acceptsAudience(claims.Audience) {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+	return claims, nil
+}
+
+// Revoke deletes a token
+func (op *OpaqueService) Revoke(ctx context.Context, token string) error {
+	return op.store.Delete(ctx, hashToken(token))
+}
+
+// RevokeUser deletes every token issued to the user
+func (op *OpaqueService) RevokeUser(ctx context.Context, userID uint) error {
+	return op.store.DeleteUser(ctx, userID)
+}
+
+// hashToken returns the hex-encoded SHA-256 hash an opaque token is stored under
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// PASETO v4 headers
+const (
+	pasetoLocal  = "v4.local."
+	pasetoPublic = "v4.public."
+)
+
+// ErrInvalidPaseto is returned for tokens that are malformed or fail authentication
+var ErrInvalidPaseto = errors.New("invalid paseto token")
+
+// PasetoService issues PASETO v4 tokens: encrypted with a shared key (local) or
+// signed with Ed25519 (public). The claims are the same as in JWTs.
+type PasetoService struct {
+	tokenOptions
+	local      bool
+	key        []byte // v4.local key
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewPasetoService creates a PASETO service. cfg.PasetoKey is hex: 32 bytes for
+// paseto-local, an Ed25519 seed (32 bytes) or private key (64 bytes) for paseto-public.
+func NewPasetoService(cfg config.JWTConfig) (*PasetoService, error) {
+	key, err := hex.DecodeString(cfg.PasetoKey)
+	if err != nil {
+		return nil, fmt.Errorf("PASETO_KEY must be hex-encoded: %w", err)
+	}
+
+	ps := &PasetoService{tokenOptions: newTokenOptions(cfg), local: cfg.Format == "paseto-local"}
+	switch {
+	case ps.local && len(key) == 32:
+		ps.key = key
+	case !ps.local && len(key) == ed25519.SeedSize:
+		ps.privateKey = ed25519.NewKeyFromSeed(key)
+	case !ps.local && len(key) == ed25519.PrivateKeySize:
+		ps.privateKey = ed25519.PrivateKey(key)
+	default:
+		return nil, fmt.Errorf("PASETO_KEY has the wrong length for %s", cfg.Format)
+	}
+	if ps.privateKey != nil {
+		ps.publicKey = ps.privateKey.Public().(ed25519.PublicKey)
+	}
+	return ps, nil
+}
+
+// PublicKey returns the hex-encoded Ed25519 public key other services need to verify
+// paseto-public tokens; it is empty for paseto-local
+func (ps *PasetoService) PublicKey() string {
+	return hex.EncodeToString(ps.publicKey)
+}
+
+// GenerateScopedToken generates an access token limited to scope, without a refresh token
+func (ps *PasetoService) GenerateScopedToken(user *models.User, authn Authentication, scope string) (*TokenPair, error) {
+	return ps.scoped(user, authn, scope, ps.generateToken)
+}
+
+// GenerateTokenPair generates both access and refresh tokens for a user
+func (ps *PasetoService) GenerateTokenPair(user *models.User, authn Authentication) (*TokenPair, error) {
+	return ps.GenerateTokenPairUntil(user, authn, time.Now().Add(ps.RefreshTTL()))
+}
+
+// GenerateTokenPairUntil generates a token pair whose refresh token expires at
+// refreshExpiresAt
+func (ps *PasetoService) GenerateTokenPairUntil(user *models.User, authn Authentication, refreshExpiresAt time.Time) (*TokenPair, error) {
+	return ps.pair(user, authn, refreshExpiresAt, ps.generateToken)
+}
+
+// ValidateRefreshToken decrypts or verifies a PASETO refresh token and checks its claims
+func (ps *PasetoService) ValidateRefreshToken(token string) (*CustomClaims, error) {
+	claims, err := ps.validate(token)
+	if err != nil {
+		return nil, err
+	}
+	return claims.ofType(TypeRefresh)
+}
+
+// IssueToken encrypts or signs the given claims
+func (ps *PasetoService) IssueToken(claims *CustomClaims) (string, error) {
+	return ps.generateToken(claims)
+}
+
+// pasetoClaims is the PASETO payload. Registered claims use ISO 8601 times as the
+// specification requires.
+type pasetoClaims struct {
+	UserID       uint       `json:"user_id"`
+	Email        string     `json:"email"`
+	Username     string     `json:"username,omitempty"`
+	Name         string     `json:"name"`
+	Roles        []string   `json:"roles"`
+	Locale       string     `json:"locale,omitempty"`
+	Type         string     `json:"typ"`
+	TokenVersion uint       `json:"tv"`
+	AuthTime     *time.Time `json:"auth_time,omitempty"`
+	AMR          []string   `json:"amr,omitempty"`
+	Actor        *Actor     `json:"act,omitempty"`
+	Scope        string     `json:"scope,omitempty"`
+	Issuer       string     `json:"iss"`
+	Audience     string     `json:"aud,omitempty"`
+	Expiration   time.Time  `json:"exp"`
+	NotBefore    time.Time  `json:"nbf"`
+	IssuedAt     time.Time  `json:"iat"`
+	ID           string     `json:"jti"`
+}
+
+// generateToken encrypts or signs the claims
+func (ps *PasetoService) generateToken(claims *CustomClaims) (string, error) {
+	payload := pasetoClaims{
+		UserID:       claims.UserID,
+		Email:        claims.Email,
+		Username:     claims.Username,
+		Name:         claims.Name,
+		Roles:        claims.Roles,
+		Locale:       claims.Locale,
+		Type:         claims.Type,
+		TokenVersion: claims.TokenVersion,
+		AMR:          claims.AMR,
+		Actor:        claims.Actor,
+		Scope:        claims.Scope,
+		Issuer:       claims.Issuer,
+		Expiration:   claims.ExpiresAt.Time.UTC().Truncate(time.Second),
+		NotBefore:    claims.NotBefore.Time.UTC().Truncate(time.Second),
+		IssuedAt:     claims.IssuedAt.Time.UTC().Truncate(time.Second),
+		ID:           claims.ID,
+	}
+	if claims.AuthTime != nil {
+		authTime := claims.AuthTime.Time.UTC().Truncate(time.Second)
+		payload.AuthTime = &authTime
+	}
+	if len(claims.Audience) > 0 {
+		payload.Audience = claims.Audience[0]
+	}
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	if ps.local {
+		return ps.encrypt(message)
+	}
+	return ps.sign(message), nil
+}
+
+// ValidateToken decrypts or verifies a PASETO access token and checks its claims
+func (ps *PasetoService) ValidateToken(token string) (*CustomClaims, error) {
+	claims, err := ps.validate(token)
+	if err != nil {
+		return nil, err
+	}
+	return claims.ofType(TypeAccess)
+}
+
+// validate decrypts or verifies a PASETO token of any type and checks its claims
+func (ps *PasetoService) validate(token string) (*CustomClaims, error) {
+	var message []byte
+	var err error
+	if ps.local {
+		message, err = ps.decrypt(token)
+	} else {
+		message, err = ps.verify(token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var payload pasetoClaims
+	if err := json.Unmarshal(message, &payload); err != nil {
+		return nil, ErrInvalidPaseto
+	}
+
+	now := time.Now()
+	switch {
+	case now.After(payload.Expiration.Add(ps.leeway)):
+		return nil, jwt.ErrTokenExpired
+	case now.Before(payload.NotBefore.Add(-ps.leeway)):
+		return nil, jwt.ErrTokenNotValidYet
+	case now.Before(payload.IssuedAt.Add(-ps.leeway)):
+		return nil, jwt.ErrTokenUsedBeforeIssued
+	case payload.Issuer != ps.issuer:
+		return nil, jwt.ErrTokenInvalidIssuer
+	}
+
+	claims := &CustomClaims{
+		UserID:       payload.UserID,
+		Email:        payload.Email,
+		Username:     payload.Username,
+		Name:         payload.Name,
+		Roles:        payload.Roles,
+		Locale:       payload.Locale,
+		Type:         payload.Type,
+		TokenVersion: payload.TokenVersion,
+		AMR:          payload.AMR,
+		Actor:        payload.Actor,
+		Scope:        payload.Scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    payload.Issuer,
+			ExpiresAt: jwt.NewNumericDate(payload.Expiration),
+			NotBefore: jwt.NewNumericDate(payload.NotBefore),
+			IssuedAt:  jwt.NewNumericDate(payload.IssuedAt),
+			ID:        payload.ID,
+		},
+	}
+	if payload.AuthTime != nil {
+		claims.AuthTime = jwt.NewNumericDate(*payload.AuthTime)
+	}
+	if payload.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{payload.Audience}
+	}
+	if !ps.acceptsAudience(claims.Audience) {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+	return claims, nil
+}
+
+// encrypt builds a v4.local token without footer or implicit assertion
+func (ps *PasetoService) encrypt(message []byte) (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	encKey, counterNonce, authKey := ps.localKeys(nonce)
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encKey, counterNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(message))
+	cipher.XORKeyStream(ciphertext, message)
+
+	tag := localTag(authKey, nonce, ciphertext, nil)
+	return pasetoLocal + base64.RawURLEncoding.EncodeToString(concat(nonce, ciphertext, tag)), nil
+}
+
+// decrypt authenticates and decrypts a v4.local token
+func (ps *PasetoService) decrypt(token string) ([]byte, error) {
+	body, footer, err := splitPaseto(token, pasetoLocal)
+	if err != nil || len(body) < 64 {
+		return nil, ErrInvalidPaseto
+	}
+	nonce, ciphertext, tag := body[:32], body[32:len(body)-32], body[len(body)-32:]
+	encKey, counterNonce, authKey := ps.localKeys(nonce)
+
+	if subtle.ConstantTimeCompare(tag, localTag(authKey, nonce, ciphertext, footer)) != 1 {
+		return nil, ErrInvalidPaseto
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encKey, counterNonce)
+	if err != nil {
+		return nil, err
+	}
+	message := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(message, ciphertext)
+	return message, nil
+}
+
+// localKeys splits the shared key into the encryption key, the XChaCha20 nonce and
+// the authentication key for one token nonce
+func (ps *PasetoService) localKeys(nonce []byte) (encKey, counterNonce, authKey []byte) {
+	tmp := keyedHash(ps.key, 56, []byte("paseto-encryption-key"), nonce)
+	authKey = keyedHash(ps.key, 32, []byte("paseto-auth-key-for-aead"), nonce)
+	return tmp[:32], tmp[32:], authKey
+}
+
+// localTag is the BLAKE2b MAC over the pre-authentication encoding of a v4.local token
+func localTag(authKey, nonce, ciphertext, footer []byte) []byte {
+	return keyedHash(authKey, 32, pae([]byte(pasetoLocal), nonce, ciphertext, footer, nil))
+}
+
+// sign builds a v4.public token without footer or implicit assertion
+func (ps *PasetoService) sign(message []byte) string {
+	signature := ed25519.Sign(ps.privateKey, pae([]byte(pasetoPublic), message, nil, nil))
+	return pasetoPublic + base64.RawURLEncoding.EncodeToString(concat(message, signature))
+}
+
+// verify checks the signature of a v4.public token and returns its message
+func (ps *PasetoService) verify(token string) ([]byte, error) {
+	body, footer, err := splitPaseto(token, pasetoPublic)
+	if err != nil || len(body) < ed25519.SignatureSize {
+		return nil, ErrInvalidPaseto
+	}
+	message, signature := body[:len(body)-ed25519.SignatureSize], body[len(body)-ed25519.SignatureSize:]
+	if !ed25519.Verify(ps.publicKey, pae([]byte(pasetoPublic), message, footer, nil), signature) {
+		return nil, ErrInvalidPaseto
+	}
+	return message, nil
+}
+
+// splitPaseto decodes the body and optional footer of a token with the given header
+func splitPaseto(token, header string) (body, footer []byte, err error) {
+	rest, ok := strings.CutPrefix(token, header)
+	if !ok {
+		return nil, nil, ErrInvalidPaseto
+	}
+	encodedBody, encodedFooter, _ := strings.Cut(rest, ".")
+	if body, err = base64.RawURLEncoding.DecodeString(encodedBody); err != nil {
+		return nil, nil, err
+	}
+	if footer, err = base64.RawURLEncoding.DecodeString(encodedFooter); err != nil {
+		return nil, nil, err
+	}
+	return body, footer, nil
+}
+
+// pae is PASETO's pre-authentication encoding of the pieces
+func pae(pieces ...[]byte) []byte {
+	out := le64(len(pieces))
+	for _, piece := range pieces {
+		out = append(out, le64(len(piece))...)
+		out = append(out, piece...)
+	}
+	return out
+}
+
+// le64 encodes n as 64-bit little endian with the top bit cleared
+func le64(n int) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(n)&(1<<63-1))
+	return b
+}
+
+// keyedHash is BLAKE2b keyed with key, producing size bytes
+func keyedHash(key []byte, size int, parts ...[]byte) []byte {
+	h, _ := blake2b.New(size, key)
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
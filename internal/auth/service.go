@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// TokenService issues and validates the access and refresh tokens handed to clients
+type TokenService interface {
+	// GenerateTokenPair generates both access and refresh tokens for a user
+	GenerateTokenPair(user *models.User, authn Authentication) (*TokenPair, error)
+	// GenerateTokenPairUntil generates a token pair whose refresh token expires at
+	// refreshExpiresAt
+	GenerateTokenPairUntil(user *models.User, authn Authentication, refreshExpiresAt time.Time) (*TokenPair, error)
+	// GenerateScopedToken generates an access token limited to scope; the pair has no
+	// refresh token
+	GenerateScopedToken(user *models.User, authn Authentication, scope string) (*TokenPair, error)
+	// IssueToken creates a single token carrying exactly the given claims
+	IssueToken(claims *CustomClaims) (string, error)
+	// ValidateToken checks a token and returns its claims
+	ValidateToken(token string) (*CustomClaims, error)
+	// ValidateRefreshToken checks a refresh token and returns its claims
+	ValidateRefreshToken(token string) (*CustomClaims, error)
+	// RefreshTTL returns how long refresh tokens are valid
+	RefreshTTL() time.Duration
+}
+
+// TTLSetter is implemented by token services whose token lifetimes can be changed at
+// runtime
+type TTLSetter interface {
+	// SetTTL changes the lifetimes of the tokens issued from now on
+	SetTTL(access, refresh time.Duration)
+}
+
+// NewTokenService creates the token service for the configured format. opaque keeps
+// the claims of opaque tokens; other formats don't use it.
+func NewTokenService(cfg config.JWTConfig, opaque OpaqueStore) (TokenService, error) {
+	switch cfg.Format {
+	case "jwt":
+		return NewJWTService(cfg), nil
+	case "paseto-local", "paseto-public":
+		return NewPasetoService(cfg)
+	case "opaque":
+		return NewOpaqueService(cfg, opaque), nil
+	default:
+		return nil, fmt.Errorf("unknown token format %q", cfg.Format)
+	}
+}
+
+// Authentication methods recorded in the amr claim (RFC 8176)
+const (
+	MethodPassword = "pwd"
+	MethodOTP      = "otp"
+)
+
+// Token types carried in the typ claim. Refresh tokens are only accepted by
+// ValidateRefreshToken and access tokens only by ValidateToken.
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
+// ErrWrongTokenType is returned for a refresh token presented as an access token or
+// the other way round
+var ErrWrongTokenType = fmt.Errorf("wrong token type: %w", jwt.ErrTokenInvalidClaims)
+
+// ScopeTwoFactorSetup limits a token to enrolling in two-factor authentication
+const ScopeTwoFactorSetup = "2fa_setup"
+
+// Authentication records when and how the user last proved their identity. Tokens
+// carry it as auth_time and amr so sensitive routes can demand a recent one.
+type Authentication struct {
+	Time    time.Time
+	Methods []string
+}
+
+// Authenticated returns an Authentication that happened just now
+func Authenticated(methods ...string) Authentication {
+	return Authentication{Time: time.Now(), Methods: methods}
+}
+
+// TokenPair represents both access and refresh tokens
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int64 `json:"expires_in"`
+	// RefreshExpiresAt is when the refresh token expires
+	RefreshExpiresAt time.Time `json:"-"`
+}
+
+// tokenOptions holds the settings shared by every token format
+type tokenOptions struct {
+	ttl       *tokenTTL
+	issuer    string
+	audience  string
+	audiences []string
+	leeway    time.Duration
+}
+
+// tokenTTL holds the token lifetimes, which are replaced on reload
+type tokenTTL struct {
+	access  atomic.Int64
+	refresh atomic.Int64
+}
+
+func newTokenOptions(cfg config.JWTConfig) tokenOptions {
+	o := tokenOptions{
+		ttl:       &tokenTTL{},
+		issuer:    cfg.Issuer,
+		audience:  cfg.Audience,
+		audiences: cfg.Audiences(),
+		leeway:    cfg.Leeway,
+	}
+	o.SetTTL(cfg.AccessTTL, cfg.RefreshTTL)
+	return o
+}
+
+// SetTTL changes the lifetimes of the tokens issued from now on
+func (o tokenOptions) SetTTL(access, refresh time.Duration) {
+	o.ttl.access.Store(int64(access))
+	o.ttl.refresh.Store(int64(refresh))
+}
+
+// accessTTL returns how long access tokens are valid
+func (o tokenOptions) accessTTL() time.Duration {
+	return time.Duration(o.ttl.access.Load())
+}
+
+// RefreshTTL returns how long refresh tokens are valid
+func (o tokenOptions) RefreshTTL() time.Duration {
+	return time.Duration(o.ttl.refresh.Load())
+}
+
+// pair builds the access and refresh token claims for user and signs them with sign
+func (o tokenOptions) pair(user *models.User, authn Authentication, refreshExpiresAt time.Time, sign func(*CustomClaims) (string, error)) (*TokenPair, error) {
+	// Generate access token (short-lived)
+	accessTTL := o.accessTTL()
+	accessToken, err := sign(o.claims(user, authn, TypeAccess, time.Now().Add(accessTTL)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	// Generate refresh token (long-lived)
+	refreshToken, err := sign(o.claims(user, authn, TypeRefresh, refreshExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(accessTTL / time.Second),
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// scoped signs an access token for user limited to scope with sign
+func (o tokenOptions) scoped(user *models.User, authn Authentication, scope string, sign func(*CustomClaims) (string, error)) (*TokenPair, error) {
+	accessTTL := o.accessTTL()
+	claims := o.claims(user, authn, TypeAccess, time.Now().Add(accessTTL))
+	claims.Scope = scope
+	accessToken, err := sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+	return &TokenPair{AccessToken: accessToken, ExpiresIn: int64(accessTTL / time.Second)}, nil
+}
+
+// claims describes user, authenticated as authn, in a token of type typ expiring at
+// expirationTime
+func (o tokenOptions) claims(user *models.User, authn Authentication, typ string, expirationTime time.Time) *CustomClaims {
+	now := time.Now()
+
+	// Extract role names from user roles
+	roleNames := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roleNames[i] = role.Name
+	}
+
+	claims := &CustomClaims{
+		UserID:       user.ID,
+		Email:        user.Email,
+		Name:         user.Name,
+		Roles:        roleNames,
+		Locale:       user.Locale,
+		Type:         typ,
+		TokenVersion: user.TokenVersion,
+		AuthTime:     jwt.NewNumericDate(authn.Time),
+		AMR:          authn.Methods,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    o.issuer,
+			// A unique ID keeps tokens issued within the same second distinct
+			ID: tokenID(),
+		},
+	}
+
+	if o.audience != "" {
+		claims.Audience = jwt.ClaimStrings{o.audience}
+	}
+	if user.Username != nil {
+		claims.Username = *user.Username
+	}
+	return claims
+}
+
+// acceptsAudience reports whether a token with the given aud values is meant for us.
+// Tokens minted for other services or environments are rejected.
+func (o tokenOptions) acceptsAudience(audience []string) bool {
+	return len(o.audiences) == 0 || slices.ContainsFunc(audience, func(aud string) bool {
+		return slices.Contains(o.audiences, aud)
+	})
+}
+
+// ofType returns c if it is a token of type typ, and ErrWrongTokenType otherwise.
+// Tokens without a typ claim predate it and are rejected as either type.
+func (c *CustomClaims) ofType(typ string) (*CustomClaims, error) {
+	if c.Type != typ {
+		return nil, ErrWrongTokenType
+	}
+	return c, nil
+}
+
+// tokenID returns a random token identifier
+func tokenID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
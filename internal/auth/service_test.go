@@ -0,0 +1,108 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/pkg/usermgmt/authtest"
+)
+
+// memoryOpaqueStore keeps opaque token claims in a map
+type memoryOpaqueStore struct {
+	mu     sync.Mutex
+	claims map[string]*auth.CustomClaims
+}
+
+func (ms *memoryOpaqueStore) Save(ctx context.Context, hash string, claims *auth.CustomClaims) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.claims[hash] = claims
+	return nil
+}
+
+func (ms *memoryOpaqueStore) Load(ctx context.Context, hash string) (*auth.CustomClaims, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	claims, ok := ms.claims[hash]
+	if !ok {
+		return nil, auth.ErrOpaqueTokenNotFound
+	}
+	copied := *claims
+	return &copied, nil
+}
+
+func (ms *memoryOpaqueStore) Delete(ctx context.Context, hash string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.claims, hash)
+	return nil
+}
+
+func (ms *memoryOpaqueStore) DeleteUser(ctx context.Context, userID uint) error {
+	return nil
+}
+
+func TestTokenTypes(t *testing.T) {
+	user := &models.User{ID: 7, Email: "user@example.com", Roles: []models.Role{{Name: "user"}}}
+
+	for _, format := range []string{"jwt", "paseto-local", "paseto-public", "opaque"} {
+		t.Run(format, func(t *testing.T) {
+			tokens, err := auth.NewTokenService(authtest.JWTConfig(format), &memoryOpaqueStore{claims: make(map[string]*auth.CustomClaims)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pair, err := tokens.GenerateTokenPair(user, auth.Authenticated(auth.MethodPassword))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := tokens.ValidateToken(pair.AccessToken)
+			if err != nil {
+				t.Fatalf("ValidateToken(access) = %v", err)
+			}
+			if claims.Type != auth.TypeAccess || claims.UserID != user.ID {
+				t.Errorf("access claims = typ %q user %d", claims.Type, claims.UserID)
+			}
+			claims, err = tokens.ValidateRefreshToken(pair.RefreshToken)
+			if err != nil {
+				t.Fatalf("ValidateRefreshToken(refresh) = %v", err)
+			}
+			if claims.Type != auth.TypeRefresh {
+				t.Errorf("refresh claims typ = %q", claims.Type)
+			}
+
+			if _, err := tokens.ValidateToken(pair.RefreshToken); !errors.Is(err, auth.ErrWrongTokenType) {
+				t.Errorf("ValidateToken(refresh) = %v, want ErrWrongTokenType", err)
+			}
+			if _, err := tokens.ValidateRefreshToken(pair.AccessToken); !errors.Is(err, auth.ErrWrongTokenType) {
+				t.Errorf("ValidateRefreshToken(access) = %v, want ErrWrongTokenType", err)
+			}
+
+			scoped, err := tokens.GenerateScopedToken(user, auth.Authenticated(auth.MethodPassword), auth.ScopeTwoFactorSetup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tokens.ValidateRefreshToken(scoped.AccessToken); !errors.Is(err, auth.ErrWrongTokenType) {
+				t.Errorf("ValidateRefreshToken(scoped) = %v, want ErrWrongTokenType", err)
+			}
+		})
+	}
+}
+
+func TestTokensWithoutTypeAreRejected(t *testing.T) {
+	tokens := authtest.NewJWTService()
+	token, err := tokens.IssueToken(&auth.CustomClaims{UserID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.ValidateToken(token); err == nil {
+		t.Error("ValidateToken accepted a token without typ")
+	}
+	if _, err := tokens.ValidateRefreshToken(token); err == nil {
+		t.Error("ValidateRefreshToken accepted a token without typ")
+	}
+}
@@ -0,0 +1,99 @@
+// Package authz decides which users may call which routes. A Policy maps routes to
+// the permission they require and roles to the permissions they grant, so the whole
+// access model reads from one table; a single middleware enforces it.
+package authz
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+)
+
+// Permission is the right to call a set of routes
+type Permission string
+
+// Rule requires a permission for a route. Path is the route pattern as registered,
+// e.g. /users/:id.
+type Rule struct {
+	Method     string
+	Path       string
+	Permission Permission
+}
+
+// Policy holds the permission every restricted route requires and the permissions
+// every role grants. Routes without a rule only need an authenticated user.
+type Policy struct {
+	routes map[string]Permission
+	grants map[string][]Permission
+}
+
+// NewPolicy creates a policy for routes registered under base, e.g. /api. A route
+// listed twice is an error.
+func NewPolicy(base string, rules []Rule, grants map[string][]Permission) (*Policy, error) {
+	p := &Policy{routes: make(map[string]Permission, len(rules)), grants: grants}
+	for _, rule := range rules {
+		key := rule.Method + " " + base + rule.Path
+		if _, ok := p.routes[key]; ok {
+			return nil, fmt.Errorf("route %s has more than one permission rule", key)
+		}
+		p.routes[key] = rule.Permission
+	}
+	return p, nil
+}
+
+// Required returns the permission a route requires, false when it needs none
+func (p *Policy) Required(method, path string) (Permission, bool) {
+	permission, ok := p.routes[method+" "+path]
+	return permission, ok
+}
+
+// Allowed reports whether the roles grant a permission
+func (p *Policy) Allowed(roles []models.Role, permission Permission) bool {
+	for _, role := range roles {
+		if slices.Contains(p.grants[role.Name], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware rejects users lacking the permission the matched route requires with
+// 403 insufficient_permissions. Use it after AuthMiddleware.
+func (p *Policy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permission, ok := p.Required(c.Request.Method, c.FullPath())
+		if !ok {
+			c.Next()
+			return
+		}
+
+		user, exists := c.Get("user")
+		if !exists {
+			problem.Abort(c, apperr.ErrUnauthorized)
+			return
+		}
+		if !p.Allowed(user.(*models.User).Roles, permission) {
+			problem.Abort(c, apperr.ErrInsufficientPermissions)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Restricted refuses every route of a group that the policy has no rule for, so a
+// route added without a rule fails closed. Use it on groups that are off limits to
+// ordinary users.
+func (p *Policy) Restricted() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := p.Required(c.Request.Method, c.FullPath()); !ok {
+			problem.Abort(c, apperr.ErrInsufficientPermissions)
+			return
+		}
+		c.Next()
+	}
+}
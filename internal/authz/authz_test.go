@@ -0,0 +1,65 @@
+package authz_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/authz"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/testutil"
+)
+
+func TestRestrictedFailsClosed(t *testing.T) {
+	policy, err := authz.NewPolicy("/api", []authz.Rule{
+		{Method: "GET", Path: "/admin/jobs", Permission: "system:operate"},
+	}, map[string][]authz.Permission{"admin": {"system:operate"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := testutil.Router()
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	admin := router.Group("/api/admin", func(c *gin.Context) {
+		roles := []models.Role{{Name: c.GetHeader("X-Role")}}
+		c.Set("user", &models.User{Roles: roles})
+	}, policy.Middleware(), policy.Restricted())
+	admin.GET("/jobs", ok)
+	// Added without a rule
+	admin.GET("/secrets", ok)
+
+	for _, tc := range []struct {
+		name, role, path string
+		want             int
+	}{
+		{"admin on a route with a rule", "admin", "/api/admin/jobs", http.StatusNoContent},
+		{"user on a route with a rule", "user", "/api/admin/jobs", http.StatusForbidden},
+		{"admin on a route without a rule", "admin", "/api/admin/secrets", http.StatusForbidden},
+		{"user on a route without a rule", "user", "/api/admin/secrets", http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := testutil.NewRequest(t, http.MethodGet, tc.path, nil)
+			req.Header.Set("X-Role", tc.role)
+			rec := testutil.Do(router, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+			if tc.want == http.StatusForbidden {
+				if p := testutil.DecodeProblem(t, rec); p.Code != "insufficient_permissions" {
+					t.Errorf("code = %q, want insufficient_permissions", p.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestNewPolicyRejectsDuplicateRules(t *testing.T) {
+	_, err := authz.NewPolicy("/api", []authz.Rule{
+		{Method: "GET", Path: "/users", Permission: "users:read"},
+		{Method: "GET", Path: "/users", Permission: "users:manage"},
+	}, nil)
+	if err == nil {
+		t.Fatal("a route with two rules was accepted")
+	}
+}
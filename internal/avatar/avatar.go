@@ -0,0 +1,71 @@
+// Package avatar validates uploaded profile pictures and normalises them to a
+// square image of fixed size.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Register the GIF decoder
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Register the WebP decoder
+)
+
+// ErrUnsupportedFormat is returned for data that is not a JPEG, PNG, GIF or WebP image
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// ErrTooLarge is returned when the image dimensions exceed the pixel limit
+var ErrTooLarge = errors.New("image dimensions too large")
+
+// Image is a processed avatar ready to be stored
+type Image struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+}
+
+// Process decodes data, crops it to a centred square and scales it to size×size.
+// JPEGs are re-encoded as JPEG and everything else as PNG to keep transparency.
+// Re-encoding also drops metadata such as EXIF location tags.
+func Process(data []byte, size, maxPixels int) (*Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	// Checked before decoding so a small file cannot expand into a huge bitmap
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxPixels/cfg.Height {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		return &Image{Data: buf.Bytes(), ContentType: "image/jpeg", Ext: ".jpg"}, nil
+	}
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return &Image{Data: buf.Bytes(), ContentType: "image/png", Ext: ".png"}, nil
+}
@@ -0,0 +1,94 @@
+// Package bruteforce tracks failed sign-ins per client IP across all accounts. IPs
+// that keep failing wait longer and longer between attempts and are eventually banned
+// for a while, which slows down password guessing spread over many accounts.
+package bruteforce
+
+import (
+	"context"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// Policy decides how long an IP waits after a number of failures
+type Policy struct {
+	// FreeAttempts failures are tolerated before any delay
+	FreeAttempts int64
+	// Window is how long an IP must stay quiet before its failures are forgotten
+	Window time.Duration
+	// BaseDelay is the first delay; it doubles with each further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// BanThreshold failures ban the IP for BanDuration
+	BanThreshold int64
+	BanDuration  time.Duration
+}
+
+// penalty returns how long an IP with the given number of failures must wait, and
+// whether that is a ban
+func (p Policy) penalty(failures int64) (time.Duration, bool) {
+	if failures >= p.BanThreshold {
+		return p.BanDuration, true
+	}
+	excess := failures - p.FreeAttempts
+	if excess <= 0 {
+		return 0, false
+	}
+	// Cap the exponent before shifting so the delay cannot overflow
+	if excess > 32 {
+		return p.MaxDelay, false
+	}
+	return min(p.BaseDelay<<(excess-1), p.MaxDelay), false
+}
+
+// Store keeps failure counts and blocks
+type Store interface {
+	// Fail counts a failed attempt from ip and returns the failures so far. The count
+	// is forgotten window after the last failure.
+	Fail(ctx context.Context, ip string, window time.Duration) (int64, error)
+	// Block makes ip wait d before its next attempt
+	Block(ctx context.Context, ip string, d time.Duration) error
+	// Blocked returns how long ip must still wait
+	Blocked(ctx context.Context, ip string) (time.Duration, error)
+}
+
+// Tracker applies a Policy to the failures kept in a Store. Store errors are logged
+// and the attempt allowed, so an outage never locks everyone out.
+type Tracker struct {
+	store  Store
+	policy Policy
+}
+
+// NewTracker creates a tracker enforcing policy
+func NewTracker(store Store, policy Policy) *Tracker {
+	return &Tracker{store: store, policy: policy}
+}
+
+// Wait returns how long ip must wait before its next attempt; 0 allows it
+func (t *Tracker) Wait(ctx context.Context, ip string) time.Duration {
+	wait, err := t.store.Blocked(ctx, ip)
+	if err != nil {
+		logging.Warn(ctx, "failed to check IP backoff", "ip", ip, "error", err)
+		return 0
+	}
+	return wait
+}
+
+// Fail records a failed attempt from ip and imposes the resulting delay
+func (t *Tracker) Fail(ctx context.Context, ip string) {
+	failures, err := t.store.Fail(ctx, ip, t.policy.Window)
+	if err != nil {
+		logging.Warn(ctx, "failed to record failed attempt", "ip", ip, "error", err)
+		return
+	}
+	wait, banned := t.policy.penalty(failures)
+	if wait <= 0 {
+		return
+	}
+	if banned {
+		logging.Warn(ctx, "IP banned after repeated failed sign-ins", "ip", ip, "failures", failures, "duration", wait)
+	}
+	if err := t.store.Block(ctx, ip, wait); err != nil {
+		logging.Warn(ctx, "failed to block IP", "ip", ip, "error", err)
+	}
+}
@@ -0,0 +1,52 @@
+package bruteforce
+
+import (
+	"context"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// FallbackStore keeps failures in a shared store, usually Redis, and in a MemoryStore
+// of its own while the shared one fails. IPs are then still slowed down per instance
+// during an outage.
+type FallbackStore struct {
+	shared Store
+	local  *MemoryStore
+}
+
+// NewFallbackStore creates a store falling back to in-process state when shared fails
+func NewFallbackStore(shared Store) *FallbackStore {
+	return &FallbackStore{shared: shared, local: NewMemoryStore()}
+}
+
+// Fail counts a failed attempt from ip
+func (fs *FallbackStore) Fail(ctx context.Context, ip string, window time.Duration) (int64, error) {
+	failures, err := fs.shared.Fail(ctx, ip, window)
+	if err == nil {
+		return failures, nil
+	}
+	logging.Warn(ctx, "shared IP backoff store failed, counting locally", "ip", ip, "error", err)
+	return fs.local.Fail(ctx, ip, window)
+}
+
+// Block makes ip wait d
+func (fs *FallbackStore) Block(ctx context.Context, ip string, d time.Duration) error {
+	if err := fs.shared.Block(ctx, ip, d); err != nil {
+		logging.Warn(ctx, "shared IP backoff store failed, blocking locally", "ip", ip, "error", err)
+		return fs.local.Block(ctx, ip, d)
+	}
+	return nil
+}
+
+// Blocked returns how long ip must still wait. Blocks imposed locally during an
+// outage keep applying after the shared store is back.
+func (fs *FallbackStore) Blocked(ctx context.Context, ip string) (time.Duration, error) {
+	local, _ := fs.local.Blocked(ctx, ip)
+	wait, err := fs.shared.Blocked(ctx, ip)
+	if err != nil {
+		logging.Warn(ctx, "shared IP backoff store failed, checking locally", "ip", ip, "error", err)
+		return local, nil
+	}
+	return max(wait, local), nil
+}
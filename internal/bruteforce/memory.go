@@ -0,0 +1,74 @@
+package bruteforce
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ipState is what MemoryStore knows about one IP
+type ipState struct {
+	failures     int64
+	forgetAt     time.Time
+	blockedUntil time.Time
+}
+
+// MemoryStore is a Store kept by a single instance; each instance counts the failures
+// it sees on its own
+type MemoryStore struct {
+	mu  sync.Mutex
+	ips map[string]*ipState
+}
+
+// NewMemoryStore creates an in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ips: make(map[string]*ipState)}
+}
+
+// Fail counts a failed attempt from ip
+func (ms *MemoryStore) Fail(_ context.Context, ip string, window time.Duration) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	// Forget IPs that went quiet and are no longer blocked
+	now := time.Now()
+	for key, state := range ms.ips {
+		if now.After(state.forgetAt) && now.After(state.blockedUntil) {
+			delete(ms.ips, key)
+		}
+	}
+
+	state, ok := ms.ips[ip]
+	if !ok {
+		state = &ipState{}
+		ms.ips[ip] = state
+	}
+	// A block can outlast the window; the count still starts over
+	if now.After(state.forgetAt) {
+		state.failures = 0
+	}
+	state.failures++
+	state.forgetAt = now.Add(window)
+	return state.failures, nil
+}
+
+// Block makes ip wait d
+func (ms *MemoryStore) Block(_ context.Context, ip string, d time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if state, ok := ms.ips[ip]; ok {
+		state.blockedUntil = time.Now().Add(d)
+	}
+	return nil
+}
+
+// Blocked returns how long ip must still wait
+func (ms *MemoryStore) Blocked(_ context.Context, ip string) (time.Duration, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	state, ok := ms.ips[ip]
+	if !ok {
+		return 0, nil
+	}
+	return max(time.Until(state.blockedUntil), 0), nil
+}
@@ -0,0 +1,54 @@
+package bruteforce
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis key prefixes for failure counts and blocks
+const (
+	failuresPrefix = "um:ip_failures:"
+	blockedPrefix  = "um:ip_blocked:"
+)
+
+// RedisStore is a Store shared by all instances, so failures spread over several
+// instances add up
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a Redis-backed store
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Fail counts a failed attempt from ip
+func (rs *RedisStore) Fail(ctx context.Context, ip string, window time.Duration) (int64, error) {
+	var failures *redis.IntCmd
+	_, err := rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		failures = pipe.Incr(ctx, failuresPrefix+ip)
+		pipe.PExpire(ctx, failuresPrefix+ip, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return failures.Val(), nil
+}
+
+// Block makes ip wait d
+func (rs *RedisStore) Block(ctx context.Context, ip string, d time.Duration) error {
+	return rs.client.Set(ctx, blockedPrefix+ip, 1, d).Err()
+}
+
+// Blocked returns how long ip must still wait
+func (rs *RedisStore) Blocked(ctx context.Context, ip string) (time.Duration, error) {
+	ttl, err := rs.client.PTTL(ctx, blockedPrefix+ip).Result()
+	if err != nil {
+		return 0, err
+	}
+	// Missing keys report a negative TTL
+	return max(ttl, 0), nil
+}
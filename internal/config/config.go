@@ -0,0 +1,1294 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the complete application configuration.
+//
+// Every leaf field carries an `env` tag (the environment variable that overrides it),
+// a `file` tag (its key inside the optional config file) and an optional `default` tag.
+// Fields tagged `reload:"hot"` are applied when the configuration is reloaded; the
+// others need a restart.
+type Config struct {
+	Env          string             `env:"ENV" file:"env" default:"development"`
+	Server       ServerConfig       `file:"server"`
+	Database     DatabaseConfig     `file:"database"`
+	JWT          JWTConfig          `file:"jwt"`
+	Auth         AuthConfig         `file:"auth"`
+	AccessLog    AccessLogConfig    `file:"access_log"`
+	Log          LogConfig          `file:"log"`
+	Audit        AuditConfig        `file:"audit"`
+	CORS         CORSConfig         `file:"cors"`
+	Reload       ReloadConfig       `file:"reload"`
+	Secrets      SecretsConfig      `file:"secrets"`
+	Encryption   EncryptionConfig   `file:"encryption"`
+	TLS          TLSConfig          `file:"tls"`
+	BodyLimit    BodyLimitConfig    `file:"body_limit"`
+	Compression  CompressionConfig  `file:"compression"`
+	Idempotency  IdempotencyConfig  `file:"idempotency"`
+	Maintenance  MaintenanceConfig  `file:"maintenance"`
+	Docs         DocsConfig         `file:"docs"`
+	Static       StaticConfig       `file:"static"`
+	I18n         I18nConfig         `file:"i18n"`
+	Storage      StorageConfig      `file:"storage"`
+	Avatar       AvatarConfig       `file:"avatar"`
+	Profile      ProfileConfig      `file:"profile"`
+	SMS          SMSConfig          `file:"sms"`
+	Mail         MailConfig         `file:"mail"`
+	Push         PushConfig         `file:"push"`
+	Phone        PhoneConfig        `file:"phone"`
+	Disposable   DisposableConfig   `file:"disposable_email"`
+	Registration RegistrationConfig `file:"registration"`
+	EmailChange  EmailChangeConfig  `file:"email_change"`
+	OneTime      OneTimeConfig      `file:"one_time_tokens"`
+	Links        LinksConfig        `file:"links"`
+	Consent      ConsentConfig      `file:"consent"`
+	Admin        AdminConfig        `file:"admin"`
+	Redis        RedisConfig        `file:"redis"`
+	UserCache    UserCacheConfig    `file:"user_cache"`
+	Session      SessionConfig      `file:"session"`
+	Exchange     ExchangeConfig     `file:"token_exchange"`
+	LoginRisk    LoginRiskConfig    `file:"login_risk"`
+	BruteForce   BruteForceConfig   `file:"brute_force"`
+	Inactivity   InactivityConfig   `file:"inactive_accounts"`
+	Retention    RetentionConfig    `file:"retention"`
+	Queue        QueueConfig        `file:"queue"`
+	RateLimit    RateLimitConfig    `file:"rate_limit"`
+	APIKeys      APIKeysConfig      `file:"api_keys"`
+	Notify       NotifyConfig       `file:"notifications"`
+	Startup      StartupConfig      `file:"startup"`
+}
+
+// StartupConfig controls the configuration checks run at startup
+type StartupConfig struct {
+	// Checks is auto, strict, warn or off: whether problems the checks find stop the
+	// service (strict, and auto in production) or are only logged
+	Checks string `env:"STARTUP_CHECKS" file:"checks" default:"auto"`
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port               string        `env:"SERVER_PORT" file:"port" default:"8080"`
+	ShutdownDrainDelay time.Duration `env:"SHUTDOWN_DRAIN_DELAY" file:"shutdown_drain_delay" default:"5s"`
+	// Connection limits guarding against slow or oversized clients
+	ReadHeaderTimeout time.Duration `env:"SERVER_READ_HEADER_TIMEOUT" file:"read_header_timeout" default:"5s"`
+	ReadTimeout       time.Duration `env:"SERVER_READ_TIMEOUT" file:"read_timeout" default:"15s"`
+	WriteTimeout      time.Duration `env:"SERVER_WRITE_TIMEOUT" file:"write_timeout" default:"30s"`
+	IdleTimeout       time.Duration `env:"SERVER_IDLE_TIMEOUT" file:"idle_timeout" default:"120s"`
+	MaxHeaderBytes    int           `env:"SERVER_MAX_HEADER_BYTES" file:"max_header_bytes" default:"1048576"`
+	// RequestTimeout cancels the context of requests running longer, aborting their
+	// database queries; it must end before WriteTimeout so the error still reaches
+	// the client. 0 disables it.
+	RequestTimeout time.Duration `env:"SERVER_REQUEST_TIMEOUT" file:"request_timeout" default:"20s"`
+	// TrustedProxies lists the proxies (IPs or CIDRs) whose X-Forwarded-For and X-Real-IP
+	// headers are believed; requests from anywhere else use the connection's address
+	TrustedProxies []string `env:"TRUSTED_PROXIES" file:"trusted_proxies"`
+}
+
+// TLSConfig holds HTTPS settings. Either a certificate/key pair or autocert domains
+// enable HTTPS; with neither the server speaks plain HTTP.
+type TLSConfig struct {
+	CertFile string `env:"TLS_CERT_FILE" file:"cert_file"`
+	KeyFile  string `env:"TLS_KEY_FILE" file:"key_file"`
+	// AutocertDomains enables Let's Encrypt certificates for the listed host names
+	AutocertDomains  []string `env:"TLS_AUTOCERT_DOMAINS" file:"autocert_domains"`
+	AutocertCacheDir string   `env:"TLS_AUTOCERT_CACHE_DIR" file:"autocert_cache_dir" default:"certs"`
+	AutocertEmail    string   `env:"TLS_AUTOCERT_EMAIL" file:"autocert_email"`
+	// RedirectHTTP starts a listener on HTTPPort that redirects to HTTPS
+	// (always on with autocert, which needs it for ACME challenges)
+	RedirectHTTP bool   `env:"TLS_REDIRECT_HTTP" file:"redirect_http" default:"true"`
+	HTTPPort     string `env:"TLS_HTTP_PORT" file:"http_port" default:"80"`
+}
+
+// Enabled reports whether the server should serve HTTPS
+func (tc TLSConfig) Enabled() bool {
+	return tc.CertFile != "" || tc.AutocertEnabled()
+}
+
+// AutocertEnabled reports whether certificates are obtained from Let's Encrypt
+func (tc TLSConfig) AutocertEnabled() bool {
+	return len(tc.AutocertDomains) > 0
+}
+
+// BodyLimitConfig holds request body size limits
+type BodyLimitConfig struct {
+	MaxBytes       int64 `env:"MAX_BODY_BYTES" file:"max_bytes" default:"1048576"`
+	MaxUploadBytes int64 `env:"MAX_UPLOAD_BODY_BYTES" file:"max_upload_bytes" default:"10485760"`
+	// UploadRoutes lists route patterns that use MaxUploadBytes, relative to the path
+	// the API routes are mounted on (e.g. /profile/avatar for /api/profile/avatar)
+	UploadRoutes []string `env:"UPLOAD_ROUTES" file:"upload_routes" default:"/profile/avatar"`
+}
+
+// CompressionConfig holds response compression settings
+type CompressionConfig struct {
+	Enabled bool `env:"COMPRESSION_ENABLED" file:"enabled" default:"true"`
+	// MinSize is the smallest body in bytes that gets compressed
+	MinSize int `env:"COMPRESSION_MIN_SIZE" file:"min_size" default:"1024"`
+	// Level is the gzip/deflate level (-1 default, 1 fastest .. 9 best)
+	Level int `env:"COMPRESSION_LEVEL" file:"level" default:"-1"`
+	// ContentTypes lists compressible media types; entries ending in "/" match a prefix
+	ContentTypes []string `env:"COMPRESSION_CONTENT_TYPES" file:"content_types" default:"application/json,application/problem+json,text/"`
+	// ExcludeRoutes lists route patterns whose responses are never compressed
+	ExcludeRoutes []string `env:"COMPRESSION_EXCLUDE_ROUTES" file:"exclude_routes"`
+}
+
+// IdempotencyConfig holds Idempotency-Key handling settings
+type IdempotencyConfig struct {
+	Enabled bool `env:"IDEMPOTENCY_ENABLED" file:"enabled" default:"true"`
+	// TTL is how long a stored response can be replayed
+	TTL time.Duration `env:"IDEMPOTENCY_TTL" file:"ttl" default:"24h"`
+}
+
+// MaintenanceConfig holds the initial maintenance mode state (reloadable)
+type MaintenanceConfig struct {
+	Enabled    bool          `env:"MAINTENANCE_MODE" file:"enabled" default:"false" reload:"hot"`
+	RetryAfter time.Duration `env:"MAINTENANCE_RETRY_AFTER" file:"retry_after" default:"5m" reload:"hot"`
+}
+
+// DocsConfig holds API documentation settings
+type DocsConfig struct {
+	// Enabled serves the OpenAPI document and Swagger UI at /api/docs
+	Enabled bool `env:"API_DOCS_ENABLED" file:"enabled" default:"true"`
+}
+
+// AuditConfig exports account activity, such as logins and role changes, to a SIEM
+type AuditConfig struct {
+	// Export is syslog, file or http; empty exports nothing
+	Export string `env:"AUDIT_EXPORT" file:"export"`
+	// Format is json or cef (ArcSight Common Event Format)
+	Format string `env:"AUDIT_FORMAT" file:"format" default:"json"`
+	// SyslogAddress is udp://host:port, tcp://host:port or unix:///path (syslog target)
+	SyslogAddress string `env:"AUDIT_SYSLOG_ADDRESS" file:"syslog_address" default:"udp://127.0.0.1:514"`
+	// File is appended to, one event per line (file target)
+	File string `env:"AUDIT_FILE" file:"file"`
+	// HTTPURL receives POSTed batches of events, authenticated with HTTPToken as a
+	// bearer token when set (http target)
+	HTTPURL   string `env:"AUDIT_HTTP_URL" file:"http_url"`
+	HTTPToken string `env:"AUDIT_HTTP_TOKEN" file:"http_token"`
+	// BufferSize is how many events may wait to be sent; more are dropped
+	BufferSize int `env:"AUDIT_BUFFER_SIZE" file:"buffer_size" default:"1000"`
+}
+
+// StaticConfig serves a frontend build from the API server
+type StaticConfig struct {
+	// Dir holds the build, with an index.html; empty serves no frontend
+	Dir string `env:"STATIC_DIR" file:"dir"`
+	// ImmutablePaths hold fingerprinted assets, which are cached for a year
+	ImmutablePaths []string `env:"STATIC_IMMUTABLE_PATHS" file:"immutable_paths" default:"/assets/,/static/"`
+	// MaxAge is how long other files may be cached; index.html is always revalidated
+	MaxAge time.Duration `env:"STATIC_MAX_AGE" file:"max_age" default:"1h"`
+}
+
+// I18nConfig holds localization settings
+type I18nConfig struct {
+	// DefaultLanguage is used when Accept-Language matches no catalog
+	DefaultLanguage string `env:"I18N_DEFAULT_LANGUAGE" file:"default_language" default:"en"`
+	// LocalesDir holds extra <tag>.json catalogs loaded at startup
+	LocalesDir string `env:"I18N_LOCALES_DIR" file:"locales_dir"`
+}
+
+// StorageConfig selects where uploaded files are stored
+type StorageConfig struct {
+	// Provider is local or s3
+	Provider string `env:"STORAGE_PROVIDER" file:"provider" default:"local"`
+	// LocalDir is the directory uploads are written to (local provider)
+	LocalDir string `env:"STORAGE_LOCAL_DIR" file:"local_dir" default:"./uploads"`
+	// PublicURL is the base URL uploads are served from. Defaults to /uploads, served
+	// by the API, for the local provider and to the bucket URL for s3.
+	PublicURL string `env:"STORAGE_PUBLIC_URL" file:"public_url"`
+	// S3Endpoint, S3Bucket and S3Region locate an S3-compatible bucket (s3 provider)
+	S3Endpoint string `env:"S3_ENDPOINT" file:"s3_endpoint"`
+	S3Bucket   string `env:"S3_BUCKET" file:"s3_bucket"`
+	S3Region   string `env:"S3_REGION" file:"s3_region" default:"us-east-1"`
+	// S3AccessKeyID and S3SecretAccessKey default to the standard AWS env vars
+	S3AccessKeyID     string `env:"S3_ACCESS_KEY_ID" file:"s3_access_key_id"`
+	S3SecretAccessKey string `env:"S3_SECRET_ACCESS_KEY" file:"s3_secret_access_key"`
+}
+
+// AvatarConfig holds avatar processing settings
+type AvatarConfig struct {
+	// Size is the width and height in pixels avatars are cropped and scaled to
+	Size int `env:"AVATAR_SIZE" file:"size" default:"256"`
+	// MaxPixels rejects uploads whose decoded dimensions exceed this many pixels
+	MaxPixels int `env:"AVATAR_MAX_PIXELS" file:"max_pixels" default:"25000000"`
+}
+
+// ProfileConfig declares deployment-specific profile fields stored in user metadata
+type ProfileConfig struct {
+	// Fields are specs of the form name:type[:required|optional[:rules]], with type one of
+	// string, int, number, bool and rules as validator tags separated by ";"
+	Fields []string `env:"PROFILE_FIELDS" file:"fields"`
+	// MinAge and MaxAge bound the age a date of birth may give
+	MinAge int `env:"PROFILE_MIN_AGE" file:"min_age" default:"0"`
+	MaxAge int `env:"PROFILE_MAX_AGE" file:"max_age" default:"130"`
+	// NormalizeAddresses trims and collapses spaces in cities and addresses and
+	// title-cases cities typed all in one case
+	NormalizeAddresses bool `env:"PROFILE_NORMALIZE_ADDRESSES" file:"normalize_addresses" default:"false"`
+	// Genders are the gender options offered besides self_described, which is always
+	// accepted with a free-text description
+	Genders []string `env:"PROFILE_GENDERS" file:"genders" default:"female,male,non_binary,prefer_not_to_say"`
+}
+
+// SMSConfig selects the SMS provider and the phone verification code policy
+type SMSConfig struct {
+	// Provider is twilio, or log to write messages to the application log (development only)
+	Provider string `env:"SMS_PROVIDER" file:"provider" default:"log"`
+	// TwilioAccountSID, TwilioAuthToken and TwilioFrom configure the twilio provider
+	TwilioAccountSID string `env:"TWILIO_ACCOUNT_SID" file:"twilio_account_sid"`
+	TwilioAuthToken  string `env:"TWILIO_AUTH_TOKEN" file:"twilio_auth_token"`
+	TwilioFrom       string `env:"TWILIO_FROM" file:"twilio_from"`
+	// OTPTTL is how long a verification code stays valid
+	OTPTTL time.Duration `env:"SMS_OTP_TTL" file:"otp_ttl" default:"10m"`
+	// OTPMaxAttempts is how many wrong codes invalidate a verification
+	OTPMaxAttempts int `env:"SMS_OTP_MAX_ATTEMPTS" file:"otp_max_attempts" default:"5"`
+	// OTPResendInterval is the minimum time between two codes sent to the same user
+	OTPResendInterval time.Duration `env:"SMS_OTP_RESEND_INTERVAL" file:"otp_resend_interval" default:"1m"`
+}
+
+// MailConfig selects how email is sent
+type MailConfig struct {
+	// Provider is smtp, or log to write messages to the application log (development only)
+	Provider string `env:"MAIL_PROVIDER" file:"provider" default:"log"`
+	From     string `env:"MAIL_FROM" file:"from" default:"no-reply@localhost"`
+	// SMTPHost, SMTPPort, SMTPUsername and SMTPPassword configure the smtp provider;
+	// an empty username disables authentication
+	SMTPHost     string `env:"SMTP_HOST" file:"smtp_host"`
+	SMTPPort     int    `env:"SMTP_PORT" file:"smtp_port" default:"587"`
+	SMTPUsername string `env:"SMTP_USERNAME" file:"smtp_username"`
+	SMTPPassword string `env:"SMTP_PASSWORD" file:"smtp_password"`
+	// ThrottlePerMinute and ThrottlePerHour cap the emails requests can trigger, per
+	// account and per client IP, so nobody's inbox can be flooded; 0 lifts a cap
+	ThrottlePerMinute int64 `env:"MAIL_THROTTLE_PER_MINUTE" file:"throttle_per_minute" default:"1"`
+	ThrottlePerHour   int64 `env:"MAIL_THROTTLE_PER_HOUR" file:"throttle_per_hour" default:"5"`
+}
+
+// PushConfig selects how push notifications reach the devices users register
+type PushConfig struct {
+	// Provider is fcm or apns, or log to write messages to the application log
+	// (development only)
+	Provider string `env:"PUSH_PROVIDER" file:"provider" default:"log"`
+	// FCMCredentialsFile is the service account key (JSON) of the Firebase project;
+	// FCMProjectID defaults to its project
+	FCMCredentialsFile string `env:"PUSH_FCM_CREDENTIALS_FILE" file:"fcm_credentials_file"`
+	FCMProjectID       string `env:"PUSH_FCM_PROJECT_ID" file:"fcm_project_id"`
+	// APNsKeyFile is the token signing key (.p8) with ID APNsKeyID of the Apple
+	// developer team APNsTeamID; APNsTopic is the bundle ID of the app
+	APNsKeyFile string `env:"PUSH_APNS_KEY_FILE" file:"apns_key_file"`
+	APNsKeyID   string `env:"PUSH_APNS_KEY_ID" file:"apns_key_id"`
+	APNsTeamID  string `env:"PUSH_APNS_TEAM_ID" file:"apns_team_id"`
+	APNsTopic   string `env:"PUSH_APNS_TOPIC" file:"apns_topic"`
+	// APNsProduction sends to apps from the App Store and TestFlight rather than
+	// development builds
+	APNsProduction bool `env:"PUSH_APNS_PRODUCTION" file:"apns_production" default:"true"`
+}
+
+// PhoneConfig holds phone number parsing settings
+type PhoneConfig struct {
+	// DefaultRegion is the ISO 3166-1 country code assumed for numbers without a
+	// "+" prefix. Empty requires an international number.
+	DefaultRegion string `env:"PHONE_DEFAULT_REGION" file:"default_region"`
+}
+
+// RegistrationConfig restricts self-service sign-up
+type RegistrationConfig struct {
+	// AllowedDomains limits registration to these email domains (e.g. company.com,
+	// *.company.com for subdomains too); empty allows any domain
+	AllowedDomains []string `env:"REGISTRATION_ALLOWED_DOMAINS" file:"allowed_domains"`
+	// ConfirmTTL is how long a registration can be confirmed when enumeration
+	// protection mails a confirmation link instead of creating the account
+	ConfirmTTL time.Duration `env:"REGISTRATION_CONFIRM_TTL" file:"confirm_ttl" default:"24h"`
+	// ConfirmURL is the page that posts the token to /api/auth/confirm-registration,
+	// absolute or relative to FRONTEND_URL. Empty mails the bare token.
+	ConfirmURL string `env:"REGISTRATION_CONFIRM_URL" file:"confirm_url"`
+}
+
+// EmailChangeConfig controls the links sent to the previous address when users change
+// their email, which revert the change and lock the account
+type EmailChangeConfig struct {
+	// ConfirmTTL is how long the new address can confirm a change
+	ConfirmTTL time.Duration `env:"EMAIL_CONFIRM_TTL" file:"confirm_ttl" default:"24h"`
+	// ConfirmURL is the page that posts the token to /api/auth/confirm-email-change,
+	// absolute or relative to FRONTEND_URL. Empty mails the bare token.
+	ConfirmURL string `env:"EMAIL_CONFIRM_URL" file:"confirm_url"`
+	// RevertTTL is how long the previous address can revert a change
+	RevertTTL time.Duration `env:"EMAIL_REVERT_TTL" file:"revert_ttl" default:"72h"`
+	// RevertURL is the page that posts the token to /api/auth/revert-email-change,
+	// absolute or relative to FRONTEND_URL; the token is appended as the token query
+	// parameter. Empty mails the bare token.
+	RevertURL string `env:"EMAIL_REVERT_URL" file:"revert_url"`
+}
+
+// OneTimeConfig controls the one-time tokens mailed by flows such as email change
+// reverts
+type OneTimeConfig struct {
+	// CleanupInterval is how often expired tokens are deleted
+	CleanupInterval time.Duration `env:"ONE_TIME_TOKEN_CLEANUP_INTERVAL" file:"cleanup_interval" default:"1h"`
+}
+
+// LinksConfig controls the links mailed to users, e.g. login confirmations and email
+// change reverts
+type LinksConfig struct {
+	// FrontendURL is the frontend's base URL, which relative link pages such as
+	// LOGIN_CONFIRM_URL=/confirm-login are resolved against
+	FrontendURL string `env:"FRONTEND_URL" file:"frontend_url"`
+	// SigningKey signs the parameters and expiry of links so the API turns away
+	// tampered or expired links up front; empty leaves links unsigned
+	SigningKey string `env:"LINK_SIGNING_KEY" file:"signing_key"`
+}
+
+// ConsentConfig holds the current legal document versions (reloadable). Users must
+// accept a set version at registration and again whenever it changes; empty versions
+// are not enforced.
+type ConsentConfig struct {
+	TermsVersion   string `env:"CONSENT_TERMS_VERSION" file:"terms_version" reload:"hot"`
+	PrivacyVersion string `env:"CONSENT_PRIVACY_VERSION" file:"privacy_version" reload:"hot"`
+}
+
+// AdminConfig describes the admin account created on startup when no admin exists,
+// so a fresh deployment can reach the admin routes. Empty Email disables it.
+type AdminConfig struct {
+	Email    string `env:"ADMIN_EMAIL" file:"email"`
+	Password string `env:"ADMIN_PASSWORD" file:"password"`
+	Name     string `env:"ADMIN_NAME" file:"name" default:"Administrator"`
+	// AllowedIPs restricts the admin routes to these IPs or CIDR ranges; empty allows all
+	AllowedIPs []string `env:"ADMIN_ALLOWED_IPS" file:"allowed_ips"`
+	// UIEnabled serves the admin web UI at /admin
+	UIEnabled bool `env:"ADMIN_UI_ENABLED" file:"ui_enabled" default:"true"`
+	// UserTags are the tags admins may put on users; empty allows any tag
+	UserTags []string `env:"ADMIN_USER_TAGS" file:"user_tags"`
+	// EventsHistory is how many recent events reconnecting event streams can catch up on
+	EventsHistory int `env:"ADMIN_EVENTS_HISTORY" file:"events_history" default:"100"`
+	// EventsHeartbeat is how often idle event streams get a keepalive comment
+	EventsHeartbeat time.Duration `env:"ADMIN_EVENTS_HEARTBEAT" file:"events_heartbeat" default:"25s"`
+	// FailedLoginBurst failed logins for one user, each within FailedLoginBurstWindow
+	// of the previous one, raise a failed login burst event; 0 raises none
+	FailedLoginBurst       int           `env:"ADMIN_EVENTS_FAILED_LOGIN_BURST" file:"failed_login_burst" default:"5"`
+	FailedLoginBurstWindow time.Duration `env:"ADMIN_EVENTS_FAILED_LOGIN_WINDOW" file:"failed_login_window" default:"5m"`
+}
+
+// userTagPattern matches the tags the API accepts
+var userTagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// AllowedPrefixes parses AllowedIPs; single addresses become one-address ranges
+func (a AdminConfig) AllowedPrefixes() ([]netip.Prefix, error) {
+	return parsePrefixes(a.AllowedIPs)
+}
+
+// parsePrefixes parses IPs and CIDR ranges
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP nor a CIDR range", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// DisposableConfig controls how registrations from disposable email domains are handled
+type DisposableConfig struct {
+	// Mode is block (reject), flag (accept and mark the user) or off
+	Mode string `env:"DISPOSABLE_EMAIL_MODE" file:"mode" default:"flag"`
+	// ListURL is a plain-text domain list merged with the embedded one; empty uses only the embedded list
+	ListURL string `env:"DISPOSABLE_EMAIL_LIST_URL" file:"list_url"`
+	// RefreshInterval is how often ListURL is re-fetched; 0 fetches it once at startup
+	RefreshInterval time.Duration `env:"DISPOSABLE_EMAIL_REFRESH_INTERVAL" file:"refresh_interval" default:"24h"`
+	// Allow lists domains that are never treated as disposable
+	Allow []string `env:"DISPOSABLE_EMAIL_ALLOW" file:"allow"`
+}
+
+// DatabaseConfig holds database connection settings
+type DatabaseConfig struct {
+	DSN string `env:"DB_DSN" file:"dsn"`
+	// ReplicaDSNs are read replicas that serve the user list, user lookups and the
+	// per-request user load of the auth middleware
+	ReplicaDSNs []string `env:"DB_REPLICA_DSNS" file:"replica_dsns"`
+	// Connection pool limits, applied to the primary and to each replica
+	MaxOpenConns    int           `env:"DB_MAX_OPEN_CONNS" file:"max_open_conns" default:"25"`
+	MaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS" file:"max_idle_conns" default:"10"`
+	ConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME" file:"conn_max_lifetime" default:"30m"`
+	ConnMaxIdleTime time.Duration `env:"DB_CONN_MAX_IDLE_TIME" file:"conn_max_idle_time" default:"5m"`
+	// StatementTimeout aborts statements running longer than this on the server; 0 disables it
+	StatementTimeout time.Duration `env:"DB_STATEMENT_TIMEOUT" file:"statement_timeout" default:"0s"`
+	// Retries is how often statements failing with transient errors (connection
+	// failures, deadlocks, serialization failures) are retried, waiting RetryDelay
+	// before the first retry and twice as long before each one after
+	Retries    int           `env:"DB_RETRIES" file:"retries" default:"2"`
+	RetryDelay time.Duration `env:"DB_RETRY_DELAY" file:"retry_delay" default:"50ms"`
+	// BreakerThreshold consecutive connection failures open the circuit breaker, which
+	// then fails statements right away for BreakerCooldown; 0 disables it
+	BreakerThreshold int           `env:"DB_BREAKER_THRESHOLD" file:"breaker_threshold" default:"5"`
+	BreakerCooldown  time.Duration `env:"DB_BREAKER_COOLDOWN" file:"breaker_cooldown" default:"10s"`
+}
+
+// RedisConfig locates the Redis server shared by the instances; empty URL means none
+type RedisConfig struct {
+	URL string `env:"REDIS_URL" file:"url"` // e.g. redis://:password@localhost:6379/0
+}
+
+// UserCacheConfig controls the cache of authenticated users in AuthMiddleware
+type UserCacheConfig struct {
+	// Backend is memory (per instance), redis (shared) or off
+	Backend string        `env:"USER_CACHE_BACKEND" file:"backend" default:"memory"`
+	TTL     time.Duration `env:"USER_CACHE_TTL" file:"ttl" default:"30s"`
+	// Size caps the number of users kept by the memory backend
+	Size int `env:"USER_CACHE_SIZE" file:"size" default:"10000"`
+}
+
+// SessionConfig controls where refresh token sessions are kept
+type SessionConfig struct {
+	// Store is database or redis; revoked access tokens are shared through Redis
+	// whenever REDIS_URL is set
+	Store string `env:"SESSION_STORE" file:"store" default:"database"`
+	// Sliding lets every refresh extend the session by the refresh token lifetime, up
+	// to MaxLifetime after login. Otherwise a session ends one refresh token lifetime
+	// after login, however often it is refreshed.
+	Sliding     bool          `env:"SESSION_SLIDING" file:"sliding" default:"false"`
+	MaxLifetime time.Duration `env:"SESSION_MAX_LIFETIME" file:"max_lifetime" default:"720h"`
+	// RefreshGracePeriod is how long a used refresh token still answers with the
+	// tokens it was exchanged for, so clients refreshing in parallel aren't signed
+	// out; 0 disables it
+	RefreshGracePeriod time.Duration `env:"REFRESH_GRACE_PERIOD" file:"refresh_grace_period" default:"10s"`
+}
+
+// ExchangeConfig controls the token exchange endpoint (RFC 8693), which lets trusted
+// services trade a user's access token for a narrower one to call downstream APIs
+type ExchangeConfig struct {
+	// Clients lists the services allowed to exchange tokens as id:secret pairs; the
+	// endpoint is disabled while it is empty
+	Clients []string `env:"TOKEN_EXCHANGE_CLIENTS" file:"clients"`
+	// Audiences lists the downstream APIs exchanged tokens may be issued for
+	Audiences []string `env:"TOKEN_EXCHANGE_AUDIENCES" file:"audiences"`
+	// TTL is the lifetime of exchanged tokens; they never outlive the original token
+	TTL time.Duration `env:"TOKEN_EXCHANGE_TTL" file:"ttl" default:"5m"`
+}
+
+// Enabled reports whether any client may exchange tokens
+func (e ExchangeConfig) Enabled() bool {
+	return len(e.Clients) > 0
+}
+
+// ClientSecrets returns the configured client secrets by client ID
+func (e ExchangeConfig) ClientSecrets() map[string]string {
+	secrets := make(map[string]string, len(e.Clients))
+	for _, client := range e.Clients {
+		id, secret, _ := strings.Cut(client, ":")
+		secrets[id] = secret
+	}
+	return secrets
+}
+
+// LoginRiskConfig controls suspicious login detection. Logins are located with a
+// MaxMind-format GeoIP database and compared with the user's earlier logins.
+type LoginRiskConfig struct {
+	// Action is off, flag (record suspicious logins) or confirm (also hold back tokens
+	// until the user confirms the login from an email)
+	Action string `env:"LOGIN_RISK_ACTION" file:"action" default:"flag"`
+	// GeoIPDB is a City or Country database, GeoIPASNDB an optional ASN database;
+	// nothing is detected without GeoIPDB
+	GeoIPDB    string `env:"GEOIP_DB" file:"geoip_db"`
+	GeoIPASNDB string `env:"GEOIP_ASN_DB" file:"geoip_asn_db"`
+	// MaxTravelSpeed in km/h; faster travel between two logins is impossible travel
+	MaxTravelSpeed float64 `env:"LOGIN_MAX_TRAVEL_SPEED" file:"max_travel_speed" default:"1000"`
+	// ConfirmTTL is how long a login confirmation link stays valid
+	ConfirmTTL time.Duration `env:"LOGIN_CONFIRM_TTL" file:"confirm_ttl" default:"30m"`
+	// ConfirmURL is the page that posts the token to /api/auth/confirm-login, absolute
+	// or relative to FRONTEND_URL; the token is appended as the token query parameter.
+	// Empty mails the bare token.
+	ConfirmURL string `env:"LOGIN_CONFIRM_URL" file:"confirm_url"`
+}
+
+// Enabled reports whether logins are located and assessed
+func (l LoginRiskConfig) Enabled() bool {
+	return l.Action != "off" && l.GeoIPDB != ""
+}
+
+// BruteForceConfig controls the per-IP backoff on sign-in routes. Failures are counted
+// across all accounts and shared through Redis whenever REDIS_URL is set.
+type BruteForceConfig struct {
+	Enabled bool `env:"IP_BACKOFF_ENABLED" file:"enabled" default:"true"`
+	// FreeAttempts failed sign-ins are tolerated before an IP has to wait
+	FreeAttempts int64 `env:"IP_BACKOFF_FREE_ATTEMPTS" file:"free_attempts" default:"10"`
+	// Window is how long an IP must stay quiet before its failures are forgotten
+	Window time.Duration `env:"IP_BACKOFF_WINDOW" file:"window" default:"15m"`
+	// BaseDelay doubles with every further failure, up to MaxDelay
+	BaseDelay time.Duration `env:"IP_BACKOFF_BASE_DELAY" file:"base_delay" default:"1s"`
+	MaxDelay  time.Duration `env:"IP_BACKOFF_MAX_DELAY" file:"max_delay" default:"5m"`
+	// BanThreshold failures ban the IP for BanDuration
+	BanThreshold int64         `env:"IP_BAN_THRESHOLD" file:"ban_threshold" default:"100"`
+	BanDuration  time.Duration `env:"IP_BAN_DURATION" file:"ban_duration" default:"1h"`
+}
+
+// RateLimitConfig controls how many requests each caller may make per window. Counts
+// are shared through Redis whenever REDIS_URL is set.
+type RateLimitConfig struct {
+	Enabled bool          `env:"RATE_LIMIT_ENABLED" file:"enabled" default:"false" reload:"hot"`
+	Window  time.Duration `env:"RATE_LIMIT_WINDOW" file:"window" default:"1m" reload:"hot"`
+	// Tiers maps tier names to requests per window ("tier:limit"; 0 is unlimited).
+	// anonymous applies to callers told apart by IP and user to signed-in users; a
+	// tier named after a role applies to that role's users, the most generous winning.
+	Tiers []string `env:"RATE_LIMIT_TIERS" file:"tiers" default:"anonymous:60,user:300,admin:1200" reload:"hot"`
+	// APIKeys assigns API keys, sent as X-API-Key, to tiers ("sha256-hex:tier"). Only
+	// hashes of the keys are configured.
+	APIKeys []string `env:"RATE_LIMIT_API_KEYS" file:"api_keys" reload:"hot"`
+}
+
+// TierLimits parses Tiers
+func (r RateLimitConfig) TierLimits() (map[string]int64, error) {
+	limits := make(map[string]int64, len(r.Tiers))
+	for _, entry := range r.Tiers {
+		name, value, ok := strings.Cut(entry, ":")
+		limit, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if !ok || strings.TrimSpace(name) == "" || err != nil || limit < 0 {
+			return nil, fmt.Errorf("%q is not a tier:limit pair", entry)
+		}
+		limits[strings.TrimSpace(name)] = limit
+	}
+	return limits, nil
+}
+
+// APIKeyTiers parses APIKeys into tiers by lower-case key hash
+func (r RateLimitConfig) APIKeyTiers() (map[string]string, error) {
+	tiers := make(map[string]string, len(r.APIKeys))
+	for _, entry := range r.APIKeys {
+		hash, tier, ok := strings.Cut(entry, ":")
+		hash = strings.ToLower(strings.TrimSpace(hash))
+		if _, err := hex.DecodeString(hash); !ok || err != nil || len(hash) != 64 || strings.TrimSpace(tier) == "" {
+			return nil, fmt.Errorf("%q is not a sha256-hex:tier pair", entry)
+		}
+		tiers[hash] = strings.TrimSpace(tier)
+	}
+	return tiers, nil
+}
+
+// APIKeysConfig controls the metering of API keys managed through /api/apikeys
+type APIKeysConfig struct {
+	// SyncInterval is how often request counts are written to the daily rollups and
+	// new or revoked keys picked up from other instances. Monthly quotas are shared
+	// between instances at this pace.
+	SyncInterval time.Duration `env:"API_KEY_SYNC_INTERVAL" file:"sync_interval" default:"30s"`
+}
+
+// NotifyConfig controls the WebSocket connections users receive account notifications on
+type NotifyConfig struct {
+	// AuthTimeout is how long a connection opened without an Authorization header may
+	// take to send its token
+	AuthTimeout time.Duration `env:"NOTIFICATIONS_AUTH_TIMEOUT" file:"auth_timeout" default:"10s"`
+	// PingInterval is how often connections are pinged to keep them open through proxies
+	PingInterval time.Duration `env:"NOTIFICATIONS_PING_INTERVAL" file:"ping_interval" default:"30s"`
+}
+
+// InactivityConfig controls the expiry of unused accounts. Owners are warned by email,
+// and accounts still unused after the grace period are suspended or deleted.
+type InactivityConfig struct {
+	// AfterMonths without a login or token refresh make an account inactive; 0 disables
+	// the job
+	AfterMonths int           `env:"INACTIVE_AFTER_MONTHS" file:"after_months" default:"0"`
+	GracePeriod time.Duration `env:"INACTIVE_GRACE_PERIOD" file:"grace_period" default:"720h"`
+	// Action is suspend or delete (soft delete)
+	Action string `env:"INACTIVE_ACTION" file:"action" default:"suspend"`
+	// CheckInterval is how often accounts are checked
+	CheckInterval time.Duration `env:"INACTIVE_CHECK_INTERVAL" file:"check_interval" default:"24h"`
+	// ExemptRoles never expire, so the last admin can't be locked out
+	ExemptRoles []string `env:"INACTIVE_EXEMPT_ROLES" file:"exempt_roles" default:"admin"`
+}
+
+// Enabled reports whether inactive accounts expire
+func (ic InactivityConfig) Enabled() bool {
+	return ic.AfterMonths > 0
+}
+
+// RetentionConfig limits how long personal data is kept. Periods are in days; 0 keeps
+// the data forever.
+type RetentionConfig struct {
+	// ActivityDays is how long account activity (the audit trail) is kept
+	ActivityDays int `env:"RETENTION_ACTIVITY_DAYS" file:"activity_days" default:"0"`
+	// LoginHistoryDays is how long login events are kept
+	LoginHistoryDays int `env:"RETENTION_LOGIN_HISTORY_DAYS" file:"login_history_days" default:"0"`
+	// DeletedUserDays is how long soft-deleted users are kept before they are erased
+	// with all their data
+	DeletedUserDays int `env:"RETENTION_DELETED_USER_DAYS" file:"deleted_user_days" default:"0"`
+	// CheckInterval is how often expired data is purged
+	CheckInterval time.Duration `env:"RETENTION_CHECK_INTERVAL" file:"check_interval" default:"24h"`
+	// DryRun only logs what would be purged
+	DryRun bool `env:"RETENTION_DRY_RUN" file:"dry_run" default:"false"`
+}
+
+// Enabled reports whether any data expires
+func (rc RetentionConfig) Enabled() bool {
+	return rc.ActivityDays > 0 || rc.LoginHistoryDays > 0 || rc.DeletedUserDays > 0
+}
+
+// QueueConfig controls the background job queue, kept in the jobs table. While it is
+// enabled, emails are sent by the queue workers rather than during requests.
+type QueueConfig struct {
+	Enabled bool `env:"QUEUE_ENABLED" file:"enabled" default:"true"`
+	// Workers is how many jobs each instance runs at once
+	Workers int `env:"QUEUE_WORKERS" file:"workers" default:"2"`
+	// PollInterval is how often idle workers look for jobs queued by other instances
+	// or due for a retry
+	PollInterval time.Duration `env:"QUEUE_POLL_INTERVAL" file:"poll_interval" default:"5s"`
+	// JobTimeout bounds one attempt; jobs of a crashed worker are retried after it
+	JobTimeout time.Duration `env:"QUEUE_JOB_TIMEOUT" file:"job_timeout" default:"1m"`
+	// MaxAttempts failed attempts mark a job as failed. Retries wait RetryDelay,
+	// doubling after every attempt.
+	MaxAttempts int           `env:"QUEUE_MAX_ATTEMPTS" file:"max_attempts" default:"5"`
+	RetryDelay  time.Duration `env:"QUEUE_RETRY_DELAY" file:"retry_delay" default:"30s"`
+}
+
+// JWTConfig holds token signing settings
+type JWTConfig struct {
+	// Format is jwt (HS256), paseto-local (PASETO v4, encrypted), paseto-public
+	// (PASETO v4, Ed25519-signed) or opaque (random tokens kept in the session store)
+	Format string `env:"TOKEN_FORMAT" file:"format" default:"jwt"`
+	Secret string `env:"JWT_SECRET" file:"secret"`
+	// PreviousSecret is the outgoing secret during a rotation: tokens signed with it
+	// still validate, but new tokens are signed with Secret
+	PreviousSecret string `env:"JWT_SECRET_PREVIOUS" file:"secret_previous"`
+	// PasetoKey is hex: a 32-byte key for paseto-local, an Ed25519 seed (32 bytes) or
+	// private key (64 bytes) for paseto-public
+	PasetoKey  string        `env:"PASETO_KEY" file:"paseto_key"`
+	AccessTTL  time.Duration `env:"ACCESS_TOKEN_TTL" file:"access_token_ttl" default:"15m" reload:"hot"`
+	RefreshTTL time.Duration `env:"REFRESH_TOKEN_TTL" file:"refresh_token_ttl" default:"168h" reload:"hot"`
+	// Issuer is set as iss and required on every token
+	Issuer string `env:"JWT_ISSUER" file:"issuer" default:"um-api"`
+	// Audience, when set, is signed into tokens as aud. Tokens are then only accepted
+	// if their aud contains it or one of AcceptedAudiences.
+	Audience          string   `env:"JWT_AUDIENCE" file:"audience"`
+	AcceptedAudiences []string `env:"JWT_ACCEPTED_AUDIENCES" file:"accepted_audiences"`
+	// Leeway tolerates clock skew between servers when checking exp, nbf and iat
+	Leeway time.Duration `env:"JWT_LEEWAY" file:"leeway" default:"0s"`
+}
+
+// Paseto reports whether tokens are PASETO rather than JWT
+func (j JWTConfig) Paseto() bool {
+	return strings.HasPrefix(j.Format, "paseto-")
+}
+
+// Audiences returns every aud value a token may carry to be accepted
+func (j JWTConfig) Audiences() []string {
+	if j.Audience == "" {
+		return j.AcceptedAudiences
+	}
+	return append([]string{j.Audience}, j.AcceptedAudiences...)
+}
+
+// AuthConfig controls how authenticated requests are resolved to users
+type AuthConfig struct {
+	// Mode is database (load the user on every request) or claims (trust the identity
+	// and roles in the access token; routes needing the stored user load it)
+	Mode string `env:"AUTH_MODE" file:"mode" default:"database"`
+	// StepUpMaxAge is how recently the user must have entered their password to change
+	// emails or roles and delete accounts
+	StepUpMaxAge time.Duration `env:"STEP_UP_MAX_AGE" file:"step_up_max_age" default:"10m"`
+	// VerifiedEmailRoutes lists routes ("METHOD /route/pattern") closed to users whose
+	// email address is not verified
+	VerifiedEmailRoutes []string `env:"VERIFIED_EMAIL_ROUTES" file:"verified_email_routes"`
+	// EnumerationProtection answers login, registration and email changes the same way
+	// whether or not the email belongs to an account; registration then confirms the
+	// address by mail before creating the account. Internal tools may prefer explicit
+	// errors.
+	EnumerationProtection bool `env:"ENUMERATION_PROTECTION" file:"enumeration_protection" default:"true"`
+	// TwoFactorRoles lists roles whose users must use two-factor authentication. Until
+	// they enroll, their logins only grant a token for the 2FA setup routes.
+	TwoFactorRoles []string `env:"TWO_FACTOR_REQUIRED_ROLES" file:"two_factor_required_roles"`
+	// TwoFactorIssuer names the service in authenticator apps
+	TwoFactorIssuer string `env:"TWO_FACTOR_ISSUER" file:"two_factor_issuer" default:"User Management"`
+	// PasswordMaxAge makes passwords expire this long after they were set; 0 never.
+	// Expired passwords must be changed before anything else.
+	PasswordMaxAge time.Duration `env:"PASSWORD_MAX_AGE" file:"password_max_age" default:"0s"`
+	// PasswordExpiryWarning is how long before expiry responses carry a Password-Expires header
+	PasswordExpiryWarning time.Duration `env:"PASSWORD_EXPIRY_WARNING" file:"password_expiry_warning" default:"168h"`
+}
+
+// ClaimsOnly reports whether requests are authenticated from token claims alone
+func (a AuthConfig) ClaimsOnly() bool {
+	return a.Mode == "claims"
+}
+
+// AccessLogConfig holds access log settings
+type AccessLogConfig struct {
+	// SampleRate is the fraction (0..1) of successful requests that are logged
+	SampleRate float64 `env:"ACCESS_LOG_SAMPLE_RATE" file:"sample_rate" default:"1"`
+	// ExcludePaths lists request paths that are never logged
+	ExcludePaths []string `env:"ACCESS_LOG_EXCLUDE_PATHS" file:"exclude_paths" default:"/healthz,/readyz"`
+}
+
+// LogConfig holds application log settings. Only the level is reloadable.
+type LogConfig struct {
+	// Level is one of debug, info, warn or error
+	Level string `env:"LOG_LEVEL" file:"level" default:"info" reload:"hot"`
+	// Redact masks personal data and credentials in all log output
+	Redact bool `env:"LOG_REDACT" file:"redact" default:"true"`
+	// RedactRules are the built-in rules applied: email, phone and token
+	RedactRules []string `env:"LOG_REDACT_RULES" file:"redact_rules" default:"email,phone,token"`
+	// RedactPatterns are extra regular expressions whose matches are masked
+	RedactPatterns []string `env:"LOG_REDACT_PATTERNS" file:"redact_patterns"`
+}
+
+// SlogLevel converts the configured level into a slog.Level
+func (lc LogConfig) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(lc.Level)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// CORSConfig holds cross-origin resource sharing settings (reloadable)
+type CORSConfig struct {
+	// AllowedOrigins lists origins allowed to call the API; "*" allows any origin
+	AllowedOrigins []string `env:"CORS_ALLOWED_ORIGINS" file:"allowed_origins" default:"*" reload:"hot"`
+}
+
+// ReloadConfig controls runtime reloading of the reloadable settings
+type ReloadConfig struct {
+	// Interval is how often the config file is checked for changes; 0 disables polling (SIGHUP still works)
+	Interval time.Duration `env:"CONFIG_RELOAD_INTERVAL" file:"interval" default:"10s"`
+}
+
+// SecretsConfig selects where JWT_SECRET and DB_DSN are read from
+type SecretsConfig struct {
+	// Provider is one of env, file, vault or aws
+	Provider string `env:"SECRETS_PROVIDER" file:"provider" default:"env"`
+	// RefreshInterval is how often secrets are re-fetched; 0 disables refreshing
+	RefreshInterval time.Duration `env:"SECRETS_REFRESH_INTERVAL" file:"refresh_interval" default:"0s"`
+	// FileDir is the directory holding one file per secret (file provider)
+	FileDir string `env:"SECRETS_FILE_DIR" file:"file_dir" default:"/run/secrets"`
+	// VaultAddr, VaultToken and VaultPath locate a KV v2 secret (vault provider)
+	VaultAddr  string `env:"VAULT_ADDR" file:"vault_addr"`
+	VaultToken string `env:"VAULT_TOKEN" file:"vault_token"`
+	VaultPath  string `env:"VAULT_SECRET_PATH" file:"vault_path"`
+	// AWSRegion and AWSSecretID locate a Secrets Manager secret (aws provider)
+	AWSRegion   string `env:"AWS_REGION" file:"aws_region"`
+	AWSSecretID string `env:"AWS_SECRET_ID" file:"aws_secret_id"`
+}
+
+// EncryptionConfig encrypts phone numbers, addresses and dates of birth at rest.
+// Data keys are stored wrapped by a key encryption key held locally, in Vault's
+// transit engine or in AWS KMS; Vault and KMS reuse VAULT_ADDR, VAULT_TOKEN and
+// AWS_REGION from the secrets settings.
+type EncryptionConfig struct {
+	// KeyProvider is local, vault or aws; empty stores the fields in plain text
+	KeyProvider string `env:"ENCRYPTION_KEY_PROVIDER" file:"key_provider"`
+	// DataKeys are id:wrapped-key pairs. The first encrypts new values, the others
+	// only decrypt values written before a rotation.
+	DataKeys []string `env:"ENCRYPTION_DATA_KEYS" file:"data_keys"`
+	// MasterKey is the base64 encoded 32 byte key encryption key (local provider)
+	MasterKey string `env:"ENCRYPTION_MASTER_KEY" file:"master_key"`
+	// VaultMount and VaultKey name the transit engine and key (vault provider)
+	VaultMount string `env:"ENCRYPTION_VAULT_MOUNT" file:"vault_mount" default:"transit"`
+	VaultKey   string `env:"ENCRYPTION_VAULT_KEY" file:"vault_key"`
+	// KMSKeyID is the ID, ARN or alias of the KMS key (aws provider)
+	KMSKeyID string `env:"ENCRYPTION_KMS_KEY_ID" file:"kms_key_id"`
+	// IndexKey is the wrapped key of the email blind index. It can't be rotated
+	// without re-indexing every user.
+	IndexKey string `env:"ENCRYPTION_INDEX_KEY" file:"index_key"`
+	// Email encrypts emails too; logins and uniqueness checks then use the blind index
+	Email bool `env:"ENCRYPTION_EMAIL" file:"email" default:"false"`
+}
+
+// IsProduction reports whether the service runs in the production environment
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// Validate checks that required values are present and all values are within range
+func (c *Config) Validate() error {
+	var errs []error
+
+	// With an external secret store these are resolved after loading
+	if c.Secrets.Provider == "env" {
+		if c.Database.DSN == "" {
+			errs = append(errs, errors.New("DB_DSN is required"))
+		}
+		if c.JWT.Secret == "" && c.JWT.Format == "jwt" {
+			errs = append(errs, errors.New("JWT_SECRET is required"))
+		}
+		if c.JWT.PasetoKey == "" && c.JWT.Paseto() {
+			errs = append(errs, errors.New("PASETO_KEY is required for PASETO tokens"))
+		}
+	}
+	switch c.Startup.Checks {
+	case "auto", "strict", "warn", "off":
+	default:
+		errs = append(errs, fmt.Errorf("STARTUP_CHECKS must be one of auto, strict, warn, off, got %q", c.Startup.Checks))
+	}
+	if c.JWT.AccessTTL < time.Minute || c.JWT.AccessTTL > 24*time.Hour {
+		errs = append(errs, fmt.Errorf("ACCESS_TOKEN_TTL must be between 1m and 24h, got %s", c.JWT.AccessTTL))
+	}
+	if c.JWT.RefreshTTL <= c.JWT.AccessTTL {
+		errs = append(errs, errors.New("REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL"))
+	}
+	if c.JWT.Leeway < 0 || c.JWT.Leeway > 5*time.Minute {
+		errs = append(errs, fmt.Errorf("JWT_LEEWAY must be between 0s and 5m, got %s", c.JWT.Leeway))
+	}
+	switch c.JWT.Format {
+	case "jwt", "paseto-local", "paseto-public", "opaque":
+	default:
+		errs = append(errs, fmt.Errorf("TOKEN_FORMAT must be one of jwt, paseto-local, paseto-public, opaque, got %q", c.JWT.Format))
+	}
+	if c.JWT.Issuer == "" {
+		errs = append(errs, errors.New("JWT_ISSUER must not be empty"))
+	}
+	if len(c.JWT.AcceptedAudiences) > 0 && c.JWT.Audience == "" {
+		errs = append(errs, errors.New("JWT_ACCEPTED_AUDIENCES requires JWT_AUDIENCE, or the service would reject its own tokens"))
+	}
+	switch c.Audit.Export {
+	case "", "syslog":
+	case "file":
+		if c.Audit.File == "" {
+			errs = append(errs, errors.New("AUDIT_FILE is required when AUDIT_EXPORT is file"))
+		}
+	case "http":
+		if u, err := url.Parse(c.Audit.HTTPURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("AUDIT_HTTP_URL must be an http(s) URL when AUDIT_EXPORT is http"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("AUDIT_EXPORT must be one of syslog, file, http or empty, got %q", c.Audit.Export))
+	}
+	if c.Audit.Format != "json" && c.Audit.Format != "cef" {
+		errs = append(errs, fmt.Errorf("AUDIT_FORMAT must be json or cef, got %q", c.Audit.Format))
+	}
+	if c.Audit.BufferSize < 1 {
+		errs = append(errs, errors.New("AUDIT_BUFFER_SIZE must be at least 1"))
+	}
+	if c.Static.MaxAge < 0 {
+		errs = append(errs, errors.New("STATIC_MAX_AGE must not be negative"))
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative"))
+	}
+	if c.Database.MaxOpenConns == 1 {
+		// The migration lock holds a connection while the migrations use another
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNS must be 0 (unlimited) or at least 2"))
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS"))
+	}
+	if c.Database.ConnMaxLifetime < 0 || c.Database.ConnMaxIdleTime < 0 || c.Database.StatementTimeout < 0 {
+		errs = append(errs, errors.New("DB_CONN_MAX_LIFETIME, DB_CONN_MAX_IDLE_TIME and DB_STATEMENT_TIMEOUT must not be negative"))
+	}
+	if c.Database.Retries < 0 || c.Database.BreakerThreshold < 0 {
+		errs = append(errs, errors.New("DB_RETRIES and DB_BREAKER_THRESHOLD must not be negative"))
+	}
+	if c.Database.Retries > 0 && c.Database.RetryDelay <= 0 {
+		errs = append(errs, errors.New("DB_RETRY_DELAY must be positive when DB_RETRIES is set"))
+	}
+	if c.Database.BreakerThreshold > 0 && c.Database.BreakerCooldown <= 0 {
+		errs = append(errs, errors.New("DB_BREAKER_COOLDOWN must be positive when DB_BREAKER_THRESHOLD is set"))
+	}
+	switch c.Auth.Mode {
+	case "database", "claims":
+	default:
+		errs = append(errs, fmt.Errorf("AUTH_MODE must be one of database, claims, got %q", c.Auth.Mode))
+	}
+	if c.Auth.StepUpMaxAge <= 0 {
+		errs = append(errs, errors.New("STEP_UP_MAX_AGE must be positive"))
+	}
+	for _, route := range c.Auth.VerifiedEmailRoutes {
+		if method, path, ok := strings.Cut(route, " "); !ok || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Errorf("VERIFIED_EMAIL_ROUTES entry %q must look like \"POST /api/profile/avatar\"", route))
+		}
+	}
+	if c.Auth.PasswordMaxAge < 0 || c.Auth.PasswordExpiryWarning < 0 {
+		errs = append(errs, errors.New("PASSWORD_MAX_AGE and PASSWORD_EXPIRY_WARNING must not be negative"))
+	}
+	if c.Auth.TwoFactorIssuer == "" || strings.Contains(c.Auth.TwoFactorIssuer, ":") {
+		errs = append(errs, errors.New("TWO_FACTOR_ISSUER must be non-empty and must not contain a colon"))
+	}
+	switch c.UserCache.Backend {
+	case "memory", "off":
+	case "redis":
+		if c.Redis.URL == "" {
+			errs = append(errs, errors.New("REDIS_URL is required for the redis user cache backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("USER_CACHE_BACKEND must be one of memory, redis, off, got %q", c.UserCache.Backend))
+	}
+	if c.UserCache.TTL <= 0 || c.UserCache.Size <= 0 {
+		errs = append(errs, errors.New("USER_CACHE_TTL and USER_CACHE_SIZE must be positive"))
+	}
+	switch c.Session.Store {
+	case "database":
+	case "redis":
+		if c.Redis.URL == "" {
+			errs = append(errs, errors.New("REDIS_URL is required for the redis session store"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("SESSION_STORE must be one of database, redis, got %q", c.Session.Store))
+	}
+	if c.Session.MaxLifetime <= 0 {
+		errs = append(errs, errors.New("SESSION_MAX_LIFETIME must be positive"))
+	}
+	if c.Session.RefreshGracePeriod < 0 || c.Session.RefreshGracePeriod > time.Minute {
+		errs = append(errs, fmt.Errorf("REFRESH_GRACE_PERIOD must be between 0s and 1m, got %s", c.Session.RefreshGracePeriod))
+	}
+	for _, client := range c.Exchange.Clients {
+		id, secret, ok := strings.Cut(client, ":")
+		if !ok || id == "" || len(secret) < 16 {
+			// Don't echo the entry, it holds a secret
+			errs = append(errs, errors.New("TOKEN_EXCHANGE_CLIENTS entries must be id:secret with a secret of at least 16 characters"))
+			break
+		}
+	}
+	if c.Exchange.Enabled() && len(c.Exchange.Audiences) == 0 {
+		errs = append(errs, errors.New("TOKEN_EXCHANGE_AUDIENCES is required when TOKEN_EXCHANGE_CLIENTS is set"))
+	}
+	if c.Exchange.TTL <= 0 || c.Exchange.TTL > c.JWT.AccessTTL {
+		errs = append(errs, errors.New("TOKEN_EXCHANGE_TTL must be positive and at most ACCESS_TOKEN_TTL"))
+	}
+	if c.Server.Port == "" {
+		errs = append(errs, errors.New("SERVER_PORT must not be empty"))
+	}
+	if c.Server.ShutdownDrainDelay < 0 {
+		errs = append(errs, errors.New("SHUTDOWN_DRAIN_DELAY must not be negative"))
+	}
+	if c.Server.ReadHeaderTimeout <= 0 || c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("SERVER_READ_HEADER_TIMEOUT, SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT and SERVER_IDLE_TIMEOUT must be positive"))
+	}
+	if c.Server.RequestTimeout < 0 || c.Server.RequestTimeout >= c.Server.WriteTimeout {
+		errs = append(errs, errors.New("SERVER_REQUEST_TIMEOUT must not be negative and must be shorter than SERVER_WRITE_TIMEOUT"))
+	}
+	if c.Server.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("SERVER_MAX_HEADER_BYTES must be positive"))
+	}
+	if _, err := parsePrefixes(c.Server.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %w", err))
+	}
+	if c.AccessLog.SampleRate < 0 || c.AccessLog.SampleRate > 1 {
+		errs = append(errs, fmt.Errorf("ACCESS_LOG_SAMPLE_RATE must be between 0 and 1, got %v", c.AccessLog.SampleRate))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be one of debug, info, warn, error, got %q", c.Log.Level))
+	}
+	for _, rule := range c.Log.RedactRules {
+		if rule != "email" && rule != "phone" && rule != "token" {
+			errs = append(errs, fmt.Errorf("LOG_REDACT_RULES entries must be email, phone or token, got %q", rule))
+		}
+	}
+	for _, pattern := range c.Log.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("LOG_REDACT_PATTERNS entry %q: %w", pattern, err))
+		}
+	}
+	switch c.Secrets.Provider {
+	case "env", "file":
+	case "vault":
+		if c.Secrets.VaultAddr == "" || c.Secrets.VaultToken == "" || c.Secrets.VaultPath == "" {
+			errs = append(errs, errors.New("VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH are required for the vault secrets provider"))
+		}
+	case "aws":
+		if c.Secrets.AWSRegion == "" || c.Secrets.AWSSecretID == "" {
+			errs = append(errs, errors.New("AWS_REGION and AWS_SECRET_ID are required for the aws secrets provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("SECRETS_PROVIDER must be one of env, file, vault, aws, got %q", c.Secrets.Provider))
+	}
+	if c.Secrets.RefreshInterval < 0 {
+		errs = append(errs, errors.New("SECRETS_REFRESH_INTERVAL must not be negative"))
+	}
+	switch c.Encryption.KeyProvider {
+	case "":
+	case "local":
+		// With an external secret store the master key is resolved after loading
+		if c.Encryption.MasterKey == "" && c.Secrets.Provider == "env" {
+			errs = append(errs, errors.New("ENCRYPTION_MASTER_KEY is required for the local encryption key provider"))
+		}
+	case "vault":
+		if c.Secrets.VaultAddr == "" || c.Secrets.VaultToken == "" || c.Encryption.VaultKey == "" {
+			errs = append(errs, errors.New("VAULT_ADDR, VAULT_TOKEN and ENCRYPTION_VAULT_KEY are required for the vault encryption key provider"))
+		}
+	case "aws":
+		if c.Secrets.AWSRegion == "" || c.Encryption.KMSKeyID == "" {
+			errs = append(errs, errors.New("AWS_REGION and ENCRYPTION_KMS_KEY_ID are required for the aws encryption key provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("ENCRYPTION_KEY_PROVIDER must be one of local, vault, aws or empty, got %q", c.Encryption.KeyProvider))
+	}
+	if c.Encryption.KeyProvider != "" {
+		seen := make(map[string]bool, len(c.Encryption.DataKeys))
+		for _, entry := range c.Encryption.DataKeys {
+			id, wrapped, ok := strings.Cut(entry, ":")
+			if !ok || id == "" || wrapped == "" {
+				errs = append(errs, fmt.Errorf("ENCRYPTION_DATA_KEYS entries must be id:wrapped-key, got %q", entry))
+			} else if seen[id] {
+				errs = append(errs, fmt.Errorf("ENCRYPTION_DATA_KEYS has key %q twice", id))
+			}
+			seen[id] = true
+		}
+	}
+	if c.Encryption.Email && (c.Encryption.KeyProvider == "" || c.Encryption.IndexKey == "") {
+		errs = append(errs, errors.New("ENCRYPTION_EMAIL requires ENCRYPTION_KEY_PROVIDER and ENCRYPTION_INDEX_KEY"))
+	}
+	if c.BodyLimit.MaxBytes <= 0 || c.BodyLimit.MaxUploadBytes <= 0 {
+		errs = append(errs, errors.New("MAX_BODY_BYTES and MAX_UPLOAD_BODY_BYTES must be positive"))
+	}
+	if c.Compression.MinSize < 0 {
+		errs = append(errs, errors.New("COMPRESSION_MIN_SIZE must not be negative"))
+	}
+	if c.Compression.Level < -1 || c.Compression.Level > 9 {
+		errs = append(errs, errors.New("COMPRESSION_LEVEL must be between -1 and 9"))
+	}
+	if c.Idempotency.TTL <= 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_TTL must be positive"))
+	}
+	if c.Maintenance.RetryAfter < time.Second {
+		errs = append(errs, errors.New("MAINTENANCE_RETRY_AFTER must be at least 1s"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if c.TLS.CertFile != "" && c.TLS.AutocertEnabled() {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS are mutually exclusive"))
+	}
+	if c.I18n.DefaultLanguage == "" {
+		errs = append(errs, errors.New("I18N_DEFAULT_LANGUAGE must not be empty"))
+	}
+	switch c.Storage.Provider {
+	case "local":
+		if c.Storage.LocalDir == "" {
+			errs = append(errs, errors.New("STORAGE_LOCAL_DIR is required for the local storage provider"))
+		}
+	case "s3":
+		if c.Storage.S3Endpoint == "" || c.Storage.S3Bucket == "" {
+			errs = append(errs, errors.New("S3_ENDPOINT and S3_BUCKET are required for the s3 storage provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE_PROVIDER must be one of local, s3, got %q", c.Storage.Provider))
+	}
+	if c.Avatar.Size < 16 || c.Avatar.Size > 2048 {
+		errs = append(errs, errors.New("AVATAR_SIZE must be between 16 and 2048"))
+	}
+	if c.Avatar.MaxPixels <= 0 {
+		errs = append(errs, errors.New("AVATAR_MAX_PIXELS must be positive"))
+	}
+	switch c.SMS.Provider {
+	case "log":
+	case "twilio":
+		if c.SMS.TwilioAccountSID == "" || c.SMS.TwilioAuthToken == "" || c.SMS.TwilioFrom == "" {
+			errs = append(errs, errors.New("TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM are required for the twilio SMS provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("SMS_PROVIDER must be one of log, twilio, got %q", c.SMS.Provider))
+	}
+	switch c.Mail.Provider {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			errs = append(errs, errors.New("SMTP_HOST is required for the smtp mail provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_PROVIDER must be one of log, smtp, got %q", c.Mail.Provider))
+	}
+	if c.Mail.SMTPPort <= 0 || c.Mail.SMTPPort > 65535 {
+		errs = append(errs, errors.New("SMTP_PORT must be between 1 and 65535"))
+	}
+	if c.Mail.ThrottlePerMinute < 0 || c.Mail.ThrottlePerHour < 0 {
+		errs = append(errs, errors.New("MAIL_THROTTLE_PER_MINUTE and MAIL_THROTTLE_PER_HOUR must not be negative"))
+	}
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		errs = append(errs, fmt.Errorf("MAIL_FROM must be an email address: %w", err))
+	}
+	switch c.Push.Provider {
+	case "log":
+	case "fcm":
+		if c.Push.FCMCredentialsFile == "" {
+			errs = append(errs, errors.New("PUSH_FCM_CREDENTIALS_FILE is required for the fcm push provider"))
+		}
+	case "apns":
+		if c.Push.APNsKeyFile == "" || c.Push.APNsKeyID == "" || c.Push.APNsTeamID == "" || c.Push.APNsTopic == "" {
+			errs = append(errs, errors.New("PUSH_APNS_KEY_FILE, PUSH_APNS_KEY_ID, PUSH_APNS_TEAM_ID and PUSH_APNS_TOPIC are required for the apns push provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("PUSH_PROVIDER must be one of log, fcm, apns, got %q", c.Push.Provider))
+	}
+	switch c.LoginRisk.Action {
+	case "off", "flag":
+	case "confirm":
+		if c.LoginRisk.GeoIPDB == "" {
+			errs = append(errs, errors.New("GEOIP_DB is required for LOGIN_RISK_ACTION=confirm"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("LOGIN_RISK_ACTION must be one of off, flag, confirm, got %q", c.LoginRisk.Action))
+	}
+	if c.LoginRisk.MaxTravelSpeed <= 0 || c.LoginRisk.ConfirmTTL <= 0 {
+		errs = append(errs, errors.New("LOGIN_MAX_TRAVEL_SPEED and LOGIN_CONFIRM_TTL must be positive"))
+	}
+	if c.BruteForce.FreeAttempts < 0 {
+		errs = append(errs, errors.New("IP_BACKOFF_FREE_ATTEMPTS must not be negative"))
+	}
+	if c.BruteForce.Window <= 0 || c.BruteForce.BaseDelay <= 0 || c.BruteForce.BanDuration <= 0 {
+		errs = append(errs, errors.New("IP_BACKOFF_WINDOW, IP_BACKOFF_BASE_DELAY and IP_BAN_DURATION must be positive"))
+	}
+	if c.BruteForce.MaxDelay < c.BruteForce.BaseDelay {
+		errs = append(errs, errors.New("IP_BACKOFF_MAX_DELAY must not be shorter than IP_BACKOFF_BASE_DELAY"))
+	}
+	if c.BruteForce.BanThreshold <= c.BruteForce.FreeAttempts {
+		errs = append(errs, errors.New("IP_BAN_THRESHOLD must be greater than IP_BACKOFF_FREE_ATTEMPTS"))
+	}
+	if c.RateLimit.Window <= 0 {
+		errs = append(errs, errors.New("RATE_LIMIT_WINDOW must be positive"))
+	}
+	limits, err := c.RateLimit.TierLimits()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_TIERS: %w", err))
+	}
+	keyTiers, err := c.RateLimit.APIKeyTiers()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_API_KEYS: %w", err))
+	}
+	for _, tier := range keyTiers {
+		if _, ok := limits[tier]; !ok && limits != nil {
+			errs = append(errs, fmt.Errorf("RATE_LIMIT_API_KEYS: tier %q is not in RATE_LIMIT_TIERS", tier))
+		}
+	}
+	if c.APIKeys.SyncInterval <= 0 {
+		errs = append(errs, errors.New("API_KEY_SYNC_INTERVAL must be positive"))
+	}
+	if c.Notify.AuthTimeout <= 0 {
+		errs = append(errs, errors.New("NOTIFICATIONS_AUTH_TIMEOUT must be positive"))
+	}
+	if c.Notify.PingInterval <= 0 {
+		errs = append(errs, errors.New("NOTIFICATIONS_PING_INTERVAL must be positive"))
+	}
+	if c.Inactivity.AfterMonths < 0 {
+		errs = append(errs, errors.New("INACTIVE_AFTER_MONTHS must not be negative"))
+	}
+	if c.Inactivity.GracePeriod <= 0 || c.Inactivity.CheckInterval <= 0 {
+		errs = append(errs, errors.New("INACTIVE_GRACE_PERIOD and INACTIVE_CHECK_INTERVAL must be positive"))
+	}
+	switch c.Inactivity.Action {
+	case "suspend", "delete":
+	default:
+		errs = append(errs, fmt.Errorf("INACTIVE_ACTION must be one of suspend, delete, got %q", c.Inactivity.Action))
+	}
+	if c.Retention.ActivityDays < 0 || c.Retention.LoginHistoryDays < 0 || c.Retention.DeletedUserDays < 0 {
+		errs = append(errs, errors.New("RETENTION_ACTIVITY_DAYS, RETENTION_LOGIN_HISTORY_DAYS and RETENTION_DELETED_USER_DAYS must not be negative"))
+	}
+	if c.Retention.CheckInterval <= 0 {
+		errs = append(errs, errors.New("RETENTION_CHECK_INTERVAL must be positive"))
+	}
+	if c.Queue.Workers <= 0 || c.Queue.MaxAttempts <= 0 {
+		errs = append(errs, errors.New("QUEUE_WORKERS and QUEUE_MAX_ATTEMPTS must be positive"))
+	}
+	if c.Queue.PollInterval <= 0 || c.Queue.JobTimeout <= 0 || c.Queue.RetryDelay <= 0 {
+		errs = append(errs, errors.New("QUEUE_POLL_INTERVAL, QUEUE_JOB_TIMEOUT and QUEUE_RETRY_DELAY must be positive"))
+	}
+	if c.SMS.OTPTTL <= 0 {
+		errs = append(errs, errors.New("SMS_OTP_TTL must be positive"))
+	}
+	if c.SMS.OTPMaxAttempts <= 0 {
+		errs = append(errs, errors.New("SMS_OTP_MAX_ATTEMPTS must be positive"))
+	}
+	if c.SMS.OTPResendInterval < 0 {
+		errs = append(errs, errors.New("SMS_OTP_RESEND_INTERVAL must not be negative"))
+	}
+	if c.Profile.MinAge < 0 || c.Profile.MaxAge < c.Profile.MinAge || c.Profile.MaxAge > 150 {
+		errs = append(errs, errors.New("PROFILE_MIN_AGE and PROFILE_MAX_AGE must satisfy 0 <= min <= max <= 150"))
+	}
+	for _, gender := range c.Profile.Genders {
+		if gender == "" || len(gender) > 50 || strings.ContainsAny(gender, " ,") {
+			errs = append(errs, fmt.Errorf("PROFILE_GENDERS entry %q must be 1-50 characters without spaces", gender))
+		}
+	}
+	for _, domain := range c.Registration.AllowedDomains {
+		if !strings.Contains(strings.TrimPrefix(domain, "*."), ".") {
+			errs = append(errs, fmt.Errorf("REGISTRATION_ALLOWED_DOMAINS entry %q is not a domain", domain))
+		}
+	}
+	if c.Registration.ConfirmTTL <= 0 {
+		errs = append(errs, errors.New("REGISTRATION_CONFIRM_TTL must be positive"))
+	}
+	if c.EmailChange.ConfirmTTL <= 0 {
+		errs = append(errs, errors.New("EMAIL_CONFIRM_TTL must be positive"))
+	}
+	if c.EmailChange.RevertTTL <= 0 {
+		errs = append(errs, errors.New("EMAIL_REVERT_TTL must be positive"))
+	}
+	if c.OneTime.CleanupInterval <= 0 {
+		errs = append(errs, errors.New("ONE_TIME_TOKEN_CLEANUP_INTERVAL must be positive"))
+	}
+	if c.Links.FrontendURL != "" {
+		if u, err := url.Parse(c.Links.FrontendURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("FRONTEND_URL must be an http(s) URL"))
+		}
+	}
+	linkPages := []struct{ name, page string }{
+		{"LOGIN_CONFIRM_URL", c.LoginRisk.ConfirmURL},
+		{"REGISTRATION_CONFIRM_URL", c.Registration.ConfirmURL},
+		{"EMAIL_CONFIRM_URL", c.EmailChange.ConfirmURL},
+		{"EMAIL_REVERT_URL", c.EmailChange.RevertURL},
+	}
+	for _, p := range linkPages {
+		if u, err := url.Parse(p.page); err != nil {
+			errs = append(errs, fmt.Errorf("%s is not a URL", p.name))
+		} else if p.page != "" && !u.IsAbs() && c.Links.FrontendURL == "" {
+			errs = append(errs, fmt.Errorf("%s is relative but FRONTEND_URL is not set", p.name))
+		}
+	}
+	if c.Links.SigningKey != "" && len(c.Links.SigningKey) < 32 {
+		errs = append(errs, errors.New("LINK_SIGNING_KEY must be at least 32 characters"))
+	}
+	if len(c.Consent.TermsVersion) > 64 || len(c.Consent.PrivacyVersion) > 64 {
+		errs = append(errs, errors.New("CONSENT_TERMS_VERSION and CONSENT_PRIVACY_VERSION must be at most 64 characters"))
+	}
+	if c.Admin.Password != "" && c.Admin.Email == "" {
+		errs = append(errs, errors.New("ADMIN_PASSWORD is set but ADMIN_EMAIL is not"))
+	}
+	if _, err := c.Admin.AllowedPrefixes(); err != nil {
+		errs = append(errs, fmt.Errorf("ADMIN_ALLOWED_IPS: %w", err))
+	}
+	for _, tag := range c.Admin.UserTags {
+		if !userTagPattern.MatchString(tag) {
+			errs = append(errs, fmt.Errorf("ADMIN_USER_TAGS entry %q must be 1-32 lowercase letters, digits, hyphens or underscores", tag))
+		}
+	}
+	if c.Admin.Password != "" && len(c.Admin.Password) < 8 {
+		errs = append(errs, errors.New("ADMIN_PASSWORD must be at least 8 characters"))
+	}
+	if c.Admin.EventsHistory < 0 {
+		errs = append(errs, errors.New("ADMIN_EVENTS_HISTORY must not be negative"))
+	}
+	if c.Admin.EventsHeartbeat <= 0 {
+		errs = append(errs, errors.New("ADMIN_EVENTS_HEARTBEAT must be positive"))
+	}
+	if c.Admin.FailedLoginBurst < 0 {
+		errs = append(errs, errors.New("ADMIN_EVENTS_FAILED_LOGIN_BURST must not be negative"))
+	}
+	if c.Admin.FailedLoginBurst > 0 && c.Admin.FailedLoginBurstWindow <= 0 {
+		errs = append(errs, errors.New("ADMIN_EVENTS_FAILED_LOGIN_WINDOW must be positive"))
+	}
+	switch c.Disposable.Mode {
+	case "block", "flag", "off":
+	default:
+		errs = append(errs, fmt.Errorf("DISPOSABLE_EMAIL_MODE must be one of block, flag, off, got %q", c.Disposable.Mode))
+	}
+	if c.Disposable.RefreshInterval < 0 {
+		errs = append(errs, errors.New("DISPOSABLE_EMAIL_REFRESH_INTERVAL must not be negative"))
+	}
+	if c.Reload.Interval < 0 {
+		errs = append(errs, errors.New("CONFIG_RELOAD_INTERVAL must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration from defaults, the optional config file named by
+// CONFIG_FILE (YAML or TOML) and environment variables, in increasing order of precedence.
+// A .env file in the working directory is loaded into the environment first if present.
+func Load() (*Config, error) {
+	_ = godotenv.Load()
+	return LoadFile(os.Getenv("CONFIG_FILE"))
+}
+
+// LoadFile is like Load but reads the given config file instead of CONFIG_FILE.
+// An empty path skips the file layer.
+func LoadFile(path string) (*Config, error) {
+	cfg := &Config{}
+	root := reflect.ValueOf(cfg).Elem()
+
+	if err := walk(root, nil, func(field reflect.Value, tag reflect.StructTag, _ map[string]any) error {
+		if def, ok := tag.Lookup("default"); ok {
+			return setValue(field, def)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to apply defaults: %w", err)
+	}
+
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := walk(root, values, func(field reflect.Value, tag reflect.StructTag, section map[string]any) error {
+			raw, ok := section[tag.Get("file")]
+			if !ok {
+				return nil
+			}
+			if err := setValue(field, fileValueString(raw)); err != nil {
+				return fmt.Errorf("%s: %w", tag.Get("file"), err)
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("invalid value in %s: %w", path, err)
+		}
+	}
+
+	if err := walk(root, nil, func(field reflect.Value, tag reflect.StructTag, _ map[string]any) error {
+		name := tag.Get("env")
+		if name == "" {
+			return nil
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+		if err := setValue(field, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("invalid environment variable %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// readFile decodes a YAML or TOML config file into a nested map
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values := make(map[string]any)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return values, nil
+}
+
+// walk visits every leaf field of a config struct together with the file section it belongs to
+func walk(v reflect.Value, section map[string]any, visit func(reflect.Value, reflect.StructTag, map[string]any) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		sf := t.Field(i)
+
+		if sf.Type.Kind() == reflect.Struct {
+			sub, _ := section[sf.Tag.Get("file")].(map[string]any)
+			if err := walk(field, sub, visit); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := visit(field, sf.Tag, section); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileValueString converts a decoded file value into the same textual form used by env vars
+func fileValueString(raw any) string {
+	if list, ok := raw.([]any); ok {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(raw)
+}
+
+// setValue parses raw into the field according to its type
+func setValue(field reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch field.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	case []string:
+		var list []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported config field type %s", field.Type())
+	}
+	return nil
+}
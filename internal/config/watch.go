@@ -0,0 +1,170 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher reloads the configuration on SIGHUP or when the config file changes and
+// notifies subscribers so they can hot-apply their reloadable settings.
+// Settings that are not tagged reloadable only take effect after a restart; a reload
+// that changes them logs a warning.
+type Watcher struct {
+	path    string
+	logger  *slog.Logger
+	resolve func(*Config) error
+	// started is the configuration the process runs with for restart-only settings
+	started *Config
+
+	mu          sync.RWMutex
+	current     *Config
+	modTime     time.Time
+	subscribers []func(*Config)
+}
+
+// NewWatcher creates a watcher for the already loaded configuration and its source
+// file. resolve, when not nil, completes every reloaded configuration the way cfg was
+// completed, e.g. with the values of a secret store, before it is compared and used.
+func NewWatcher(cfg *Config, path string, logger *slog.Logger, resolve func(*Config) error) *Watcher {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	w := &Watcher{
+		path:    path,
+		logger:  logger,
+		resolve: resolve,
+		started: cfg,
+		current: cfg,
+	}
+	if info, err := os.Stat(path); err == nil {
+		w.modTime = info.ModTime()
+	}
+	return w
+}
+
+// Current returns the most recently loaded configuration
+func (w *Watcher) Current() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// OnReload registers a function called with the new configuration after every successful reload
+func (w *Watcher) OnReload(fn func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Reload loads the configuration again and notifies subscribers.
+// The previous configuration stays active if the new one is invalid.
+func (w *Watcher) Reload() error {
+	cfg, err := LoadFile(w.path)
+	if err != nil {
+		return err
+	}
+	if w.resolve != nil {
+		if err := w.resolve(cfg); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	w.current = cfg
+	subscribers := append([]func(*Config){}, w.subscribers...)
+	w.mu.Unlock()
+
+	if pending := RestartRequired(w.started, cfg); len(pending) > 0 {
+		w.logger.Warn("configuration changes need a restart to take effect", "settings", pending)
+	}
+	for _, fn := range subscribers {
+		fn(cfg)
+	}
+	return nil
+}
+
+// RestartRequired returns the environment variable names of the settings that differ
+// between two configurations and are not reloadable
+func RestartRequired(old, cfg *Config) []string {
+	type setting struct {
+		name  string
+		value any
+		hot   bool
+	}
+	collect := func(c *Config) []setting {
+		var settings []setting
+		walk(reflect.ValueOf(c).Elem(), nil, func(field reflect.Value, tag reflect.StructTag, _ map[string]any) error {
+			settings = append(settings, setting{name: tag.Get("env"), value: field.Interface(), hot: tag.Get("reload") == "hot"})
+			return nil
+		})
+		return settings
+	}
+
+	var changed []string
+	before, after := collect(old), collect(cfg)
+	for i := range before {
+		if !before[i].hot && !reflect.DeepEqual(before[i].value, after[i].value) {
+			changed = append(changed, before[i].name)
+		}
+	}
+	return changed
+}
+
+// Run reloads on SIGHUP and, when a config file is used, polls it for changes
+// every Reload.Interval. It blocks until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval := w.Current().Reload.Interval; w.path != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			w.reload("signal")
+		case <-tick:
+			if w.fileChanged() {
+				w.reload("file change")
+			}
+		}
+	}
+}
+
+func (w *Watcher) reload(trigger string) {
+	if err := w.Reload(); err != nil {
+		w.logger.Error("config reload failed, keeping previous configuration", "trigger", trigger, "error", err)
+		return
+	}
+	w.logger.Info("configuration reloaded", "trigger", trigger)
+}
+
+// fileChanged reports whether the config file's modification time moved since the last check
+func (w *Watcher) fileChanged() bool {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if info.ModTime().Equal(w.modTime) {
+		return false
+	}
+	w.modTime = info.ModTime()
+	return true
+}
@@ -0,0 +1,88 @@
+package config_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/secrets"
+)
+
+func TestRestartRequired(t *testing.T) {
+	old := &config.Config{}
+	old.Server.Port = "8080"
+	old.RateLimit.Tiers = []string{"anonymous:60"}
+
+	cfg := &config.Config{}
+	cfg.Server.Port = "9090"
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Tiers = []string{"anonymous:10"}
+	cfg.RateLimit.Window = time.Minute
+	cfg.JWT.AccessTTL = 5 * time.Minute
+	cfg.JWT.RefreshTTL = 24 * time.Hour
+	cfg.Log.Level = "debug"
+	cfg.CORS.AllowedOrigins = []string{"https://example.com"}
+	cfg.Maintenance.Enabled = true
+
+	want := []string{"SERVER_PORT"}
+	if got := config.RestartRequired(old, cfg); !slices.Equal(got, want) {
+		t.Errorf("RestartRequired = %v, want %v", got, want)
+	}
+	if got := config.RestartRequired(cfg, cfg); len(got) != 0 {
+		t.Errorf("RestartRequired of the same config = %v, want none", got)
+	}
+}
+
+func TestReloadResolvesSecretsBeforeComparing(t *testing.T) {
+	dir := t.TempDir()
+	store := secrets.FileProvider{Dir: filepath.Join(dir, "secrets")}
+	if err := os.Mkdir(store.Dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetSecrets(context.Background(), map[string]string{
+		secrets.JWTSecret: "secret-from-the-store-that-is-long-enough",
+		secrets.DBDSN:     "postgres://store/um",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	write := func(level string) {
+		t.Helper()
+		data := "secrets:\n  provider: file\n  file_dir: " + store.Dir + "\nlog:\n  level: " + level + "\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolve := func(cfg *config.Config) error {
+		return secrets.Resolve(context.Background(), store, cfg)
+	}
+
+	write("info")
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolve(cfg); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	w := config.NewWatcher(cfg, path, slog.New(slog.NewTextHandler(&logs, nil)), resolve)
+
+	write("debug")
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), "restart") {
+		t.Errorf("reload warned about secrets that did not change: %s", logs.String())
+	}
+	if got := w.Current().JWT.Secret; got != cfg.JWT.Secret {
+		t.Errorf("reloaded JWT secret = %q, want the one from the store", got)
+	}
+}
@@ -0,0 +1,80 @@
+// Package consent tracks which versions of the terms of service and privacy policy
+// users must have accepted.
+package consent
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// Documents users consent to
+const (
+	Terms   = "terms"
+	Privacy = "privacy"
+)
+
+// Policy holds the current document versions and can be replaced at runtime
+type Policy struct {
+	versions atomic.Pointer[map[string]string]
+}
+
+// NewPolicy creates a policy from the consent configuration
+func NewPolicy(cfg config.ConsentConfig) *Policy {
+	p := &Policy{}
+	p.Update(cfg)
+	return p
+}
+
+// Update replaces the current versions. Users who accepted an older version must
+// accept the new one before continuing.
+func (p *Policy) Update(cfg config.ConsentConfig) {
+	versions := make(map[string]string)
+	if cfg.TermsVersion != "" {
+		versions[Terms] = cfg.TermsVersion
+	}
+	if cfg.PrivacyVersion != "" {
+		versions[Privacy] = cfg.PrivacyVersion
+	}
+	p.versions.Store(&versions)
+}
+
+// Required returns the current version of every document that must be accepted
+func (p *Policy) Required() map[string]string {
+	current := *p.versions.Load()
+	versions := make(map[string]string, len(current))
+	for doc, version := range current {
+		versions[doc] = version
+	}
+	return versions
+}
+
+// Pending returns the documents whose current version the user has not accepted
+func (p *Policy) Pending(user *models.User) []string {
+	var pending []string
+	for doc, version := range *p.versions.Load() {
+		if Accepted(user, doc) != version {
+			pending = append(pending, doc)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// Accepted returns the version of doc the user last accepted
+func Accepted(user *models.User, doc string) string {
+	switch doc {
+	case Terms:
+		return user.TermsVersion
+	case Privacy:
+		return user.PrivacyVersion
+	}
+	return ""
+}
+
+// Column returns the users column holding the accepted version of doc
+func Column(doc string) string {
+	return doc + "_version"
+}
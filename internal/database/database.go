@@ -0,0 +1,192 @@
+// Package database opens the PostgreSQL connection and keeps the schema up to date.
+// It is shared by the API server and the umctl admin tool.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the pgx driver
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/dbguard"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// DefaultRoles exist in every deployment
+var DefaultRoles = []string{"user", "admin"}
+
+// replicaResolver names the dbresolver that owns the read replicas
+const replicaResolver = "replicas"
+
+// migrationLockID keys the advisory lock held while the database is migrated and seeded
+const migrationLockID int64 = 0x756d5f6d69677261
+
+// Open connects to the primary database and registers the configured read replicas.
+// Queries only go to a replica when they opt in with the ReadReplica scope. Every
+// connection pool is guarded by retries and a circuit breaker (see dbguard), which
+// logs to logger, or to the default logger when it is nil.
+func Open(cfg config.DatabaseConfig, logger *slog.Logger) (*gorm.DB, error) {
+	primary, err := openPool(cfg, cfg.DSN, "primary", logger)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: primary}), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.ReplicaDSNs) == 0 {
+		return db, nil
+	}
+
+	replicas := make([]gorm.Dialector, len(cfg.ReplicaDSNs))
+	for i, dsn := range cfg.ReplicaDSNs {
+		pool, err := openPool(cfg, dsn, fmt.Sprintf("replica %d", i+1), logger)
+		if err != nil {
+			return nil, err
+		}
+		replicas[i] = postgres.New(postgres.Config{Conn: pool})
+	}
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RandomPolicy{},
+	}, replicaResolver)
+	if err := db.Use(resolver); err != nil {
+		return nil, fmt.Errorf("connect to read replicas: %w", err)
+	}
+	return db, nil
+}
+
+// openPool creates a guarded connection pool for dsn with the configured limits
+func openPool(cfg config.DatabaseConfig, dsn, name string, logger *slog.Logger) (*dbguard.Pool, error) {
+	sqlDB, err := sql.Open("pgx", withStatementTimeout(dsn, cfg.StatementTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("open %s database: %w", name, err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	return dbguard.New(sqlDB, dbguard.Config{
+		Name:       name,
+		Retries:    cfg.Retries,
+		RetryDelay: cfg.RetryDelay,
+		Threshold:  cfg.BreakerThreshold,
+		Cooldown:   cfg.BreakerCooldown,
+		Logger:     logger,
+	}), nil
+}
+
+// withStatementTimeout adds the statement_timeout run-time parameter, which pgx
+// sends on connect, to a URL or key=value DSN
+func withStatementTimeout(dsn string, timeout time.Duration) string {
+	if timeout <= 0 {
+		return dsn
+	}
+	ms := strconv.FormatInt(timeout.Milliseconds(), 10)
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("statement_timeout", ms)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " statement_timeout=" + ms
+}
+
+// ReadReplica is a query scope that sends reads to a random read replica. Use it for
+// read-heavy paths that tolerate replication lag; writes and transactions always go
+// to the primary, as does everything when no replicas are configured.
+func ReadReplica(db *gorm.DB) *gorm.DB {
+	return db.Clauses(dbresolver.Use(replicaResolver))
+}
+
+// WithMigrationLock runs fn holding a PostgreSQL advisory lock, so instances started at
+// the same time migrate and seed the database one after another instead of racing on
+// schema changes and creating duplicate seeds. The lock is held by a connection of its
+// own and waited for as long as ctx allows.
+func WithMigrationLock(ctx context.Context, db *gorm.DB, fn func() error) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("connect for the migration lock: %w", err)
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", migrationLockID).Scan(&locked); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	if !locked {
+		logging.Info(ctx, "waiting for another instance to finish migrating the database")
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			// Ending the session releases the lock, so don't return it to the pool
+			logging.Warn(ctx, "failed to release migration lock", "error", err)
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+	return fn()
+}
+
+// Migrate creates or updates the tables of all models and runs data migrations
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Role{},
+		&models.IdempotencyRecord{},
+		&models.PhoneVerification{},
+		&models.Consent{},
+		&models.LoginEvent{},
+		&models.Activity{},
+		&models.AdminNote{},
+		&models.PushDevice{},
+		&models.LoginConfirmation{},
+		&models.OneTimeToken{},
+		&models.RefreshToken{},
+		&models.OpaqueToken{},
+		&models.Job{},
+		&models.APIKey{},
+		&models.APIKeyUsage{},
+	); err != nil {
+		return fmt.Errorf("auto-migrate models: %w", err)
+	}
+	if err := models.MigrateAgeToDateOfBirth(db); err != nil {
+		return fmt.Errorf("migrate ages to dates of birth: %w", err)
+	}
+	if err := models.BackfillPasswordChangedAt(db); err != nil {
+		return fmt.Errorf("backfill password change times: %w", err)
+	}
+	if err := models.BackfillLastActiveAt(db); err != nil {
+		return fmt.Errorf("backfill last activity times: %w", err)
+	}
+	return nil
+}
+
+// Seed creates the default roles if they don't exist
+func Seed(db *gorm.DB) error {
+	for _, name := range DefaultRoles {
+		if err := db.FirstOrCreate(&models.Role{}, models.Role{Name: name}).Error; err != nil {
+			return fmt.Errorf("create role %q: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+// Package dbguard wraps a database connection pool with bounded retries and a
+// circuit breaker. Statements failing with transient errors that PostgreSQL is known
+// to have not applied are retried with backoff; once the database looks down, the
+// breaker fails statements immediately instead of letting every request wait for a
+// connection timeout, and probes with a single statement after a cooldown.
+package dbguard
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrUnavailable matches errors returned while the database can't be used: statements
+// rejected by the open breaker and outage errors left after retrying
+var ErrUnavailable = errors.New("database unavailable")
+
+// UnavailableError reports that the database can't be used right now
+type UnavailableError struct {
+	// RetryAfter is when the breaker lets statements through again
+	RetryAfter time.Duration
+	Err        error
+}
+
+// Error returns the cause
+func (e *UnavailableError) Error() string {
+	return ErrUnavailable.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrUnavailable
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+// Config tunes the retries and the breaker
+type Config struct {
+	// Name identifies the pool in logs, e.g. "primary"
+	Name string
+	// Retries is how many times a statement is retried; 0 disables retries
+	Retries int
+	// RetryDelay is the wait before the first retry, doubled for each one after
+	RetryDelay time.Duration
+	// Threshold consecutive outage errors open the breaker; 0 disables it
+	Threshold int
+	// Cooldown is how long the breaker stays open before probing
+	Cooldown time.Duration
+	// Logger receives the breaker's state changes; nil uses the default logger
+	Logger *slog.Logger
+}
+
+// Breaker states
+const (
+	closed = iota
+	open
+	halfOpen
+)
+
+// Pool is a gorm.ConnPool guarding an *sql.DB. Statements inside transactions go to
+// the *sql.Tx directly, so only starting a transaction is guarded; a transaction
+// can't be retried statement by statement.
+type Pool struct {
+	db  *sql.DB
+	cfg Config
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+// New wraps db
+func New(db *sql.DB, cfg Config) *Pool {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &Pool{db: db, cfg: cfg}
+}
+
+// GetDBConn returns the underlying pool, for gorm.DB.DB
+func (p *Pool) GetDBConn() (*sql.DB, error) {
+	return p.db, nil
+}
+
+// PrepareContext prepares a statement
+func (p *Pool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	var stmt *sql.Stmt
+	err := p.do(ctx, func() (err error) {
+		stmt, err = p.db.PrepareContext(ctx, query)
+		return err
+	})
+	return stmt, err
+}
+
+// ExecContext runs a statement that returns no rows
+func (p *Pool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var result sql.Result
+	err := p.do(ctx, func() (err error) {
+		result, err = p.db.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// QueryContext runs a query. Errors while reading the rows are neither retried nor
+// seen by the breaker.
+func (p *Pool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := p.do(ctx, func() (err error) {
+		rows, err = p.db.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRowContext runs a query expected to return one row. *sql.Row defers its
+// error to Scan, so these queries bypass the retries and the breaker.
+func (p *Pool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return p.db.QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx starts a transaction
+func (p *Pool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := p.do(ctx, func() (err error) {
+		tx, err = p.db.BeginTx(ctx, opts)
+		return err
+	})
+	return tx, err
+}
+
+// do runs fn through the breaker, retrying transient errors
+func (p *Pool) do(ctx context.Context, fn func() error) error {
+	delay := p.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		if wait, ok := p.allow(); !ok {
+			return &UnavailableError{RetryAfter: wait, Err: errors.New("circuit breaker open")}
+		}
+		err := fn()
+		if err != nil && ctx.Err() != nil {
+			// The caller gave up, which says nothing about the database
+			p.abandon()
+			return err
+		}
+		p.record(err)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= p.cfg.Retries || !retryable(err) {
+			if outage(err) {
+				return &UnavailableError{RetryAfter: p.retryAfter(), Err: err}
+			}
+			return err
+		}
+		// Full jitter keeps instances from retrying in lockstep
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(rand.N(delay) + 1):
+		}
+		delay *= 2
+	}
+}
+
+// allow reports whether a statement may run, or how long until it may
+func (p *Pool) allow() (time.Duration, bool) {
+	if p.cfg.Threshold <= 0 {
+		return 0, true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.state {
+	case open:
+		if wait := p.cfg.Cooldown - time.Since(p.openedAt); wait > 0 {
+			return wait, false
+		}
+		// Let this statement probe the database
+		p.state = halfOpen
+		return 0, true
+	case halfOpen:
+		return time.Second, false
+	}
+	return 0, true
+}
+
+// record updates the breaker with the outcome of a statement. Errors the database
+// answered, such as constraint violations, show that it is up.
+func (p *Pool) record(err error) {
+	if p.cfg.Threshold <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil && outage(err) {
+		p.failures++
+		if p.state == halfOpen || (p.state == closed && p.failures >= p.cfg.Threshold) {
+			if p.state == closed {
+				p.cfg.Logger.Warn("database circuit breaker opened", "pool", p.cfg.Name, "failures", p.failures, "error", err)
+			}
+			p.state = open
+			p.openedAt = time.Now()
+		}
+		return
+	}
+
+	if p.state != closed {
+		p.cfg.Logger.Info("database circuit breaker closed", "pool", p.cfg.Name)
+	}
+	p.state = closed
+	p.failures = 0
+}
+
+// abandon lets the next statement probe again when a probe was cancelled
+func (p *Pool) abandon() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == halfOpen {
+		p.state = open
+	}
+}
+
+// retryAfter is how long clients should wait before trying again
+func (p *Pool) retryAfter() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == open {
+		return max(p.cfg.Cooldown-time.Since(p.openedAt), time.Second)
+	}
+	return time.Second
+}
+
+// outage reports whether err means the database can't be reached or isn't accepting
+// work, as opposed to rejecting a statement
+func outage(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case strings.HasPrefix(pgErr.Code, "08"), // connection_exception
+			pgErr.Code == "53300", // too_many_connections
+			pgErr.Code == "57P01", // admin_shutdown
+			pgErr.Code == "57P02", // crash_shutdown
+			pgErr.Code == "57P03": // cannot_connect_now
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryable reports whether err is transient and guaranteed to have left the database
+// unchanged, so the statement can run again
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"53300", // too_many_connections
+			"57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			// The server rolled the statement back
+			return true
+		}
+		return false
+	}
+	// Failing to connect or to take a connection means nothing was sent
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return pgconn.SafeToRetry(err) || errors.Is(err, driver.ErrBadConn)
+}
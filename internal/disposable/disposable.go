@@ -0,0 +1,154 @@
+// Package disposable recognises email addresses at throwaway mailbox providers.
+// It ships with an embedded domain list and can merge in a list fetched from a URL,
+// such as the community-maintained disposable-email-domains blocklist.
+package disposable
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+//go:embed domains.txt
+var embedded string
+
+// maxListBytes caps the size of a downloaded list
+const maxListBytes = 16 << 20
+
+// Blocklist is a set of disposable email domains that is safe for concurrent use
+type Blocklist struct {
+	mu      sync.RWMutex
+	builtin map[string]bool
+	remote  map[string]bool
+	allow   map[string]bool
+}
+
+// NewBlocklist creates a blocklist from the embedded list. Domains in allow are
+// never reported as disposable.
+func NewBlocklist(allow []string) *Blocklist {
+	builtin, _ := parse(strings.NewReader(embedded))
+	allowed := make(map[string]bool, len(allow))
+	for _, domain := range allow {
+		allowed[normalize(domain)] = true
+	}
+	return &Blocklist{builtin: builtin, allow: allowed}
+}
+
+// IsDisposable reports whether the email's domain, or a parent domain, is listed
+func (bl *Blocklist) IsDisposable(email string) bool {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return false
+	}
+	domain := normalize(email[at+1:])
+
+	bl.mu.RLock()
+	defer bl.mu.RUnlock()
+	for {
+		if bl.allow[domain] {
+			return false
+		}
+		if bl.builtin[domain] || bl.remote[domain] {
+			return true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			return false
+		}
+		domain = parent
+	}
+}
+
+// Len returns the number of listed domains
+func (bl *Blocklist) Len() int {
+	bl.mu.RLock()
+	defer bl.mu.RUnlock()
+	n := len(bl.builtin)
+	for domain := range bl.remote {
+		if !bl.builtin[domain] {
+			n++
+		}
+	}
+	return n
+}
+
+// Load fetches a plain-text list (one domain per line, "#" comments) from url and
+// uses it alongside the embedded list, replacing any previously loaded one
+func (bl *Blocklist) Load(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch disposable domain list: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch disposable domain list: status %d", resp.StatusCode)
+	}
+	remote, err := parse(io.LimitReader(resp.Body, maxListBytes))
+	if err != nil {
+		return fmt.Errorf("read disposable domain list: %w", err)
+	}
+
+	bl.mu.Lock()
+	bl.remote = remote
+	bl.mu.Unlock()
+	return nil
+}
+
+// Refresh loads the list from url immediately and then every interval until ctx is
+// cancelled. Failures are logged and the last good list is kept.
+func (bl *Blocklist) Refresh(ctx context.Context, url string, interval time.Duration) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	load := func() {
+		if err := bl.Load(ctx, client, url); err != nil {
+			logging.Error(ctx, "failed to refresh disposable email domains", "url", url, "error", err)
+			return
+		}
+		logging.Info(ctx, "disposable email domains refreshed", "domains", bl.Len())
+	}
+
+	load()
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			load()
+		}
+	}
+}
+
+func parse(r io.Reader) (map[string]bool, error) {
+	domains := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[normalize(line)] = true
+	}
+	return domains, scanner.Err()
+}
+
+func normalize(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
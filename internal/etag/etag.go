@@ -0,0 +1,51 @@
+// Package etag implements weak entity tags and the If-None-Match / If-Match
+// preconditions for resources that carry an update timestamp.
+package etag
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Weak returns the weak ETag of a resource version, e.g. W/"12-1702324800000"
+func Weak(id uint, updatedAt int64) string {
+	return `W/"` + strconv.FormatUint(uint64(id), 10) + "-" + strconv.FormatInt(updatedAt, 10) + `"`
+}
+
+// Set sends the ETag and asks caches to revalidate before reusing the response,
+// since resources are only visible to their authenticated owner or admins
+func Set(c *gin.Context, tag string) {
+	c.Header("ETag", tag)
+	c.Header("Cache-Control", "private, no-cache")
+}
+
+// NotModified reports whether the request's If-None-Match header matches tag,
+// in which case the caller should answer 304 without a body
+func NotModified(c *gin.Context, tag string) bool {
+	header := c.GetHeader("If-None-Match")
+	return header != "" && matches(header, tag)
+}
+
+// PreconditionFailed reports whether the request carries an If-Match header that
+// does not match tag. Weak tags are compared by their opaque value: they change on
+// every write, so a match means the client saw the current version.
+func PreconditionFailed(c *gin.Context, tag string) bool {
+	header := c.GetHeader("If-Match")
+	return header != "" && !matches(header, tag)
+}
+
+// matches reports whether a comma-separated list of entity tags (or "*") contains tag
+func matches(header, tag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	want := strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
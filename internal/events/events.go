@@ -0,0 +1,190 @@
+// Package events notifies admins of notable account events as they happen: new
+// registrations, bursts of failed logins and role changes. Events are fanned out to
+// the subscribed streams of this instance and, through Redis, of every instance. A
+// short history lets reconnecting streams catch up on what they missed.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// Event types
+const (
+	TypeUserRegistered   = "user_registered"
+	TypeFailedLoginBurst = "failed_login_burst"
+	TypeRoleAssigned     = "role_assigned"
+	TypeRoleRemoved      = "role_removed"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it is dropped
+const subscriberBuffer = 64
+
+// Redis keys shared by the instances
+const (
+	redisChannel = "um:events"
+	redisIDKey   = "um:events:id"
+)
+
+// Event is a notification for admins
+type Event struct {
+	// ID increases with every event; streams resume after it with Last-Event-ID
+	ID     uint64 `json:"id"`
+	Type   string `json:"type"`
+	UserID uint   `json:"user_id"`
+	// ActorID is the admin who made a change; absent when the user acted themselves
+	ActorID   uint           `json:"actor_id,omitempty"`
+	IP        string         `json:"ip,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+	CreatedAt int64          `json:"created_at"`
+}
+
+// Broker publishes events to the subscribed streams
+type Broker struct {
+	redis       *redis.Client
+	historySize int
+
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+// NewBroker creates a broker keeping the last historySize events. With a Redis client
+// events are relayed between instances; Run must then be running to receive them.
+func NewBroker(client *redis.Client, historySize int) *Broker {
+	return &Broker{
+		redis:       client,
+		historySize: historySize,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber. Delivery is best effort: an event that
+// can't be relayed through Redis is logged and dropped.
+func (b *Broker) Publish(ctx context.Context, event Event) {
+	if event.CreatedAt == 0 {
+		event.CreatedAt = time.Now().UnixMilli()
+	}
+	if b.redis == nil {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		event.ID = b.lastID + 1
+		b.deliverLocked(event)
+		return
+	}
+
+	// Numbered in Redis so every instance agrees on the IDs streams resume after
+	ctx = context.WithoutCancel(ctx)
+	id, err := b.redis.Incr(ctx, redisIDKey).Result()
+	if err == nil {
+		event.ID = uint64(id)
+		var data []byte
+		if data, err = json.Marshal(event); err == nil {
+			err = b.redis.Publish(ctx, redisChannel, data).Err()
+		}
+	}
+	if err != nil {
+		logging.Warn(ctx, "failed to publish admin event", "type", event.Type, "user_id", event.UserID, "error", err)
+	}
+}
+
+// Run receives the events published by every instance through Redis until ctx is
+// cancelled. Without Redis it returns at once.
+func (b *Broker) Run(ctx context.Context) {
+	if b.redis == nil {
+		return
+	}
+	pubsub := b.redis.Subscribe(ctx, redisChannel)
+	defer pubsub.Close()
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				logging.Warn(ctx, "invalid admin event received", "error", err)
+				continue
+			}
+			b.mu.Lock()
+			b.deliverLocked(event)
+			b.mu.Unlock()
+		}
+	}
+}
+
+// Subscribe registers a stream. It returns the events in the history after lastID,
+// when lastID is not 0, and a channel receiving new events. The channel is closed when
+// the subscriber falls too far behind or the broker closes; cancel unregisters it.
+func (b *Broker) Subscribe(lastID uint64) (missed []Event, events <-chan Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastID {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return missed, ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+	return missed, ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends every stream, e.g. so a shutting-down server isn't held up by them
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// deliverLocked adds an event to the history and hands it to the subscribers.
+// Subscribers whose buffer is full are dropped; they reconnect and catch up from the
+// history. b.mu must be held.
+func (b *Broker) deliverLocked(event Event) {
+	b.lastID = max(b.lastID, event.ID)
+	if b.historySize > 0 {
+		if len(b.history) >= b.historySize {
+			b.history = append(b.history[:0], b.history[len(b.history)-b.historySize+1:]...)
+		}
+		b.history = append(b.history, event)
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+)
+
+// failureKeyPrefix namespaces the failed login counters in Redis
+const failureKeyPrefix = "um:events:failures:"
+
+// BurstPolicy is how many failed logins for one user, each within Window of the
+// previous one, make a burst. A burst is published once, when it reaches Failures.
+type BurstPolicy struct {
+	Failures int
+	Window   time.Duration
+}
+
+// activityRepository publishes role changes and failed login bursts it records
+type activityRepository struct {
+	repository.ActivityRepository
+	broker *Broker
+	policy BurstPolicy
+
+	// mu guards failures, the per-user counters used without Redis
+	mu       sync.Mutex
+	failures map[uint]failureCount
+}
+
+// failureCount counts a user's failed logins up to the last one
+type failureCount struct {
+	last  time.Time
+	count int
+}
+
+// WrapActivity returns an activity repository that also publishes the role changes
+// and failed login bursts it records. A policy of 0 failures publishes no bursts.
+func WrapActivity(repo repository.ActivityRepository, broker *Broker, policy BurstPolicy) repository.ActivityRepository {
+	return &activityRepository{
+		ActivityRepository: repo,
+		broker:             broker,
+		policy:             policy,
+		failures:           make(map[uint]failureCount),
+	}
+}
+
+// Add records the event and publishes it when admins are notified of it
+func (r *activityRepository) Add(ctx context.Context, activity *models.Activity) error {
+	err := r.ActivityRepository.Add(ctx, activity)
+
+	event := Event{UserID: activity.UserID, IP: activity.IP, Details: activity.Details, CreatedAt: activity.CreatedAt}
+	if activity.ActorID != nil {
+		event.ActorID = *activity.ActorID
+	}
+	switch activity.Type {
+	case models.ActivityRoleAssigned:
+		event.Type = TypeRoleAssigned
+	case models.ActivityRoleRemoved:
+		event.Type = TypeRoleRemoved
+	case models.ActivityLoginFailed:
+		failures := r.countFailure(ctx, activity.UserID)
+		if r.policy.Failures <= 0 || failures != r.policy.Failures {
+			return err
+		}
+		event.Type = TypeFailedLoginBurst
+		event.Details = map[string]any{"failures": failures, "window": r.policy.Window.String()}
+	default:
+		return err
+	}
+	r.broker.Publish(ctx, event)
+	return err
+}
+
+// countFailure counts a failed login of the user and returns the failures in the
+// current burst. The counters are shared through Redis when the broker has it.
+func (r *activityRepository) countFailure(ctx context.Context, userID uint) int {
+	if r.policy.Failures <= 0 {
+		return 0
+	}
+	if client := r.broker.redis; client != nil {
+		return countFailureInRedis(ctx, client, userID, r.policy.Window)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	failures := r.failures[userID]
+	if now.Sub(failures.last) >= r.policy.Window {
+		failures.count = 0
+	}
+	failures.last = now
+	failures.count++
+	r.failures[userID] = failures
+
+	// Drop ended bursts now and then so counters of idle users don't pile up
+	if len(r.failures) > 10000 {
+		for id, f := range r.failures {
+			if now.Sub(f.last) >= r.policy.Window {
+				delete(r.failures, id)
+			}
+		}
+	}
+	return failures.count
+}
+
+// countFailureInRedis counts a failed login in a counter expiring a window after the
+// last failure
+func countFailureInRedis(ctx context.Context, client *redis.Client, userID uint, window time.Duration) int {
+	key := failureKeyPrefix + strconv.FormatUint(uint64(userID), 10)
+	var failures *redis.IntCmd
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		failures = pipe.Incr(ctx, key)
+		pipe.PExpire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		logging.Warn(ctx, "failed to count failed login for admin events", "user_id", userID, "error", err)
+		return 0
+	}
+	return int(failures.Val())
+}
+
+// userRepository publishes the users it creates
+type userRepository struct {
+	repository.UserRepository
+	broker *Broker
+}
+
+// WrapUsers returns a user repository that also publishes the users it creates
+func WrapUsers(repo repository.UserRepository, broker *Broker) repository.UserRepository {
+	return &userRepository{UserRepository: repo, broker: broker}
+}
+
+// Create stores the user and publishes the registration
+func (r *userRepository) Create(ctx context.Context, user *models.User, consents []models.Consent) error {
+	if err := r.UserRepository.Create(ctx, user, consents); err != nil {
+		return err
+	}
+	r.broker.Publish(ctx, Event{
+		Type:      TypeUserRegistered,
+		UserID:    user.ID,
+		Details:   map[string]any{"email": user.Email, "name": user.Name},
+		CreatedAt: user.CreatedAt,
+	})
+	return nil
+}
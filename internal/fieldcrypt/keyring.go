@@ -0,0 +1,178 @@
+// Package fieldcrypt encrypts sensitive columns at rest with envelope encryption.
+// Values are sealed with AES-256-GCM under a data key; data keys are stored wrapped
+// by a key encryption key that never leaves the local config, Vault's transit engine
+// or AWS KMS. Columns opt in with the `serializer:encrypted` GORM tag, so handlers and
+// services see plaintext.
+//
+// The first configured data key encrypts; the others only decrypt, so keys rotate by
+// adding a new key in front and re-encrypting the stored values with it.
+//
+// Encrypted values can't be looked up, so emails are also stored as a blind index:
+// an HMAC of the address under a separate index key.
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+)
+
+// prefix marks encrypted values; the key ID and the sealed value follow
+const prefix = "enc:v1:"
+
+// ErrNoKey is returned for values encrypted under a key that isn't configured
+var ErrNoKey = errors.New("value is encrypted under an unknown data key")
+
+// Keyring holds the unwrapped data keys and the blind index key
+type Keyring struct {
+	primary  string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+	email    bool
+}
+
+// Load unwraps the configured data keys with the key encryption key. It returns nil
+// when encryption is off.
+func Load(ctx context.Context, cfg config.EncryptionConfig, secrets config.SecretsConfig) (*Keyring, error) {
+	if cfg.KeyProvider == "" {
+		return nil, nil
+	}
+	wrapper, err := NewWrapper(cfg, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Keyring{keys: make(map[string]cipher.AEAD, len(cfg.DataKeys))}
+	for _, entry := range cfg.DataKeys {
+		id, wrapped, _ := strings.Cut(entry, ":")
+		key, err := wrapper.Unwrap(ctx, wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("unwrap data key %s: %w", id, err)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("data key %s: %w", id, err)
+		}
+		if k.primary == "" {
+			k.primary = id
+		}
+		k.keys[id] = aead
+	}
+	if k.primary == "" {
+		return nil, errors.New("ENCRYPTION_DATA_KEYS is empty")
+	}
+
+	if cfg.IndexKey != "" {
+		if k.indexKey, err = wrapper.Unwrap(ctx, cfg.IndexKey); err != nil {
+			return nil, fmt.Errorf("unwrap index key: %w", err)
+		}
+		if len(k.indexKey) != 32 {
+			return nil, fmt.Errorf("index keys must be 32 bytes, got %d", len(k.indexKey))
+		}
+	}
+	k.email = cfg.Email
+	return k, nil
+}
+
+// NewDataKey returns a random data key
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("data keys must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plaintext under the primary key. The column name is bound to the
+// ciphertext, so a value copied into another column fails to decrypt.
+func (k *Keyring) Encrypt(plaintext, column string) (string, error) {
+	aead := k.keys[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(column))
+	return prefix + k.primary + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt
+func (k *Keyring) Decrypt(stored, column string) (string, error) {
+	id, data, ok := strings.Cut(strings.TrimPrefix(stored, prefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted value")
+	}
+	aead := k.keys[id]
+	if aead == nil {
+		return "", fmt.Errorf("%w %q", ErrNoKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", column, err)
+	}
+	return string(plaintext), nil
+}
+
+// Current reports whether a stored value is encrypted under the primary key. Empty
+// values are never encrypted and count as current.
+func (k *Keyring) Current(stored string) bool {
+	return stored == "" || strings.HasPrefix(stored, prefix+k.primary+":")
+}
+
+// HasIndexKey reports whether emails are indexed
+func (k *Keyring) HasIndexKey() bool {
+	return k.indexKey != nil
+}
+
+// EncryptsEmail reports whether emails are encrypted
+func (k *Keyring) EncryptsEmail() bool {
+	return k.email
+}
+
+// EncryptsEmail reports whether the active keyring encrypts emails
+func EncryptsEmail() bool {
+	k := active.Load()
+	return k != nil && k.email
+}
+
+// BlindIndex returns the HMAC of value under the index key of the active keyring, or
+// "" without one. Equal values have equal indexes, so they can be looked up and
+// held unique without being stored in plain text.
+func BlindIndex(value string) string {
+	k := active.Load()
+	if k == nil || k.indexKey == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encrypted reports whether a stored value is encrypted
+func Encrypted(stored string) bool {
+	return strings.HasPrefix(stored, prefix)
+}
@@ -0,0 +1,121 @@
+package fieldcrypt
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"gorm.io/gorm/schema"
+)
+
+// active is the keyring the serializer uses; nil stores plain text
+var active atomic.Pointer[Keyring]
+
+func init() {
+	schema.RegisterSerializer("encrypted", serializer{})
+	schema.RegisterSerializer("encrypted_email", serializer{email: true})
+}
+
+// Use makes k the keyring of the `encrypted` serializer. With a nil keyring values
+// are stored in plain text, and encrypted values can't be read.
+func Use(k *Keyring) {
+	active.Store(k)
+}
+
+// serializer encrypts a column on write and decrypts it on read. Plain text values
+// written before encryption was enabled are read as they are. Fields may be strings
+// or types implementing driver.Valuer and sql.Scanner with a string form, and
+// pointers to them. Email columns are only encrypted with ENCRYPTION_EMAIL.
+type serializer struct {
+	email bool
+}
+
+// Scan decrypts the stored value into the field
+func (s serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	target := field.ReflectValueOf(ctx, dst)
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+		target.Set(reflect.Zero(field.FieldType))
+		return nil
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("unsupported value %T for encrypted column %s", dbValue, field.DBName)
+	}
+
+	plaintext := stored
+	if Encrypted(stored) {
+		k := active.Load()
+		if k == nil {
+			return fmt.Errorf("column %s is encrypted but no encryption keys are configured", field.DBName)
+		}
+		var err error
+		if plaintext, err = k.Decrypt(stored, field.DBName); err != nil {
+			return err
+		}
+	}
+
+	value := reflect.New(field.FieldType).Elem()
+	if err := setPlaintext(value, plaintext); err != nil {
+		return fmt.Errorf("column %s: %w", field.DBName, err)
+	}
+	target.Set(value)
+	return nil
+}
+
+// setPlaintext stores plaintext in v, allocating pointers on the way
+func setPlaintext(v reflect.Value, plaintext string) error {
+	if v.Kind() == reflect.Pointer {
+		if plaintext == "" {
+			return nil
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	if scanner, ok := v.Addr().Interface().(sql.Scanner); ok {
+		return scanner.Scan(plaintext)
+	}
+	if v.Kind() != reflect.String {
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	v.SetString(plaintext)
+	return nil
+}
+
+// Value encrypts the field. Empty values are stored as they are, so nothing is
+// learned from them that the column being empty wouldn't tell.
+func (s serializer) Value(_ context.Context, field *schema.Field, _ reflect.Value, fieldValue interface{}) (interface{}, error) {
+	if v := reflect.ValueOf(fieldValue); !v.IsValid() || (v.Kind() == reflect.Pointer && v.IsNil()) {
+		return nil, nil
+	}
+
+	var plaintext string
+	switch v := fieldValue.(type) {
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil || value == nil {
+			return value, err
+		}
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("unsupported value %T for encrypted column %s", value, field.DBName)
+		}
+		plaintext = str
+	case string:
+		plaintext = v
+	default:
+		return nil, fmt.Errorf("unsupported field type %T for encrypted column %s", fieldValue, field.DBName)
+	}
+
+	k := active.Load()
+	if k == nil || plaintext == "" || (s.email && !k.email) {
+		return plaintext, nil
+	}
+	return k.Encrypt(plaintext, field.DBName)
+}
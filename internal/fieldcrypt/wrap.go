@@ -0,0 +1,179 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/awssig"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+)
+
+// Wrapper protects data keys with a key encryption key
+type Wrapper interface {
+	// Wrap encrypts a data key for storage in the configuration
+	Wrap(ctx context.Context, key []byte) (string, error)
+	// Unwrap decrypts a wrapped data key
+	Unwrap(ctx context.Context, wrapped string) ([]byte, error)
+}
+
+// NewWrapper creates the wrapper selected by cfg.KeyProvider. Vault and AWS KMS share
+// their address, token and region with the secrets provider settings.
+func NewWrapper(cfg config.EncryptionConfig, secrets config.SecretsConfig) (Wrapper, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	switch cfg.KeyProvider {
+	case "local":
+		master, err := base64.StdEncoding.DecodeString(cfg.MasterKey)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_MASTER_KEY is not base64: %w", err)
+		}
+		aead, err := newAEAD(master)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_MASTER_KEY: %w", err)
+		}
+		return &localWrapper{aead: aead}, nil
+	case "vault":
+		return &vaultWrapper{addr: secrets.VaultAddr, token: secrets.VaultToken, mount: cfg.VaultMount, key: cfg.VaultKey, client: client}, nil
+	case "aws":
+		return &kmsWrapper{region: secrets.AWSRegion, keyID: cfg.KMSKeyID, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown encryption key provider %q", cfg.KeyProvider)
+	}
+}
+
+// localWrapper wraps data keys with a master key from the configuration
+type localWrapper struct {
+	aead cipher.AEAD
+}
+
+func (w *localWrapper) Wrap(_ context.Context, key []byte) (string, error) {
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(w.aead.Seal(nonce, nonce, key, nil)), nil
+}
+
+func (w *localWrapper) Unwrap(_ context.Context, wrapped string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(sealed) < w.aead.NonceSize() {
+		return nil, errors.New("malformed wrapped key")
+	}
+	return w.aead.Open(nil, sealed[:w.aead.NonceSize()], sealed[w.aead.NonceSize():], nil)
+}
+
+// vaultWrapper wraps data keys with a key of Vault's transit secrets engine
+type vaultWrapper struct {
+	addr, token, mount, key string
+	client                  *http.Client
+}
+
+func (w *vaultWrapper) Wrap(ctx context.Context, key []byte) (string, error) {
+	var result struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	err := w.call(ctx, "encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}, &result)
+	return result.Data.Ciphertext, err
+}
+
+func (w *vaultWrapper) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	var result struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := w.call(ctx, "decrypt", map[string]string{"ciphertext": wrapped}, &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.Data.Plaintext)
+}
+
+func (w *vaultWrapper) call(ctx context.Context, op string, payload map[string]string, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(w.addr, "/") + "/v1/" + strings.Trim(w.mount, "/") + "/" + op + "/" + w.key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", w.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault transit %s returned status %d", op, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return nil
+}
+
+// kmsWrapper wraps data keys with an AWS KMS key. Credentials come from the standard
+// AWS env vars.
+type kmsWrapper struct {
+	region, keyID string
+	client        *http.Client
+}
+
+func (w *kmsWrapper) Wrap(ctx context.Context, key []byte) (string, error) {
+	var result struct {
+		CiphertextBlob string `json:"CiphertextBlob"`
+	}
+	err := w.call(ctx, "TrentService.Encrypt", map[string]string{"KeyId": w.keyID, "Plaintext": base64.StdEncoding.EncodeToString(key)}, &result)
+	return result.CiphertextBlob, err
+}
+
+func (w *kmsWrapper) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	var result struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	if err := w.call(ctx, "TrentService.Decrypt", map[string]string{"CiphertextBlob": wrapped}, &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.Plaintext)
+}
+
+func (w *kmsWrapper) call(ctx context.Context, target string, payload map[string]string, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("https://kms.%s.amazonaws.com/", w.region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	awssig.Sign(req, body, awssig.CredentialsFromEnv(), w.region, "kms", time.Now())
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kms request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kms returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode kms response: %w", err)
+	}
+	return nil
+}
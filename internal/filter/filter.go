@@ -0,0 +1,228 @@
+// Package filter compiles a small filter language into parameterized SQL conditions,
+// for admin queries the plain query parameters can't express:
+//
+//	country eq "MK" and (created_at gt "2024-01-01" or not email_verified eq true)
+//
+// A comparison is a field, an operator (eq, ne, gt, ge, lt, le, and for text co, sw
+// and ew for contains, starts with and ends with) and a value: a double-quoted string,
+// a number, true, false or null. Comparisons combine with and, or and not, grouped
+// with parentheses. Only fields of the schema can be named, and values are always
+// passed as query arguments.
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the type of a field, deciding which values and operators it takes
+type Type int
+
+const (
+	// Text compares strings; co, sw and ew match case-insensitively
+	Text Type = iota
+	// Integer compares whole numbers
+	Integer
+	// Bool takes true or false with eq and ne
+	Bool
+	// Timestamp is a Unix time in milliseconds, compared with dates ("2024-01-01"),
+	// RFC 3339 times or millisecond numbers
+	Timestamp
+	// Date is a calendar date, compared with "YYYY-MM-DD" strings
+	Date
+)
+
+// Field describes a field that filters may name
+type Field struct {
+	Type Type
+	// Column is the SQL expression compared to the value
+	Column string
+	// ColumnArgs are arguments of placeholders in Column
+	ColumnArgs []any
+	// Nullable fields can be compared to null with eq and ne
+	Nullable bool
+	// Match, when set, is a condition with one placeholder for the value that eq
+	// tests; ne negates it and other operators are rejected. Column is unused.
+	Match string
+	// MatchArgs, when set, turns the value into the arguments of Match's placeholders
+	MatchArgs func(value any) []any
+}
+
+// Schema lists the fields filters may name
+type Schema struct {
+	Fields map[string]Field
+	// Dynamic resolves names missing from Fields, e.g. keys of a JSON column
+	Dynamic func(name string) (Field, bool)
+}
+
+// Condition is a compiled filter, ready for a WHERE clause
+type Condition struct {
+	SQL  string
+	Args []any
+}
+
+// Compile parses an expression and compiles it against the schema. Errors are *Error.
+func Compile(input string, schema Schema) (*Condition, error) {
+	root, err := parse(input)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{schema: schema}
+	sql, err := c.compile(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Condition{SQL: "(" + sql + ")", Args: c.args}, nil
+}
+
+type compiler struct {
+	schema Schema
+	args   []any
+}
+
+func (c *compiler) compile(n *node) (string, error) {
+	switch n.op {
+	case "and", "or":
+		left, err := c.compile(n.left)
+		if err != nil {
+			return "", err
+		}
+		right, err := c.compile(n.right)
+		if err != nil {
+			return "", err
+		}
+		return "(" + left + " " + strings.ToUpper(n.op) + " " + right + ")", nil
+	case "not":
+		operand, err := c.compile(n.left)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + operand + ")", nil
+	default:
+		return c.comparison(n)
+	}
+}
+
+// sqlOperators are the SQL forms of the ordering operators
+var sqlOperators = map[string]string{OpEq: "=", OpNe: "<>", OpGt: ">", OpGe: ">=", OpLt: "<", OpLe: "<="}
+
+func (c *compiler) comparison(n *node) (string, error) {
+	field, ok := c.schema.Fields[n.field]
+	if !ok && c.schema.Dynamic != nil {
+		field, ok = c.schema.Dynamic(n.field)
+	}
+	if !ok {
+		return "", &Error{Pos: n.pos, Msg: fmt.Sprintf("unknown field %q", n.field)}
+	}
+
+	if n.value.kind == tokNull {
+		if !field.Nullable || (n.op != OpEq && n.op != OpNe) {
+			return "", &Error{Pos: n.value.pos, Msg: fmt.Sprintf("%s can't be compared to null with %s", n.field, n.op)}
+		}
+		c.args = append(c.args, field.ColumnArgs...)
+		if n.op == OpEq {
+			return field.Column + " IS NULL", nil
+		}
+		return field.Column + " IS NOT NULL", nil
+	}
+
+	arg, err := convert(field.Type, n)
+	if err != nil {
+		return "", err
+	}
+
+	if field.Match != "" {
+		if n.op != OpEq && n.op != OpNe {
+			return "", &Error{Pos: n.pos, Msg: fmt.Sprintf("%s only supports eq and ne", n.field)}
+		}
+		if field.MatchArgs != nil {
+			c.args = append(c.args, field.MatchArgs(arg)...)
+		} else {
+			c.args = append(c.args, arg)
+		}
+		if n.op == OpNe {
+			return "NOT (" + field.Match + ")", nil
+		}
+		return field.Match, nil
+	}
+
+	switch n.op {
+	case OpCo, OpSw, OpEw:
+		if field.Type != Text {
+			return "", &Error{Pos: n.pos, Msg: fmt.Sprintf("%s only applies to text fields", n.op)}
+		}
+		pattern := escapeLike(arg.(string))
+		switch n.op {
+		case OpCo:
+			pattern = "%" + pattern + "%"
+		case OpSw:
+			pattern += "%"
+		case OpEw:
+			pattern = "%" + pattern
+		}
+		c.args = append(append(c.args, field.ColumnArgs...), pattern)
+		return field.Column + ` ILIKE ? ESCAPE '\'`, nil
+	case OpGt, OpGe, OpLt, OpLe:
+		if field.Type == Bool {
+			return "", &Error{Pos: n.pos, Msg: fmt.Sprintf("%s only supports eq and ne", n.field)}
+		}
+	}
+	c.args = append(append(c.args, field.ColumnArgs...), arg)
+	return field.Column + " " + sqlOperators[n.op] + " ?", nil
+}
+
+// convert checks the value against the field's type and returns the query argument
+func convert(t Type, n *node) (any, error) {
+	v := n.value
+	mismatch := func(want string) error {
+		return &Error{Pos: v.pos, Msg: fmt.Sprintf("%s needs %s", n.field, want)}
+	}
+	switch t {
+	case Text:
+		if v.kind != tokString {
+			return nil, mismatch("a quoted string")
+		}
+		return v.text, nil
+	case Integer:
+		i, err := strconv.ParseInt(v.text, 10, 64)
+		if v.kind != tokNumber || err != nil {
+			return nil, mismatch("a whole number")
+		}
+		return i, nil
+	case Bool:
+		if v.kind != tokBool {
+			return nil, mismatch("true or false")
+		}
+		return v.text == "true", nil
+	case Timestamp:
+		if v.kind == tokNumber {
+			if ms, err := strconv.ParseInt(v.text, 10, 64); err == nil {
+				return ms, nil
+			}
+		}
+		if v.kind == tokString {
+			if ts, err := time.Parse(time.RFC3339, v.text); err == nil {
+				return ts.UnixMilli(), nil
+			}
+			if d, err := time.Parse(time.DateOnly, v.text); err == nil {
+				return d.UnixMilli(), nil
+			}
+		}
+		return nil, mismatch(`a date ("2024-01-01"), an RFC 3339 time or milliseconds`)
+	case Date:
+		if v.kind == tokString {
+			if _, err := time.Parse(time.DateOnly, v.text); err == nil {
+				return v.text, nil
+			}
+		}
+		return nil, mismatch(`a date ("2024-01-01")`)
+	}
+	return nil, mismatch("a value")
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
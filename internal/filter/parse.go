@@ -0,0 +1,297 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits on expressions, so a filter can't make the database do unbounded work
+const (
+	MaxLength      = 1000
+	maxComparisons = 20
+	maxDepth       = 10
+)
+
+// Error is a syntax or type error in an expression, at a byte offset
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// Operators of comparisons
+const (
+	OpEq = "eq"
+	OpNe = "ne"
+	OpGt = "gt"
+	OpGe = "ge"
+	OpLt = "lt"
+	OpLe = "le"
+	OpCo = "co" // contains
+	OpSw = "sw" // starts with
+	OpEw = "ew" // ends with
+)
+
+var operators = map[string]bool{OpEq: true, OpNe: true, OpGt: true, OpGe: true, OpLt: true, OpLe: true, OpCo: true, OpSw: true, OpEw: true}
+
+// node is a parsed expression: a comparison, or a logical operator with operands
+type node struct {
+	op          string // and, or, not, or a comparison operator
+	left, right *node
+	field       string
+	value       value
+	pos         int
+}
+
+// value is a literal of a comparison
+type value struct {
+	kind tokenKind // tokString, tokNumber, tokBool or tokNull
+	text string
+	pos  int
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokBool
+	tokNull
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// parse turns an expression into a tree. Precedence is not, then and, then or;
+// parentheses group.
+func parse(input string) (*node, error) {
+	if len(input) > MaxLength {
+		return nil, &Error{Pos: MaxLength, Msg: fmt.Sprintf("filter is longer than %d characters", MaxLength)}
+	}
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.text)}
+	}
+	return n, nil
+}
+
+type parser struct {
+	tokens      []token
+	next        int
+	comparisons int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+	return t
+}
+
+// keyword reports whether the next token is the (case-insensitive) keyword
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) or(depth int) (*node, error) {
+	left, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		pos := p.take().pos
+		right, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &node{op: "or", left: left, right: right, pos: pos}
+	}
+	return left, nil
+}
+
+func (p *parser) and(depth int) (*node, error) {
+	left, err := p.not(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		pos := p.take().pos
+		right, err := p.not(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &node{op: "and", left: left, right: right, pos: pos}
+	}
+	return left, nil
+}
+
+func (p *parser) not(depth int) (*node, error) {
+	if !p.keyword("not") {
+		return p.primary(depth)
+	}
+	pos := p.take().pos
+	if depth >= maxDepth {
+		return nil, &Error{Pos: pos, Msg: "filter is nested too deeply"}
+	}
+	operand, err := p.not(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &node{op: "not", left: operand, pos: pos}, nil
+}
+
+func (p *parser) primary(depth int) (*node, error) {
+	t := p.take()
+	switch t.kind {
+	case tokLParen:
+		if depth >= maxDepth {
+			return nil, &Error{Pos: t.pos, Msg: "filter is nested too deeply"}
+		}
+		n, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); closing.kind != tokRParen {
+			return nil, &Error{Pos: closing.pos, Msg: "expected )"}
+		}
+		return n, nil
+	case tokIdent:
+		return p.comparison(t)
+	case tokEOF:
+		return nil, &Error{Pos: t.pos, Msg: "unexpected end of filter"}
+	default:
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected a field name, got %q", t.text)}
+	}
+}
+
+// comparison parses the operator and value following a field name
+func (p *parser) comparison(field token) (*node, error) {
+	op := p.take()
+	if op.kind != tokIdent || !operators[strings.ToLower(op.text)] {
+		return nil, &Error{Pos: op.pos, Msg: fmt.Sprintf("expected an operator (eq, ne, gt, ge, lt, le, co, sw, ew) after %q", field.text)}
+	}
+	v := p.take()
+	switch v.kind {
+	case tokString, tokNumber, tokBool, tokNull:
+	default:
+		return nil, &Error{Pos: v.pos, Msg: "expected a value: a quoted string, number, true, false or null"}
+	}
+	p.comparisons++
+	if p.comparisons > maxComparisons {
+		return nil, &Error{Pos: field.pos, Msg: fmt.Sprintf("filter has more than %d comparisons", maxComparisons)}
+	}
+	return &node{
+		op:    strings.ToLower(op.text),
+		field: field.text,
+		value: value{kind: v.kind, text: v.text, pos: v.pos},
+		pos:   field.pos,
+	}, nil
+}
+
+// lex splits an expression into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case r == '"':
+			text, end, err := lexString(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: i})
+			i = end
+		case r == '-' || (r >= '0' && r <= '9'):
+			end := i + 1
+			for end < len(input) && (input[end] >= '0' && input[end] <= '9' || input[end] == '.') {
+				end++
+			}
+			text := input[i:end]
+			if _, err := strconv.ParseFloat(text, 64); err != nil {
+				return nil, &Error{Pos: i, Msg: fmt.Sprintf("invalid number %q", text)}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, pos: i})
+			i = end
+		case r == '_' || r < utf8.RuneSelf && unicode.IsLetter(r):
+			end := i + 1
+			for end < len(input) && isIdentByte(input[end]) {
+				end++
+			}
+			text := input[i:end]
+			kind := tokIdent
+			switch strings.ToLower(text) {
+			case "true", "false":
+				kind, text = tokBool, strings.ToLower(text)
+			case "null":
+				kind = tokNull
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: i})
+			i = end
+		default:
+			return nil, &Error{Pos: i, Msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, text: "end of filter", pos: len(input)}), nil
+}
+
+// lexString reads a double-quoted string starting at start, with \" and \\ escapes
+func lexString(input string, start int) (string, int, error) {
+	var b strings.Builder
+	for i := start + 1; i < len(input); i++ {
+		switch c := input[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(input) && (input[i+1] == '"' || input[i+1] == '\\') {
+				b.WriteByte(input[i+1])
+				i++
+				continue
+			}
+			return "", 0, &Error{Pos: i, Msg: `invalid escape; only \" and \\ are allowed`}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, &Error{Pos: start, Msg: "unterminated string"}
+}
+
+// isIdentByte reports whether c may continue a field name; dots separate the keys of
+// nested fields
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,82 @@
+// Package geoip resolves client IPs to a country, coordinates and network (ASN) using
+// MaxMind-format databases such as GeoLite2.
+package geoip
+
+import (
+	"errors"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Location is what is known about where an IP is. Fields are zero when unknown.
+type Location struct {
+	Country   string // ISO 3166-1 alpha-2
+	ASN       uint
+	Latitude  float64
+	Longitude float64
+	// HasCoordinates is set when the database resolved the IP to a city or region
+	HasCoordinates bool
+}
+
+// Locator looks up IP addresses
+type Locator interface {
+	Locate(ip string) Location
+	Close() error
+}
+
+// MaxMindLocator reads a City or Country database and, optionally, an ASN database
+type MaxMindLocator struct {
+	geo *geoip2.Reader
+	asn *geoip2.Reader
+}
+
+// Open opens the databases; asnPath may be empty
+func Open(geoPath, asnPath string) (*MaxMindLocator, error) {
+	geo, err := geoip2.Open(geoPath)
+	if err != nil {
+		return nil, err
+	}
+	ml := &MaxMindLocator{geo: geo}
+	if asnPath != "" {
+		if ml.asn, err = geoip2.Open(asnPath); err != nil {
+			geo.Close()
+			return nil, err
+		}
+	}
+	return ml, nil
+}
+
+// Locate resolves ip; unknown or private addresses give an empty Location
+func (ml *MaxMindLocator) Locate(ip string) Location {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return Location{}
+	}
+
+	var loc Location
+	if city, err := ml.geo.City(addr); err == nil {
+		loc.Country = city.Country.IsoCode
+		if city.Location.Latitude != 0 || city.Location.Longitude != 0 {
+			loc.Latitude, loc.Longitude = city.Location.Latitude, city.Location.Longitude
+			loc.HasCoordinates = true
+		}
+	} else if country, err := ml.geo.Country(addr); err == nil {
+		loc.Country = country.Country.IsoCode
+	}
+	if ml.asn != nil {
+		if asn, err := ml.asn.ASN(addr); err == nil {
+			loc.ASN = asn.AutonomousSystemNumber
+		}
+	}
+	return loc
+}
+
+// Close releases the databases
+func (ml *MaxMindLocator) Close() error {
+	var asnErr error
+	if ml.asn != nil {
+		asnErr = ml.asn.Close()
+	}
+	return errors.Join(ml.geo.Close(), asnErr)
+}
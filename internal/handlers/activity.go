@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// ActivityHandler lets users review what happened to their account
+type ActivityHandler struct {
+	activity repository.ActivityRepository
+}
+
+// NewActivityHandler creates a new activity handler
+func NewActivityHandler(activity repository.ActivityRepository) *ActivityHandler {
+	return &ActivityHandler{activity: activity}
+}
+
+// PageQuery holds the pagination parameters of a list
+type PageQuery struct {
+	Page    int `form:"page" json:"page" binding:"omitempty,min=1"`
+	PerPage int `form:"per_page" json:"per_page" binding:"omitempty,min=1,max=100"`
+}
+
+// ListActivityHandler returns a page of the current user's activity feed: logins,
+// new sessions, and changes to their profile and roles, newest first
+func (ah *ActivityHandler) ListActivityHandler(c *gin.Context) {
+	query := PageQuery{Page: 1, PerPage: 20}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	events, total, err := ah.activity.List(c.Request.Context(), actorID(c), (query.Page-1)*query.PerPage, query.PerPage)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	pagination := response.NewPagination(query.Page, query.PerPage, total)
+	response.OK(c, events,
+		response.WithPagination(pagination),
+		response.WithLinks(pageLinks(c, pagination)),
+	)
+}
+
+// actorID returns the ID of the authenticated user making the request
+func actorID(c *gin.Context) uint {
+	if user, ok := c.Get("user"); ok {
+		return user.(*models.User).ID
+	}
+	return 0
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apikeys"
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/ratelimit"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/service"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// usageDays is how many days of usage are returned by default
+const usageDays = 30
+
+// APIKeyHandler manages API keys and reports their usage
+type APIKeyHandler struct {
+	users    repository.UserRepository
+	registry *apikeys.Registry
+	// limiter has the rate limit tiers keys can be given
+	limiter *ratelimit.Limiter
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(users repository.UserRepository, registry *apikeys.Registry, limiter *ratelimit.Limiter) *APIKeyHandler {
+	return &APIKeyHandler{users: users, registry: registry, limiter: limiter}
+}
+
+// CreateAPIKeyRequest represents the JSON payload for creating an API key
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+	// UserID is the owner; defaults to the admin creating the key
+	UserID       uint   `json:"user_id"`
+	Tier         string `json:"tier" binding:"required"`
+	MonthlyQuota int64  `json:"monthly_quota" binding:"min=0"`
+}
+
+// APIKeyCreatedResponse carries a new key, which is shown only this once
+type APIKeyCreatedResponse struct {
+	APIKey models.APIKey `json:"api_key"`
+	Key    string        `json:"key"`
+}
+
+// SetAPIKeyQuotaRequest represents the JSON payload for setting a monthly quota
+type SetAPIKeyQuotaRequest struct {
+	MonthlyQuota *int64 `json:"monthly_quota" binding:"required,min=0"`
+}
+
+// APIKeyUsageQuery holds the date range of a usage report
+type APIKeyUsageQuery struct {
+	From string `form:"from" json:"from" binding:"omitempty,datetime=2006-01-02"`
+	To   string `form:"to" json:"to" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// APIKeyUsageResponse reports the requests made with an API key
+type APIKeyUsageResponse struct {
+	APIKeyID     uint  `json:"api_key_id"`
+	MonthlyQuota int64 `json:"monthly_quota"`
+	// MonthToDate counts this calendar month's requests (UTC)
+	MonthToDate int64                `json:"month_to_date"`
+	Days        []models.APIKeyUsage `json:"days"`
+}
+
+// ListAPIKeysHandler returns the API keys of the current user; admins see all keys
+func (ah *APIKeyHandler) ListAPIKeysHandler(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	owner := user.ID
+	if service.IsAdmin(user) {
+		owner = 0
+	}
+	keys, err := ah.registry.List(c.Request.Context(), owner)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	response.OK(c, keys)
+}
+
+// CreateAPIKeyHandler issues a new API key (admin only)
+func (ah *APIKeyHandler) CreateAPIKeyHandler(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	if !slices.Contains(ah.limiter.Tiers(), req.Tier) {
+		problem.Write(c, apperr.ErrUnknownTier.WithDetail("Configured tiers are listed in RATE_LIMIT_TIERS"))
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if req.UserID == 0 {
+		req.UserID = user.ID
+	} else if _, err := ah.users.FindByID(c.Request.Context(), req.UserID); err != nil {
+		problem.Write(c, userError(err))
+		return
+	}
+
+	key, hash, err := apikeys.Generate()
+	if err != nil {
+		problem.Write(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+	apiKey := models.APIKey{
+		UserID:       req.UserID,
+		Name:         req.Name,
+		Prefix:       apikeys.Prefix(key),
+		Hash:         hash,
+		Tier:         req.Tier,
+		MonthlyQuota: req.MonthlyQuota,
+	}
+	if err := ah.registry.Create(c.Request.Context(), &apiKey); err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	ah.sync(c)
+
+	response.Created(c, APIKeyCreatedResponse{APIKey: apiKey, Key: key})
+}
+
+// SetAPIKeyQuotaHandler sets the monthly request quota of an API key; 0 removes it
+// (admin only)
+func (ah *APIKeyHandler) SetAPIKeyQuotaHandler(c *gin.Context) {
+	var req SetAPIKeyQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	apiKey, ok := ah.apiKeyByID(c)
+	if !ok {
+		return
+	}
+	if err := ah.registry.SetQuota(c.Request.Context(), apiKey, *req.MonthlyQuota); err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	ah.sync(c)
+
+	response.OK(c, apiKey)
+}
+
+// RevokeAPIKeyHandler revokes an API key; requests with it then count as anonymous
+// (admin only)
+func (ah *APIKeyHandler) RevokeAPIKeyHandler(c *gin.Context) {
+	apiKey, ok := ah.apiKeyByID(c)
+	if !ok {
+		return
+	}
+	if apiKey.RevokedAt == nil {
+		if err := ah.registry.Revoke(c.Request.Context(), apiKey); err != nil {
+			problem.Write(c, apperr.ErrDatabase.Wrap(err))
+			return
+		}
+		ah.sync(c)
+	}
+
+	response.OK(c, MessageResponse{Message: "API key revoked"})
+}
+
+// APIKeyUsageHandler returns the daily request counts of an API key, by default for
+// the last 30 days. Owners may see the usage of their own keys, admins of every key.
+func (ah *APIKeyHandler) APIKeyUsageHandler(c *gin.Context) {
+	var query APIKeyUsageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	apiKey, ok := ah.apiKeyByID(c)
+	if !ok {
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if apiKey.UserID != user.ID && !service.IsAdmin(user) {
+		// Don't reveal which IDs belong to others
+		problem.Write(c, apperr.ErrAPIKeyNotFound)
+		return
+	}
+
+	now := time.Now().UTC()
+	if query.To == "" {
+		query.To = now.Format("2006-01-02")
+	}
+	if query.From == "" {
+		query.From = now.AddDate(0, 0, -(usageDays - 1)).Format("2006-01-02")
+	}
+
+	days, err := ah.registry.Usage(c.Request.Context(), apiKey.ID, query.From, query.To)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	response.OK(c, APIKeyUsageResponse{
+		APIKeyID:     apiKey.ID,
+		MonthlyQuota: apiKey.MonthlyQuota,
+		MonthToDate:  ah.registry.MonthToDate(apiKey.ID, now),
+		Days:         days,
+	})
+}
+
+// apiKeyByID loads the API key named by the :id path parameter
+func (ah *APIKeyHandler) apiKeyByID(c *gin.Context) (*models.APIKey, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		problem.Write(c, apperr.ErrAPIKeyNotFound)
+		return nil, false
+	}
+	apiKey, err := ah.registry.Get(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, apikeys.ErrNotFound) {
+			problem.Write(c, apperr.ErrAPIKeyNotFound)
+			return nil, false
+		}
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return nil, false
+	}
+	return apiKey, true
+}
+
+// sync makes key changes take effect on this instance right away; other instances
+// pick them up on their next sync
+func (ah *APIKeyHandler) sync(c *gin.Context) {
+	if err := ah.registry.Sync(c.Request.Context()); err != nil {
+		logging.Warn(c.Request.Context(), "failed to sync API keys", "error", err)
+	}
+}
+
+// currentUser returns the authenticated user, answering 401 if there is none
+func currentUser(c *gin.Context) (*models.User, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return nil, false
+	}
+	return user.(*models.User), true
+}
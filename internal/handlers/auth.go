@@ -1,48 +1,109 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
 	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/etag"
+	"github.com/ristep/um_starter_jwt_go/internal/filter"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/loginrisk"
 	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/service"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
 )
 
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
-	db         *gorm.DB
-	jwtService *auth.JWTService
+	service       *service.AuthService
+	users         repository.UserRepository
+	tokenRepo     repository.TokenRepository
+	tokens        auth.TokenService
+	profileFields *validation.FieldSchema
+	sessions      sessions.Store
+	revocations   sessions.RevocationList
+	grace         *sessions.Grace
+	authCfg       config.AuthConfig
+	loginRisk     LoginRiskPolicy
+	registration  RegistrationMail
 }
 
-// NewAuthHandler creates a new auth handler
-func NewAuthHandler(db *gorm.DB, jwtService *auth.JWTService) *AuthHandler {
+// NewAuthHandler creates a new auth handler. grace lets clients refresh with the same
+// token in parallel; registration mails the registration confirmations sent under
+// enumeration protection.
+func NewAuthHandler(svc *service.AuthService, users repository.UserRepository, tokenRepo repository.TokenRepository, tokens auth.TokenService, profileFields *validation.FieldSchema, sessions sessions.Store, revocations sessions.RevocationList, grace *sessions.Grace, authCfg config.AuthConfig, loginRisk LoginRiskPolicy, registration RegistrationMail) *AuthHandler {
 	return &AuthHandler{
-		db:         db,
-		jwtService: jwtService,
+		service:       svc,
+		users:         users,
+		tokenRepo:     tokenRepo,
+		tokens:        tokens,
+		profileFields: profileFields,
+		sessions:      sessions,
+		revocations:   revocations,
+		grace:         grace,
+		authCfg:       authCfg,
+		loginRisk:     loginRisk,
+		registration:  registration,
 	}
 }
 
 // RegisterRequest represents the JSON payload for registration
 type RegisterRequest struct {
-	Email    string `json:"email" binding:"required,email"`
+	Email string `json:"email" binding:"required,email"`
+	// Username is optional; it is matched case-insensitively
+	Username string `json:"username" binding:"omitempty,username"`
 	Password string `json:"password" binding:"required,min=8"`
 	Name     string `json:"name" binding:"required,min=2"`
-	Tel      string `json:"tel"`
-	Age      int    `json:"age"`
-	Gender   string `json:"gender"`
-	Address  string `json:"address"`
-	City     string `json:"city"`
-	Country  string `json:"country"`
+	Tel      string `json:"tel" binding:"omitempty,phone"`
+	// DateOfBirth is a "2006-01-02" date; the age it gives must be within the configured limits
+	DateOfBirth string `json:"date_of_birth" binding:"omitempty,birthdate"`
+	// Gender is one of the configured options or self_described, which requires
+	// GenderDescription
+	Gender            string `json:"gender" binding:"omitempty,gender"`
+	GenderDescription string `json:"gender_description"`
+	Address           string `json:"address" binding:"omitempty,max=200,printable"`
+	City              string `json:"city" binding:"omitempty,max=100,printable"`
+	// Country is an ISO 3166-1 alpha-2 or alpha-3 code, stored as alpha-2
+	Country string `json:"country" binding:"omitempty,country"`
+	// Metadata holds the deployment's custom profile fields and any other attributes
+	Metadata models.Metadata `json:"metadata"`
+	// AcceptTerms accepts the current terms of service and privacy policy; it must be
+	// true when the deployment sets document versions
+	AcceptTerms bool `json:"accept_terms"`
 }
 
-// LoginRequest represents the JSON payload for login
+// LoginRequest represents the JSON payload for login. Either email or username
+// identifies the account.
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
+	Email    string `json:"email" binding:"omitempty,email"`
+	Username string `json:"username" binding:"required_without=Email"`
 	Password string `json:"password" binding:"required"`
+	// OTP is the authenticator code, required once two-factor authentication is enabled
+	OTP string `json:"otp"`
+}
+
+// UsernameAvailabilityQuery represents the query of a username availability check
+type UsernameAvailabilityQuery struct {
+	Username string `form:"username" json:"username" binding:"required,username"`
+}
+
+// UsernameAvailabilityResponse reports whether a username can be registered
+type UsernameAvailabilityResponse struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
 }
 
 // RefreshRequest represents the JSON payload for refresh token
@@ -50,87 +111,111 @@ type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
-// SuccessResponse represents a successful API response
-type SuccessResponse struct {
-	Data interface{} `json:"data"`
+// ReauthenticateRequest represents the JSON payload for confirming the password
+type ReauthenticateRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+	Password     string `json:"password" binding:"required"`
+}
+
+// AuthResponse represents the payload returned after registration or login
+type AuthResponse struct {
+	User         models.User `json:"user"`
+	AccessToken  string      `json:"access_token"`
+	RefreshToken string      `json:"refresh_token"`
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int64 `json:"expires_in"`
+	// TwoFactorSetupRequired is set when the user's role requires two-factor
+	// authentication they haven't set up; the access token then only reaches the setup
+	// routes and there is no refresh token
+	TwoFactorSetupRequired bool `json:"two_factor_setup_required,omitempty"`
+	// PasswordExpired is set when the password is older than the maximum age; the
+	// tokens then only reach the routes for changing it
+	PasswordExpired bool `json:"password_expired,omitempty"`
 }
 
-// ErrorResponse represents an error API response
-type ErrorResponse struct {
-	Error string `json:"error"`
+// TokenResponse represents the payload returned after a token refresh
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int64 `json:"expires_in"`
 }
 
-// RegisterHandler handles user registration
+// MessageResponse represents a payload carrying only a human-readable message
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// RegisterHandler handles user registration. With enumeration protection the account
+// is only created once the address confirms it, and the answer is the same whether or
+// not the email is taken.
 func (ah *AuthHandler) RegisterHandler(c *gin.Context) {
 	var req RegisterRequest
 
 	// Validate JSON input
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		problem.Write(c, validation.Translate(c, err))
 		return
 	}
-
-	// Check if user already exists
-	var existingUser models.User
-	if err := ah.db.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "User already exists"})
-		return
-	} else if err != gorm.ErrRecordNotFound {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+	if err := ah.profileFields.Validate(c, req.Metadata); err != nil {
+		problem.Write(c, err)
 		return
 	}
-
-	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	genderDescription, err := validation.GenderDescription(c, req.Gender, req.GenderDescription)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to process password"})
+		problem.Write(c, err)
 		return
 	}
 
-	// Get or create the default "user" role
-	var userRole models.Role
-	if err := ah.db.FirstOrCreate(&userRole, models.Role{Name: "user"}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
-		return
+	if len(ah.service.RequiredConsents()) > 0 {
+		if err := validation.Var(c, "accept_terms", req.AcceptTerms, "eq=true"); err != nil {
+			problem.Write(c, err)
+			return
+		}
 	}
 
-	// Create the new user
-	newUser := models.User{
-		Email:    req.Email,
-		Password: string(hashedPassword),
-		Name:     req.Name,
-		Tel:      req.Tel,
-		Age:      req.Age,
-		Gender:   req.Gender,
-		Address:  req.Address,
-		City:     req.City,
-		Country:  req.Country,
-		Roles:    []models.Role{userRole},
+	reg := service.Registration{
+		Email:             req.Email,
+		Username:          req.Username,
+		Password:          req.Password,
+		Name:              req.Name,
+		Tel:               normalizeTel(req.Tel),
+		DateOfBirth:       parseDateOfBirth(req.DateOfBirth),
+		Gender:            req.Gender,
+		Address:           validation.NormalizeAddress(req.Address),
+		City:              validation.NormalizeCity(req.City),
+		Country:           normalizeCountry(req.Country),
+		Metadata:          req.Metadata,
+		GenderDescription: genderDescription,
 	}
-
-	if err := ah.db.Create(&newUser).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create user"})
+	if ah.authCfg.EnumerationProtection {
+		ah.requestRegistration(c, reg)
 		return
 	}
 
-	// Load the user with roles
-	if err := ah.db.Preload("Roles").First(&newUser, newUser.ID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve user"})
+	user, err := ah.service.Register(c.Request.Context(), reg, client(c))
+	if err != nil {
+		problem.Write(c, err)
 		return
 	}
+	ah.respondRegistered(c, user)
+}
 
+// respondRegistered logs a newly created user in
+func (ah *AuthHandler) respondRegistered(c *gin.Context, user *models.User) {
 	// Generate tokens
-	tokenPair, err := ah.jwtService.GenerateTokenPair(&newUser)
+	tokenPair, err := ah.service.IssueTokens(c.Request.Context(), user, auth.Authenticated(auth.MethodPassword), nil, client(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		problem.Write(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, SuccessResponse{Data: map[string]interface{}{
-		"user":          newUser,
-		"access_token":  tokenPair.AccessToken,
-		"refresh_token": tokenPair.RefreshToken,
-	}})
+	response.Created(c, AuthResponse{
+		User:         *user,
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+		ExpiresIn:    tokenPair.ExpiresIn,
+	}, response.WithLinks(response.Links{"profile": "/api/profile"}))
 }
 
 // LoginHandler handles user login
@@ -139,39 +224,127 @@ func (ah *AuthHandler) LoginHandler(c *gin.Context) {
 
 	// Validate JSON input
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	user, authn, err := ah.service.Authenticate(c.Request.Context(), service.Credentials{
+		Email:    req.Email,
+		Username: req.Username,
+		Password: req.Password,
+		OTP:      req.OTP,
+	}, client(c))
+	if err != nil {
+		problem.Write(c, err)
 		return
 	}
 
-	// Find user by email
-	var user models.User
-	if err := ah.db.Preload("Roles").Where("email = ?", req.Email).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid email or password"})
+	// Logins from unusual places are flagged, and may need confirming by email first
+	assessment := ah.assessLogin(c, user)
+	if assessment.Suspicious() && ah.loginRisk.Confirm {
+		confirmed, err := ah.loginConfirmed(c, user.ID)
+		if err != nil {
+			problem.Write(c, apperr.ErrDatabase.Wrap(err))
+			return
+		}
+		if !confirmed {
+			ah.service.RecordLogin(c.Request.Context(), user.ID, client(c), false, assessment)
+			ah.requestLoginConfirmation(c, user, assessment)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
-		return
 	}
 
-	// Compare passwords
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid email or password"})
+	// Users whose role requires two-factor authentication only get to set it up
+	if ah.service.TwoFactorSetupRequired(user) {
+		tokenPair, err := ah.tokens.GenerateScopedToken(user, authn, auth.ScopeTwoFactorSetup)
+		if err != nil {
+			problem.Write(c, apperr.ErrTokenGeneration)
+			return
+		}
+		ah.service.RecordLogin(c.Request.Context(), user.ID, client(c), true, assessment)
+
+		response.OK(c, AuthResponse{
+			User:                   *user,
+			AccessToken:            tokenPair.AccessToken,
+			ExpiresIn:              tokenPair.ExpiresIn,
+			TwoFactorSetupRequired: true,
+		}, response.WithLinks(response.Links{"setup": "/api/profile/2fa/setup"}))
 		return
 	}
 
 	// Generate tokens
-	tokenPair, err := ah.jwtService.GenerateTokenPair(&user)
+	tokenPair, err := ah.service.IssueTokens(c.Request.Context(), user, authn, nil, client(c))
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+	ah.service.RecordLogin(c.Request.Context(), user.ID, client(c), true, assessment)
+
+	links := response.Links{"profile": "/api/profile"}
+	expired := ah.passwordExpiry(c, user)
+	if expired {
+		links = response.Links{"change_password": "/api/profile/password"}
+	}
+	response.OK(c, AuthResponse{
+		User:            *user,
+		AccessToken:     tokenPair.AccessToken,
+		RefreshToken:    tokenPair.RefreshToken,
+		ExpiresIn:       tokenPair.ExpiresIn,
+		PasswordExpired: expired,
+	}, response.WithLinks(links))
+}
+
+// client describes the device a request comes from
+func client(c *gin.Context) service.Client {
+	return service.Client{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
+// sessionAuthentication returns how the user of a session authenticated
+func sessionAuthentication(session *models.RefreshToken) auth.Authentication {
+	authn := auth.Authentication{Time: time.UnixMilli(session.AuthenticatedAt)}
+	// Sessions from before login times were recorded start at their creation
+	if session.AuthenticatedAt == 0 {
+		authn.Time = time.UnixMilli(session.CreatedAt)
+	}
+	if session.AuthMethods != "" {
+		authn.Methods = strings.Split(session.AuthMethods, ",")
+	}
+	return authn
+}
+
+// parseDateOfBirth converts a date that passed the "birthdate" rule; empty gives nil
+func parseDateOfBirth(s string) *models.Date {
+	dob, err := models.ParseDate(s)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		return nil
+	}
+	return &dob
+}
+
+// normalizeCountry returns the alpha-2 form of a code that passed the "country" rule
+func normalizeCountry(code string) string {
+	if normalized, ok := validation.NormalizeCountry(code); ok {
+		return normalized
+	}
+	return code
+}
+
+// UsernameAvailableHandler reports whether a username is valid and not yet taken
+func (ah *AuthHandler) UsernameAvailableHandler(c *gin.Context) {
+	var query UsernameAvailabilityQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	username := validation.NormalizeUsername(query.Username)
+	taken, err := ah.users.UsernameTaken(c.Request.Context(), username)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]interface{}{
-		"user":          user,
-		"access_token":  tokenPair.AccessToken,
-		"refresh_token": tokenPair.RefreshToken,
-	}})
+	response.OK(c, UsernameAvailabilityResponse{Username: username, Available: !taken})
 }
 
 // RefreshHandler handles token refresh
@@ -180,39 +353,188 @@ func (ah *AuthHandler) RefreshHandler(c *gin.Context) {
 
 	// Validate JSON input
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		problem.Write(c, validation.Translate(c, err))
 		return
 	}
 
-	// Validate the refresh token
-	claims, err := ah.jwtService.ValidateRefreshToken(req.RefreshToken)
+	// Parallel refreshes with the token, e.g. from several tabs, share one new pair.
+	// The token is validated only when it is actually used: opaque refresh tokens are
+	// deleted on first use, and later refreshes in the grace period get its result.
+	result, err := ah.grace.Refresh(c.Request.Context(), req.RefreshToken, func() ([]byte, error) {
+		claims, err := ah.tokens.ValidateRefreshToken(req.RefreshToken)
+		if err != nil {
+			return nil, apperr.ErrInvalidRefreshToken
+		}
+		tokens, err := ah.refresh(c, claims, req.RefreshToken)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(tokens)
+	})
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid refresh token"})
+		problem.Write(c, err)
+		return
+	}
+	var tokens TokenResponse
+	if err := json.Unmarshal(result, &tokens); err != nil {
+		problem.Write(c, apperr.ErrInternal.Wrap(err))
 		return
 	}
 
-	// Fetch the user from the database
-	var user models.User
-	if err := ah.db.Preload("Roles").First(&user, claims.UserID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not found"})
+	response.OK(c, tokens)
+}
+
+// refresh exchanges a validated refresh token for a new token pair
+func (ah *AuthHandler) refresh(c *gin.Context, claims *auth.CustomClaims, refreshToken string) (*TokenResponse, error) {
+	// The token must belong to an active session; using it ends that session so a
+	// stolen token can be replayed at most once
+	session, err := ah.sessions.Use(c.Request.Context(), sessions.Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, sessions.ErrNotFound) {
+			return nil, apperr.ErrInvalidRefreshToken
+		}
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	if session.UserID != claims.UserID {
+		return nil, apperr.ErrInvalidRefreshToken
+	}
+	// Server-side tokens of the used refresh token can go right away
+	if revoker, ok := ah.tokens.(auth.Revoker); ok {
+		if err := revoker.Revoke(c.Request.Context(), refreshToken); err != nil {
+			logging.Warn(c.Request.Context(), "failed to delete used refresh token", "user_id", session.UserID, "error", err)
+		}
+	}
+
+	user, err := ah.service.SessionUser(c.Request.Context(), claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate a new token pair
+	tokenPair, err := ah.service.IssueTokens(c.Request.Context(), user, sessionAuthentication(session), session, client(c))
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+		ExpiresIn:    tokenPair.ExpiresIn,
+	}, nil
+}
+
+// ReauthenticateHandler confirms the password of a signed-in user and replaces their
+// refresh token with one whose tokens carry a fresh auth_time, as routes guarded by
+// RequireRecentAuth demand
+func (ah *AuthHandler) ReauthenticateHandler(c *gin.Context) {
+	var req ReauthenticateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	claims, err := ah.tokens.ValidateRefreshToken(req.RefreshToken)
+	if err != nil {
+		problem.Write(c, apperr.ErrInvalidRefreshToken)
+		return
+	}
+
+	user, err := ah.service.SessionUser(c.Request.Context(), claims)
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+
+	// Check the password before touching the session, so a typo doesn't sign the
+	// user out
+	if err := ah.service.CheckPassword(c.Request.Context(), user, req.Password, client(c)); err != nil {
+		problem.Write(c, err)
+		return
+	}
+
+	session, err := ah.sessions.Use(c.Request.Context(), sessions.Hash(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, sessions.ErrNotFound) {
+			problem.Write(c, apperr.ErrInvalidRefreshToken)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	if session.UserID != user.ID {
+		problem.Write(c, apperr.ErrInvalidRefreshToken)
 		return
 	}
+	if revoker, ok := ah.tokens.(auth.Revoker); ok {
+		if err := revoker.Revoke(c.Request.Context(), req.RefreshToken); err != nil {
+			logging.Warn(c.Request.Context(), "failed to delete used refresh token", "user_id", user.ID, "error", err)
+		}
+	}
 
-	// Generate a new token pair
-	tokenPair, err := ah.jwtService.GenerateTokenPair(&user)
+	// Confirming the password counts as a new login for the session lifetime
+	tokenPair, err := ah.service.IssueTokens(c.Request.Context(), user, auth.Authenticated(auth.MethodPassword), nil, client(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		problem.Write(c, err)
+		return
+	}
+	ah.service.RecordLogin(c.Request.Context(), user.ID, client(c), true, loginrisk.Assessment{})
+
+	response.OK(c, TokenResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+		ExpiresIn:    tokenPair.ExpiresIn,
+	})
+}
+
+// LogoutHandler ends the session of a refresh token. Unknown or already revoked
+// tokens are accepted so logging out twice is harmless. An access token sent in the
+// Authorization header is revoked as well.
+func (ah *AuthHandler) LogoutHandler(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]interface{}{
-		"access_token":  tokenPair.AccessToken,
-		"refresh_token": tokenPair.RefreshToken,
-	}})
+	ctx := c.Request.Context()
+	if _, err := ah.sessions.Use(ctx, sessions.Hash(req.RefreshToken)); err != nil && !errors.Is(err, sessions.ErrNotFound) {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	if revoker, ok := ah.tokens.(auth.Revoker); ok {
+		if err := revoker.Revoke(ctx, req.RefreshToken); err != nil {
+			problem.Write(c, apperr.ErrInternal.WithDetail("Failed to revoke refresh token").Wrap(err))
+			return
+		}
+	}
+
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		if claims, err := ah.tokens.ValidateToken(token); err == nil {
+			if err := revokeAccessToken(c, ah.tokens, ah.revocations, token, claims); err != nil {
+				problem.Write(c, err)
+				return
+			}
+		}
+	}
+
+	response.OK(c, MessageResponse{Message: "Logged out"})
+}
+
+// revokeAccessToken puts the token on the revocation list until it expires. Tokens
+// kept server-side are deleted as well.
+func revokeAccessToken(c *gin.Context, tokens auth.TokenService, revocations sessions.RevocationList, token string, claims *auth.CustomClaims) error {
+	if revoker, ok := tokens.(auth.Revoker); ok {
+		if err := revoker.Revoke(c.Request.Context(), token); err != nil {
+			return apperr.ErrInternal.WithDetail("Failed to revoke access token").Wrap(err)
+		}
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	if err := revocations.Revoke(c.Request.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+		return apperr.ErrInternal.WithDetail("Failed to revoke access token").Wrap(err)
+	}
+	return nil
 }
 
 // ProfileHandler returns the current user's profile
@@ -220,171 +542,264 @@ func (ah *AuthHandler) ProfileHandler(c *gin.Context) {
 	// Get user from context (set by middleware)
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		problem.Write(c, apperr.ErrUnauthorized)
 		return
 	}
 
 	userObj, ok := user.(*models.User)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Invalid user data"})
+		problem.Write(c, apperr.ErrInternal.WithDetail("Invalid user data"))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: userObj})
+	tag := etag.Weak(userObj.ID, userObj.UpdatedAt)
+	etag.Set(c, tag)
+	if etag.NotModified(c, tag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	response.OK(c, userObj, response.WithLinks(response.Links{"self": "/api/profile"}))
 }
 
 // UserHandler represents handlers for user management
 type UserHandler struct {
-	db *gorm.DB
+	service       *service.UserService
+	users         repository.UserRepository
+	profileFields *validation.FieldSchema
 }
 
 // NewUserHandler creates a new user handler
-func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{db: db}
+func NewUserHandler(svc *service.UserService, users repository.UserRepository, profileFields *validation.FieldSchema) *UserHandler {
+	return &UserHandler{service: svc, users: users, profileFields: profileFields}
+}
+
+// ListUsersQuery holds the pagination parameters of the user list
+type ListUsersQuery struct {
+	Page    int `form:"page" json:"page" binding:"omitempty,min=1"`
+	PerPage int `form:"per_page" json:"per_page" binding:"omitempty,min=1,max=100"`
 }
 
-// GetAllUsersHandler returns all users (admin only)
+// GetAllUsersHandler returns a page of users (admin only)
 func (uh *UserHandler) GetAllUsersHandler(c *gin.Context) {
-	var users []models.User
+	query := ListUsersQuery{Page: 1, PerPage: 20}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
 
-	if err := uh.db.Preload("Roles").Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+	filters, err := metadataFilters(c)
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+	tags, err := tagFilters(c)
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+	var condition *filter.Condition
+	if expr := c.Query("filter"); expr != "" {
+		if condition, err = filter.Compile(expr, repository.UserFilterSchema()); err != nil {
+			problem.Write(c, apperr.ErrInvalidFilter.WithDetail(err.Error()))
+			return
+		}
+	}
+
+	users, total, err := uh.users.List(c.Request.Context(), repository.UserQuery{
+		Metadata: filters,
+		Tags:     tags,
+		Filter:   condition,
+		Offset:   (query.Page - 1) * query.PerPage,
+		Limit:    query.PerPage,
+	})
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: users})
+	pagination := response.NewPagination(query.Page, query.PerPage, total)
+	response.OK(c, users,
+		response.WithPagination(pagination),
+		response.WithLinks(pageLinks(c, pagination)),
+	)
+}
+
+// pageLinks builds self/first/prev/next/last links for a paginated list
+func pageLinks(c *gin.Context, p *response.Pagination) response.Links {
+	link := func(page int) string {
+		u := *c.Request.URL
+		q := u.Query()
+		q.Set("page", strconv.Itoa(page))
+		q.Set("per_page", strconv.Itoa(p.PerPage))
+		u.RawQuery = q.Encode()
+		return u.RequestURI()
+	}
+
+	links := response.Links{"self": link(p.Page), "first": link(1)}
+	if p.TotalPages > 0 {
+		links["last"] = link(p.TotalPages)
+	}
+	if p.Page > 1 {
+		links["prev"] = link(min(p.Page-1, max(p.TotalPages, 1)))
+	}
+	if p.Page < p.TotalPages {
+		links["next"] = link(p.Page + 1)
+	}
+	return links
+}
+
+// userLinks returns the links of a user resource
+func userLinks(user models.User) response.Links {
+	self := "/api/users/" + strconv.FormatUint(uint64(user.ID), 10)
+	return response.Links{"self": self, "roles": self + "/roles"}
 }
 
 // GetUserByIDHandler returns a specific user by ID (admin only)
 func (uh *UserHandler) GetUserByIDHandler(c *gin.Context) {
-	userID := c.Param("id")
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	user, err := uh.users.FindByIDFromReplica(c.Request.Context(), userID)
+	if err != nil {
+		problem.Write(c, userError(err))
+		return
+	}
 
-	var user models.User
-	if err := uh.db.Preload("Roles").First(&user, userID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+	tag := etag.Weak(user.ID, user.UpdatedAt)
+	etag.Set(c, tag)
+	if etag.NotModified(c, tag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: user})
+	response.OK(c, user, response.WithLinks(userLinks(*user)))
 }
 
 // UpdateUserRequest represents the JSON payload for user updates
 type UpdateUserRequest struct {
-	Name    string `json:"name" binding:"omitempty,min=2"`
-	Tel     string `json:"tel"`
-	Age     int    `json:"age"`
-	Address string `json:"address"`
-	City    string `json:"city"`
-	Country string `json:"country"`
-	Gender  string `json:"gender"`
+	Name string `json:"name" binding:"omitempty,min=2"`
+	Tel  string `json:"tel" binding:"omitempty,phone"`
+	// DateOfBirth is a "2006-01-02" date
+	DateOfBirth string `json:"date_of_birth" binding:"omitempty,birthdate"`
+	Address     string `json:"address" binding:"omitempty,max=200,printable"`
+	City        string `json:"city" binding:"omitempty,max=100,printable"`
+	// Country is an ISO 3166-1 alpha-2 or alpha-3 code, stored as alpha-2
+	Country string `json:"country" binding:"omitempty,country"`
+	// Gender is one of the configured options or self_described, which requires
+	// GenderDescription
+	Gender            string `json:"gender" binding:"omitempty,gender"`
+	GenderDescription string `json:"gender_description"`
+	// Metadata keys are merged into the user's metadata
+	Metadata models.Metadata `json:"metadata"`
+	// Version, when set, must equal the user's current version or the update is rejected
+	Version *uint `json:"version"`
 }
 
 // UpdateUserHandler updates a user (user can update self, admin can update anyone)
 func (uh *UserHandler) UpdateUserHandler(c *gin.Context) {
-	userID := c.Param("id")
-	var req UpdateUserRequest
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
-
-	// Get current user from context
 	currentUser, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		problem.Write(c, apperr.ErrUnauthorized)
 		return
 	}
+	actor := currentUser.(*models.User)
 
-	currentUserObj := currentUser.(*models.User)
-
-	// Check if user is trying to update someone else (must be admin)
-	if userID != string(rune(currentUserObj.ID)) {
-		// Check if current user is admin
-		isAdmin := false
-		for _, role := range currentUserObj.Roles {
-			if role.Name == "admin" {
-				isAdmin = true
-				break
-			}
-		}
-		if !isAdmin {
-			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Forbidden"})
-			return
-		}
+	user, err := uh.service.Editable(c.Request.Context(), actor, userID)
+	if err != nil {
+		problem.Write(c, err)
+		return
 	}
 
-	var user models.User
-	if err := uh.db.First(&user, userID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+	uh.updateUser(c, actor.ID, user, userLinks(*user))
+}
+
+// UpdateProfileHandler updates the current user's profile
+func (uh *UserHandler) UpdateProfileHandler(c *gin.Context) {
+	user, ok := uh.currentUser(c)
+	if !ok {
 		return
 	}
 
-	// Update fields
-	if req.Name != "" {
-		user.Name = req.Name
-	}
-	if req.Tel != "" {
-		user.Tel = req.Tel
-	}
-	if req.Age != 0 {
-		user.Age = req.Age
-	}
-	if req.Address != "" {
-		user.Address = req.Address
-	}
-	if req.City != "" {
-		user.City = req.City
-	}
-	if req.Country != "" {
-		user.Country = req.Country
-	}
-	if req.Gender != "" {
-		user.Gender = req.Gender
+	uh.updateUser(c, user.ID, user, response.Links{"self": "/api/profile"})
+}
+
+// updateUser applies an UpdateUserRequest by the actor to a user and saves it
+func (uh *UserHandler) updateUser(c *gin.Context, actorID uint, user *models.User, links response.Links) {
+	var req UpdateUserRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
 	}
-	if req.Tel != "" {
-		user.Tel = req.Tel
+	genderDescription, err := validation.GenderDescription(c, req.Gender, req.GenderDescription)
+	if err != nil {
+		problem.Write(c, err)
+		return
 	}
 
-	if err := uh.db.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update user"})
+	// Reject the write if the client's copy is stale
+	if etag.PreconditionFailed(c, etag.Weak(user.ID, user.UpdatedAt)) {
+		problem.Write(c, apperr.ErrPreconditionFailed)
 		return
 	}
 
-	// Reload with roles
-	uh.db.Preload("Roles").First(&user, userID)
+	user, err = uh.service.Update(c.Request.Context(), actorID, user, service.ProfileUpdate{
+		Name:              req.Name,
+		Tel:               normalizeTel(req.Tel),
+		DateOfBirth:       parseDateOfBirth(req.DateOfBirth),
+		Address:           validation.NormalizeAddress(req.Address),
+		City:              validation.NormalizeCity(req.City),
+		Country:           normalizeCountry(req.Country),
+		Gender:            req.Gender,
+		GenderDescription: genderDescription,
+		Metadata:          req.Metadata,
+		Version:           req.Version,
+	}, func(metadata models.Metadata) error {
+		return uh.profileFields.Validate(c, metadata)
+	})
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: user})
+	etag.Set(c, etag.Weak(user.ID, user.UpdatedAt))
+	response.OK(c, user, response.WithLinks(links))
 }
 
 // DeleteUserHandler deletes a user (admin only)
 func (uh *UserHandler) DeleteUserHandler(c *gin.Context) {
-	userID := c.Param("id")
+	user, ok := uh.userByID(c)
+	if !ok {
+		return
+	}
 
-	var user models.User
-	if err := uh.db.First(&user, userID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+	if err := uh.users.Delete(c.Request.Context(), user); err != nil {
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to delete user").Wrap(err))
+		return
+	}
+
+	response.OK(c, MessageResponse{Message: "User deleted successfully"})
+}
+
+// DeleteProfileHandler deletes the current user's account
+func (uh *UserHandler) DeleteProfileHandler(c *gin.Context) {
+	user, ok := uh.currentUser(c)
+	if !ok {
 		return
 	}
 
-	if err := uh.db.Delete(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete user"})
+	if err := uh.users.Delete(c.Request.Context(), user); err != nil {
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to delete account").Wrap(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "User deleted successfully"}})
+	response.OK(c, MessageResponse{Message: "Account deleted successfully"})
 }
 
 // AssignRoleRequest represents the JSON payload for assigning roles
@@ -394,52 +809,25 @@ type AssignRoleRequest struct {
 
 // AssignRoleHandler assigns a role to a user (admin only)
 func (uh *UserHandler) AssignRoleHandler(c *gin.Context) {
-	userID := c.Param("id")
 	var req AssignRoleRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
-		return
-	}
-
-	// Normalize role name
-	roleName := strings.ToLower(strings.TrimSpace(req.RoleName))
-
-	var user models.User
-	if err := uh.db.Preload("Roles").First(&user, userID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		problem.Write(c, validation.Translate(c, err))
 		return
 	}
 
-	// Find or create the role
-	var role models.Role
-	if err := uh.db.FirstOrCreate(&role, models.Role{Name: roleName}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
-
-	// Check if user already has this role
-	for _, r := range user.Roles {
-		if r.ID == role.ID {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "User already has this role"})
-			return
-		}
-	}
-
-	// Assign the role
-	if err := uh.db.Model(&user).Association("Roles").Append(&role); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to assign role"})
+	user, err := uh.service.AssignRole(c.Request.Context(), actorID(c), userID, req.RoleName)
+	if err != nil {
+		problem.Write(c, err)
 		return
 	}
 
-	// Reload user with roles
-	uh.db.Preload("Roles").First(&user, userID)
-
-	c.JSON(http.StatusOK, SuccessResponse{Data: user})
+	etag.Set(c, etag.Weak(user.ID, user.UpdatedAt))
+	response.OK(c, user, response.WithLinks(userLinks(*user)))
 }
 
 // RemoveRoleRequest represents the JSON payload for removing roles
@@ -449,47 +837,23 @@ type RemoveRoleRequest struct {
 
 // RemoveRoleHandler removes a role from a user (admin only)
 func (uh *UserHandler) RemoveRoleHandler(c *gin.Context) {
-	userID := c.Param("id")
 	var req RemoveRoleRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
-		return
-	}
-
-	roleName := strings.ToLower(strings.TrimSpace(req.RoleName))
-
-	var user models.User
-	if err := uh.db.Preload("Roles").First(&user, userID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		problem.Write(c, validation.Translate(c, err))
 		return
 	}
 
-	var roleToRemove *models.Role
-	for i := range user.Roles {
-		if user.Roles[i].Name == roleName {
-			roleToRemove = &user.Roles[i]
-			break
-		}
-	}
-
-	if roleToRemove == nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "User doesn't have this role"})
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
-
-	// Remove the role
-	if err := uh.db.Model(&user).Association("Roles").Delete(roleToRemove); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to remove role"})
+	user, err := uh.service.RemoveRole(c.Request.Context(), actorID(c), userID, req.RoleName)
+	if err != nil {
+		problem.Write(c, err)
 		return
 	}
 
-	// Reload user with roles
-	uh.db.Preload("Roles").First(&user, userID)
-
-	c.JSON(http.StatusOK, SuccessResponse{Data: user})
+	etag.Set(c, etag.Weak(user.ID, user.UpdatedAt))
+	response.OK(c, user, response.WithLinks(userLinks(*user)))
 }
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/avatar"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/etag"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/requestid"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/storage"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// AvatarHandler handles profile picture uploads
+type AvatarHandler struct {
+	users repository.UserRepository
+	store storage.Storage
+	cfg   config.AvatarConfig
+}
+
+// NewAvatarHandler creates a new avatar handler
+func NewAvatarHandler(users repository.UserRepository, store storage.Storage, cfg config.AvatarConfig) *AvatarHandler {
+	return &AvatarHandler{users: users, store: store, cfg: cfg}
+}
+
+// AvatarUpload is the multipart form of an avatar upload
+type AvatarUpload struct {
+	// Avatar is a JPEG, PNG, GIF or WebP image
+	Avatar *multipart.FileHeader `form:"avatar" json:"avatar" binding:"required"`
+}
+
+// UploadAvatarHandler replaces the current user's avatar with the uploaded image
+func (avh *AvatarHandler) UploadAvatarHandler(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID := currentUser.(*models.User).ID
+
+	var req AvatarUpload
+	if err := c.ShouldBindWith(&req, binding.FormMultipart); err != nil {
+		if errors.Is(err, http.ErrNotMultipart) {
+			problem.Write(c, apperr.ErrUnsupportedMediaType.WithDetail("Use multipart/form-data"))
+			return
+		}
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	f, err := req.Avatar.Open()
+	if err != nil {
+		problem.Write(c, apperr.ErrInvalidInput.Wrap(err))
+		return
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	img, err := avatar.Process(data, avh.cfg.Size, avh.cfg.MaxPixels)
+	if errors.Is(err, avatar.ErrTooLarge) {
+		problem.Write(c, apperr.ErrImageTooLarge)
+		return
+	}
+	if err != nil {
+		problem.Write(c, apperr.ErrInvalidImage.Wrap(err))
+		return
+	}
+
+	// A new key per upload keeps cached copies of the old avatar from being served
+	key := fmt.Sprintf("avatars/%d-%s%s", userID, requestid.New()[:12], img.Ext)
+	url, err := avh.store.Put(c.Request.Context(), key, img.Data, img.ContentType)
+	if err != nil {
+		problem.Write(c, apperr.ErrAvatarStorage.Wrap(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := avh.users.FindByID(ctx, userID)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	oldKey := user.AvatarKey
+
+	if err := avh.users.SetAvatar(ctx, user, url, key); err != nil {
+		avh.store.Delete(c.Request.Context(), key)
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to update user").Wrap(err))
+		return
+	}
+
+	if oldKey != "" {
+		if err := avh.store.Delete(c.Request.Context(), oldKey); err != nil {
+			logging.Warn(c.Request.Context(), "failed to delete previous avatar", "key", oldKey, "error", err)
+		}
+	}
+
+	// Reload to pick up the new version
+	if reloaded, err := avh.users.FindByID(ctx, userID); err == nil {
+		user = reloaded
+	}
+
+	etag.Set(c, etag.Weak(user.ID, user.UpdatedAt))
+	response.OK(c, user, response.WithLinks(response.Links{"self": "/api/profile"}))
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/consent"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// ConsentHandler records users' acceptance of the terms of service and privacy policy
+type ConsentHandler struct {
+	users  repository.UserRepository
+	policy *consent.Policy
+}
+
+// NewConsentHandler creates a new consent handler
+func NewConsentHandler(users repository.UserRepository, policy *consent.Policy) *ConsentHandler {
+	return &ConsentHandler{users: users, policy: policy}
+}
+
+// ConsentsResponse lists the current document versions and the user's consent history
+type ConsentsResponse struct {
+	// Required maps each document to its current version
+	Required map[string]string `json:"required"`
+	// Pending lists documents whose current version the user has not accepted
+	Pending []string         `json:"pending"`
+	History []models.Consent `json:"history"`
+}
+
+// AcceptConsentRequest represents the JSON payload for accepting a document
+type AcceptConsentRequest struct {
+	Document string `json:"document" binding:"required,oneof=terms privacy"`
+	Version  string `json:"version" binding:"required"`
+}
+
+// GetConsentsHandler returns the current user's consents
+func (ch *ConsentHandler) GetConsentsHandler(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return
+	}
+	user := currentUser.(*models.User)
+
+	history, err := ch.users.Consents(c.Request.Context(), user.ID)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	pending := ch.policy.Pending(user)
+	if pending == nil {
+		pending = []string{}
+	}
+	response.OK(c, ConsentsResponse{
+		Required: ch.policy.Required(),
+		Pending:  pending,
+		History:  history,
+	}, response.WithLinks(response.Links{"self": "/api/profile/consents"}))
+}
+
+// AcceptConsentHandler records that the current user accepted the current version of a document
+func (ch *ConsentHandler) AcceptConsentHandler(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return
+	}
+	user := currentUser.(*models.User)
+
+	var req AcceptConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	current, ok := ch.policy.Required()[req.Document]
+	if !ok || req.Version != current {
+		problem.Write(c, apperr.ErrConsentVersionOutdated.WithDetail("Current version of "+req.Document+" is "+current))
+		return
+	}
+
+	record := models.Consent{
+		UserID:    user.ID,
+		Document:  req.Document,
+		Version:   req.Version,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if err := ch.users.AddConsent(c.Request.Context(), &record); err != nil {
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to record consent").Wrap(err))
+		return
+	}
+
+	response.Created(c, record, response.WithLinks(response.Links{"consents": "/api/profile/consents"}))
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// DeviceHandler lets users register the app installations that receive their push
+// notifications
+type DeviceHandler struct {
+	devices repository.DeviceRepository
+}
+
+// NewDeviceHandler creates a new device handler
+func NewDeviceHandler(devices repository.DeviceRepository) *DeviceHandler {
+	return &DeviceHandler{devices: devices}
+}
+
+// RegisterDeviceRequest represents the JSON payload for registering a device
+type RegisterDeviceRequest struct {
+	// Token is the registration token the app got from FCM or APNs
+	Token    string `json:"token" binding:"required,max=512"`
+	Platform string `json:"platform" binding:"required,oneof=android ios"`
+	Name     string `json:"name" binding:"omitempty,max=100,printable"`
+}
+
+// ListDevicesHandler returns the current user's registered devices
+func (dh *DeviceHandler) ListDevicesHandler(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	devices, err := dh.devices.List(c.Request.Context(), user.ID)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	response.OK(c, devices, response.WithLinks(response.Links{"self": "/api/profile/devices"}))
+}
+
+// RegisterDeviceHandler registers an app installation of the current user for push
+// notifications. Registering a known token again updates it and moves it to the user.
+func (dh *DeviceHandler) RegisterDeviceHandler(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	var req RegisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	device := models.PushDevice{
+		UserID:   user.ID,
+		Token:    req.Token,
+		Platform: req.Platform,
+		Name:     strings.TrimSpace(req.Name),
+	}
+	if err := dh.devices.Register(c.Request.Context(), &device); err != nil {
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to register device").Wrap(err))
+		return
+	}
+
+	self := "/api/profile/devices/" + strconv.FormatUint(uint64(device.ID), 10)
+	response.Created(c, device, response.WithLinks(response.Links{"self": self}))
+}
+
+// DeleteDeviceHandler stops push notifications to one of the current user's devices
+func (dh *DeviceHandler) DeleteDeviceHandler(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		problem.Write(c, apperr.ErrDeviceNotFound)
+		return
+	}
+
+	if err := dh.devices.Delete(c.Request.Context(), user.ID, uint(id)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			problem.Write(c, apperr.ErrDeviceNotFound)
+			return
+		}
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to remove device").Wrap(err))
+		return
+	}
+	response.OK(c, MessageResponse{Message: "Device removed"})
+}
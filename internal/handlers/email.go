@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/mail"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/onetime"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/ratelimit"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/service"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+	"github.com/ristep/um_starter_jwt_go/internal/signedurl"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// EmailHandler changes users' email addresses. The new address is sent a link that
+// confirms the change, and once it is confirmed the previous address is sent a link
+// that reverts it and locks the account, in case the change was made from a
+// compromised session.
+type EmailHandler struct {
+	service  *service.UserService
+	mailer   mail.Sender
+	throttle *ratelimit.Throttle
+	links    *signedurl.Signer
+	cfg      config.EmailChangeConfig
+	// enumerationProtection answers a taken new address like a free one
+	enumerationProtection bool
+}
+
+// NewEmailHandler creates a new email change handler. throttle caps the emails sent
+// per account and client IP; links builds and signs the confirmation and revert links.
+// With enumerationProtection a taken new address is sent a notice instead of a link,
+// and the change is answered as if it were free.
+func NewEmailHandler(svc *service.UserService, mailer mail.Sender, throttle *ratelimit.Throttle, links *signedurl.Signer, cfg config.EmailChangeConfig, enumerationProtection bool) *EmailHandler {
+	return &EmailHandler{service: svc, mailer: mailer, throttle: throttle, links: links, cfg: cfg, enumerationProtection: enumerationProtection}
+}
+
+// emailChangeRequested is the answer to an email change, whether or not the new
+// address was free
+const emailChangeRequested = "Check the new address for a link that confirms the change"
+
+// ChangeEmailRequest represents the JSON payload for changing the email address
+type ChangeEmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ConfirmEmailChangeRequest represents the JSON payload for confirming an email
+// change. Expires and Signature are passed on from signed links.
+type ConfirmEmailChangeRequest struct {
+	Token     string `json:"token" binding:"required"`
+	Expires   int64  `json:"expires"`
+	Signature string `json:"signature"`
+}
+
+// RevertEmailChangeRequest represents the JSON payload for reverting an email change.
+// Expires and Signature are passed on from signed links.
+type RevertEmailChangeRequest struct {
+	Token     string `json:"token" binding:"required"`
+	Expires   int64  `json:"expires"`
+	Signature string `json:"signature"`
+}
+
+// ChangeEmailHandler starts changing the current user's email address: the new
+// address is sent a link that confirms the change. The email stays the same until then.
+func (eh *EmailHandler) ChangeEmailHandler(c *gin.Context) {
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	current, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !throttleEmail(c, eh.throttle, current.ID) {
+		return
+	}
+
+	token, confirm, err := onetime.New(models.TokenPurposeEmailChange, current.ID, eh.cfg.ConfirmTTL, nil)
+	if err != nil {
+		problem.Write(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+	ctx := c.Request.Context()
+	user, err := eh.service.RequestEmailChange(ctx, current.ID, req.Email, confirm)
+	if errors.Is(err, apperr.ErrEmailTaken) && eh.enumerationProtection {
+		err = eh.mailer.Send(ctx, req.Email, "Someone tried to use your email address", takenBody("change their account's email to", c.ClientIP(), c.Request.UserAgent()))
+		if err != nil {
+			problem.Write(c, apperr.ErrMailDelivery.Wrap(err))
+			return
+		}
+		response.JSON(c, http.StatusAccepted, MessageResponse{Message: emailChangeRequested})
+		return
+	}
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+
+	subject := "Confirm your new email address"
+	body := eh.confirmBody(token, user.Email, time.UnixMilli(confirm.ExpiresAt))
+	if err := eh.mailer.Send(ctx, req.Email, subject, body); err != nil {
+		problem.Write(c, apperr.ErrMailDelivery.Wrap(err))
+		return
+	}
+
+	response.JSON(c, http.StatusAccepted, MessageResponse{Message: emailChangeRequested})
+}
+
+// confirmBody is the text of the email sent to the new address of an email change
+func (eh *EmailHandler) confirmBody(token, previous string, expiresAt time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "You asked to change the email address of your account from %s to this one.\n\n", previous)
+	if eh.cfg.ConfirmURL != "" {
+		fmt.Fprintf(&b, "Confirm the change here:\n%s\n\n", tokenLink(eh.links, eh.cfg.ConfirmURL, models.TokenPurposeEmailChange, token, expiresAt))
+	} else {
+		fmt.Fprintf(&b, "Confirm the change with this code:\n%s\n\n", token)
+	}
+	fmt.Fprintf(&b, "This expires on %s. If you didn't ask for this, ignore this email.\n",
+		expiresAt.UTC().Format("2 Jan 2006 15:04 MST"))
+	return b.String()
+}
+
+// ConfirmEmailChangeHandler changes the email address with the token sent to the new
+// address, and sends the previous address a link to revert the change
+func (eh *EmailHandler) ConfirmEmailChangeHandler(c *gin.Context) {
+	var req ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	// Tampered and expired links are turned away before the lookup
+	if !checkTokenLink(eh.links, eh.cfg.ConfirmURL, models.TokenPurposeEmailChange, req.Token, req.Expires, req.Signature) {
+		problem.Write(c, apperr.ErrInvalidEmailChange)
+		return
+	}
+
+	token, revert, err := onetime.New(models.TokenPurposeEmailRevert, 0, eh.cfg.RevertTTL, nil)
+	if err != nil {
+		problem.Write(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+	ctx := c.Request.Context()
+	user, previous, err := eh.service.ConfirmEmailChange(ctx, sessions.Hash(req.Token), revert, client(c))
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+
+	// The change is done; a lost notice only costs the previous address its way back
+	subject := "Your email address was changed"
+	body := eh.revertBody(token, user.Email, c.ClientIP(), c.Request.UserAgent(), time.UnixMilli(revert.ExpiresAt))
+	if err := eh.mailer.Send(ctx, previous, subject, body); err != nil {
+		logging.Error(ctx, "failed to send email change notice", "user_id", user.ID, "error", err)
+	}
+
+	response.OK(c, MessageResponse{Message: "Email address changed"})
+}
+
+// throttleEmail counts an email a request is about to trigger for the user, and
+// answers 429 with Retry-After when the user or the client IP had too many lately
+func throttleEmail(c *gin.Context, throttle *ratelimit.Throttle, userID uint) bool {
+	wait, ok := throttle.Allow(c.Request.Context(), ratelimit.UserKey(userID), ratelimit.IPKey(c.ClientIP()))
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		problem.Write(c, apperr.ErrTooManyEmails)
+	}
+	return ok
+}
+
+// revertBody is the text of the notice sent to the previous address of a changed email
+func (eh *EmailHandler) revertBody(token, email, ip, userAgent string, expiresAt time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The email address of your account was changed to %s.\n\n", email)
+	fmt.Fprintf(&b, "IP address: %s\n", ip)
+	fmt.Fprintf(&b, "Device: %s\n\n", userAgent)
+
+	if eh.cfg.RevertURL != "" {
+		fmt.Fprintf(&b, "If this wasn't you, revert the change and lock your account here:\n%s\n\n", tokenLink(eh.links, eh.cfg.RevertURL, models.TokenPurposeEmailRevert, token, expiresAt))
+	} else {
+		fmt.Fprintf(&b, "If this wasn't you, revert the change and lock your account with this code:\n%s\n\n", token)
+	}
+	fmt.Fprintf(&b, "This expires on %s. Contact support to unlock your account afterwards.\n",
+		expiresAt.UTC().Format("2 Jan 2006 15:04 MST"))
+	return b.String()
+}
+
+// RevertEmailChangeHandler restores the previous email address with the token sent
+// to it and locks the account, signing out every session
+func (eh *EmailHandler) RevertEmailChangeHandler(c *gin.Context) {
+	var req RevertEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	// Tampered and expired links are turned away before the lookup
+	if !checkTokenLink(eh.links, eh.cfg.RevertURL, models.TokenPurposeEmailRevert, req.Token, req.Expires, req.Signature) {
+		problem.Write(c, apperr.ErrInvalidEmailRevert)
+		return
+	}
+
+	if err := eh.service.RevertEmailChange(c.Request.Context(), sessions.Hash(req.Token), client(c)); err != nil {
+		problem.Write(c, err)
+		return
+	}
+
+	response.OK(c, MessageResponse{Message: "Email change reverted and account locked, contact support to unlock it"})
+}
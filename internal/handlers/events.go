@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/events"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+)
+
+// eventTypes are the event types a stream may be limited to
+var eventTypes = []string{events.TypeUserRegistered, events.TypeFailedLoginBurst, events.TypeRoleAssigned, events.TypeRoleRemoved}
+
+// EventHandler streams admin notifications as server-sent events
+type EventHandler struct {
+	broker    *events.Broker
+	heartbeat time.Duration
+}
+
+// NewEventHandler creates a new event stream handler. A comment is sent every
+// heartbeat to keep idle streams open through proxies.
+func NewEventHandler(broker *events.Broker, heartbeat time.Duration) *EventHandler {
+	return &EventHandler{broker: broker, heartbeat: heartbeat}
+}
+
+// StreamEventsHandler streams events as they happen until the client disconnects
+// (admin only). A Last-Event-ID header, or last_event_id parameter, first replays the
+// recent events after it; types limits the stream to a comma-separated list of types.
+func (eh *EventHandler) StreamEventsHandler(c *gin.Context) {
+	var types []string
+	if param := c.Query("types"); param != "" {
+		types = strings.Split(param, ",")
+		for _, t := range types {
+			if !slices.Contains(eventTypes, t) {
+				problem.Write(c, apperr.ErrInvalidInput.WithDetail(fmt.Sprintf("Unknown event type %q", t)))
+				return
+			}
+		}
+	}
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	var after uint64
+	if lastID != "" {
+		var err error
+		if after, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			problem.Write(c, apperr.ErrInvalidInput.WithDetail("Last-Event-ID must be an event ID"))
+			return
+		}
+	}
+
+	missed, stream, cancel := eh.broker.Subscribe(after)
+	defer cancel()
+
+	middleware.DisableCompression(c)
+	middleware.DisableRequestTimeout(c)
+	// Streams stay open far longer than the server's write timeout allows; where the
+	// deadline can't be lifted clients reconnect when it ends the stream
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// Keep nginx from buffering the stream
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	send := func(event events.Event) {
+		if len(types) > 0 && !slices.Contains(types, event.Type) {
+			return
+		}
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	}
+	for _, event := range missed {
+		send(event)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eh.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-stream:
+			if !ok {
+				// Dropped for falling behind or the server is shutting down; the
+				// client reconnects and catches up
+				return
+			}
+			send(event)
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": keepalive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
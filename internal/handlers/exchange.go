@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// Token exchange grant and token type identifiers (RFC 8693)
+const (
+	exchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType   = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// ExchangeHandler lets trusted services trade a user's access token for a narrower,
+// shorter-lived token meant for a downstream API
+type ExchangeHandler struct {
+	users       repository.UserRepository
+	tokens      auth.TokenService
+	revocations sessions.RevocationList
+	clients     map[string]string
+	cfg         config.ExchangeConfig
+}
+
+// NewExchangeHandler creates a new token exchange handler
+func NewExchangeHandler(users repository.UserRepository, tokens auth.TokenService, revocations sessions.RevocationList, cfg config.ExchangeConfig) *ExchangeHandler {
+	return &ExchangeHandler{
+		users:       users,
+		tokens:      tokens,
+		revocations: revocations,
+		clients:     cfg.ClientSecrets(),
+		cfg:         cfg,
+	}
+}
+
+// TokenExchangeRequest represents a token exchange request, sent as a form (as OAuth
+// clients do) or as JSON
+type TokenExchangeRequest struct {
+	GrantType        string `form:"grant_type" json:"grant_type" binding:"required"`
+	SubjectToken     string `form:"subject_token" json:"subject_token" binding:"required"`
+	SubjectTokenType string `form:"subject_token_type" json:"subject_token_type" binding:"required"`
+	Audience         string `form:"audience" json:"audience" binding:"required"`
+	// Scope is a space-separated subset of the user's roles; all of them by default
+	Scope string `form:"scope" json:"scope"`
+}
+
+// TokenExchangeResponse represents the payload returned by a token exchange
+type TokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	// ExpiresIn is the lifetime of the issued token in seconds
+	ExpiresIn int64  `json:"expires_in"`
+	Scope     string `json:"scope"`
+}
+
+// TokenExchangeHandler exchanges a user's access token for one scoped to a single
+// audience and a subset of the user's roles. The caller authenticates as a configured
+// client with HTTP Basic.
+func (eh *ExchangeHandler) TokenExchangeHandler(c *gin.Context) {
+	clientID, ok := eh.authenticate(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="token-exchange"`)
+		problem.Write(c, apperr.ErrInvalidClient)
+		return
+	}
+
+	var req TokenExchangeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	if req.GrantType != exchangeGrantType {
+		problem.Write(c, apperr.ErrUnsupportedGrantType)
+		return
+	}
+	if req.SubjectTokenType != accessTokenType {
+		problem.Write(c, apperr.ErrInvalidGrant.WithDetail("Only access tokens can be exchanged"))
+		return
+	}
+	if !slices.Contains(eh.cfg.Audiences, req.Audience) {
+		problem.Write(c, apperr.ErrInvalidTarget)
+		return
+	}
+
+	claims, err := eh.subjectClaims(c, req.SubjectToken)
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+
+	roles := claims.Roles
+	if scope := strings.Fields(req.Scope); len(scope) > 0 {
+		for _, role := range scope {
+			if !slices.Contains(claims.Roles, role) {
+				problem.Write(c, apperr.ErrInvalidScope)
+				return
+			}
+		}
+		roles = scope
+	}
+
+	exchanged := claims.Exchange(req.Audience, roles, eh.cfg.TTL, clientID)
+	token, err := eh.tokens.IssueToken(exchanged)
+	if err != nil {
+		problem.Write(c, apperr.ErrTokenGeneration.Wrap(err))
+		return
+	}
+
+	// Tokens must not be cached (RFC 6749 section 5.1)
+	c.Header("Cache-Control", "no-store")
+	response.OK(c, TokenExchangeResponse{
+		AccessToken:     token,
+		IssuedTokenType: accessTokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(exchanged.ExpiresAt.Sub(exchanged.IssuedAt.Time).Seconds()),
+		Scope:           strings.Join(roles, " "),
+	})
+}
+
+// authenticate checks the client credentials and returns the client ID
+func (eh *ExchangeHandler) authenticate(c *gin.Context) (string, bool) {
+	id, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	expected, known := eh.clients[id]
+	// Compare even for unknown clients so timing doesn't reveal which IDs exist
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) != 1 || !known {
+		return "", false
+	}
+	return id, true
+}
+
+// subjectClaims validates the subject token the way AuthMiddleware validates a
+// bearer token and returns its claims
+func (eh *ExchangeHandler) subjectClaims(c *gin.Context, token string) (*auth.CustomClaims, error) {
+	claims, err := eh.tokens.ValidateToken(token)
+	// Exchanged tokens can't be exchanged again, nor can scoped ones
+	if err != nil || claims.Actor != nil || claims.Scope != "" {
+		return nil, apperr.ErrInvalidGrant
+	}
+	if claims.ID != "" && eh.revocations.Revoked(c.Request.Context(), claims.ID) {
+		return nil, apperr.ErrInvalidGrant
+	}
+
+	user, err := eh.users.FindByID(c.Request.Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperr.ErrInvalidGrant
+		}
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	if claims.TokenVersion != user.TokenVersion || user.Suspended() {
+		return nil, apperr.ErrInvalidGrant
+	}
+	return claims, nil
+}
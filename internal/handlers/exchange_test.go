@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/handlers"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+	"github.com/ristep/um_starter_jwt_go/internal/testutil"
+	"github.com/ristep/um_starter_jwt_go/pkg/usermgmt/authtest"
+)
+
+// singleUser is a UserRepository holding one user; other methods are not implemented
+type singleUser struct {
+	repository.UserRepository
+	user *models.User
+}
+
+func (su singleUser) FindByID(_ context.Context, id uint) (*models.User, error) {
+	if id != su.user.ID {
+		return nil, repository.ErrNotFound
+	}
+	return su.user, nil
+}
+
+func TestTokenExchangeHandler(t *testing.T) {
+	user := testutil.NewAdmin(t)
+	user.ID = 42
+	fake := authtest.NewFake()
+	h := handlers.NewExchangeHandler(singleUser{user: user}, fake, sessions.NewMemoryRevocations(), config.ExchangeConfig{
+		Clients:   []string{"billing:secret"},
+		Audiences: []string{"billing-api"},
+		TTL:       5 * time.Minute,
+	})
+	router := testutil.Router()
+	router.POST("/api/auth/token-exchange", h.TokenExchangeHandler)
+
+	pair, err := fake.GenerateTokenPair(user, auth.Authenticated(auth.MethodPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchange := func(t *testing.T, subjectToken string) *handlers.TokenExchangeResponse {
+		t.Helper()
+		req := testutil.NewRequest(t, http.MethodPost, "/api/auth/token-exchange", handlers.TokenExchangeRequest{
+			GrantType:        "urn:ietf:params:oauth:grant-type:token-exchange",
+			SubjectToken:     subjectToken,
+			SubjectTokenType: "urn:ietf:params:oauth:token-type:access_token",
+			Audience:         "billing-api",
+			Scope:            "user",
+		})
+		req.SetBasicAuth("billing", "secret")
+		rec := testutil.Do(router, req)
+		if rec.Code != http.StatusOK {
+			if p := testutil.DecodeProblem(t, rec); p.Code != "invalid_grant" {
+				t.Fatalf("code = %q, want invalid_grant", p.Code)
+			}
+			return nil
+		}
+		var resp handlers.TokenExchangeResponse
+		testutil.DecodeData(t, rec, &resp)
+		return &resp
+	}
+
+	t.Run("access token", func(t *testing.T) {
+		resp := exchange(t, pair.AccessToken)
+		if resp == nil {
+			t.Fatal("the access token was not exchanged")
+		}
+		claims, err := fake.ValidateToken(resp.AccessToken)
+		if err != nil {
+			t.Fatalf("the exchanged token is not an access token: %v", err)
+		}
+		if claims.UserID != user.ID || claims.Actor == nil || claims.Actor.Subject != "billing" || len(claims.Roles) != 1 {
+			t.Errorf("claims = %+v", claims)
+		}
+		if _, err := fake.ValidateRefreshToken(resp.AccessToken); err == nil {
+			t.Error("the exchanged token was accepted as a refresh token")
+		}
+	})
+
+	t.Run("refresh token", func(t *testing.T) {
+		if exchange(t, pair.RefreshToken) != nil {
+			t.Fatal("a refresh token was exchanged")
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		if exchange(t, "access-999") != nil {
+			t.Fatal("an unknown token was exchanged")
+		}
+	})
+}
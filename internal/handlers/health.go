@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/buildinfo"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// HealthCheck reports whether a dependency is usable
+type HealthCheck func(ctx context.Context) error
+
+// HealthHandler serves the liveness and readiness probes
+type HealthHandler struct {
+	mu           sync.RWMutex
+	checks       map[string]HealthCheck
+	order        []string
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+// NewHealthHandler creates a health handler with a database readiness check
+func NewHealthHandler(db *sql.DB) *HealthHandler {
+	hh := &HealthHandler{
+		checks:  make(map[string]HealthCheck),
+		timeout: 2 * time.Second,
+	}
+	hh.AddCheck("database", db.PingContext)
+	return hh
+}
+
+// AddCheck registers a named dependency check that must pass for the service to be ready
+func (hh *HealthHandler) AddCheck(name string, check HealthCheck) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	if _, exists := hh.checks[name]; !exists {
+		hh.order = append(hh.order, name)
+	}
+	hh.checks[name] = check
+}
+
+// SetShuttingDown marks the service as unready so load balancers stop routing to it
+func (hh *HealthHandler) SetShuttingDown() {
+	hh.shuttingDown.Store(true)
+}
+
+// ComponentStatus represents the readiness of a single dependency. Errors are only
+// logged, as they may name hosts, users or other internals.
+type ComponentStatus struct {
+	Status string `json:"status"`
+}
+
+// ReadinessResponse represents the readiness probe payload
+type ReadinessResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// LivenessHandler reports that the process is up and serving requests
+func (hh *HealthHandler) LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// VersionHandler reports the build version, commit and Go runtime
+func (hh *HealthHandler) VersionHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, buildinfo.Get())
+}
+
+// ReadinessHandler reports whether the service and its dependencies can handle traffic
+func (hh *HealthHandler) ReadinessHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), hh.timeout)
+	defer cancel()
+
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+
+	resp := ReadinessResponse{
+		Status:     "ok",
+		Components: make(map[string]ComponentStatus, len(hh.checks)),
+	}
+
+	for _, name := range hh.order {
+		if err := hh.checks[name](ctx); err != nil {
+			resp.Status = "unavailable"
+			logging.Warn(ctx, "readiness check failed", "check", name, "error", err)
+			resp.Components[name] = ComponentStatus{Status: "down"}
+			continue
+		}
+		resp.Components[name] = ComponentStatus{Status: "up"}
+	}
+
+	if hh.shuttingDown.Load() {
+		resp.Status = "shutting_down"
+	}
+
+	if resp.Status != "ok" {
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,40 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ristep/um_starter_jwt_go/internal/handlers"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/testutil"
+)
+
+func TestReadinessLogsCheckErrors(t *testing.T) {
+	var logs bytes.Buffer
+	hh := handlers.NewHealthHandler(nil)
+	hh.AddCheck("database", func(context.Context) error {
+		return errors.New("dial tcp db.internal:5432: connection refused")
+	})
+	router := testutil.Router()
+	router.Use(middleware.LoggerMiddleware(slog.New(slog.NewTextHandler(&logs, nil))))
+	router.GET("/readyz", hh.ReadinessHandler)
+
+	rec := testutil.Do(router, testutil.NewRequest(t, http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "db.internal") {
+		t.Errorf("the check error was returned: %s", rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"database":{"status":"down"}`) {
+		t.Errorf("body = %s, want the database down", rec.Body)
+	}
+	if !strings.Contains(logs.String(), "db.internal") {
+		t.Errorf("the check error was not logged: %q", logs.String())
+	}
+}
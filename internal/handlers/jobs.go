@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/queue"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// JobHandler lets admins inspect the background job queue and deal with failed jobs
+type JobHandler struct {
+	queue *queue.Queue
+}
+
+// NewJobHandler creates a new job queue handler
+func NewJobHandler(q *queue.Queue) *JobHandler {
+	return &JobHandler{queue: q}
+}
+
+// ListJobsQuery holds the filter and pagination parameters of the job list
+type ListJobsQuery struct {
+	State   string `form:"state" json:"state" binding:"omitempty,oneof=pending running failed"`
+	Kind    string `form:"kind" json:"kind"`
+	Page    int    `form:"page" json:"page" binding:"omitempty,min=1"`
+	PerPage int    `form:"per_page" json:"per_page" binding:"omitempty,min=1,max=100"`
+}
+
+// ListJobsHandler returns a page of jobs, the failed ones unless another state is
+// asked for, newest first (admin only)
+func (jh *JobHandler) ListJobsHandler(c *gin.Context) {
+	query := ListJobsQuery{State: models.JobFailed, Page: 1, PerPage: 20}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	jobs, total, err := jh.queue.List(c.Request.Context(), query.State, query.Kind,
+		(query.Page-1)*query.PerPage, query.PerPage)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	pagination := response.NewPagination(query.Page, query.PerPage, total)
+	response.OK(c, jobs,
+		response.WithPagination(pagination),
+		response.WithLinks(pageLinks(c, pagination)),
+	)
+}
+
+// RetryJobHandler queues a failed job again with a fresh set of attempts (admin only)
+func (jh *JobHandler) RetryJobHandler(c *gin.Context) {
+	id, ok := jh.jobID(c)
+	if !ok {
+		return
+	}
+	if err := jh.queue.Retry(c.Request.Context(), id); err != nil {
+		problem.Write(c, jobError(err))
+		return
+	}
+	response.OK(c, MessageResponse{Message: "Job queued for retry"})
+}
+
+// DiscardJobHandler deletes a failed job (admin only)
+func (jh *JobHandler) DiscardJobHandler(c *gin.Context) {
+	id, ok := jh.jobID(c)
+	if !ok {
+		return
+	}
+	if err := jh.queue.Discard(c.Request.Context(), id); err != nil {
+		problem.Write(c, jobError(err))
+		return
+	}
+	response.OK(c, MessageResponse{Message: "Job discarded"})
+}
+
+// jobID parses the :id path parameter, answering 404 for anything but a job ID
+func (jh *JobHandler) jobID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		problem.Write(c, apperr.ErrJobNotFound)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// jobError maps queue errors to API errors
+func jobError(err error) error {
+	switch {
+	case errors.Is(err, queue.ErrJobNotFound):
+		return apperr.ErrJobNotFound
+	case errors.Is(err, queue.ErrJobNotFailed):
+		return apperr.ErrJobNotFailed
+	default:
+		return apperr.ErrDatabase.Wrap(err)
+	}
+}
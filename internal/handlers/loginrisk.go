@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/loginrisk"
+	"github.com/ristep/um_starter_jwt_go/internal/mail"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/ratelimit"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+	"github.com/ristep/um_starter_jwt_go/internal/signedurl"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// linkActionConfirmLogin is the action login confirmation links are signed for
+const linkActionConfirmLogin = "confirm_login"
+
+// confirmationResendInterval is the minimum time between two confirmation emails for
+// logins from the same IP
+const confirmationResendInterval = time.Minute
+
+// LoginRiskPolicy decides what happens to suspicious logins
+type LoginRiskPolicy struct {
+	// Detector assesses logins; nil disables detection
+	Detector *loginrisk.Detector
+	// Confirm holds back tokens until the user confirms a suspicious login by email
+	Confirm bool
+	Mailer  mail.Sender
+	// Throttle caps the confirmation emails an account receives
+	Throttle *ratelimit.Throttle
+	// ConfirmTTL and ConfirmURL describe the confirmation links (see config.LoginRiskConfig)
+	ConfirmTTL time.Duration
+	ConfirmURL string
+	// Links builds and signs the confirmation links
+	Links *signedurl.Signer
+}
+
+// ConfirmLoginRequest represents the JSON payload for confirming a suspicious login.
+// Expires and Signature are passed on from signed links.
+type ConfirmLoginRequest struct {
+	Token     string `json:"token" binding:"required"`
+	Expires   int64  `json:"expires"`
+	Signature string `json:"signature"`
+}
+
+// assessLogin checks a login with valid credentials. Detection failures are logged
+// and the login treated as unsuspicious, so an outage never locks users out.
+func (ah *AuthHandler) assessLogin(c *gin.Context, user *models.User) loginrisk.Assessment {
+	if ah.loginRisk.Detector == nil {
+		return loginrisk.Assessment{}
+	}
+	assessment, err := ah.loginRisk.Detector.Assess(c.Request.Context(), user.ID, c.ClientIP(), time.Now())
+	if err != nil {
+		logging.Warn(c.Request.Context(), "failed to assess login", "user_id", user.ID, "error", err)
+		return assessment
+	}
+	if assessment.Suspicious() {
+		logging.Warn(c.Request.Context(), "suspicious login", "user_id", user.ID, "ip", c.ClientIP(),
+			"country", assessment.Location.Country, "asn", assessment.Location.ASN, "reasons", assessment.Reasons)
+	}
+	return assessment
+}
+
+// loginConfirmed reports whether the user confirmed a login from the client's IP, and
+// uses up that confirmation
+func (ah *AuthHandler) loginConfirmed(c *gin.Context, userID uint) (bool, error) {
+	return ah.tokenRepo.UseLoginConfirmation(c.Request.Context(), userID, c.ClientIP())
+}
+
+// requestLoginConfirmation emails the user a link to confirm a suspicious login and
+// answers that the login must be confirmed first
+func (ah *AuthHandler) requestLoginConfirmation(c *gin.Context, user *models.User, assessment loginrisk.Assessment) {
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	// Repeated attempts don't flood the inbox
+	recent, err := ah.tokenRepo.CountRecentLoginConfirmations(ctx, user.ID, c.ClientIP(), now.Add(-confirmationResendInterval).UnixMilli())
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	if recent > 0 {
+		problem.Write(c, apperr.ErrLoginConfirmationRequired)
+		return
+	}
+	// Nor can someone who knows the password flood it from many networks
+	if _, ok := ah.loginRisk.Throttle.Allow(ctx, ratelimit.UserKey(user.ID)); !ok {
+		problem.Write(c, apperr.ErrLoginConfirmationRequired)
+		return
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		problem.Write(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+
+	confirmation := models.LoginConfirmation{
+		UserID:    user.ID,
+		TokenHash: sessions.Hash(token),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		ExpiresAt: now.Add(ah.loginRisk.ConfirmTTL).UnixMilli(),
+	}
+	if err := ah.tokenRepo.CreateLoginConfirmation(ctx, &confirmation); err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	subject := "Confirm your sign-in"
+	body := ah.confirmationBody(token, c.ClientIP(), c.Request.UserAgent(), assessment, time.UnixMilli(confirmation.ExpiresAt))
+	if err := ah.loginRisk.Mailer.Send(ctx, user.Email, subject, body); err != nil {
+		ah.tokenRepo.DeleteLoginConfirmation(context.WithoutCancel(ctx), &confirmation)
+		problem.Write(c, apperr.ErrMailDelivery.Wrap(err))
+		return
+	}
+
+	problem.Write(c, apperr.ErrLoginConfirmationRequired)
+}
+
+// confirmationBody is the text of a login confirmation email
+func (ah *AuthHandler) confirmationBody(token, ip, userAgent string, assessment loginrisk.Assessment, expiresAt time.Time) string {
+	var b strings.Builder
+	b.WriteString("Someone signed in to your account from an unusual location.\n\n")
+	fmt.Fprintf(&b, "IP address: %s\n", ip)
+	if assessment.Location.Country != "" {
+		fmt.Fprintf(&b, "Country: %s\n", assessment.Location.Country)
+	}
+	fmt.Fprintf(&b, "Device: %s\n\n", userAgent)
+
+	if ah.loginRisk.ConfirmURL != "" {
+		fmt.Fprintf(&b, "If this was you, confirm the sign-in here:\n%s\n\n", tokenLink(ah.loginRisk.Links, ah.loginRisk.ConfirmURL, linkActionConfirmLogin, token, expiresAt))
+	} else {
+		fmt.Fprintf(&b, "If this was you, confirm the sign-in with this code:\n%s\n\n", token)
+	}
+	fmt.Fprintf(&b, "Then sign in again. The confirmation expires in %d minutes. If this wasn't you, change your password.\n",
+		int(ah.loginRisk.ConfirmTTL.Minutes()))
+	return b.String()
+}
+
+// randomToken returns a random token for a link sent by email
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// tokenLink is the link to the page that handles a token, with the token as the token
+// query parameter, signed for action until expires when links are signed
+func tokenLink(links *signedurl.Signer, page, action, token string, expires time.Time) string {
+	return links.Link(page, action, url.Values{"token": {token}}, expires)
+}
+
+// checkTokenLink verifies the signature of the link a token was posted from. Tokens
+// mailed bare, without a page to link to, or while links aren't signed carry none.
+func checkTokenLink(links *signedurl.Signer, page, action, token string, expires int64, signature string) bool {
+	if page == "" || !links.Enabled() {
+		return true
+	}
+	return links.Verify(action, url.Values{"token": {token}}, expires, signature, time.Now()) == nil
+}
+
+// ConfirmLoginHandler confirms a suspicious login with the token from the email. The
+// user then signs in again from the device that was held back.
+func (ah *AuthHandler) ConfirmLoginHandler(c *gin.Context) {
+	var req ConfirmLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	// Tampered and expired links are turned away before the lookup
+	if !checkTokenLink(ah.loginRisk.Links, ah.loginRisk.ConfirmURL, linkActionConfirmLogin, req.Token, req.Expires, req.Signature) {
+		problem.Write(c, apperr.ErrInvalidLoginConfirmation)
+		return
+	}
+
+	// Leave time to go back and sign in
+	expiresAt := time.Now().Add(ah.loginRisk.ConfirmTTL).UnixMilli()
+	confirmed, err := ah.tokenRepo.ConfirmLogin(c.Request.Context(), sessions.Hash(req.Token), expiresAt)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	if !confirmed {
+		problem.Write(c, apperr.ErrInvalidLoginConfirmation)
+		return
+	}
+
+	response.OK(c, MessageResponse{Message: "Sign-in confirmed, sign in again to continue"})
+}
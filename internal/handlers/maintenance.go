@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/maintenance"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// MaintenanceHandler exposes the maintenance mode switch to admins
+type MaintenanceHandler struct {
+	mode *maintenance.Mode
+}
+
+// NewMaintenanceHandler creates a new maintenance handler
+func NewMaintenanceHandler(mode *maintenance.Mode) *MaintenanceHandler {
+	return &MaintenanceHandler{mode: mode}
+}
+
+// SetMaintenanceRequest represents the JSON payload for toggling maintenance mode
+type SetMaintenanceRequest struct {
+	Enabled    *bool  `json:"enabled" binding:"required"`
+	RetryAfter int    `json:"retry_after" binding:"omitempty,min=1"` // Seconds
+	Message    string `json:"message"`
+}
+
+// GetMaintenanceHandler returns the current maintenance state (admin only)
+func (mh *MaintenanceHandler) GetMaintenanceHandler(c *gin.Context) {
+	response.OK(c, mh.mode.State())
+}
+
+// SetMaintenanceHandler turns maintenance mode on or off (admin only)
+func (mh *MaintenanceHandler) SetMaintenanceHandler(c *gin.Context) {
+	var req SetMaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	mh.mode.Set(*req.Enabled, time.Duration(req.RetryAfter)*time.Second, req.Message)
+
+	response.OK(c, mh.mode.State())
+}
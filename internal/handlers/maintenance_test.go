@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ristep/um_starter_jwt_go/internal/handlers"
+	"github.com/ristep/um_starter_jwt_go/internal/maintenance"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/testutil"
+)
+
+func TestSetMaintenanceHandler(t *testing.T) {
+	tokens := testutil.Tokens()
+	mode := maintenance.NewMode(false, 0)
+	h := handlers.NewMaintenanceHandler(mode)
+	router := testutil.Router()
+	admin := router.Group("/api/admin", middleware.AuthMiddleware(tokens, nil, nil, true, nil), middleware.RoleMiddleware("admin"))
+	admin.PUT("/maintenance", h.SetMaintenanceHandler)
+
+	body := map[string]any{"enabled": true, "retry_after": 120, "message": "Upgrading"}
+
+	t.Run("user", func(t *testing.T) {
+		rec := testutil.Do(router, testutil.AuthRequest(t, tokens, testutil.NewUser(t), http.MethodPut, "/api/admin/maintenance", body))
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("status = %d, want 403: %s", rec.Code, rec.Body)
+		}
+		if p := testutil.DecodeProblem(t, rec); p.Code != "insufficient_permissions" {
+			t.Errorf("code = %q, want insufficient_permissions", p.Code)
+		}
+		if mode.Enabled() {
+			t.Error("a user turned maintenance mode on")
+		}
+	})
+
+	t.Run("missing enabled", func(t *testing.T) {
+		rec := testutil.Do(router, testutil.AuthRequest(t, tokens, testutil.NewAdmin(t), http.MethodPut, "/api/admin/maintenance", map[string]any{"message": "Upgrading"}))
+		if p := testutil.DecodeProblem(t, rec); p.Code != "validation_failed" {
+			t.Errorf("code = %q, want validation_failed", p.Code)
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		rec := testutil.Do(router, testutil.AuthRequest(t, tokens, testutil.NewAdmin(t), http.MethodPut, "/api/admin/maintenance", body))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		var state maintenance.State
+		testutil.DecodeData(t, rec, &state)
+		if !state.Enabled || state.RetryAfter != 120 || state.Message != "Upgrading" {
+			t.Errorf("state = %+v", state)
+		}
+		if !mode.Enabled() {
+			t.Error("maintenance mode is still off")
+		}
+	})
+}
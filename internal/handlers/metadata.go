@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/i18n"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// maxMetadataBytes caps the encoded size of a user's metadata
+const maxMetadataBytes = 64 << 10
+
+// metadataFilterPrefix marks list query parameters that filter on metadata
+const metadataFilterPrefix = "metadata."
+
+// metadataKeyPattern restricts the segments of a metadata filter path
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// GetProfileMetadataHandler returns the current user's metadata
+func (uh *UserHandler) GetProfileMetadataHandler(c *gin.Context) {
+	user, ok := uh.currentUser(c)
+	if !ok {
+		return
+	}
+	response.OK(c, user.Metadata, response.WithLinks(response.Links{"self": "/api/profile/metadata"}))
+}
+
+// PutProfileMetadataHandler replaces the current user's metadata
+func (uh *UserHandler) PutProfileMetadataHandler(c *gin.Context) {
+	user, ok := uh.currentUser(c)
+	if !ok {
+		return
+	}
+	uh.replaceMetadata(c, user, "/api/profile/metadata")
+}
+
+// GetUserMetadataHandler returns a user's metadata (admin only)
+func (uh *UserHandler) GetUserMetadataHandler(c *gin.Context) {
+	user, ok := uh.userByID(c)
+	if !ok {
+		return
+	}
+	response.OK(c, user.Metadata, response.WithLinks(response.Links{"self": c.Request.URL.Path}))
+}
+
+// PutUserMetadataHandler replaces a user's metadata (admin only)
+func (uh *UserHandler) PutUserMetadataHandler(c *gin.Context) {
+	user, ok := uh.userByID(c)
+	if !ok {
+		return
+	}
+	uh.replaceMetadata(c, user, c.Request.URL.Path)
+}
+
+// replaceMetadata stores the request body, which must be a JSON object, as the user's metadata
+func (uh *UserHandler) replaceMetadata(c *gin.Context, user *models.User, self string) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	if len(body) > maxMetadataBytes {
+		problem.Write(c, apperr.ErrRequestTooLarge.WithDetail("Metadata must be at most 64 KiB"))
+		return
+	}
+
+	var metadata models.Metadata
+	if err := json.Unmarshal(body, &metadata); err != nil || metadata == nil {
+		var typeErr *json.UnmarshalTypeError
+		if err == nil || errors.As(err, &typeErr) {
+			problem.Write(c, apperr.ErrInvalidInput.WithDetail("Metadata must be a JSON object"))
+			return
+		}
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	if err := uh.profileFields.Validate(c, metadata); err != nil {
+		problem.Write(c, err)
+		return
+	}
+
+	if err := uh.users.SetMetadata(c.Request.Context(), user, metadata); err != nil {
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to update metadata").Wrap(err))
+		return
+	}
+	uh.service.ProfileChanged(c.Request.Context(), actorID(c), user.ID, "metadata")
+
+	response.OK(c, metadata, response.WithLinks(response.Links{"self": self}))
+}
+
+// currentUser loads the authenticated user from the database
+func (uh *UserHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return nil, false
+	}
+
+	user, err := uh.users.FindByID(c.Request.Context(), currentUser.(*models.User).ID)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return nil, false
+	}
+	return user, true
+}
+
+// userByID loads the user named by the :id path parameter
+func (uh *UserHandler) userByID(c *gin.Context) (*models.User, bool) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return nil, false
+	}
+	user, err := uh.users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		problem.Write(c, userError(err))
+		return nil, false
+	}
+	return user, true
+}
+
+// userIDParam parses the :id path parameter, answering 404 for anything but a user ID
+func userIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		problem.Write(c, apperr.ErrUserNotFound)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// userError maps repository errors to API errors
+func userError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperr.ErrUserNotFound
+	}
+	return apperr.ErrDatabase.Wrap(err)
+}
+
+// metadataFilters turns ?metadata.<path>=<value> query parameters into user list filters.
+// Nested keys use dots (metadata.address.city=Skopje); values are compared as text.
+func metadataFilters(c *gin.Context) ([]repository.MetadataFilter, error) {
+	var filters []repository.MetadataFilter
+	var invalid []apperr.FieldError
+
+	for param, values := range c.Request.URL.Query() {
+		key, ok := strings.CutPrefix(param, metadataFilterPrefix)
+		if !ok {
+			continue
+		}
+		segments := strings.Split(key, ".")
+		for _, segment := range segments {
+			if !metadataKeyPattern.MatchString(segment) {
+				invalid = append(invalid, apperr.FieldError{
+					Field:   param,
+					Rule:    "metadata_key",
+					Message: i18n.T(i18n.Language(c), "validation.metadata_key", nil),
+				})
+				break
+			}
+		}
+		filters = append(filters, repository.MetadataFilter{Path: segments, Value: values[0]})
+	}
+	if len(invalid) > 0 {
+		return nil, apperr.ErrValidation.WithFields(invalid)
+	}
+	sort.Slice(filters, func(i, j int) bool {
+		return strings.Join(filters[i].Path, ".") < strings.Join(filters[j].Path, ".")
+	})
+	return filters, nil
+}
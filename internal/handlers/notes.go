@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// NoteHandler lets admins keep notes on users, e.g. about support conversations or
+// abuse reports
+type NoteHandler struct {
+	notes repository.NoteRepository
+	users repository.UserRepository
+}
+
+// NewNoteHandler creates a new note handler
+func NewNoteHandler(notes repository.NoteRepository, users repository.UserRepository) *NoteHandler {
+	return &NoteHandler{notes: notes, users: users}
+}
+
+// CreateNoteRequest represents the JSON payload for adding a note
+type CreateNoteRequest struct {
+	Body string `json:"body" binding:"required,max=5000"`
+}
+
+// ListNotesHandler returns a page of a user's notes, newest first (admin only)
+func (nh *NoteHandler) ListNotesHandler(c *gin.Context) {
+	query := PageQuery{Page: 1, PerPage: 20}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	userID, ok := nh.userID(c)
+	if !ok {
+		return
+	}
+
+	notes, total, err := nh.notes.List(c.Request.Context(), userID, (query.Page-1)*query.PerPage, query.PerPage)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	pagination := response.NewPagination(query.Page, query.PerPage, total)
+	response.OK(c, notes,
+		response.WithPagination(pagination),
+		response.WithLinks(pageLinks(c, pagination)),
+	)
+}
+
+// CreateNoteHandler adds a note to a user, signed by the current admin (admin only)
+func (nh *NoteHandler) CreateNoteHandler(c *gin.Context) {
+	var req CreateNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		problem.Write(c, apperr.ErrInvalidInput.WithDetail("Note must not be empty"))
+		return
+	}
+	userID, ok := nh.userID(c)
+	if !ok {
+		return
+	}
+
+	note := models.AdminNote{UserID: userID, AuthorID: actorID(c), Body: body}
+	if err := nh.notes.Create(c.Request.Context(), &note); err != nil {
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to add note").Wrap(err))
+		return
+	}
+
+	self := "/api/users/" + strconv.FormatUint(uint64(userID), 10) + "/notes/" + strconv.FormatUint(uint64(note.ID), 10)
+	response.Created(c, note, response.WithLinks(response.Links{"self": self}))
+}
+
+// DeleteNoteHandler removes a note from a user (admin only)
+func (nh *NoteHandler) DeleteNoteHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	noteID, err := strconv.ParseUint(c.Param("noteId"), 10, 0)
+	if err != nil {
+		problem.Write(c, apperr.ErrNoteNotFound)
+		return
+	}
+
+	if err := nh.notes.Delete(c.Request.Context(), userID, uint(noteID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			problem.Write(c, apperr.ErrNoteNotFound)
+			return
+		}
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to delete note").Wrap(err))
+		return
+	}
+	response.OK(c, MessageResponse{Message: "Note deleted"})
+}
+
+// userID parses the :id path parameter and checks the user exists
+func (nh *NoteHandler) userID(c *gin.Context) (uint, bool) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return 0, false
+	}
+	if _, err := nh.users.FindByID(c.Request.Context(), id); err != nil {
+		problem.Write(c, userError(err))
+		return 0, false
+	}
+	return id, true
+}
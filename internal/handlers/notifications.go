@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/notify"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+)
+
+// Messages sent on notification connections besides notifications
+const (
+	messageAuth  = "auth"
+	messageReady = "ready"
+	messageError = "error"
+)
+
+// maxClientMessage limits what clients may send, which is only their token
+const maxClientMessage = 16 << 10
+
+// writeTimeout bounds each write to a notification connection
+const writeTimeout = 10 * time.Second
+
+// pingCodec sends WebSocket ping frames
+var pingCodec = websocket.Codec{Marshal: func(any) ([]byte, byte, error) {
+	return nil, websocket.PingFrame, nil
+}}
+
+// ClientMessage is a message sent by a client on a notification connection
+type ClientMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+// ErrorMessage ends a notification connection that can't continue
+type ErrorMessage struct {
+	Type  string          `json:"type"`
+	Error problem.Problem `json:"error"`
+}
+
+// NotificationHandler serves the WebSocket connections users receive account
+// notifications on
+type NotificationHandler struct {
+	hub     *notify.Hub
+	users   repository.UserRepository
+	tokens  auth.TokenService
+	revoked sessions.RevocationList
+	cfg     config.NotifyConfig
+}
+
+// NewNotificationHandler creates a new notification handler
+func NewNotificationHandler(hub *notify.Hub, users repository.UserRepository, tokens auth.TokenService, revoked sessions.RevocationList, cfg config.NotifyConfig) *NotificationHandler {
+	return &NotificationHandler{hub: hub, users: users, tokens: tokens, revoked: revoked, cfg: cfg}
+}
+
+// NotificationsHandler upgrades the request to a WebSocket that receives the user's
+// account notifications until either side closes it or the access token expires.
+// Browsers can't set the Authorization header on a WebSocket, so without it the token
+// is expected as the first message: {"type": "auth", "token": "..."}.
+func (nh *NotificationHandler) NotificationsHandler(c *gin.Context) {
+	if !strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		problem.Write(c, apperr.ErrInvalidInput.WithDetail("A WebSocket upgrade is required"))
+		return
+	}
+
+	middleware.DisableRequestTimeout(c)
+	header := c.GetHeader("Authorization")
+	server := websocket.Server{
+		// Tokens, not cookies, authenticate the connection, so other sites can't use it
+		// on a visitor's behalf and any origin may connect
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			nh.serve(c.Request.Context(), ws, header)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// serve authenticates a connection and forwards the user's notifications to it
+func (nh *NotificationHandler) serve(ctx context.Context, ws *websocket.Conn, header string) {
+	defer ws.Close()
+	// The hijacked connection keeps the deadlines the server set for the request
+	ws.SetDeadline(time.Time{})
+	ws.MaxPayloadBytes = maxClientMessage
+
+	claims, err := nh.authenticate(ctx, ws, header)
+	if err != nil {
+		nh.send(ws, ErrorMessage{Type: messageError, Error: problem.FromError(err)})
+		return
+	}
+
+	notifications, disconnect := nh.hub.Connect(claims.UserID)
+	defer disconnect()
+	if err := nh.send(ws, gin.H{"type": messageReady}); err != nil {
+		return
+	}
+
+	// Nothing more is expected from the client; reading notices when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		buf := make([]byte, 512)
+		for {
+			if _, err := ws.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	expiry := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+	defer expiry.Stop()
+	ping := time.NewTicker(nh.cfg.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-expiry.C:
+			nh.send(ws, ErrorMessage{Type: messageError, Error: problem.FromError(apperr.ErrTokenExpired)})
+			return
+		case notification, ok := <-notifications:
+			if !ok {
+				// Dropped for falling behind or the server is shutting down; the client
+				// reconnects
+				return
+			}
+			if err := nh.send(ws, notification); err != nil {
+				return
+			}
+			// Password and role changes revoke the user's tokens, this one included
+			if err := nh.checkUser(ctx, claims); err != nil {
+				nh.send(ws, ErrorMessage{Type: messageError, Error: problem.FromError(err)})
+				return
+			}
+		case <-ping.C:
+			ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := pingCodec.Send(ws, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// authenticate validates the token from the Authorization header or, without one, the
+// first message of the client
+func (nh *NotificationHandler) authenticate(ctx context.Context, ws *websocket.Conn, header string) (*auth.CustomClaims, error) {
+	if header == "" {
+		ws.SetReadDeadline(time.Now().Add(nh.cfg.AuthTimeout))
+		var msg ClientMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != messageAuth {
+			return nil, apperr.ErrMissingToken
+		}
+		ws.SetReadDeadline(time.Time{})
+		header = "Bearer " + msg.Token
+	}
+
+	claims, err := middleware.Authenticate(ctx, header, nh.tokens, nh.revoked)
+	if err != nil {
+		return nil, err
+	}
+	if err := middleware.RejectExchanged(claims); err != nil {
+		return nil, err
+	}
+	// Tokens limited to the two-factor setup don't reach the account
+	if claims.Scope != "" {
+		return nil, apperr.ErrTwoFactorEnrollmentRequired
+	}
+	if claims.ExpiresAt == nil {
+		return nil, apperr.ErrTokenInvalid
+	}
+	if err := nh.checkUser(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkUser checks that the token's user may still use it
+func (nh *NotificationHandler) checkUser(ctx context.Context, claims *auth.CustomClaims) error {
+	user, err := nh.users.FindByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return apperr.ErrTokenUserNotFound
+		}
+		return apperr.ErrDatabase.Wrap(err)
+	}
+	return middleware.CheckUser(claims, user)
+}
+
+// send writes a message as JSON
+func (nh *NotificationHandler) send(ws *websocket.Conn, v any) error {
+	ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return websocket.JSON.Send(ws, v)
+}
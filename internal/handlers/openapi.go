@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ristep/um_starter_jwt_go/internal/buildinfo"
+	"github.com/ristep/um_starter_jwt_go/internal/events"
+	"github.com/ristep/um_starter_jwt_go/internal/maintenance"
+	"github.com/ristep/um_starter_jwt_go/internal/mergepatch"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/notify"
+	"github.com/ristep/um_starter_jwt_go/internal/openapi"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+)
+
+// APISpec describes every endpoint for the generated OpenAPI document.
+// Add an entry here whenever a route is added.
+func APISpec() openapi.Spec {
+	return openapi.Spec{
+		Info:             openapi.Info{Title: "User Management API", Version: "1.0.0"},
+		Envelope:         response.Envelope{},
+		ErrorBody:        problem.Problem{},
+		ErrorContentType: problem.ContentType,
+		Operations: map[string]openapi.Operation{
+			// Health
+			"GET /healthz": {
+				Summary: "Liveness probe", Tags: []string{"health"},
+				Response: map[string]string{}, Unwrapped: true,
+			},
+			"GET /readyz": {
+				Summary: "Readiness probe with dependency checks", Tags: []string{"health"},
+				Response: ReadinessResponse{}, Unwrapped: true,
+				Errors: []int{http.StatusServiceUnavailable},
+			},
+			"GET /version": {
+				Summary: "Build version, commit and Go runtime", Tags: []string{"health"},
+				Response: buildinfo.Info{}, Unwrapped: true,
+			},
+
+			// Authentication
+			"POST /api/auth/register": {
+				Summary: "Register a new user; the account is created once the email confirms it, or straight away with tokens (201) when ENUMERATION_PROTECTION=false", Tags: []string{"auth"},
+				Request: RegisterRequest{}, Response: MessageResponse{}, Status: http.StatusAccepted,
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusTooManyRequests, http.StatusBadGateway},
+			},
+			"POST /api/auth/confirm-registration": {
+				Summary: "Create the account of a registration with the token from the confirmation email", Tags: []string{"auth"},
+				Request: ConfirmRegistrationRequest{}, Response: AuthResponse{}, Status: http.StatusCreated,
+				Errors: []int{http.StatusBadRequest},
+			},
+			"POST /api/auth/login": {
+				Summary: "Log in with email or username and password, plus an authenticator code once two-factor authentication is enabled", Tags: []string{"auth"},
+				Request: LoginRequest{}, Response: AuthResponse{},
+				Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests, http.StatusBadGateway},
+			},
+			"POST /api/auth/confirm-login": {
+				Summary: "Confirm a suspicious login with the token from the confirmation email", Tags: []string{"auth"},
+				Request: ConfirmLoginRequest{}, Response: MessageResponse{},
+				Errors: []int{http.StatusBadRequest},
+			},
+			"POST /api/auth/confirm-email-change": {
+				Summary: "Confirm an email change with the token sent to the new address; the previous address is sent a revert link", Tags: []string{"auth"},
+				Request: ConfirmEmailChangeRequest{}, Response: MessageResponse{},
+				Errors: []int{http.StatusBadRequest},
+			},
+			"POST /api/auth/revert-email-change": {
+				Summary: "Revert an email change with the token sent to the previous address and lock the account", Tags: []string{"auth"},
+				Request: RevertEmailChangeRequest{}, Response: MessageResponse{},
+				Errors: []int{http.StatusBadRequest},
+			},
+			"GET /api/auth/username-available": {
+				Summary: "Check whether a username can be registered", Tags: []string{"auth"},
+				Response: UsernameAvailabilityResponse{},
+				Errors:   []int{http.StatusBadRequest},
+				Query: []openapi.Param{
+					{Name: "username", Description: "Username to check", Required: true},
+				},
+			},
+			"POST /api/auth/refresh": {
+				Summary: "Exchange a refresh token for a new token pair", Tags: []string{"auth"},
+				Request: RefreshRequest{}, Response: TokenResponse{},
+				Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+			},
+			"POST /api/auth/logout": {
+				Summary: "End the session of a refresh token", Tags: []string{"auth"},
+				Request: RefreshRequest{}, Response: MessageResponse{},
+				Errors: []int{http.StatusBadRequest},
+			},
+			"POST /api/auth/reauthenticate": {
+				Summary: "Confirm the password and rotate the refresh token, refreshing auth_time", Tags: []string{"auth"},
+				Request: ReauthenticateRequest{}, Response: TokenResponse{},
+				Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+			},
+			"POST /api/auth/token-exchange": {
+				Summary: "Exchange a user's access token for one scoped to a downstream API (RFC 8693, HTTP Basic client authentication)", Tags: []string{"auth"},
+				Request: TokenExchangeRequest{}, RequestType: "application/x-www-form-urlencoded", Response: TokenExchangeResponse{},
+				Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests},
+			},
+
+			// Profile
+			"GET /api/profile": {
+				Summary: "Get the current user's profile", Tags: []string{"profile"}, Auth: true,
+				Response: models.User{},
+			},
+			"PUT /api/profile": {
+				Summary: "Update the current user's profile", Tags: []string{"profile"}, Auth: true,
+				Request: UpdateUserRequest{}, Response: models.User{},
+				Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusPreconditionFailed},
+			},
+			"DELETE /api/profile": {
+				Summary: "Delete the current user's account (requires a recent password entry)", Tags: []string{"profile"}, Auth: true,
+				Response: MessageResponse{},
+				Errors:   []int{http.StatusForbidden},
+			},
+			"PATCH /api/profile": {
+				Summary: "Update the current user's profile with a JSON merge patch (RFC 7386)", Tags: []string{"profile"}, Auth: true,
+				Request: PatchUserRequest{}, RequestType: mergepatch.ContentType, Response: models.User{},
+				Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusPreconditionFailed, http.StatusUnsupportedMediaType},
+			},
+			"GET /api/profile/metadata": {
+				Summary: "Get the current user's metadata", Tags: []string{"profile"}, Auth: true,
+				Response: models.Metadata{},
+			},
+			"PUT /api/profile/metadata": {
+				Summary: "Replace the current user's metadata", Tags: []string{"profile"}, Auth: true,
+				Request: models.Metadata{}, Response: models.Metadata{},
+				Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge},
+			},
+			"POST /api/profile/avatar": {
+				Summary: "Upload a new avatar image", Tags: []string{"profile"}, Auth: true,
+				Request: AvatarUpload{}, RequestType: "multipart/form-data", Response: models.User{},
+				Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+			},
+			"POST /api/profile/phone/send-code": {
+				Summary: "Text a verification code to the profile's phone number", Tags: []string{"profile"}, Auth: true,
+				Response: PhoneCodeResponse{}, Status: http.StatusAccepted,
+				Errors: []int{http.StatusBadRequest, http.StatusTooManyRequests, http.StatusBadGateway},
+			},
+			"POST /api/profile/phone/verify": {
+				Summary: "Confirm the profile's phone number with the texted code", Tags: []string{"profile"}, Auth: true,
+				Request: VerifyPhoneRequest{}, Response: models.User{},
+				Errors: []int{http.StatusBadRequest, http.StatusTooManyRequests},
+			},
+			"GET /api/profile/preferences": {
+				Summary: "Get the current user's time zone and locale", Tags: []string{"profile"}, Auth: true,
+				Response: Preferences{},
+			},
+			"PUT /api/profile/preferences": {
+				Summary: "Set the current user's time zone and locale", Tags: []string{"profile"}, Auth: true,
+				Request: Preferences{}, Response: Preferences{},
+				Errors: []int{http.StatusBadRequest},
+			},
+			"GET /api/profile/consents": {
+				Summary: "List the current document versions and the user's consents", Tags: []string{"profile"}, Auth: true,
+				Response: ConsentsResponse{},
+			},
+			"POST /api/profile/consents": {
+				Summary: "Accept the current version of the terms or privacy policy", Tags: []string{"profile"}, Auth: true,
+				Request: AcceptConsentRequest{}, Response: models.Consent{}, Status: http.StatusCreated,
+				Errors: []int{http.StatusBadRequest, http.StatusConflict},
+			},
+			"GET /api/profile/sessions": {
+				Summary: "List the devices holding an active refresh token", Tags: []string{"profile"}, Auth: true,
+				Response: []models.RefreshToken{},
+			},
+			"DELETE /api/profile/sessions": {
+				Summary: "Revoke all of the current user's refresh tokens", Tags: []string{"profile"}, Auth: true,
+				Response: MessageResponse{},
+			},
+			"DELETE /api/profile/sessions/:id": {
+				Summary: "Revoke the refresh token of one session", Tags: []string{"profile"}, Auth: true,
+				Response: MessageResponse{},
+				Errors:   []int{http.StatusNotFound},
+			},
+			"POST /api/profile/2fa/setup": {
+				Summary: "Generate an authenticator app secret for two-factor authentication", Tags: []string{"profile"}, Auth: true,
+				Response: TwoFactorSetupResponse{},
+				Errors:   []int{http.StatusBadRequest},
+			},
+			"POST /api/profile/2fa/enable": {
+				Summary: "Enable two-factor authentication with a code from the authenticator app", Tags: []string{"profile"}, Auth: true,
+				Request: TwoFactorCodeRequest{}, Response: MessageResponse{},
+				Errors: []int{http.StatusBadRequest},
+			},
+			"POST /api/profile/password": {
+				Summary: "Change the password; other sessions are signed out", Tags: []string{"profile"}, Auth: true,
+				Request: ChangePasswordRequest{}, Response: TokenResponse{},
+				Errors: []int{http.StatusBadRequest, http.StatusTooManyRequests},
+			},
+			"PUT /api/profile/email": {
+				Summary: "Start changing the email address (requires a recent password entry); the new address is sent a confirmation link", Tags: []string{"profile"}, Auth: true,
+				Request: ChangeEmailRequest{}, Response: MessageResponse{}, Status: http.StatusAccepted,
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict},
+			},
+			"DELETE /api/profile/2fa": {
+				Summary: "Disable two-factor authentication (requires a recent password entry)", Tags: []string{"profile"}, Auth: true,
+				Request: TwoFactorCodeRequest{}, Response: MessageResponse{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden},
+			},
+
+			// User management
+			"GET /api/users": {
+				Summary: "List users page by page", Tags: []string{"users"}, Auth: true,
+				Response: []models.User{},
+				Errors:   []int{http.StatusBadRequest, http.StatusForbidden},
+				Query: []openapi.Param{
+					{Name: "page", Description: "Page number, starting at 1", Type: "integer"},
+					{Name: "per_page", Description: "Users per page (1-100, default 20)", Type: "integer"},
+					{Name: "metadata.{key}", Description: "Only users whose metadata value at the dot-separated key path equals this value"},
+					{Name: "tag", Description: "Only users carrying this tag; repeat to require several tags"},
+					{Name: "filter", Description: `Filter expression, e.g. country eq "MK" and created_at gt "2024-01-01"`},
+				},
+			},
+			"GET /api/users/:id": {
+				Summary: "Get a user by ID", Tags: []string{"users"}, Auth: true,
+				Response: models.User{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+			},
+			"PUT /api/users/:id": {
+				Summary: "Update a user (needs a recently entered password)", Tags: []string{"users"}, Auth: true,
+				Request: UpdateUserRequest{}, Response: models.User{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed},
+			},
+			"PATCH /api/users/:id": {
+				Summary: "Update a user with a JSON merge patch (RFC 7386; needs a recently entered password)", Tags: []string{"users"}, Auth: true,
+				Request: PatchUserRequest{}, RequestType: mergepatch.ContentType, Response: models.User{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusUnsupportedMediaType},
+			},
+			"GET /api/users/:id/metadata": {
+				Summary: "Get a user's metadata", Tags: []string{"users"}, Auth: true,
+				Response: models.Metadata{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+			},
+			"PUT /api/users/:id/metadata": {
+				Summary: "Replace a user's metadata", Tags: []string{"users"}, Auth: true,
+				Request: models.Metadata{}, Response: models.Metadata{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge},
+			},
+			"DELETE /api/users/:id": {
+				Summary: "Delete a user (needs a recently entered password)", Tags: []string{"users"}, Auth: true,
+				Response: MessageResponse{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+			},
+			"POST /api/users/:id/roles": {
+				Summary: "Assign a role to a user (needs a recently entered password)", Tags: []string{"users"}, Auth: true,
+				Request: AssignRoleRequest{}, Response: models.User{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+			},
+			"DELETE /api/users/:id/roles": {
+				Summary: "Remove a role from a user (needs a recently entered password)", Tags: []string{"users"}, Auth: true,
+				Request: RemoveRoleRequest{}, Response: models.User{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+			},
+			"POST /api/users/:id/tags": {
+				Summary: "Tag a user, e.g. beta or vip", Tags: []string{"users"}, Auth: true,
+				Request: AddTagRequest{}, Response: models.User{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+			},
+			"DELETE /api/users/:id/tags/:tag": {
+				Summary: "Remove a tag from a user", Tags: []string{"users"}, Auth: true,
+				Response: models.User{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+			},
+			"PUT /api/users/:id/suspension": {
+				Summary: "Suspend a user and revoke their tokens (needs a recently entered password)", Tags: []string{"users"}, Auth: true,
+				Request: SuspendUserRequest{}, Response: models.User{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+			},
+			"DELETE /api/users/:id/suspension": {
+				Summary: "Lift a user's suspension", Tags: []string{"users"}, Auth: true,
+				Response: models.User{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+			},
+			"POST /api/users/:id/revoke-tokens": {
+				Summary: "End every session of a user and revoke all their tokens", Tags: []string{"users"}, Auth: true,
+				Response: models.User{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+			},
+			"GET /api/profile/devices": {
+				Summary: "List your devices registered for push notifications", Tags: []string{"profile"}, Auth: true,
+				Response: []models.PushDevice{},
+			},
+			"POST /api/profile/devices": {
+				Summary: "Register a device for push notifications of security alerts", Tags: []string{"profile"}, Auth: true,
+				Request: RegisterDeviceRequest{}, Response: models.PushDevice{}, Status: http.StatusCreated,
+				Errors: []int{http.StatusBadRequest},
+			},
+			"DELETE /api/profile/devices/:id": {
+				Summary: "Stop push notifications to a device", Tags: []string{"profile"}, Auth: true,
+				Response: MessageResponse{},
+				Errors:   []int{http.StatusNotFound},
+			},
+			"GET /api/profile/notifications": {
+				Summary: "Receive account notifications over a WebSocket: new device logins, password changes, granted roles", Tags: []string{"profile"}, Auth: true,
+				Response: notify.Notification{}, ResponseType: "application/json", Status: http.StatusSwitchingProtocols,
+				Errors: []int{http.StatusBadRequest},
+			},
+			"GET /api/profile/activity": {
+				Summary: "List your account activity: logins, new sessions, profile and role changes", Tags: []string{"profile"}, Auth: true,
+				Response: []models.Activity{},
+				Errors:   []int{http.StatusBadRequest},
+				Query: []openapi.Param{
+					{Name: "page", Description: "Page number, starting at 1", Type: "integer"},
+					{Name: "per_page", Description: "Events per page (1-100, default 20)", Type: "integer"},
+				},
+			},
+			"GET /api/users/:id/logins": {
+				Summary: "List a user's login attempts, newest first", Tags: []string{"users"}, Auth: true,
+				Response: []models.LoginEvent{},
+				Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+				Query: []openapi.Param{
+					{Name: "page", Description: "Page number, starting at 1", Type: "integer"},
+					{Name: "per_page", Description: "Entries per page (1-100, default 20)", Type: "integer"},
+				},
+			},
+			"GET /api/users/:id/notes": {
+				Summary: "List the admin notes on a user, newest first", Tags: []string{"users"}, Auth: true,
+				Response: []models.AdminNote{},
+				Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+				Query: []openapi.Param{
+					{Name: "page", Description: "Page number, starting at 1", Type: "integer"},
+					{Name: "per_page", Description: "Notes per page (1-100, default 20)", Type: "integer"},
+				},
+			},
+			"POST /api/users/:id/notes": {
+				Summary: "Add a note to a user, signed by you; only admins see notes", Tags: []string{"users"}, Auth: true,
+				Request: CreateNoteRequest{}, Response: models.AdminNote{}, Status: http.StatusCreated,
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+			},
+			"DELETE /api/users/:id/notes/:noteId": {
+				Summary: "Delete a note from a user", Tags: []string{"users"}, Auth: true,
+				Response: MessageResponse{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+			},
+
+			// Administration
+			"GET /api/admin/maintenance": {
+				Summary: "Get the maintenance mode state", Tags: []string{"admin"}, Auth: true,
+				Response: maintenance.State{},
+				Errors:   []int{http.StatusForbidden},
+			},
+			"PUT /api/admin/maintenance": {
+				Summary: "Turn maintenance mode on or off", Tags: []string{"admin"}, Auth: true,
+				Request: SetMaintenanceRequest{}, Response: maintenance.State{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden},
+			},
+			"GET /api/apikeys": {
+				Summary: "List your API keys; admins see all keys", Tags: []string{"apikeys"}, Auth: true,
+				Response: []models.APIKey{},
+			},
+			"POST /api/apikeys": {
+				Summary: "Create an API key; the key is only shown in this response", Tags: []string{"apikeys"}, Auth: true,
+				Request: CreateAPIKeyRequest{}, Response: APIKeyCreatedResponse{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+			},
+			"PUT /api/apikeys/:id/quota": {
+				Summary: "Set the monthly request quota of an API key (0 removes it)", Tags: []string{"apikeys"}, Auth: true,
+				Request: SetAPIKeyQuotaRequest{}, Response: models.APIKey{},
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+			},
+			"DELETE /api/apikeys/:id": {
+				Summary: "Revoke an API key", Tags: []string{"apikeys"}, Auth: true,
+				Response: MessageResponse{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+			},
+			"GET /api/apikeys/:id/usage": {
+				Summary: "Daily request counts of an API key", Tags: []string{"apikeys"}, Auth: true,
+				Response: APIKeyUsageResponse{},
+				Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+				Query: []openapi.Param{
+					{Name: "from", Description: "First day (YYYY-MM-DD, UTC); defaults to 29 days before to"},
+					{Name: "to", Description: "Last day (YYYY-MM-DD, UTC); defaults to today"},
+				},
+			},
+			"GET /api/admin/tags": {
+				Summary: "List the predefined user tags and how many users carry each tag", Tags: []string{"admin"}, Auth: true,
+				Response: TagsResponse{},
+				Errors:   []int{http.StatusForbidden},
+			},
+			"GET /api/admin/jobs": {
+				Summary: "List background jobs, the failed ones by default", Tags: []string{"admin"}, Auth: true,
+				Response: []models.Job{},
+				Errors:   []int{http.StatusBadRequest, http.StatusForbidden},
+				Query: []openapi.Param{
+					{Name: "state", Description: "pending, running or failed (default)"},
+					{Name: "kind", Description: "Only jobs of this kind, e.g. email"},
+					{Name: "page", Description: "Page number, starting at 1", Type: "integer"},
+					{Name: "per_page", Description: "Jobs per page (1-100, default 20)", Type: "integer"},
+				},
+			},
+			"GET /api/admin/events": {
+				Summary: "Stream registrations, failed login bursts and role changes as server-sent events", Tags: []string{"admin"}, Auth: true,
+				Response: events.Event{}, ResponseType: "text/event-stream",
+				Errors: []int{http.StatusBadRequest, http.StatusForbidden},
+				Query: []openapi.Param{
+					{Name: "types", Description: "Comma-separated event types: user_registered, failed_login_burst, role_assigned, role_removed"},
+					{Name: "last_event_id", Description: "Replay the recent events after this ID, like the Last-Event-ID header", Type: "integer"},
+				},
+			},
+			"POST /api/admin/jobs/:id/retry": {
+				Summary: "Queue a failed job again", Tags: []string{"admin"}, Auth: true,
+				Response: MessageResponse{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+			},
+			"DELETE /api/admin/jobs/:id": {
+				Summary: "Discard a failed job", Tags: []string{"admin"}, Auth: true,
+				Response: MessageResponse{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+			},
+
+			// Documentation
+			"GET /api/docs": {
+				Summary: "Swagger UI", Tags: []string{"docs"},
+			},
+			"GET /api/docs/openapi.json": {
+				Summary: "OpenAPI document", Tags: []string{"docs"},
+				Response: map[string]any{}, Unwrapped: true,
+			},
+		},
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// ChangePasswordRequest represents the JSON payload for changing the password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// passwordExpiry reports whether the user's password has expired under the configured
+// maximum age, and sets the Password-Expires header when expiry is near
+func (ah *AuthHandler) passwordExpiry(c *gin.Context, user *models.User) bool {
+	if ah.authCfg.PasswordMaxAge == 0 {
+		return false
+	}
+	expiresAt := user.PasswordExpiresAt(ah.authCfg.PasswordMaxAge)
+	if time.Until(expiresAt) <= ah.authCfg.PasswordExpiryWarning {
+		c.Header("Password-Expires", expiresAt.UTC().Format(http.TimeFormat))
+	}
+	return !time.Now().Before(expiresAt)
+}
+
+// ChangePasswordHandler replaces the current user's password. Tokens issued before
+// are revoked, so the response carries a new token pair for this device.
+func (ah *AuthHandler) ChangePasswordHandler(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	// Cached users lack the password hash
+	current, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return
+	}
+	ctx := c.Request.Context()
+	user, err := ah.users.FindByID(ctx, current.(*models.User).ID)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	if err := ah.service.CheckPassword(ctx, user, req.CurrentPassword, client(c)); err != nil {
+		problem.Write(c, err)
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		problem.Write(c, apperr.ErrPasswordUnchanged)
+		return
+	}
+
+	if err := ah.users.ResetPassword(ctx, user, req.NewPassword); err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	// Reload for the new token version
+	user, err = ah.users.FindByID(ctx, user.ID)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	tokenPair, err := ah.service.IssueTokens(ctx, user, auth.Authenticated(auth.MethodPassword), nil, client(c))
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+
+	response.OK(c, TokenResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+		ExpiresIn:    tokenPair.ExpiresIn,
+	})
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/etag"
+	"github.com/ristep/um_starter_jwt_go/internal/mergepatch"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// PatchUserRequest is the editable view of a user that merge patches apply to.
+// A member set to null is reset to its zero value; the name cannot be cleared.
+type PatchUserRequest struct {
+	Name string `json:"name" binding:"required,min=2"`
+	// Tel is normalized to E.164; it is only validated when the patch sets it
+	Tel string `json:"tel"`
+	// DateOfBirth is a "2006-01-02" date; it is only validated when the patch sets it
+	DateOfBirth string `json:"date_of_birth"`
+	// Address, City and Country are only validated when the patch sets them
+	Address string `json:"address"`
+	City    string `json:"city"`
+	// Country is an ISO 3166-1 alpha-2 or alpha-3 code, stored as alpha-2
+	Country string `json:"country"`
+	// Gender and GenderDescription are only validated when the patch sets either
+	Gender            string `json:"gender"`
+	GenderDescription string `json:"gender_description"`
+	// Metadata is merged recursively; custom profile fields are validated against the schema
+	Metadata models.Metadata `json:"metadata"`
+	// Version, unless removed by the patch, must equal the user's current version
+	Version *uint `json:"version"`
+}
+
+// PatchUserHandler applies a JSON merge patch to a user (admin only)
+func (uh *UserHandler) PatchUserHandler(c *gin.Context) {
+	user, ok := uh.userByID(c)
+	if !ok {
+		return
+	}
+
+	uh.patchUser(c, user, userLinks(*user))
+}
+
+// PatchProfileHandler applies a JSON merge patch to the current user's profile
+func (uh *UserHandler) PatchProfileHandler(c *gin.Context) {
+	user, ok := uh.currentUser(c)
+	if !ok {
+		return
+	}
+
+	uh.patchUser(c, user, response.Links{"self": "/api/profile"})
+}
+
+// patchUser merges the request body into the user's editable fields, validates the
+// result and saves it
+func (uh *UserHandler) patchUser(c *gin.Context, user *models.User, links response.Links) {
+	if ct := c.ContentType(); ct != mergepatch.ContentType && ct != binding.MIMEJSON {
+		problem.Write(c, apperr.ErrUnsupportedMediaType.WithDetail("Use "+mergepatch.ContentType))
+		return
+	}
+
+	// Reject the write if the client's copy is stale
+	if etag.PreconditionFailed(c, etag.Weak(user.ID, user.UpdatedAt)) {
+		problem.Write(c, apperr.ErrPreconditionFailed)
+		return
+	}
+
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	keys, err := mergepatch.Keys(patch)
+	if err != nil {
+		if errors.Is(err, mergepatch.ErrNotObject) {
+			problem.Write(c, apperr.ErrInvalidInput.WithDetail("Merge patch must be a JSON object"))
+			return
+		}
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	current := PatchUserRequest{
+		Name:              user.Name,
+		Tel:               user.Tel,
+		DateOfBirth:       dateString(user.DateOfBirth),
+		Address:           user.Address,
+		City:              user.City,
+		Country:           user.Country,
+		Gender:            user.Gender,
+		GenderDescription: user.GenderDesc,
+		Metadata:          user.Metadata,
+		Version:           &user.Version,
+	}
+	target, err := json.Marshal(current)
+	if err != nil {
+		problem.Write(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+
+	var known map[string]json.RawMessage
+	json.Unmarshal(target, &known)
+	var unknown []string
+	for _, key := range keys {
+		if _, ok := known[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		problem.Write(c, validation.UnknownFields(c, unknown))
+		return
+	}
+
+	merged, err := mergepatch.Apply(target, patch)
+	if err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	var req PatchUserRequest
+	if err := json.Unmarshal(merged, &req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	// Stored numbers that predate validation must not block unrelated patches
+	if slices.Contains(keys, "tel") {
+		if err := validation.Var(c, "tel", req.Tel, "omitempty,phone"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		req.Tel = normalizeTel(req.Tel)
+	}
+
+	if slices.Contains(keys, "date_of_birth") {
+		if err := validation.Var(c, "date_of_birth", req.DateOfBirth, "omitempty,birthdate"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+	}
+
+	if slices.Contains(keys, "address") {
+		if err := validation.Var(c, "address", req.Address, "omitempty,max=200,printable"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		req.Address = validation.NormalizeAddress(req.Address)
+	}
+
+	if slices.Contains(keys, "city") {
+		if err := validation.Var(c, "city", req.City, "omitempty,max=100,printable"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		req.City = validation.NormalizeCity(req.City)
+	}
+
+	if slices.Contains(keys, "country") {
+		if err := validation.Var(c, "country", req.Country, "omitempty,country"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		req.Country = normalizeCountry(req.Country)
+	}
+
+	if slices.Contains(keys, "gender") || slices.Contains(keys, "gender_description") {
+		if err := validation.Var(c, "gender", req.Gender, "omitempty,gender"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		if req.GenderDescription, err = validation.GenderDescription(c, req.Gender, req.GenderDescription); err != nil {
+			problem.Write(c, err)
+			return
+		}
+	}
+
+	// Custom profile fields are only checked when the patch touches metadata
+	if slices.Contains(keys, "metadata") {
+		if err := uh.profileFields.Validate(c, req.Metadata); err != nil {
+			problem.Write(c, err)
+			return
+		}
+	}
+
+	if req.Version != nil && *req.Version != user.Version {
+		problem.Write(c, apperr.ErrVersionConflict)
+		return
+	}
+
+	if req.Tel != user.Tel {
+		user.PhoneVerified = false
+	}
+	user.Name = req.Name
+	user.Tel = req.Tel
+	user.DateOfBirth = parseDateOfBirth(req.DateOfBirth)
+	user.Address = req.Address
+	user.City = req.City
+	user.Country = req.Country
+	user.Gender = req.Gender
+	user.GenderDesc = req.GenderDescription
+	user.Metadata = req.Metadata
+
+	fields := slices.DeleteFunc(slices.Clone(keys), func(key string) bool { return key == "version" })
+	sort.Strings(fields)
+	if err := uh.service.Save(c.Request.Context(), actorID(c), user, fields); err != nil {
+		problem.Write(c, err)
+		return
+	}
+
+	// Reload with roles
+	if reloaded, err := uh.users.FindByID(c.Request.Context(), user.ID); err == nil {
+		user = reloaded
+	}
+
+	etag.Set(c, etag.Weak(user.ID, user.UpdatedAt))
+	response.OK(c, user, response.WithLinks(links))
+}
+
+// dateString formats an optional date, giving "" for nil
+func dateString(d *models.Date) string {
+	if d == nil {
+		return ""
+	}
+	return d.String()
+}
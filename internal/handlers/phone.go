@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/etag"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/phone"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/sms"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// PhoneHandler verifies users' phone numbers with one-time codes sent by SMS
+type PhoneHandler struct {
+	users     repository.UserRepository
+	tokenRepo repository.TokenRepository
+	sender    sms.Sender
+	cfg       config.SMSConfig
+}
+
+// NewPhoneHandler creates a new phone verification handler
+func NewPhoneHandler(users repository.UserRepository, tokenRepo repository.TokenRepository, sender sms.Sender, cfg config.SMSConfig) *PhoneHandler {
+	return &PhoneHandler{users: users, tokenRepo: tokenRepo, sender: sender, cfg: cfg}
+}
+
+// PhoneCodeResponse describes a verification code that was sent
+type PhoneCodeResponse struct {
+	Tel       string `json:"tel"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// VerifyPhoneRequest represents the JSON payload for confirming a phone number
+type VerifyPhoneRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// SendPhoneCodeHandler texts a verification code to the phone number on the current user's profile
+func (ph *PhoneHandler) SendPhoneCodeHandler(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return
+	}
+	user := currentUser.(*models.User)
+
+	if user.Tel == "" {
+		problem.Write(c, apperr.ErrPhoneMissing)
+		return
+	}
+	// Numbers saved before normalization was introduced must be re-saved first
+	if normalized, err := phone.Normalize(user.Tel); err != nil || normalized != user.Tel {
+		problem.Write(c, apperr.ErrInvalidPhone)
+		return
+	}
+	if user.PhoneVerified {
+		problem.Write(c, apperr.ErrPhoneAlreadyVerified)
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+	pending, err := ph.tokenRepo.PhoneVerification(ctx, user.ID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	if err == nil {
+		if wait := time.UnixMilli(pending.CreatedAt).Add(ph.cfg.OTPResendInterval).Sub(now); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			problem.Write(c, apperr.ErrOTPResendTooSoon)
+			return
+		}
+	}
+
+	code, err := otpCode()
+	if err != nil {
+		problem.Write(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+
+	// Replace any previous code so only the latest one is accepted
+	verification := models.PhoneVerification{
+		UserID:    user.ID,
+		Tel:       user.Tel,
+		CodeHash:  hashPhoneCode(user.ID, user.Tel, code),
+		CreatedAt: now.UnixMilli(),
+		ExpiresAt: now.Add(ph.cfg.OTPTTL).UnixMilli(),
+	}
+	if err := ph.tokenRepo.SavePhoneVerification(ctx, &verification); err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	body := fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, int(ph.cfg.OTPTTL.Minutes()))
+	if err := ph.sender.Send(ctx, user.Tel, body); err != nil {
+		ph.tokenRepo.DeletePhoneVerification(context.WithoutCancel(ctx), user.ID)
+		problem.Write(c, apperr.ErrSMSDelivery.Wrap(err))
+		return
+	}
+
+	response.JSON(c, http.StatusAccepted, PhoneCodeResponse{Tel: user.Tel, ExpiresAt: verification.ExpiresAt},
+		response.WithLinks(response.Links{"verify": "/api/profile/phone/verify"}))
+}
+
+// VerifyPhoneHandler confirms the current user's phone number with the code sent to it
+func (ph *PhoneHandler) VerifyPhoneHandler(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return
+	}
+	user := currentUser.(*models.User)
+
+	var req VerifyPhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	pending, err := ph.tokenRepo.PhoneVerification(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			problem.Write(c, apperr.ErrOTPInvalid)
+			return
+		}
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	// A code is only good for the number it was sent to
+	if pending.Tel != user.Tel || time.Now().UnixMilli() > pending.ExpiresAt {
+		ph.tokenRepo.DeletePhoneVerification(ctx, user.ID)
+		problem.Write(c, apperr.ErrOTPInvalid)
+		return
+	}
+	if pending.Attempts >= ph.cfg.OTPMaxAttempts {
+		problem.Write(c, apperr.ErrOTPTooManyAttempts)
+		return
+	}
+
+	expected := hashPhoneCode(user.ID, pending.Tel, req.Code)
+	if !hmac.Equal([]byte(expected), []byte(pending.CodeHash)) {
+		if err := ph.tokenRepo.CountPhoneVerificationAttempt(ctx, pending); err != nil {
+			logging.Warn(ctx, "failed to count phone verification attempt", "user_id", user.ID, "error", err)
+		}
+		problem.Write(c, apperr.ErrOTPInvalid)
+		return
+	}
+
+	if err := ph.tokenRepo.VerifyPhone(ctx, pending); err != nil {
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to verify phone number").Wrap(err))
+		return
+	}
+
+	updated, err := ph.users.FindByID(ctx, user.ID)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	etag.Set(c, etag.Weak(updated.ID, updated.UpdatedAt))
+	response.OK(c, updated, response.WithLinks(response.Links{"self": "/api/profile"}))
+}
+
+// normalizeTel returns the E.164 form of a number that passed the "phone" rule
+func normalizeTel(tel string) string {
+	if normalized, err := phone.Normalize(tel); err == nil {
+		return normalized
+	}
+	return tel
+}
+
+// hashPhoneCode binds a code to the user and number it was sent to
+func hashPhoneCode(userID uint, tel, code string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s", userID, tel, code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// otpCode returns a random six-digit code
+func otpCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
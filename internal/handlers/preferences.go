@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// Preferences holds the current user's time zone and locale. Empty values fall back
+// to UTC and the request's Accept-Language header.
+type Preferences struct {
+	Timezone string `json:"timezone" binding:"omitempty,timezone"`
+	Locale   string `json:"locale" binding:"omitempty,locale"`
+}
+
+// GetPreferencesHandler returns the current user's preferences
+func (uh *UserHandler) GetPreferencesHandler(c *gin.Context) {
+	user, ok := uh.currentUser(c)
+	if !ok {
+		return
+	}
+	response.OK(c, Preferences{Timezone: user.Timezone, Locale: user.Locale},
+		response.WithLinks(response.Links{"self": "/api/profile/preferences"}))
+}
+
+// PutPreferencesHandler replaces the current user's preferences
+func (uh *UserHandler) PutPreferencesHandler(c *gin.Context) {
+	user, ok := uh.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req Preferences
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	req.Timezone, _ = validation.NormalizeTimezone(req.Timezone)
+	req.Locale, _ = validation.NormalizeLocale(req.Locale)
+
+	if err := uh.users.SetPreferences(c.Request.Context(), user, req.Timezone, req.Locale); err != nil {
+		problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to update preferences").Wrap(err))
+		return
+	}
+	uh.service.ProfileChanged(c.Request.Context(), user.ID, user.ID, "timezone", "locale")
+
+	response.OK(c, req, response.WithLinks(response.Links{"self": "/api/profile/preferences"}))
+}
@@ -0,0 +1,119 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/handlers"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/service"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+	"github.com/ristep/um_starter_jwt_go/internal/testutil"
+	"github.com/ristep/um_starter_jwt_go/pkg/usermgmt/authtest"
+)
+
+func (singleUser) RecordActivity(context.Context, uint) error { return nil }
+
+// opaqueTokens is an in-memory auth.OpaqueStore
+type opaqueTokens struct {
+	mu     sync.Mutex
+	claims map[string]*auth.CustomClaims
+}
+
+func (ot *opaqueTokens) Save(_ context.Context, hash string, claims *auth.CustomClaims) error {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+	ot.claims[hash] = claims
+	return nil
+}
+
+func (ot *opaqueTokens) Load(_ context.Context, hash string) (*auth.CustomClaims, error) {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+	claims, ok := ot.claims[hash]
+	if !ok {
+		return nil, auth.ErrOpaqueTokenNotFound
+	}
+	return claims, nil
+}
+
+func (ot *opaqueTokens) Delete(_ context.Context, hash string) error {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+	delete(ot.claims, hash)
+	return nil
+}
+
+func (ot *opaqueTokens) DeleteUser(context.Context, uint) error { return nil }
+
+// sessionStore is an in-memory sessions.Store; only Create and Use are implemented
+type sessionStore struct {
+	sessions.Store
+	mu       sync.Mutex
+	sessions map[string]*models.RefreshToken
+}
+
+func (ss *sessionStore) Create(_ context.Context, session *models.RefreshToken) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.sessions[session.TokenHash] = session
+	return nil
+}
+
+func (ss *sessionStore) Use(_ context.Context, hash string) (*models.RefreshToken, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	session, ok := ss.sessions[hash]
+	if !ok {
+		return nil, sessions.ErrNotFound
+	}
+	delete(ss.sessions, hash)
+	return session, nil
+}
+
+func TestRefreshGraceWithOpaqueTokens(t *testing.T) {
+	user := testutil.NewUser(t)
+	user.ID = 7
+	users := singleUser{user: user}
+	tokens := auth.NewOpaqueService(authtest.JWTConfig("opaque"), &opaqueTokens{claims: make(map[string]*auth.CustomClaims)})
+	store := &sessionStore{sessions: make(map[string]*models.RefreshToken)}
+	svc := service.NewAuthService(users, nil, nil, tokens, store, nil, service.RegistrationPolicy{}, config.SessionConfig{}, config.AuthConfig{})
+	grace := sessions.NewGrace(sessions.NewMemoryGraceStore(), time.Minute)
+	h := handlers.NewAuthHandler(svc, users, nil, tokens, nil, store, nil, grace, config.AuthConfig{}, handlers.LoginRiskPolicy{}, handlers.RegistrationMail{})
+	router := testutil.Router()
+	router.POST("/api/auth/refresh", h.RefreshHandler)
+
+	pair, err := tokens.GenerateTokenPair(user, auth.Authenticated(auth.MethodPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Create(context.Background(), &models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: sessions.Hash(pair.RefreshToken),
+		ExpiresAt: pair.RefreshExpiresAt.UnixMilli(),
+	})
+
+	refresh := func(t *testing.T) handlers.TokenResponse {
+		t.Helper()
+		rec := testutil.Do(router, testutil.NewRequest(t, http.MethodPost, "/api/auth/refresh", handlers.RefreshRequest{RefreshToken: pair.RefreshToken}))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		var resp handlers.TokenResponse
+		testutil.DecodeData(t, rec, &resp)
+		return resp
+	}
+
+	first := refresh(t)
+	if _, err := tokens.ValidateRefreshToken(pair.RefreshToken); err == nil {
+		t.Fatal("the used refresh token was not deleted")
+	}
+	if second := refresh(t); second != first {
+		t.Errorf("second refresh = %+v, want the first one's tokens %+v", second, first)
+	}
+}
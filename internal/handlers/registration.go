@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/mail"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/onetime"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/ratelimit"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/service"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+	"github.com/ristep/um_starter_jwt_go/internal/signedurl"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// RegistrationMail sends the emails of registrations under enumeration protection:
+// a link that creates the account, or a notice to the owner of a taken email
+type RegistrationMail struct {
+	Mailer mail.Sender
+	// Throttle caps the emails an address and a client IP receive
+	Throttle *ratelimit.Throttle
+	// ConfirmTTL and ConfirmURL describe the confirmation links (see config.RegistrationConfig)
+	ConfirmTTL time.Duration
+	ConfirmURL string
+	// Links builds and signs the confirmation links
+	Links *signedurl.Signer
+}
+
+// ConfirmRegistrationRequest represents the JSON payload for confirming a
+// registration. Expires and Signature are passed on from signed links.
+type ConfirmRegistrationRequest struct {
+	Token     string `json:"token" binding:"required"`
+	Expires   int64  `json:"expires"`
+	Signature string `json:"signature"`
+}
+
+// requestRegistration mails the address a link that creates the account, or tells its
+// owner when the email is taken, and answers both cases with 202
+func (ah *AuthHandler) requestRegistration(c *gin.Context, reg service.Registration) {
+	wait, ok := ah.registration.Throttle.Allow(c.Request.Context(), ratelimit.EmailKey(reg.Email), ratelimit.IPKey(c.ClientIP()))
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		problem.Write(c, apperr.ErrTooManyEmails)
+		return
+	}
+
+	token, confirm, err := onetime.New(models.TokenPurposeRegistration, 0, ah.registration.ConfirmTTL, nil)
+	if err != nil {
+		problem.Write(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+	ctx := c.Request.Context()
+	taken, err := ah.service.RequestRegistration(ctx, reg, confirm, client(c))
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+
+	to, subject, body := reg.Email, "Confirm your email address", ah.registrationBody(token, time.UnixMilli(confirm.ExpiresAt))
+	if taken != nil {
+		to, subject, body = taken.Email, "Someone tried to sign up with your email address", takenBody("sign up with", c.ClientIP(), c.Request.UserAgent())
+	}
+	if err := ah.registration.Mailer.Send(ctx, to, subject, body); err != nil {
+		problem.Write(c, apperr.ErrMailDelivery.Wrap(err))
+		return
+	}
+
+	response.JSON(c, http.StatusAccepted, MessageResponse{Message: "Check your email to finish signing up"})
+}
+
+// registrationBody is the text of the email that confirms a registration
+func (ah *AuthHandler) registrationBody(token string, expiresAt time.Time) string {
+	var b strings.Builder
+	b.WriteString("You signed up with this email address.\n\n")
+	if ah.registration.ConfirmURL != "" {
+		fmt.Fprintf(&b, "Confirm it to create your account:\n%s\n\n", tokenLink(ah.registration.Links, ah.registration.ConfirmURL, models.TokenPurposeRegistration, token, expiresAt))
+	} else {
+		fmt.Fprintf(&b, "Confirm it with this code to create your account:\n%s\n\n", token)
+	}
+	fmt.Fprintf(&b, "This expires on %s. If you didn't sign up, ignore this email.\n",
+		expiresAt.UTC().Format("2 Jan 2006 15:04 MST"))
+	return b.String()
+}
+
+// takenBody is the text of the notice sent when someone tries to use an email that
+// already has an account, e.g. to "sign up with"
+func takenBody(attempt, ip, userAgent string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Someone tried to %s this email address, which already has an account.\n\n", attempt)
+	fmt.Fprintf(&b, "IP address: %s\n", ip)
+	fmt.Fprintf(&b, "Device: %s\n\n", userAgent)
+	b.WriteString("If it was you, sign in to that account instead. Otherwise you can ignore this email.\n")
+	return b.String()
+}
+
+// ConfirmRegistrationHandler creates the account of a registration with the token
+// mailed to its address, and logs the new user in
+func (ah *AuthHandler) ConfirmRegistrationHandler(c *gin.Context) {
+	var req ConfirmRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	// Tampered and expired links are turned away before the lookup
+	if !checkTokenLink(ah.registration.Links, ah.registration.ConfirmURL, models.TokenPurposeRegistration, req.Token, req.Expires, req.Signature) {
+		problem.Write(c, apperr.ErrInvalidRegistration)
+		return
+	}
+
+	user, err := ah.service.ConfirmRegistration(c.Request.Context(), sessions.Hash(req.Token))
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+	ah.respondRegistered(c, user)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/etag"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/service"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+)
+
+// SessionHandler lets users see and revoke the refresh tokens issued to their devices,
+// and admins revoke every token of a user
+type SessionHandler struct {
+	service     *service.UserService
+	store       sessions.Store
+	tokens      auth.TokenService
+	revocations sessions.RevocationList
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(svc *service.UserService, store sessions.Store, tokens auth.TokenService, revocations sessions.RevocationList) *SessionHandler {
+	return &SessionHandler{service: svc, store: store, tokens: tokens, revocations: revocations}
+}
+
+// ListSessionsHandler returns the current user's active sessions
+func (sh *SessionHandler) ListSessionsHandler(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return
+	}
+
+	list, err := sh.store.List(c.Request.Context(), currentUser.(*models.User).ID)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	if list == nil {
+		list = []models.RefreshToken{}
+	}
+
+	response.OK(c, list, response.WithLinks(response.Links{"self": "/api/profile/sessions"}))
+}
+
+// RevokeSessionHandler ends one of the current user's sessions
+func (sh *SessionHandler) RevokeSessionHandler(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		problem.Write(c, apperr.ErrSessionNotFound)
+		return
+	}
+
+	if err := sh.store.Revoke(c.Request.Context(), currentUser.(*models.User).ID, uint(id)); err != nil {
+		if errors.Is(err, sessions.ErrNotFound) {
+			problem.Write(c, apperr.ErrSessionNotFound)
+			return
+		}
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	response.OK(c, MessageResponse{Message: "Session revoked"})
+}
+
+// RevokeAllSessionsHandler ends all of the current user's sessions and revokes the
+// access token of the request. Other access tokens stay valid until they expire,
+// unless tokens are kept server-side, in which case all of them are deleted.
+func (sh *SessionHandler) RevokeAllSessionsHandler(c *gin.Context) {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return
+	}
+
+	userID := currentUser.(*models.User).ID
+	if err := sh.store.RevokeAll(c.Request.Context(), userID); err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	if revoker, ok := sh.tokens.(auth.Revoker); ok {
+		if err := revoker.RevokeUser(c.Request.Context(), userID); err != nil {
+			problem.Write(c, apperr.ErrInternal.WithDetail("Failed to revoke tokens").Wrap(err))
+			return
+		}
+	}
+	if claims, ok := c.Get("claims"); ok {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if err := revokeAccessToken(c, sh.tokens, sh.revocations, token, claims.(*auth.CustomClaims)); err != nil {
+			problem.Write(c, err)
+			return
+		}
+	}
+
+	response.OK(c, MessageResponse{Message: "All sessions revoked"})
+}
+
+// RevokeUserTokensHandler ends every session of a user and invalidates all their
+// refresh and access tokens (admin only), e.g. when the account was compromised. The
+// user can log in again.
+func (sh *SessionHandler) RevokeUserTokensHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := sh.service.RevokeTokens(ctx, actorID(c), userID, client(c))
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+	if err := sh.store.RevokeAll(ctx, userID); err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	if revoker, ok := sh.tokens.(auth.Revoker); ok {
+		if err := revoker.RevokeUser(ctx, userID); err != nil {
+			problem.Write(c, apperr.ErrInternal.WithDetail("Failed to revoke tokens").Wrap(err))
+			return
+		}
+	}
+
+	etag.Set(c, etag.Weak(user.ID, user.UpdatedAt))
+	response.OK(c, user, response.WithLinks(userLinks(*user)))
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/etag"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// SuspendUserRequest represents the JSON payload for suspending a user
+type SuspendUserRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// SuspendUserHandler suspends a user, revoking their tokens (admin only).
+// Suspending a suspended user updates the reason.
+func (uh *UserHandler) SuspendUserHandler(c *gin.Context) {
+	var req SuspendUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	user, ok := uh.userByID(c)
+	if !ok {
+		return
+	}
+
+	currentUser, exists := c.Get("user")
+	if !exists {
+		problem.Write(c, apperr.ErrUnauthorized)
+		return
+	}
+	if currentUser.(*models.User).ID == user.ID {
+		problem.Write(c, apperr.ErrCannotSuspendSelf)
+		return
+	}
+
+	if err := uh.service.Suspend(c.Request.Context(), user, req.Reason); err != nil {
+		problem.Write(c, err)
+		return
+	}
+	uh.respondWithUser(c, user)
+}
+
+// UnsuspendUserHandler lifts a user's suspension (admin only)
+func (uh *UserHandler) UnsuspendUserHandler(c *gin.Context) {
+	user, ok := uh.userByID(c)
+	if !ok {
+		return
+	}
+
+	if user.Suspended() {
+		if err := uh.users.Unsuspend(c.Request.Context(), user); err != nil {
+			problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to unsuspend user").Wrap(err))
+			return
+		}
+	}
+	uh.respondWithUser(c, user)
+}
+
+// GetUserLoginsHandler returns a page of a user's login history, newest first (admin only)
+func (uh *UserHandler) GetUserLoginsHandler(c *gin.Context) {
+	query := PageQuery{Page: 1, PerPage: 20}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	user, ok := uh.userByID(c)
+	if !ok {
+		return
+	}
+
+	events, total, err := uh.users.LoginHistory(c.Request.Context(), user.ID, (query.Page-1)*query.PerPage, query.PerPage)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	pagination := response.NewPagination(query.Page, query.PerPage, total)
+	response.OK(c, events,
+		response.WithPagination(pagination),
+		response.WithLinks(pageLinks(c, pagination)),
+	)
+}
+
+// respondWithUser reloads the user with roles and writes it with its ETag
+func (uh *UserHandler) respondWithUser(c *gin.Context, user *models.User) {
+	user, err := uh.users.FindByID(c.Request.Context(), user.ID)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	etag.Set(c, etag.Weak(user.ID, user.UpdatedAt))
+	response.OK(c, user, response.WithLinks(userLinks(*user)))
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// maxUserTags caps the number of tags on one user
+const maxUserTags = 20
+
+// tagPattern restricts tags to short lower-case labels
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// TagHandler lets admins label users with tags, e.g. beta, vip or flagged, to
+// segment them without creating roles
+type TagHandler struct {
+	users repository.UserRepository
+	// allowed are the predefined tags; empty allows any tag
+	allowed []string
+}
+
+// NewTagHandler creates a new tag handler
+func NewTagHandler(users repository.UserRepository, allowed []string) *TagHandler {
+	return &TagHandler{users: users, allowed: allowed}
+}
+
+// AddTagRequest represents the JSON payload for tagging a user
+type AddTagRequest struct {
+	Tag string `json:"tag" binding:"required"`
+}
+
+// TagsResponse lists the predefined tags and the tags in use
+type TagsResponse struct {
+	// Allowed are the tags admins may use; empty means any tag is accepted
+	Allowed []string              `json:"allowed"`
+	InUse   []repository.TagCount `json:"in_use"`
+}
+
+// ListTagsHandler returns the predefined tags and how many users carry each tag (admin only)
+func (th *TagHandler) ListTagsHandler(c *gin.Context) {
+	counts, err := th.users.TagCounts(c.Request.Context())
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	allowed := th.allowed
+	if allowed == nil {
+		allowed = []string{}
+	}
+	response.OK(c, TagsResponse{Allowed: allowed, InUse: counts})
+}
+
+// AddTagHandler puts a tag on a user and returns the updated user (admin only).
+// Adding a tag the user already carries changes nothing.
+func (th *TagHandler) AddTagHandler(c *gin.Context) {
+	var req AddTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+	tag, err := th.tag(req.Tag)
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+	user, ok := th.user(c)
+	if !ok {
+		return
+	}
+
+	if !slices.Contains(user.Tags, tag) {
+		if len(user.Tags) >= maxUserTags {
+			problem.Write(c, apperr.ErrTooManyTags)
+			return
+		}
+		if err := th.users.AddTag(c.Request.Context(), user, tag); err != nil {
+			problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to add tag").Wrap(err))
+			return
+		}
+	}
+	th.respond(c, user.ID)
+}
+
+// RemoveTagHandler takes a tag off a user and returns the updated user (admin only).
+// Removing a tag the user doesn't carry changes nothing.
+func (th *TagHandler) RemoveTagHandler(c *gin.Context) {
+	user, ok := th.user(c)
+	if !ok {
+		return
+	}
+	tag := normalizeTag(c.Param("tag"))
+	if slices.Contains(user.Tags, tag) {
+		if err := th.users.RemoveTag(c.Request.Context(), user, tag); err != nil {
+			problem.Write(c, apperr.ErrDatabase.WithDetail("Failed to remove tag").Wrap(err))
+			return
+		}
+	}
+	th.respond(c, user.ID)
+}
+
+// tag normalizes a tag and checks it is well-formed and, if tags are predefined,
+// one of them
+func (th *TagHandler) tag(raw string) (string, error) {
+	tag := normalizeTag(raw)
+	if !tagPattern.MatchString(tag) {
+		return "", apperr.ErrInvalidTag
+	}
+	if len(th.allowed) > 0 && !slices.Contains(th.allowed, tag) {
+		return "", apperr.ErrTagNotAllowed
+	}
+	return tag, nil
+}
+
+// user loads the user named by the :id path parameter
+func (th *TagHandler) user(c *gin.Context) (*models.User, bool) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return nil, false
+	}
+	user, err := th.users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		problem.Write(c, userError(err))
+		return nil, false
+	}
+	return user, true
+}
+
+// respond reloads the user and writes it
+func (th *TagHandler) respond(c *gin.Context, id uint) {
+	user, err := th.users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	response.OK(c, user)
+}
+
+// tagFilters reads the ?tag= parameters of the user list; users must carry every tag
+func tagFilters(c *gin.Context) ([]string, error) {
+	var tags []string
+	for _, raw := range c.QueryArray("tag") {
+		tag := normalizeTag(raw)
+		if !tagPattern.MatchString(tag) {
+			return nil, apperr.ErrInvalidTag
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
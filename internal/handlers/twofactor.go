@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/response"
+	"github.com/ristep/um_starter_jwt_go/internal/service"
+	"github.com/ristep/um_starter_jwt_go/internal/totp"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// TwoFactorHandler enrolls users in two-factor authentication with an authenticator app
+type TwoFactorHandler struct {
+	users repository.UserRepository
+	cfg   config.AuthConfig
+}
+
+// NewTwoFactorHandler creates a new two-factor authentication handler
+func NewTwoFactorHandler(users repository.UserRepository, cfg config.AuthConfig) *TwoFactorHandler {
+	return &TwoFactorHandler{users: users, cfg: cfg}
+}
+
+// TwoFactorSetupResponse carries the secret to add to an authenticator app
+type TwoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI, usually shown as a QR code
+	URI string `json:"otpauth_uri"`
+}
+
+// TwoFactorCodeRequest represents the JSON payload carrying an authenticator code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// SetupTwoFactorHandler generates a new authenticator secret for the current user.
+// Two-factor authentication is enabled once a code from it is confirmed.
+func (th *TwoFactorHandler) SetupTwoFactorHandler(c *gin.Context) {
+	user, err := th.storedUser(c)
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+	if user.TOTPEnabled {
+		problem.Write(c, apperr.ErrTwoFactorAlreadyEnabled)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		problem.Write(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+	if err := th.users.SetTOTPSecret(c.Request.Context(), user.ID, secret); err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+
+	response.OK(c, TwoFactorSetupResponse{
+		Secret: secret,
+		URI:    totp.URI(th.cfg.TwoFactorIssuer, user.Email, secret),
+	}, response.WithLinks(response.Links{"enable": "/api/profile/2fa/enable"}))
+}
+
+// EnableTwoFactorHandler turns on two-factor authentication after the user proves
+// their authenticator app produces valid codes
+func (th *TwoFactorHandler) EnableTwoFactorHandler(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	user, err := th.storedUser(c)
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+	if user.TOTPEnabled {
+		problem.Write(c, apperr.ErrTwoFactorAlreadyEnabled)
+		return
+	}
+	if user.TOTPSecret == "" {
+		problem.Write(c, apperr.ErrTwoFactorNotSetUp)
+		return
+	}
+
+	ok, err := service.UseTOTPCode(c.Request.Context(), th.users, user, req.Code)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	if !ok {
+		problem.Write(c, apperr.ErrOTPInvalid)
+		return
+	}
+
+	if err := th.users.SetTOTPEnabled(c.Request.Context(), user.ID, true); err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	response.OK(c, MessageResponse{Message: "Two-factor authentication enabled"})
+}
+
+// DisableTwoFactorHandler turns off two-factor authentication, unless one of the
+// user's roles requires it
+func (th *TwoFactorHandler) DisableTwoFactorHandler(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, validation.Translate(c, err))
+		return
+	}
+
+	user, err := th.storedUser(c)
+	if err != nil {
+		problem.Write(c, err)
+		return
+	}
+	if !user.TOTPEnabled {
+		problem.Write(c, apperr.ErrTwoFactorNotEnabled)
+		return
+	}
+	if service.TwoFactorRequired(th.cfg.TwoFactorRoles, user) {
+		problem.Write(c, apperr.ErrTwoFactorMandatory)
+		return
+	}
+
+	ok, err := service.UseTOTPCode(c.Request.Context(), th.users, user, req.Code)
+	if err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	if !ok {
+		problem.Write(c, apperr.ErrOTPInvalid)
+		return
+	}
+
+	if err := th.users.SetTOTPEnabled(c.Request.Context(), user.ID, false); err != nil {
+		problem.Write(c, apperr.ErrDatabase.Wrap(err))
+		return
+	}
+	response.OK(c, MessageResponse{Message: "Two-factor authentication disabled"})
+}
+
+// storedUser loads the current user from the database; cached users lack the secret
+func (th *TwoFactorHandler) storedUser(c *gin.Context) (*models.User, error) {
+	current, exists := c.Get("user")
+	if !exists {
+		return nil, apperr.ErrUnauthorized
+	}
+	user, err := th.users.FindByID(c.Request.Context(), current.(*models.User).ID)
+	if err != nil {
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	return user, nil
+}
@@ -0,0 +1,217 @@
+// Package i18n localizes user-facing messages. Catalogs are flat key → message maps
+// per language; the built-in ones live in locales/*.json and more can be added at
+// runtime with AddLanguage or LoadDir.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey stores the negotiated language on the Gin context
+const contextKey = "i18n.language"
+
+//go:embed locales/*.json
+var builtin embed.FS
+
+var (
+	mu          sync.RWMutex
+	catalogs    = make(map[string]map[string]string)
+	defaultLang = "en"
+)
+
+func init() {
+	entries, err := builtin.ReadDir("locales")
+	if err != nil {
+		panic("i18n: " + err.Error())
+	}
+	for _, entry := range entries {
+		data, err := builtin.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic("i18n: " + err.Error())
+		}
+		if err := addJSON(entry.Name(), data); err != nil {
+			panic("i18n: " + err.Error())
+		}
+	}
+}
+
+// AddLanguage registers the catalog for a language tag (e.g. "fr" or "pt-BR").
+// Messages are merged into an existing catalog, replacing keys that are already set.
+func AddLanguage(tag string, messages map[string]string) {
+	tag = normalize(tag)
+
+	mu.Lock()
+	defer mu.Unlock()
+	catalog := catalogs[tag]
+	if catalog == nil {
+		catalog = make(map[string]string, len(messages))
+		catalogs[tag] = catalog
+	}
+	for key, msg := range messages {
+		catalog[key] = msg
+	}
+}
+
+// LoadDir adds a catalog for every <tag>.json file in dir
+func LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := addJSON(filepath.Base(path), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addJSON(name string, data []byte) error {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return fmt.Errorf("catalog %s: %w", name, err)
+	}
+	AddLanguage(strings.TrimSuffix(name, ".json"), messages)
+	return nil
+}
+
+// SetDefault sets the language used when nothing better matches; it must have a catalog
+func SetDefault(tag string) error {
+	tag = normalize(tag)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := catalogs[tag]; !ok {
+		return fmt.Errorf("i18n: no catalog for default language %q", tag)
+	}
+	defaultLang = tag
+	return nil
+}
+
+// Default returns the default language
+func Default() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultLang
+}
+
+// Languages returns the tags of all loaded catalogs
+func Languages() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	tags := make([]string, 0, len(catalogs))
+	for tag := range catalogs {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Negotiate picks the best supported language for an Accept-Language header,
+// matching exact tags first and then their base language (de-CH → de)
+func Negotiate(header string) string {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.ReplaceAll(strings.TrimSpace(params), " ", ""), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{tag: normalize(tag), q: q})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, c := range candidates {
+		if c.tag == "*" {
+			break
+		}
+		for _, tag := range []string{c.tag, base(c.tag)} {
+			if _, ok := catalogs[tag]; ok {
+				return tag
+			}
+		}
+	}
+	return defaultLang
+}
+
+// Message looks up key for lang, falling back to its base language and then to the
+// default language
+func Message(lang, key string) (string, bool) {
+	lang = normalize(lang)
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, tag := range []string{lang, base(lang), defaultLang} {
+		if msg, ok := catalogs[tag][key]; ok {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// T returns the message for key in lang with {name} placeholders replaced from vars.
+// The key itself is returned when no catalog has it.
+func T(lang, key string, vars map[string]string) string {
+	msg, ok := Message(lang, key)
+	if !ok {
+		return key
+	}
+	for name, value := range vars {
+		msg = strings.ReplaceAll(msg, "{"+name+"}", value)
+	}
+	return msg
+}
+
+// SetLanguage stores the language negotiated for the request
+func SetLanguage(c *gin.Context, lang string) {
+	c.Set(contextKey, lang)
+}
+
+// Language returns the language negotiated for the request, or the default language
+func Language(c *gin.Context) string {
+	if lang := c.GetString(contextKey); lang != "" {
+		return lang
+	}
+	return Default()
+}
+
+// normalize lower-cases a tag and uses "-" as the subtag separator
+func normalize(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
+
+// base returns the primary language subtag (pt-br → pt)
+func base(tag string) string {
+	primary, _, _ := strings.Cut(tag, "-")
+	return primary
+}
@@ -0,0 +1,53 @@
+package idempotency
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// ErrUnsealable is returned by Open for bodies not sealed with the request's secret
+var ErrUnsealable = errors.New("stored response can't be decrypted")
+
+// aead is the cipher for the responses to a request. The key is a hash of secret,
+// which the store never sees, so stored bodies such as login responses don't put
+// live tokens in the database.
+func aead(secret []byte) (cipher.AEAD, error) {
+	key := sha256.Sum256(append([]byte("idempotency:"), secret...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts a response body with a key derived from secret, prefixed with its nonce
+func Seal(secret, body []byte) ([]byte, error) {
+	gcm, err := aead(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, body, nil), nil
+}
+
+// Open decrypts a body sealed by Seal with the same secret
+func Open(secret, sealed []byte) ([]byte, error) {
+	gcm, err := aead(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrUnsealable
+	}
+	body, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrUnsealable
+	}
+	return body, nil
+}
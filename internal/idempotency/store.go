@@ -0,0 +1,106 @@
+// Package idempotency stores responses of mutating requests so that retries carrying
+// the same Idempotency-Key replay the original response instead of repeating the action.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+var (
+	// ErrInProgress is returned when the original request is still being processed
+	ErrInProgress = errors.New("request with this idempotency key is in progress")
+	// ErrFingerprintMismatch is returned when a key is reused with a different request body
+	ErrFingerprintMismatch = errors.New("idempotency key was used with a different request")
+)
+
+// Response is a stored response that can be replayed
+type Response struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Store persists idempotency records
+type Store interface {
+	// Begin reserves key for a new request. If a completed response exists for key it is
+	// returned for replay; otherwise nil is returned and the caller must Complete or Release.
+	Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Response, error)
+	// Complete stores the response for key
+	Complete(ctx context.Context, key string, resp Response) error
+	// Release drops the reservation so the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// GormStore is a Store backed by the idempotency_records table
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database-backed idempotency store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Begin reserves key or returns the stored response
+func (gs *GormStore) Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Response, error) {
+	db := gs.db.WithContext(ctx)
+	now := time.Now()
+
+	// Expired reservations no longer block the key
+	if err := db.Where("key = ? AND expires_at < ?", key, now.UnixMilli()).Delete(&models.IdempotencyRecord{}).Error; err != nil {
+		return nil, err
+	}
+
+	record := models.IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   now.Add(ttl).UnixMilli(),
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	// The key already exists
+	var existing models.IdempotencyRecord
+	if err := db.Where("key = ?", key).First(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing.Fingerprint != fingerprint {
+		return nil, ErrFingerprintMismatch
+	}
+	if !existing.Completed {
+		return nil, ErrInProgress
+	}
+
+	return &Response{
+		StatusCode:  existing.StatusCode,
+		ContentType: existing.ContentType,
+		Body:        existing.Body,
+	}, nil
+}
+
+// Complete stores the response for key
+func (gs *GormStore) Complete(ctx context.Context, key string, resp Response) error {
+	return gs.db.WithContext(ctx).Model(&models.IdempotencyRecord{}).Where("key = ?", key).Updates(map[string]interface{}{
+		"completed":    true,
+		"status_code":  resp.StatusCode,
+		"content_type": resp.ContentType,
+		"body":         resp.Body,
+	}).Error
+}
+
+// Release drops the reservation for key
+func (gs *GormStore) Release(ctx context.Context, key string) error {
+	return gs.db.WithContext(ctx).Where("key = ?", key).Delete(&models.IdempotencyRecord{}).Error
+}
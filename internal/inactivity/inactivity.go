@@ -0,0 +1,173 @@
+// Package inactivity expires unused accounts. Owners of accounts without a login or
+// token refresh for a configured number of months are warned by email; accounts still
+// unused after the grace period are suspended or deleted.
+package inactivity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/accounts"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/mail"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// batchSize is how many accounts are loaded at a time
+const batchSize = 200
+
+// SuspendReason is recorded on accounts suspended for inactivity
+const SuspendReason = "Inactive account"
+
+// Job warns about and expires inactive accounts
+type Job struct {
+	db     *gorm.DB
+	mailer mail.Sender
+	cfg    config.InactivityConfig
+}
+
+// NewJob creates an inactivity job
+func NewJob(db *gorm.DB, mailer mail.Sender, cfg config.InactivityConfig) *Job {
+	return &Job{db: db, mailer: mailer, cfg: cfg}
+}
+
+// Run sweeps immediately and then every check interval until ctx is cancelled.
+// Failures are logged and retried on the next sweep.
+func (j *Job) Run(ctx context.Context) {
+	sweep := func() {
+		if err := j.Sweep(ctx, time.Now()); err != nil {
+			logging.Error(ctx, "failed to expire inactive accounts", "error", err)
+		}
+	}
+
+	sweep()
+	ticker := time.NewTicker(j.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweep()
+		}
+	}
+}
+
+// Sweep warns the owners of accounts that just became inactive and expires those
+// whose grace period is over
+func (j *Job) Sweep(ctx context.Context, now time.Time) error {
+	warned, err := j.warn(ctx, now)
+	if err != nil {
+		return fmt.Errorf("warn inactive accounts: %w", err)
+	}
+	expired, err := j.expire(ctx, now)
+	if err != nil {
+		return fmt.Errorf("expire inactive accounts: %w", err)
+	}
+	if warned > 0 || expired > 0 {
+		logging.Info(ctx, "inactive accounts processed", "warned", warned, "expired", expired, "action", j.cfg.Action)
+	}
+	return nil
+}
+
+// warn emails the owners of accounts inactive since before the cutoff that haven't
+// been warned yet
+func (j *Job) warn(ctx context.Context, now time.Time) (int, error) {
+	cutoff := now.AddDate(0, -j.cfg.AfterMonths, 0).UnixMilli()
+	deadline := now.Add(j.cfg.GracePeriod)
+
+	warned := 0
+	err := j.each(ctx, func(db *gorm.DB) *gorm.DB {
+		return db.Where("last_active_at < ? AND inactivity_warned_at IS NULL", cutoff)
+	}, func(user *models.User) error {
+		// Claim the account first, so concurrent instances don't send the warning twice
+		claim := j.db.WithContext(ctx).Model(&models.User{ID: user.ID}).
+			Where("inactivity_warned_at IS NULL").
+			UpdateColumn("inactivity_warned_at", now.UnixMilli())
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := j.mailer.Send(ctx, user.Email, "Your account will be closed", j.warningBody(user, deadline)); err != nil {
+			// Unclaim so the next sweep tries again
+			logging.Warn(ctx, "failed to send inactivity warning", "user_id", user.ID, "error", err)
+			return j.db.WithContext(ctx).Model(&models.User{ID: user.ID}).UpdateColumn("inactivity_warned_at", nil).Error
+		}
+		warned++
+		return nil
+	})
+	return warned, err
+}
+
+// expire suspends or deletes warned accounts that stayed unused for the grace period
+func (j *Job) expire(ctx context.Context, now time.Time) (int, error) {
+	warnedBefore := now.Add(-j.cfg.GracePeriod).UnixMilli()
+
+	expired := 0
+	err := j.each(ctx, func(db *gorm.DB) *gorm.DB {
+		return db.Where("inactivity_warned_at <= ? AND last_active_at < inactivity_warned_at", warnedBefore)
+	}, func(user *models.User) error {
+		var err error
+		if j.cfg.Action == "delete" {
+			err = j.db.WithContext(ctx).Delete(user).Error
+		} else {
+			err = accounts.Suspend(j.db.WithContext(ctx), user, SuspendReason)
+		}
+		if err != nil {
+			return err
+		}
+		logging.Info(ctx, "inactive account expired", "user_id", user.ID, "action", j.cfg.Action)
+		expired++
+		return nil
+	})
+	return expired, err
+}
+
+// each calls fn for every active, non-exempt account matching filter, in batches
+func (j *Job) each(ctx context.Context, filter func(*gorm.DB) *gorm.DB, fn func(*models.User) error) error {
+	var lastID uint
+	for {
+		query := j.db.WithContext(ctx).Where("id > ? AND suspended_at IS NULL", lastID)
+		if len(j.cfg.ExemptRoles) > 0 {
+			query = query.Where(`NOT EXISTS (SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+				WHERE user_roles.user_id = users.id AND roles.name IN ?)`, j.cfg.ExemptRoles)
+		}
+
+		var users []models.User
+		if err := filter(query).Order("id").Limit(batchSize).Find(&users).Error; err != nil {
+			return err
+		}
+		for i := range users {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(&users[i]); err != nil {
+				return err
+			}
+			lastID = users[i].ID
+		}
+		if len(users) < batchSize {
+			return nil
+		}
+	}
+}
+
+// warningBody is the text of an inactivity warning email
+func (j *Job) warningBody(user *models.User, deadline time.Time) string {
+	action := "suspended"
+	if j.cfg.Action == "delete" {
+		action = "deleted"
+	}
+	return fmt.Sprintf("Hello %s,\n\n"+
+		"You haven't signed in to your account for %d months. Unless you sign in by %s, "+
+		"your account will be %s.\n\n"+
+		"If you no longer need the account, you don't have to do anything.\n",
+		user.Name, j.cfg.AfterMonths, deadline.UTC().Format("January 2, 2006"), action)
+}
@@ -0,0 +1,41 @@
+// Package logging carries the application's logger in contexts. Code running for a
+// request or a background job logs through the logger of its context, so an
+// application embedded in another program never logs through that program's default
+// logger, which may not redact personal data.
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// contextKey keys the logger in a context
+type contextKey struct{}
+
+// With returns a copy of ctx carrying logger
+func With(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// From returns the logger of ctx, or the default logger when it carries none
+func From(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Info logs at info level through the logger of ctx
+func Info(ctx context.Context, msg string, args ...any) {
+	From(ctx).InfoContext(ctx, msg, args...)
+}
+
+// Warn logs at warn level through the logger of ctx
+func Warn(ctx context.Context, msg string, args ...any) {
+	From(ctx).WarnContext(ctx, msg, args...)
+}
+
+// Error logs at error level through the logger of ctx
+func Error(ctx context.Context, msg string, args ...any) {
+	From(ctx).ErrorContext(ctx, msg, args...)
+}
@@ -0,0 +1,96 @@
+// Package loginrisk flags logins that don't fit a user's history: from a country the
+// user never logged in from, or so far from the previous login that nobody could have
+// travelled there in time.
+package loginrisk
+
+import (
+	"context"
+	"math"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/geoip"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// Reasons a login is suspicious
+const (
+	ReasonNewCountry       = "new_country"
+	ReasonImpossibleTravel = "impossible_travel"
+)
+
+// historySize is how many recent successful logins are compared with a new one
+const historySize = 50
+
+// minTravelDistance ignores jumps shorter than the typical error of city-level
+// geolocation, in km
+const minTravelDistance = 500
+
+// Assessment is the outcome of checking a login
+type Assessment struct {
+	Location geoip.Location
+	Reasons  []string
+}
+
+// Suspicious reports whether any check flagged the login
+func (a Assessment) Suspicious() bool {
+	return len(a.Reasons) > 0
+}
+
+// Detector assesses logins against the user's successful logins in login_events
+type Detector struct {
+	db       *gorm.DB
+	locator  geoip.Locator
+	maxSpeed float64 // km/h
+}
+
+// NewDetector creates a detector; maxSpeed is the fastest plausible travel in km/h
+func NewDetector(db *gorm.DB, locator geoip.Locator, maxSpeed float64) *Detector {
+	return &Detector{db: db, locator: locator, maxSpeed: maxSpeed}
+}
+
+// Assess locates ip and compares it with the user's recent successful logins
+func (d *Detector) Assess(ctx context.Context, userID uint, ip string, now time.Time) (Assessment, error) {
+	assessment := Assessment{Location: d.locator.Locate(ip)}
+	loc := assessment.Location
+	if loc.Country == "" {
+		return assessment, nil
+	}
+
+	var history []models.LoginEvent
+	err := d.db.WithContext(ctx).
+		Where("user_id = ? AND success AND country <> ''", userID).
+		Order("created_at DESC").Limit(historySize).
+		Find(&history).Error
+	if err != nil || len(history) == 0 {
+		// Nothing to compare the first located login with
+		return assessment, err
+	}
+
+	if !slices.ContainsFunc(history, func(e models.LoginEvent) bool { return e.Country == loc.Country }) {
+		assessment.Reasons = append(assessment.Reasons, ReasonNewCountry)
+	}
+
+	last := history[0]
+	if loc.HasCoordinates && (last.Latitude != 0 || last.Longitude != 0) {
+		distance := haversine(last.Latitude, last.Longitude, loc.Latitude, loc.Longitude)
+		hours := now.Sub(time.UnixMilli(last.CreatedAt)).Hours()
+		if distance > minTravelDistance && (hours <= 0 || distance/hours > d.maxSpeed) {
+			assessment.Reasons = append(assessment.Reasons, ReasonImpossibleTravel)
+		}
+	}
+	return assessment, nil
+}
+
+// haversine returns the great-circle distance between two points in km
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,45 @@
+// Package mail sends transactional email such as login confirmations.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// Sender delivers a plain-text email
+type Sender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// NewSender creates the sender selected by cfg.Provider
+func NewSender(cfg config.MailConfig) (Sender, error) {
+	switch cfg.Provider {
+	case "log":
+		return LogSender{}, nil
+	case "smtp":
+		return &SMTPSender{
+			Addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+			Host:     cfg.SMTPHost,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q", cfg.Provider)
+	}
+}
+
+// LogSender writes emails to the application log instead of sending them.
+// It is meant for local development.
+type LogSender struct{}
+
+// Send logs the email
+func (LogSender) Send(ctx context.Context, to, subject, body string) error {
+	logging.Info(ctx, "email message", "to", to, "subject", subject, "body", body)
+	return nil
+}
@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPSender sends email through an SMTP server, upgrading to TLS with STARTTLS when
+// the server offers it
+type SMTPSender struct {
+	Addr     string // host:port
+	Host     string
+	Username string // Empty disables authentication
+	Password string
+	From     string
+}
+
+// Send delivers the message. net/smtp has no context support, so ctx is only checked
+// before connecting.
+func (ss *SMTPSender) Send(ctx context.Context, to, subject, body string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if ss.Username != "" {
+		auth = smtp.PlainAuth("", ss.Username, ss.Password, ss.Host)
+	}
+	if err := smtp.SendMail(ss.Addr, auth, ss.From, []string{to}, ss.message(to, subject, body)); err != nil {
+		return fmt.Errorf("smtp delivery failed: %w", err)
+	}
+	return nil
+}
+
+// message builds a UTF-8 plain-text message
+func (ss *SMTPSender) message(to, subject, body string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + ss.From + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,58 @@
+// Package maintenance holds the runtime-toggleable maintenance mode switch.
+package maintenance
+
+import (
+	"sync"
+	"time"
+)
+
+// Mode tracks whether the service is in maintenance mode
+type Mode struct {
+	mu         sync.RWMutex
+	enabled    bool
+	retryAfter time.Duration
+	message    string
+}
+
+// State is a snapshot of the maintenance mode
+type State struct {
+	Enabled    bool   `json:"enabled"`
+	RetryAfter int    `json:"retry_after"` // Seconds clients should wait before retrying
+	Message    string `json:"message,omitempty"`
+}
+
+// NewMode creates a maintenance switch with the given initial state
+func NewMode(enabled bool, retryAfter time.Duration) *Mode {
+	return &Mode{enabled: enabled, retryAfter: retryAfter}
+}
+
+// Enabled reports whether maintenance mode is on
+func (m *Mode) Enabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled
+}
+
+// Set turns maintenance mode on or off. A zero retryAfter keeps the current value.
+func (m *Mode) Set(enabled bool, retryAfter time.Duration, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enabled = enabled
+	m.message = message
+	if retryAfter > 0 {
+		m.retryAfter = retryAfter
+	}
+}
+
+// State returns the current maintenance state
+func (m *Mode) State() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return State{
+		Enabled:    m.enabled,
+		RetryAfter: int(m.retryAfter.Seconds()),
+		Message:    m.message,
+	}
+}
@@ -0,0 +1,65 @@
+// Package mergepatch implements JSON Merge Patch (RFC 7386): members of the patch
+// replace those of the target, null removes a member, and nested objects merge
+// recursively.
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ContentType is the media type of merge-patch documents
+const ContentType = "application/merge-patch+json"
+
+// ErrNotObject is returned when a patch for a resource is not a JSON object
+var ErrNotObject = errors.New("merge patch must be a JSON object")
+
+// Apply returns target with patch applied. Both must be JSON documents.
+func Apply(target, patch []byte) ([]byte, error) {
+	var t, p any
+	if err := json.Unmarshal(target, &t); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(t, p))
+}
+
+// Keys returns the top-level member names of an object patch
+func Keys(patch []byte) ([]string, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil || members == nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, err
+		}
+		return nil, ErrNotObject
+	}
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// merge is the MergePatch function from RFC 7386 section 2
+func merge(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = make(map[string]any)
+	}
+	for name, value := range patchObj {
+		if value == nil {
+			delete(targetObj, name)
+			continue
+		}
+		targetObj[name] = merge(targetObj[name], value)
+	}
+	return targetObj
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apikeys"
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+)
+
+// APIKeyMiddleware recognises API keys sent in X-API-Key, counts the request against
+// the key's usage and rejects it once the monthly quota is used up. The key is stored
+// in the context as "api_key"; unknown keys are ignored.
+func APIKeyMiddleware(registry *apikeys.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey, ok := registry.Lookup(c.GetHeader(APIKeyHeader))
+		if !ok {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		if !registry.Use(apiKey, now) {
+			// Quotas start over with the calendar month (UTC)
+			year, month, _ := now.UTC().Date()
+			nextMonth := time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+			c.Header("Retry-After", strconv.Itoa(int(nextMonth.Sub(now).Seconds())+1))
+			problem.Abort(c, apperr.ErrAPIKeyQuotaExceeded)
+			return
+		}
+
+		c.Set("api_key", apiKey)
+		c.Next()
+	}
+}
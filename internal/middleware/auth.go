@@ -1,80 +1,206 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
+	"github.com/golang-jwt/jwt/v5"
 
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
 	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/consent"
 	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+	"github.com/ristep/um_starter_jwt_go/internal/usercache"
 )
 
-// AuthMiddleware validates JWT tokens and attaches user claims to the request context
-func AuthMiddleware(jwtService *auth.JWTService, db *gorm.DB) gin.HandlerFunc {
+// userLoaderKey holds, in claims-only mode, the function that loads the stored user
+const userLoaderKey = "user_loader"
+
+// AuthMiddleware validates JWT tokens and attaches user claims to the request context.
+// Users are looked up in cache first when it is not nil. With claimsOnly the user is
+// built from the token's claims without touching the database; routes that need the
+// stored user must add LoadUser. Tokens on the revoked list, when it is not nil, are
+// rejected.
+func AuthMiddleware(tokens auth.TokenService, users repository.UserRepository, cache usercache.Cache, claimsOnly bool, revoked sessions.RevocationList) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Extract the token from the Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing authorization header"})
-			c.Abort()
+		claims, err := Authenticate(c.Request.Context(), c.GetHeader("Authorization"), tokens, revoked)
+		if err == nil {
+			err = RejectExchanged(claims)
+		}
+		if err != nil {
+			problem.Abort(c, err)
 			return
 		}
 
-		// Check for Bearer scheme
-		const bearerScheme = "Bearer "
-		if !strings.HasPrefix(authHeader, bearerScheme) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+		if claimsOnly {
+			c.Set("user", claims.User())
+			c.Set("claims", claims)
+			c.Set(userLoaderKey, func() (*models.User, error) {
+				return loadUser(c, users, cache, claims.UserID)
+			})
+			c.Next()
 			return
 		}
 
-		tokenString := authHeader[len(bearerScheme):]
-
-		// Validate the token
-		claims, err := jwtService.ValidateToken(tokenString)
+		// Fetch the user from the cache or the database
+		user, err := loadUser(c, users, cache, claims.UserID)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			if errors.Is(err, repository.ErrNotFound) {
+				problem.Write(c, apperr.ErrTokenUserNotFound)
+			} else {
+				problem.Write(c, apperr.ErrDatabase.Wrap(err))
+			}
 			c.Abort()
 			return
 		}
 
-		// Fetch the user from the database
-		var user models.User
-		if err := db.Preload("Roles").First(&user, claims.UserID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-			}
-			c.Abort()
+		if err := CheckUser(claims, user); err != nil {
+			problem.Abort(c, err)
 			return
 		}
 
 		// Attach user and claims to context
-		c.Set("user", &user)
+		c.Set("user", user)
 		c.Set("claims", claims)
 
 		c.Next()
 	}
 }
 
+// Authenticate validates the bearer token of an Authorization header and returns its
+// claims. Tokens on the revoked list, when it is not nil, are rejected. Errors are
+// apperr errors; the Gin and net/http middleware share it.
+func Authenticate(ctx context.Context, header string, tokens auth.TokenService, revoked sessions.RevocationList) (*auth.CustomClaims, error) {
+	if header == "" {
+		return nil, apperr.ErrMissingToken
+	}
+
+	// Check for Bearer scheme
+	const bearerScheme = "Bearer "
+	if !strings.HasPrefix(header, bearerScheme) {
+		return nil, apperr.ErrMalformedToken
+	}
+
+	// Validate the token
+	claims, err := tokens.ValidateToken(header[len(bearerScheme):])
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, apperr.ErrTokenExpired
+		}
+		return nil, apperr.ErrTokenInvalid
+	}
+	if revoked != nil && claims.ID != "" && revoked.Revoked(ctx, claims.ID) {
+		return nil, apperr.ErrTokenRevoked
+	}
+	// Also covers tokens checked without loading the user, whose token version isn't
+	// compared
+	if users, ok := revoked.(sessions.UserRevocations); ok && claims.IssuedAt != nil &&
+		users.UserRevoked(ctx, claims.UserID, claims.IssuedAt.Time) {
+		return nil, apperr.ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// RejectExchanged rejects tokens from the token exchange, which are meant for the
+// downstream APIs they were issued for and not for this one
+func RejectExchanged(claims *auth.CustomClaims) error {
+	if claims.Actor != nil {
+		return apperr.ErrTokenInvalid
+	}
+	return nil
+}
+
+// CheckUser rejects tokens of suspended users and tokens issued before the user's
+// tokens were revoked
+func CheckUser(claims *auth.CustomClaims, user *models.User) error {
+	if claims.TokenVersion != user.TokenVersion {
+		return apperr.ErrTokenRevoked
+	}
+	if user.Suspended() {
+		return apperr.ErrAccountSuspended
+	}
+	return nil
+}
+
+// loadUser returns the user with roles, caching it on a miss
+func loadUser(c *gin.Context, users repository.UserRepository, cache usercache.Cache, id uint) (*models.User, error) {
+	ctx := c.Request.Context()
+	if cache != nil {
+		if user, ok := cache.Get(ctx, id); ok {
+			return user, nil
+		}
+	}
+
+	user, err := users.FindByIDFromReplica(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cache != nil {
+		cache.Set(ctx, user)
+	}
+	return user, nil
+}
+
+// FullUser returns the stored user of the request. In claims-only mode the user is
+// loaded on first use, its token version checked, and the context user replaced.
+func FullUser(c *gin.Context) (*models.User, error) {
+	if loader, ok := c.Value(userLoaderKey).(func() (*models.User, error)); ok && loader != nil {
+		user, err := loader()
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, apperr.ErrTokenUserNotFound
+			}
+			return nil, apperr.ErrDatabase.Wrap(err)
+		}
+		if err := CheckUser(c.MustGet("claims").(*auth.CustomClaims), user); err != nil {
+			return nil, err
+		}
+		c.Set("user", user)
+		c.Set(userLoaderKey, nil)
+		return user, nil
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		return nil, apperr.ErrUnauthorized
+	}
+	return user.(*models.User), nil
+}
+
+// LoadUser makes sure handlers see the stored user rather than one built from token
+// claims. It only does work in claims-only mode. Use it after AuthMiddleware.
+func LoadUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := FullUser(c); err != nil {
+			problem.Abort(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
 // RoleMiddleware checks if the authenticated user has at least one of the required roles
 func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user from context (should be set by AuthMiddleware)
 		user, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
+			problem.Abort(c, apperr.ErrUnauthorized)
 			return
 		}
 
 		userObj, ok := user.(*models.User)
 		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data"})
-			c.Abort()
+			problem.Abort(c, apperr.ErrInternal.WithDetail("Invalid user data"))
 			return
 		}
 
@@ -93,8 +219,26 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 		}
 
 		if !hasRole {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
-			c.Abort()
+			problem.Abort(c, apperr.ErrInsufficientPermissions)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireVerifiedPhone rejects users whose phone number has not been verified.
+// Use it after AuthMiddleware.
+func RequireVerifiedPhone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := FullUser(c)
+		if err != nil {
+			problem.Abort(c, err)
+			return
+		}
+
+		if !user.PhoneVerified {
+			problem.Abort(c, apperr.ErrPhoneNotVerified)
 			return
 		}
 
@@ -102,16 +246,129 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	}
 }
 
-// CORSMiddleware handles CORS headers
-func CORSMiddleware() gin.HandlerFunc {
+// RequireVerifiedEmail rejects users whose email address has not been verified, so
+// clients can send them to a verification prompt. Given routes ("METHOD /route/pattern"),
+// only those are checked; otherwise every route is. Use it after AuthMiddleware.
+func RequireVerifiedEmail(routes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		if len(routes) > 0 && !slices.Contains(routes, c.Request.Method+" "+c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		user, err := FullUser(c)
+		if err != nil {
+			problem.Abort(c, err)
+			return
+		}
+
+		if !user.EmailVerified {
+			problem.Abort(c, apperr.ErrEmailNotVerified)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireRecentAuth rejects tokens whose user last entered their password more than
+// maxAge ago, so a stolen or long-lived session alone can't perform sensitive actions.
+// Clients confirm the password with POST /api/auth/reauthenticate and retry. Use it
+// after AuthMiddleware.
+func RequireRecentAuth(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Value("claims").(*auth.CustomClaims)
+		if !ok {
+			problem.Abort(c, apperr.ErrUnauthorized)
+			return
+		}
+
+		if !claims.AuthenticatedWithin(maxAge) {
+			// Step-up challenge as in RFC 9470
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", max_age=%d`, int(maxAge.Seconds())))
+			problem.Abort(c, apperr.ErrReauthenticationRequired)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// TwoFactorSetupMiddleware confines tokens scoped to two-factor setup, which users
+// whose role requires it get until they enroll, to the given routes ("METHOD
+// /route/pattern"). Other tokens pass. Use it after AuthMiddleware.
+func TwoFactorSetupMiddleware(routes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Value("claims").(*auth.CustomClaims)
+		if !ok {
+			problem.Abort(c, apperr.ErrUnauthorized)
+			return
+		}
+
+		if claims.Scope != "" && (claims.Scope != auth.ScopeTwoFactorSetup || !slices.Contains(routes, c.Request.Method+" "+c.FullPath())) {
+			problem.Abort(c, apperr.ErrTwoFactorEnrollmentRequired)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// PasswordExpiryMiddleware rejects users whose password is older than maxAge until
+// they change it; exempt routes ("METHOD /route/pattern") always pass. Within warning
+// of expiry, responses carry a Password-Expires header. A zero maxAge disables the
+// policy. Use it after AuthMiddleware.
+func PasswordExpiryMiddleware(maxAge, warning time.Duration, exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxAge == 0 {
+			c.Next()
+			return
+		}
+
+		user, err := FullUser(c)
+		if err != nil {
+			problem.Abort(c, err)
+			return
+		}
+
+		expiresAt := user.PasswordExpiresAt(maxAge)
+		if time.Until(expiresAt) <= warning {
+			c.Header("Password-Expires", expiresAt.UTC().Format(http.TimeFormat))
+		}
+		if !time.Now().Before(expiresAt) && !slices.Contains(exempt, c.Request.Method+" "+c.FullPath()) {
+			problem.Abort(c, apperr.ErrPasswordExpired.WithDetail("Change your password at /api/profile/password"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ConsentMiddleware rejects users who have not accepted the current version of the
+// terms of service or privacy policy. Exempt routes, given as "METHOD /route/pattern"
+// (e.g. the consent endpoints themselves), always pass. Use it after AuthMiddleware.
+func ConsentMiddleware(policy *consent.Policy, exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(exempt, c.Request.Method+" "+c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		// Without required documents there is nothing to check, so claims-only
+		// requests need not load the stored user
+		if len(policy.Required()) == 0 {
+			c.Next()
+			return
+		}
+
+		user, err := FullUser(c)
+		if err != nil {
+			problem.Abort(c, err)
+			return
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
+		if pending := policy.Pending(user); len(pending) > 0 {
+			problem.Abort(c, apperr.ErrConsentRequired.WithDetail("Accept the current "+strings.Join(pending, " and ")+" at /api/profile/consents"))
 			return
 		}
 
@@ -0,0 +1,93 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/testutil"
+	"github.com/ristep/um_starter_jwt_go/pkg/usermgmt/httpauth"
+)
+
+func TestAuthMiddlewareRejectsRefreshTokens(t *testing.T) {
+	tokens := testutil.Tokens()
+	router := testutil.Router()
+	router.GET("/api/profile", middleware.AuthMiddleware(tokens, nil, nil, true, nil), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	pair, err := tokens.GenerateTokenPair(testutil.NewUser(t), auth.Authenticated(auth.MethodPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"access token", pair.AccessToken, http.StatusNoContent},
+		{"refresh token", pair.RefreshToken, http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := testutil.NewRequest(t, http.MethodGet, "/api/profile", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rec := testutil.Do(router, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+			if tc.want == http.StatusUnauthorized {
+				if p := testutil.DecodeProblem(t, rec); p.Code != "token_invalid" {
+					t.Errorf("code = %q, want token_invalid", p.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestExchangedTokensOnlyWorkDownstream(t *testing.T) {
+	tokens := testutil.Tokens()
+	pair, err := tokens.GenerateTokenPair(testutil.NewUser(t), auth.Authenticated(auth.MethodPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := tokens.ValidateToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchanged, err := tokens.IssueToken(claims.Exchange("billing-api", claims.Roles, 5*time.Minute, "billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	router := testutil.Router()
+	router.GET("/api/profile", middleware.AuthMiddleware(tokens, nil, nil, true, nil), gin.WrapF(ok))
+	downstream := httpauth.Authenticate(tokens, httpauth.Options{})(http.HandlerFunc(ok))
+	request := func(t *testing.T) *http.Request {
+		req := testutil.NewRequest(t, http.MethodGet, "/api/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+exchanged)
+		return req
+	}
+
+	t.Run("this API", func(t *testing.T) {
+		rec := testutil.Do(router, request(t))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401: %s", rec.Code, rec.Body)
+		}
+		if p := testutil.DecodeProblem(t, rec); p.Code != "token_invalid" {
+			t.Errorf("code = %q, want token_invalid", p.Code)
+		}
+	})
+
+	t.Run("downstream API", func(t *testing.T) {
+		rec := testutil.Do(downstream, request(t))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body)
+		}
+	})
+}
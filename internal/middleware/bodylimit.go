@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+)
+
+// BodyLimitMiddleware caps the size of request bodies so oversized payloads are rejected
+// before they reach the JSON binding layer. Routes listed in cfg.UploadRoutes, which
+// are relative to base, the path the API routes are mounted on, get the larger upload
+// limit.
+func BodyLimitMiddleware(cfg config.BodyLimitConfig, base string) gin.HandlerFunc {
+	base = strings.TrimSuffix(base, "/")
+	uploadRoutes := make(map[string]struct{}, len(cfg.UploadRoutes))
+	for _, route := range cfg.UploadRoutes {
+		uploadRoutes[base+route] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		limit := cfg.MaxBytes
+		if _, ok := uploadRoutes[c.FullPath()]; ok {
+			limit = cfg.MaxUploadBytes
+		}
+
+		if c.Request.ContentLength > limit {
+			problem.Abort(c, apperr.ErrRequestTooLarge)
+			return
+		}
+
+		// Guards bodies without (or with a lying) Content-Length
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/bruteforce"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+)
+
+// BruteForceMiddleware makes clients whose IP keeps failing to authenticate wait
+// before trying again. Every 401 answer of the wrapped route counts as a failure,
+// whichever account it was for; a nil tracker disables the check.
+func BruteForceMiddleware(tracker *bruteforce.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tracker == nil {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		if wait := tracker.Wait(ctx, c.ClientIP()); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			problem.Abort(c, apperr.ErrTooManyFailedAttempts)
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() == http.StatusUnauthorized {
+			tracker.Fail(ctx, c.ClientIP())
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+)
+
+// skipCompressionKey marks a request whose response must not be compressed
+const skipCompressionKey = "compression.skip"
+
+// DisableCompression opts the current response out of compression, e.g. for
+// payloads that are already compressed. Call it before writing the body.
+func DisableCompression(c *gin.Context) {
+	c.Set(skipCompressionKey, true)
+}
+
+// CompressionMiddleware gzip- or deflate-encodes responses whose content type is
+// listed in cfg.ContentTypes and whose body reaches cfg.MinSize bytes
+func CompressionMiddleware(cfg config.CompressionConfig) gin.HandlerFunc {
+	excluded := make(map[string]struct{}, len(cfg.ExcludeRoutes))
+	for _, route := range cfg.ExcludeRoutes {
+		excluded[route] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+		if _, skip := excluded[c.FullPath()]; skip {
+			c.Next()
+			return
+		}
+		// Protocol upgrades (WebSocket) and range requests bypass compression
+		if c.GetHeader("Upgrade") != "" || c.GetHeader("Range") != "" {
+			c.Next()
+			return
+		}
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: c.Writer,
+			ctx:            c,
+			cfg:            cfg,
+			encoding:       encoding,
+			status:         http.StatusOK,
+		}
+		c.Writer = cw
+		defer func() {
+			cw.finish()
+			c.Writer = cw.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(strings.TrimSpace(params), " ", "") == "q=0" {
+			continue
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+// compressWriter buffers the start of a response until it knows whether the body is
+// large enough to be worth compressing, then either streams through an encoder or
+// writes the body unchanged
+type compressWriter struct {
+	gin.ResponseWriter
+	ctx      *gin.Context
+	cfg      config.CompressionConfig
+	encoding string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	encoder     io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+	w.wroteHeader = true
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *compressWriter) Status() int {
+	if w.decided {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *compressWriter) Written() bool {
+	return w.decided || w.wroteHeader || len(w.buf) > 0
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.cfg.MinSize {
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(len(w.buf) >= w.cfg.MinSize)
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide commits the response headers and the buffered body, compressed or not
+func (w *compressWriter) decide(largeEnough bool) error {
+	w.decided = true
+
+	header := w.ResponseWriter.Header()
+	if largeEnough && w.compressible(header) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+
+		if w.encoding == "gzip" {
+			w.encoder, _ = gzip.NewWriterLevel(w.ResponseWriter, w.cfg.Level)
+		} else {
+			w.encoder, _ = flate.NewWriter(w.ResponseWriter, w.cfg.Level)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// compressible reports whether the response may be encoded
+func (w *compressWriter) compressible(header http.Header) bool {
+	if w.ctx.GetBool(skipCompressionKey) || header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, allowed := range w.cfg.ContentTypes {
+		if mediaType == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// finish flushes a response that never reached the size threshold and closes the encoder
+func (w *compressWriter) finish() {
+	if !w.decided {
+		if !w.Written() {
+			return
+		}
+		w.decide(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
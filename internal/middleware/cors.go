@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+)
+
+// CORS applies CORS headers according to a policy that can be replaced at runtime
+type CORS struct {
+	allowAny atomic.Bool
+	origins  atomic.Pointer[map[string]struct{}]
+}
+
+// NewCORS creates a CORS policy from the CORS configuration
+func NewCORS(cfg config.CORSConfig) *CORS {
+	cors := &CORS{}
+	cors.Update(cfg)
+	return cors
+}
+
+// Update replaces the allowed origins; in-flight requests keep the previous policy
+func (cm *CORS) Update(cfg config.CORSConfig) {
+	origins := make(map[string]struct{}, len(cfg.AllowedOrigins))
+	allowAny := false
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+		origins[origin] = struct{}{}
+	}
+	cm.origins.Store(&origins)
+	cm.allowAny.Store(allowAny)
+}
+
+// CORSMiddleware handles CORS headers
+func (cm *CORS) CORSMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+
+		if cm.allowAny.Load() {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		} else if _, ok := (*cm.origins.Load())[origin]; ok {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+
+		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID, X-API-Key, Last-Event-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-App-Version, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/idempotency"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+)
+
+// IdempotencyKeyHeader is the request header carrying the client-chosen idempotency key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyMiddleware replays the stored response when a POST, PUT, PATCH or DELETE
+// request is retried with the same Idempotency-Key. Keys are scoped to the caller
+// (Authorization header, or client IP for anonymous requests) and the route. Stored
+// bodies are encrypted with a key derived from the request, including its body, since
+// login and refresh responses carry tokens.
+func IdempotencyMiddleware(store idempotency.Store, cfg config.IdempotencyConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientKey := c.GetHeader(IdempotencyKeyHeader)
+		if !cfg.Enabled || clientKey == "" || !isMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(clientKey) > 255 {
+			problem.Abort(c, apperr.ErrIdempotencyKeyTooLong)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			problem.Abort(c, apperr.ErrRequestTooLarge)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		caller := c.GetHeader("Authorization")
+		if caller == "" {
+			caller = c.ClientIP()
+		}
+		key := hashHex(caller, c.Request.Method, c.Request.URL.Path, clientKey)
+		fingerprint := hashHex(string(body))
+		secret := []byte(hashHex(caller, c.Request.Method, c.Request.URL.Path, clientKey, string(body)))
+
+		ctx := c.Request.Context()
+		stored, err := store.Begin(ctx, key, fingerprint, cfg.TTL)
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			problem.Abort(c, apperr.ErrIdempotencyInProgress)
+			return
+		case errors.Is(err, idempotency.ErrFingerprintMismatch):
+			problem.Abort(c, apperr.ErrIdempotencyKeyReused)
+			return
+		case err != nil:
+			problem.Abort(c, apperr.ErrDatabase.Wrap(err))
+			return
+		}
+
+		if stored != nil {
+			body, err := idempotency.Open(secret, stored.Body)
+			if err != nil {
+				problem.Abort(c, apperr.ErrInternal.Wrap(err))
+				return
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(stored.StatusCode, stored.ContentType, body)
+			c.Abort()
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := c.Writer.Status()
+		if !replayable(status) {
+			if err := store.Release(ctx, key); err != nil {
+				logging.Error(ctx, "failed to release idempotency key", "error", err)
+			}
+			return
+		}
+
+		sealed, err := idempotency.Seal(secret, recorder.body.Bytes())
+		if err != nil {
+			logging.Error(ctx, "failed to encrypt idempotent response", "error", err)
+			if err := store.Release(ctx, key); err != nil {
+				logging.Error(ctx, "failed to release idempotency key", "error", err)
+			}
+			return
+		}
+		if err := store.Complete(ctx, key, idempotency.Response{
+			StatusCode:  status,
+			ContentType: c.Writer.Header().Get("Content-Type"),
+			Body:        sealed,
+		}); err != nil {
+			logging.Error(ctx, "failed to store idempotent response", "error", err)
+		}
+	}
+}
+
+// replayable reports whether a response with status may be stored and replayed.
+// Only successes and client errors that a retry would get again are; server errors,
+// conflicts, rate limits and timeouts release the key so the client can retry.
+func replayable(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusLocked, http.StatusTooEarly, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= 200 && status < 300 || status >= 400 && status < 500
+}
+
+// isMutatingMethod reports whether method changes server state
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// hashHex returns the hex SHA-256 of the NUL-joined parts
+func hashHex(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// bodyRecorder copies the response body while it is written to the client
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,112 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/idempotency"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/testutil"
+)
+
+// memoryIdempotencyStore keeps idempotency records in a map
+type memoryIdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]*idempotency.Response
+}
+
+func (ms *memoryIdempotencyStore) Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*idempotency.Response, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if resp, ok := ms.responses[key]; ok {
+		if resp == nil {
+			return nil, idempotency.ErrInProgress
+		}
+		return resp, nil
+	}
+	ms.responses[key] = nil
+	return nil, nil
+}
+
+func (ms *memoryIdempotencyStore) Complete(ctx context.Context, key string, resp idempotency.Response) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.responses[key] = &resp
+	return nil
+}
+
+func (ms *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.responses, key)
+	return nil
+}
+
+func TestIdempotencyMiddlewareSealsStoredResponses(t *testing.T) {
+	const token = "secret-refresh-token"
+	store := &memoryIdempotencyStore{responses: make(map[string]*idempotency.Response)}
+	calls := 0
+	router := testutil.Router()
+	router.Use(middleware.IdempotencyMiddleware(store, config.IdempotencyConfig{Enabled: true, TTL: time.Hour}))
+	router.POST("/api/auth/login", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"refresh_token": token})
+	})
+
+	send := func() *bytes.Buffer {
+		req := testutil.NewRequest(t, http.MethodPost, "/api/auth/login", map[string]string{"email": "user@example.com", "password": testutil.Password})
+		req.Header.Set(middleware.IdempotencyKeyHeader, "retry-1")
+		rec := testutil.Do(router, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		return rec.Body
+	}
+	first := send()
+	replayed := send()
+
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+	if !bytes.Equal(first.Bytes(), replayed.Bytes()) {
+		t.Errorf("replayed body = %s, want %s", replayed, first)
+	}
+	for _, resp := range store.responses {
+		if bytes.Contains(resp.Body, []byte(token)) {
+			t.Errorf("stored body contains the token in plaintext: %s", resp.Body)
+		}
+	}
+}
+
+func TestIdempotencyMiddlewareRetriesTransientFailures(t *testing.T) {
+	store := &memoryIdempotencyStore{responses: make(map[string]*idempotency.Response)}
+	statuses := []int{http.StatusTooManyRequests, http.StatusConflict, http.StatusCreated}
+	calls := 0
+	router := testutil.Router()
+	router.Use(middleware.IdempotencyMiddleware(store, config.IdempotencyConfig{Enabled: true, TTL: time.Hour}))
+	router.POST("/api/notes", func(c *gin.Context) {
+		c.JSON(statuses[calls], gin.H{"call": calls})
+		calls++
+	})
+
+	send := func() int {
+		req := testutil.NewRequest(t, http.MethodPost, "/api/notes", map[string]string{"body": "note"})
+		req.Header.Set(middleware.IdempotencyKeyHeader, "retry-1")
+		return testutil.Do(router, req).Code
+	}
+	for _, want := range []int{http.StatusTooManyRequests, http.StatusConflict, http.StatusCreated, http.StatusCreated} {
+		if got := send(); got != want {
+			t.Errorf("status = %d, want %d", got, want)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("handler ran %d times, want 3", calls)
+	}
+}
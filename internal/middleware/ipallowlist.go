@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/netip"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+)
+
+// IPAllowlistMiddleware rejects requests whose client IP is outside the given ranges.
+// The client IP is only taken from X-Forwarded-For or X-Real-IP when the request came
+// through one of the router's trusted proxies. An empty list allows every client.
+func IPAllowlistMiddleware(allowed []netip.Prefix) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(allowed) == 0 {
+			c.Next()
+			return
+		}
+
+		ip, err := netip.ParseAddr(c.ClientIP())
+		if err == nil {
+			ip = ip.Unmap()
+			for _, prefix := range allowed {
+				if prefix.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		logging.Warn(c.Request.Context(), "request from outside the allowlist", "ip", c.ClientIP(), "path", c.FullPath())
+		problem.Abort(c, apperr.ErrIPNotAllowed)
+	}
+}
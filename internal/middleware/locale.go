@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/i18n"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// LocaleMiddleware negotiates the response language from Accept-Language and
+// announces it in Content-Language
+func LocaleMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang := i18n.Negotiate(c.GetHeader("Accept-Language"))
+		i18n.SetLanguage(c, lang)
+		c.Header("Content-Language", lang)
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		c.Next()
+	}
+}
+
+// UserLocaleMiddleware switches to the authenticated user's saved locale, which takes
+// precedence over Accept-Language. Use it after AuthMiddleware.
+func UserLocaleMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, ok := c.Get("user"); ok {
+			if locale := user.(*models.User).Locale; locale != "" {
+				lang := i18n.Negotiate(locale)
+				i18n.SetLanguage(c, lang)
+				c.Header("Content-Language", lang)
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/requestid"
+)
+
+// LoggerMiddleware puts logger in the request context, so everything running for the
+// request logs through it (see the logging package)
+func LoggerMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), logger))
+		c.Next()
+	}
+}
+
+// AccessLogMiddleware emits a structured access log record for every request.
+// Successful requests are sampled at cfg.SampleRate; server errors are always logged.
+func AccessLogMiddleware(logger *slog.Logger, cfg config.AccessLogConfig) gin.HandlerFunc {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	excluded := make(map[string]struct{}, len(cfg.ExcludePaths))
+	for _, path := range cfg.ExcludePaths {
+		excluded[path] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if _, skip := excluded[path]; skip {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+		latency := time.Since(start)
+
+		status := c.Writer.Status()
+		if status < 500 && cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate {
+			return
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Duration("latency", latency),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("ip", c.ClientIP()),
+			slog.String("request_id", requestid.Get(c)),
+		}
+
+		// The user is only present when AuthMiddleware ran for this route
+		if user, exists := c.Get("user"); exists {
+			if userObj, ok := user.(*models.User); ok {
+				attrs = append(attrs, slog.Uint64("user_id", uint64(userObj.ID)))
+			}
+		}
+
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
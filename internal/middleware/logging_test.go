@@ -0,0 +1,31 @@
+package middleware_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/testutil"
+)
+
+func TestLoggerMiddlewareRoutesRequestLogs(t *testing.T) {
+	var logs bytes.Buffer
+	router := testutil.Router()
+	router.Use(middleware.LoggerMiddleware(slog.New(slog.NewTextHandler(&logs, nil))))
+	router.GET("/fail", func(c *gin.Context) {
+		problem.Write(c, apperr.ErrDatabase.Wrap(errors.New("connection refused")))
+	})
+
+	testutil.Do(router, testutil.NewRequest(t, http.MethodGet, "/fail", nil))
+	if !strings.Contains(logs.String(), "request failed") || !strings.Contains(logs.String(), "connection refused") {
+		t.Errorf("the failure was not logged through the request's logger: %q", logs.String())
+	}
+}
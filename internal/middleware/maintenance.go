@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/maintenance"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+)
+
+// maintenanceBypassRoutes stay reachable for everyone so admins can still sign in;
+// they are relative to the base path the API routes are mounted on
+var maintenanceBypassRoutes = []string{"/auth/login", "/auth/refresh"}
+
+// maintenanceProbePaths stay reachable for everyone so probes keep working
+var maintenanceProbePaths = []string{"/healthz", "/readyz"}
+
+// maintenanceBypassPrefix is the admin web UI, whose static pages admins sign in from
+const maintenanceBypassPrefix = "/admin/"
+
+// MaintenanceMiddleware answers 503 with Retry-After to non-admin requests while
+// maintenance mode is on. Admins are recognised by the roles in their access token.
+// base is the path the API routes are mounted on, e.g. /api.
+func MaintenanceMiddleware(mode *maintenance.Mode, tokens auth.TokenService, base string) gin.HandlerFunc {
+	base = strings.TrimSuffix(base, "/")
+	bypassPaths := make(map[string]struct{}, len(maintenanceProbePaths)+len(maintenanceBypassRoutes))
+	for _, path := range maintenanceProbePaths {
+		bypassPaths[path] = struct{}{}
+	}
+	for _, route := range maintenanceBypassRoutes {
+		bypassPaths[base+route] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		if !mode.Enabled() {
+			c.Next()
+			return
+		}
+		path := c.Request.URL.Path
+		if _, ok := bypassPaths[path]; ok || strings.HasPrefix(path+"/", maintenanceBypassPrefix) {
+			c.Next()
+			return
+		}
+
+		const bearerScheme = "Bearer "
+		if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, bearerScheme) {
+			if claims, err := tokens.ValidateToken(authHeader[len(bearerScheme):]); err == nil {
+				for _, role := range claims.Roles {
+					if role == "admin" {
+						c.Next()
+						return
+					}
+				}
+			}
+		}
+
+		state := mode.State()
+		c.Header("Retry-After", strconv.Itoa(state.RetryAfter))
+		problem.Abort(c, apperr.ErrMaintenance.WithDetail(state.Message))
+	}
+}
@@ -0,0 +1,38 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/maintenance"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/testutil"
+)
+
+func TestMaintenanceBypassFollowsMountPath(t *testing.T) {
+	router := testutil.Router()
+	group := router.Group("/accounts")
+	group.Use(middleware.MaintenanceMiddleware(maintenance.NewMode(true, 0), testutil.Tokens(), group.BasePath()))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	group.POST("/auth/login", ok)
+	group.POST("/auth/refresh", ok)
+	group.GET("/profile", ok)
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPost, "/accounts/auth/login", http.StatusNoContent},
+		{http.MethodPost, "/accounts/auth/refresh", http.StatusNoContent},
+		{http.MethodGet, "/accounts/profile", http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			rec := testutil.Do(router, testutil.NewRequest(t, tc.method, tc.path, nil))
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/ratelimit"
+)
+
+// APIKeyHeader carries the API key that puts a caller in its rate limit tier
+const APIKeyHeader = "X-API-Key"
+
+// RateLimitMiddleware limits how many requests each caller makes per window. Callers
+// are told apart by an API key (managed, as set by APIKeyMiddleware, or configured),
+// then by user once AuthMiddleware has run, and otherwise by IP. Limited responses carry X-RateLimit-Limit, X-RateLimit-Remaining
+// and X-RateLimit-Reset (seconds); a nil or disabled limiter skips the check.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil || !limiter.Enabled() {
+			c.Next()
+			return
+		}
+
+		var caller ratelimit.Caller
+		if apiKey, managed := c.Value("api_key").(*models.APIKey); managed {
+			caller = limiter.ManagedKey(apiKey.ID, apiKey.Tier)
+		} else if key, ok := limiter.APIKey(c.GetHeader(APIKeyHeader)); ok {
+			caller = key
+		} else if claims, signedIn := c.Value("claims").(*auth.CustomClaims); signedIn {
+			caller = limiter.User(claims.UserID, claims.Roles)
+		} else {
+			caller = limiter.IP(c.ClientIP())
+		}
+
+		result, allowed := limiter.Allow(c.Request.Context(), caller)
+		if result.Limit > 0 {
+			reset := strconv.Itoa(int(result.Reset.Seconds() + 0.999))
+			c.Header("X-RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+			c.Header("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+			c.Header("X-RateLimit-Reset", reset)
+			if !allowed {
+				c.Header("Retry-After", reset)
+				problem.Abort(c, apperr.ErrRateLimited)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/requestid"
+)
+
+// RequestIDMiddleware reuses a valid incoming X-Request-ID or generates a new one,
+// and echoes it in the response
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		requestid.Set(c, id)
+		c.Header(requestid.Header, id)
+		c.Next()
+	}
+}
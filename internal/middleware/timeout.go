@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+)
+
+// requestContextKey holds the request context from before the timeout was applied
+const requestContextKey = "timeout.context"
+
+// DisableRequestTimeout lifts the request timeout for the rest of the request, e.g.
+// for streams that stay open. Call it before doing any work with the context.
+func DisableRequestTimeout(c *gin.Context) {
+	if ctx, ok := c.Get(requestContextKey); ok {
+		c.Request = c.Request.WithContext(ctx.(context.Context))
+	}
+}
+
+// RequestTimeoutMiddleware gives every request context a deadline timeout from now,
+// so database queries and outgoing calls still running then are cancelled instead of
+// piling up. Requests whose handler hit the deadline without responding get 503
+// request_timeout. A timeout of 0 disables it.
+func RequestTimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		parent := c.Request.Context()
+		ctx, cancel := context.WithTimeout(parent, timeout)
+		defer cancel()
+		c.Set(requestContextKey, parent)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if !c.Writer.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			problem.Write(c, apperr.ErrRequestTimeout)
+		}
+	}
+}
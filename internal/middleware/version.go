@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/buildinfo"
+)
+
+// VersionMiddleware names the running version in every response, so support can tell
+// which build answered a request
+func VersionMiddleware() gin.HandlerFunc {
+	version := buildinfo.Get().Version
+	return func(c *gin.Context) {
+		c.Header(buildinfo.Header, version)
+		c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package models
+
+// Activity types
+const (
+	ActivityLogin          = "login"
+	ActivityLoginFailed    = "login_failed"
+	ActivitySessionCreated = "session_created"
+	ActivityProfileUpdated = "profile_updated"
+	ActivityEmailChanged   = "email_changed"
+	ActivityEmailReverted  = "email_change_reverted"
+	ActivityRoleAssigned   = "role_assigned"
+	ActivityRoleRemoved    = "role_removed"
+	ActivityTokensRevoked  = "tokens_revoked"
+)
+
+// Activity is an entry of a user's account activity feed
+type Activity struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"index:idx_activities_user_created,priority:1;not null" json:"-"`
+	Type   string `gorm:"size:32;not null" json:"type"`
+	// ActorID is the admin who made a change to the user; nil when the user acted
+	ActorID   *uint  `json:"actor_id,omitempty"`
+	IP        string `gorm:"size:45" json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	// Details describe the event, e.g. the role assigned or the fields changed
+	Details   Metadata `gorm:"type:jsonb;not null;default:'{}'" json:"details"`
+	CreatedAt int64    `gorm:"autoCreateTime:milli;index:idx_activities_user_created,priority:2" json:"created_at"`
+}
+
+// TableName specifies the table name for Activity
+func (Activity) TableName() string {
+	return "activities"
+}
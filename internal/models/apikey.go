@@ -0,0 +1,34 @@
+package models
+
+// APIKey identifies an integration calling the API. Only the SHA-256 hash of the key
+// is stored; Prefix helps owners recognise it.
+type APIKey struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"index;not null" json:"user_id"` // Owner, who may see the usage
+	Name   string `gorm:"size:100;not null" json:"name"`
+	Prefix string `gorm:"size:12;not null" json:"prefix"`
+	Hash   string `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	// Tier is the rate limit tier of requests made with the key
+	Tier string `gorm:"size:64;not null" json:"tier"`
+	// MonthlyQuota is the most requests per calendar month (UTC); 0 is unlimited
+	MonthlyQuota int64  `gorm:"not null;default:0" json:"monthly_quota"`
+	CreatedAt    int64  `gorm:"autoCreateTime:milli" json:"created_at"`
+	RevokedAt    *int64 `json:"revoked_at,omitempty"`
+}
+
+// TableName specifies the table name for APIKey
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// APIKeyUsage is the number of requests made with an API key on one day (UTC)
+type APIKeyUsage struct {
+	APIKeyID uint   `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	Day      string `gorm:"primaryKey;size:10" json:"day"` // YYYY-MM-DD
+	Requests int64  `gorm:"not null;default:0" json:"requests"`
+}
+
+// TableName specifies the table name for APIKeyUsage
+func (APIKeyUsage) TableName() string {
+	return "api_key_usages"
+}
@@ -0,0 +1,17 @@
+package models
+
+// Consent records that a user accepted a version of a legal document
+type Consent struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	UserID     uint   `gorm:"index;not null" json:"user_id"`
+	Document   string `gorm:"size:32;not null" json:"document"` // terms or privacy
+	Version    string `gorm:"size:64;not null" json:"version"`
+	AcceptedAt int64  `gorm:"autoCreateTime:milli" json:"accepted_at"`
+	IP         string `gorm:"size:45" json:"ip"`
+	UserAgent  string `json:"user_agent"`
+}
+
+// TableName specifies the table name for Consent
+func (Consent) TableName() string {
+	return "consents"
+}
@@ -0,0 +1,25 @@
+package models
+
+// Push notification platforms
+const (
+	PlatformAndroid = "android"
+	PlatformIOS     = "ios"
+)
+
+// PushDevice is an app installation registered to receive push notifications, such
+// as security alerts
+type PushDevice struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"index;not null" json:"user_id"`
+	// Token is the registration token the push provider issued to the installation
+	Token     string `gorm:"size:512;uniqueIndex;not null" json:"-"`
+	Platform  string `gorm:"size:10;not null" json:"platform"`
+	Name      string `gorm:"size:100" json:"name,omitempty"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli" json:"created_at"`
+	UpdatedAt int64  `gorm:"autoUpdateTime:milli" json:"updated_at"`
+}
+
+// TableName specifies the table name for PushDevice
+func (PushDevice) TableName() string {
+	return "push_devices"
+}
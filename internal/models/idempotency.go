@@ -0,0 +1,19 @@
+package models
+
+// IdempotencyRecord stores the response to a mutating request sent with an Idempotency-Key
+type IdempotencyRecord struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Key         string `gorm:"uniqueIndex;size:64;not null" json:"key"` // Hash of caller, route and client key
+	Fingerprint string `gorm:"size:64;not null" json:"fingerprint"`     // Hash of the request body
+	Completed   bool   `gorm:"default:false" json:"completed"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"-"`
+	CreatedAt   int64  `gorm:"autoCreateTime:milli" json:"created_at"`
+	ExpiresAt   int64  `gorm:"index" json:"expires_at"`
+}
+
+// TableName specifies the table name for IdempotencyRecord
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_records"
+}
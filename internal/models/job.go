@@ -0,0 +1,28 @@
+package models
+
+// Job states
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobFailed  = "failed" // Out of attempts; kept for inspection
+)
+
+// Job is a unit of background work, such as sending an email, run by the queue
+// workers outside the request that created it
+type Job struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Kind        string `gorm:"size:64;not null" json:"kind"`
+	Payload     string `gorm:"type:text;not null" json:"payload"` // JSON
+	State       string `gorm:"size:16;not null;index:idx_jobs_state_run_at" json:"state"`
+	Attempts    int    `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int    `gorm:"not null" json:"max_attempts"`
+	RunAt       int64  `gorm:"not null;index:idx_jobs_state_run_at" json:"run_at"` // Next attempt; while running, when the lease ends
+	LastError   string `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt   int64  `gorm:"autoCreateTime:milli" json:"created_at"`
+	UpdatedAt   int64  `gorm:"autoUpdateTime:milli" json:"updated_at"`
+}
+
+// TableName specifies the table name for Job
+func (Job) TableName() string {
+	return "jobs"
+}
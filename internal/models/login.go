@@ -0,0 +1,44 @@
+package models
+
+// LoginEvent records a login attempt for an existing account
+type LoginEvent struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	UserID    uint   `gorm:"index;not null" json:"user_id"`
+	Success   bool   `gorm:"not null" json:"success"`
+	IP        string `gorm:"size:45" json:"ip"`
+	UserAgent string `json:"user_agent"`
+	// Country (ISO 3166-1 alpha-2), ASN and coordinates are resolved from the IP when a
+	// GeoIP database is configured
+	Country   string  `gorm:"size:2" json:"country,omitempty"`
+	ASN       uint    `json:"asn,omitempty"`
+	Latitude  float64 `json:"-"`
+	Longitude float64 `json:"-"`
+	// Suspicious logins come from a new country or imply impossible travel;
+	// RiskReasons lists why, comma-separated
+	Suspicious  bool   `gorm:"not null;default:false" json:"suspicious"`
+	RiskReasons string `gorm:"size:100" json:"risk_reasons,omitempty"`
+	CreatedAt   int64  `gorm:"autoCreateTime:milli;index" json:"created_at"`
+}
+
+// TableName specifies the table name for LoginEvent
+func (LoginEvent) TableName() string {
+	return "login_events"
+}
+
+// LoginConfirmation is a suspicious login waiting for the user to confirm it from an
+// email. Once confirmed, logging in again from the same IP succeeds.
+type LoginConfirmation struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"index;not null"`
+	TokenHash   string `gorm:"size:64;uniqueIndex;not null"`
+	IP          string `gorm:"size:45;not null"`
+	UserAgent   string
+	CreatedAt   int64  `gorm:"autoCreateTime:milli"`
+	ExpiresAt   int64  `gorm:"not null"`
+	ConfirmedAt *int64 // Set when the user confirmed the login
+}
+
+// TableName specifies the table name for LoginConfirmation
+func (LoginConfirmation) TableName() string {
+	return "login_confirmations"
+}
@@ -0,0 +1,34 @@
+package models
+
+import "gorm.io/gorm"
+
+// MigrateAgeToDateOfBirth replaces the legacy age column with an approximate date of
+// birth: the registration date minus the stored age. It is a no-op once the column is gone.
+func MigrateAgeToDateOfBirth(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("users", "age") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE users
+			SET date_of_birth = (to_timestamp(created_at / 1000.0) - make_interval(years => age))::date
+			WHERE date_of_birth IS NULL AND age > 0`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn("users", "age")
+	})
+}
+
+// BackfillPasswordChangedAt dates the passwords of accounts from before password
+// changes were tracked to the account's creation
+func BackfillPasswordChangedAt(db *gorm.DB) error {
+	return db.Exec(`UPDATE users SET password_changed_at = created_at WHERE password_changed_at = 0`).Error
+}
+
+// BackfillLastActiveAt dates the last activity of accounts from before activity was
+// tracked to their last successful login, or their creation
+func BackfillLastActiveAt(db *gorm.DB) error {
+	return db.Exec(`UPDATE users SET last_active_at = COALESCE(
+		(SELECT MAX(created_at) FROM login_events WHERE login_events.user_id = users.id AND success),
+		created_at) WHERE last_active_at = 0`).Error
+}
@@ -0,0 +1,25 @@
+package models
+
+// AdminNote is a note an admin attached to a user, e.g. about a support conversation
+// or an abuse report. Only admins see notes.
+type AdminNote struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"index;not null" json:"user_id"`
+	// AuthorID is the admin who wrote the note; Author is filled in when loaded
+	AuthorID  uint        `gorm:"not null" json:"author_id"`
+	Author    *NoteAuthor `gorm:"-" json:"author,omitempty"`
+	Body      string      `gorm:"type:text;not null" json:"body"`
+	CreatedAt int64       `gorm:"autoCreateTime:milli" json:"created_at"`
+}
+
+// TableName specifies the table name for AdminNote
+func (AdminNote) TableName() string {
+	return "admin_notes"
+}
+
+// NoteAuthor is the admin shown with a note, including admins deleted since
+type NoteAuthor struct {
+	ID    uint   `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
@@ -0,0 +1,27 @@
+package models
+
+// One-time token purposes
+const (
+	TokenPurposeEmailRevert  = "email_revert"
+	TokenPurposeEmailChange  = "email_change"
+	TokenPurposeRegistration = "registration"
+)
+
+// OneTimeToken is a single-use token sent to a user, e.g. in a link. It is only
+// accepted for its purpose, once and before it expires; Data holds what the flow
+// needs when the token is used.
+type OneTimeToken struct {
+	ID        uint     `gorm:"primaryKey"`
+	UserID    uint     `gorm:"index;not null"`
+	Purpose   string   `gorm:"size:32;not null"`
+	TokenHash string   `gorm:"size:64;uniqueIndex;not null"`
+	Data      Metadata `gorm:"type:jsonb;not null;default:'{}'"`
+	CreatedAt int64    `gorm:"autoCreateTime:milli"`
+	ExpiresAt int64    `gorm:"index;not null"`
+	UsedAt    *int64   // Set when the token was used
+}
+
+// TableName specifies the table name for OneTimeToken
+func (OneTimeToken) TableName() string {
+	return "one_time_tokens"
+}
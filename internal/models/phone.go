@@ -0,0 +1,17 @@
+package models
+
+// PhoneVerification is a pending SMS code that proves the user controls their phone number
+type PhoneVerification struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	UserID    uint   `gorm:"uniqueIndex;not null" json:"user_id"` // One pending code per user
+	Tel       string `gorm:"not null" json:"tel"`                 // Number the code was sent to
+	CodeHash  string `gorm:"size:64;not null" json:"-"`
+	Attempts  int    `gorm:"not null;default:0" json:"attempts"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli" json:"created_at"`
+	ExpiresAt int64  `gorm:"index" json:"expires_at"`
+}
+
+// TableName specifies the table name for PhoneVerification
+func (PhoneVerification) TableName() string {
+	return "phone_verifications"
+}
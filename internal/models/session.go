@@ -0,0 +1,38 @@
+package models
+
+// RefreshToken is an issued refresh token, stored as a SHA-256 hash together with
+// the device it was issued to. Each one is a session the user can revoke.
+type RefreshToken struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	UserID    uint   `gorm:"index;not null" json:"user_id"`
+	TokenHash string `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	IP        string `gorm:"size:45" json:"ip"`
+	UserAgent string `json:"user_agent"`
+	CreatedAt int64  `gorm:"autoCreateTime:milli" json:"created_at"`
+	// AuthenticatedAt is when the user logged in or last confirmed their password, and
+	// AuthMethods how (comma-separated amr values); rotated tokens keep both
+	AuthenticatedAt int64  `gorm:"not null;default:0" json:"authenticated_at"`
+	AuthMethods     string `gorm:"size:64" json:"auth_methods"`
+	ExpiresAt       int64  `gorm:"index;not null" json:"expires_at"`
+	RevokedAt       *int64 `json:"-"` // Set when the token was used, logged out or revoked
+}
+
+// TableName specifies the table name for RefreshToken
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// OpaqueToken holds the claims of an opaque access or refresh token, stored under the
+// SHA-256 hash of the token
+type OpaqueToken struct {
+	TokenHash string `gorm:"primaryKey;size:64"`
+	UserID    uint   `gorm:"index;not null"`
+	Claims    string `gorm:"type:text;not null"` // JSON
+	CreatedAt int64  `gorm:"autoCreateTime:milli"`
+	ExpiresAt int64  `gorm:"index;not null"`
+}
+
+// TableName specifies the table name for OpaqueToken
+func (OpaqueToken) TableName() string {
+	return "opaque_tokens"
+}
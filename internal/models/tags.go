@@ -0,0 +1,45 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Tags are labels admins put on a user to segment users, stored as a JSONB array
+type Tags []string
+
+// Value stores the tags as a JSON array, never as NULL
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(t))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan reads a JSON array from the database
+func (t *Tags) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*t = Tags{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Tags", src)
+	}
+
+	result := Tags{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	*t = result
+	return nil
+}
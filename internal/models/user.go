@@ -1,24 +1,54 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/fieldcrypt"
+)
 
 // User represents a user in the system
 type User struct {
-	ID            uint           `gorm:"primaryKey" json:"id"`
-	Email         string         `gorm:"unique;not null" json:"email"`
-	Password      string         `gorm:"not null" json:"-"` // Never expose password in JSON
-	Name          string         `gorm:"not null" json:"name"`
-	Tel           string         `json:"tel"`
-	Age           int            `json:"age"`
-	Address       string         `json:"address"`
-	City          string         `json:"city"`
-	Country       string         `json:"country"`
-	Gender        string         `json:"gender"`
-	EmailVerified bool           `gorm:"default:false" json:"email_verified"`
-	Roles         []Role         `gorm:"many2many:user_roles;" json:"roles"`
-	CreatedAt     int64          `gorm:"autoCreateTime:milli" json:"created_at"`
-	UpdatedAt     int64          `gorm:"autoUpdateTime:milli" json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"` // Soft delete support
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Email          string         `gorm:"unique;not null;serializer:encrypted_email" json:"email"`
+	EmailIndex     *string        `gorm:"size:64;uniqueIndex" json:"-"`          // Blind index of Email, for lookups when it is encrypted
+	Username       *string        `gorm:"uniqueIndex" json:"username,omitempty"` // Stored lower-case; optional for accounts created before usernames
+	Password       string         `gorm:"not null" json:"-"`                     // Never expose password in JSON
+	Name           string         `gorm:"not null" json:"name"`
+	PasswordSetAt  int64          `gorm:"column:password_changed_at;not null;default:0" json:"password_changed_at"`
+	LastActiveAt   int64          `gorm:"not null;default:0;index" json:"last_active_at"`
+	IdleWarnedAt   *int64         `gorm:"column:inactivity_warned_at" json:"inactivity_warned_at"`
+	Tel            string         `gorm:"serializer:encrypted" json:"tel"`
+	DateOfBirth    *Date          `gorm:"type:text;serializer:encrypted" json:"date_of_birth"`
+	Age            *int           `gorm:"-" json:"age"` // Derived from DateOfBirth when loaded
+	Address        string         `gorm:"serializer:encrypted" json:"address"`
+	City           string         `json:"city"`
+	Country        string         `json:"country"`
+	Gender         string         `json:"gender"`
+	GenderDesc     string         `gorm:"column:gender_description;size:100" json:"gender_description"` // Set when Gender is self_described
+	EmailVerified  bool           `gorm:"default:false" json:"email_verified"`
+	EmailFlagged   bool           `gorm:"default:false" json:"email_flagged"`  // Registered with a disposable email domain
+	PhoneVerified  bool           `gorm:"default:false" json:"phone_verified"` // Reset whenever Tel changes
+	TOTPEnabled    bool           `gorm:"default:false" json:"totp_enabled"`   // Logins need an authenticator code
+	TOTPSecret     string         `gorm:"size:64" json:"-"`                    // Base32 authenticator secret, set from setup until disabled
+	TOTPLastStep   int64          `json:"-"`                                   // Time step of the last accepted code, against replays
+	Timezone       string         `gorm:"size:64" json:"timezone"`             // IANA name; empty means UTC
+	Locale         string         `gorm:"size:35" json:"locale"`               // BCP 47 tag; empty follows Accept-Language
+	TermsVersion   string         `json:"terms_version"`                       // Last accepted terms of service version
+	PrivacyVersion string         `json:"privacy_version"`                     // Last accepted privacy policy version
+	AvatarURL      string         `json:"avatar_url"`
+	AvatarKey      string         `json:"-"` // Storage key of the current avatar
+	Metadata       Metadata       `gorm:"type:jsonb;not null;default:'{}'" json:"metadata"`
+	Tags           Tags           `gorm:"type:jsonb;not null;default:'[]';index:,type:gin" json:"tags"` // Set by admins to segment users
+	Roles          []Role         `gorm:"many2many:user_roles;" json:"roles"`
+	SuspendedAt    *int64         `json:"suspended_at"`                      // Set while the account is suspended
+	SuspendReason  string         `json:"suspend_reason,omitempty"`          // Why the account was suspended
+	TokenVersion   uint           `gorm:"not null;default:0" json:"-"`       // Incremented to revoke all issued tokens
+	Version        uint           `gorm:"not null;default:1" json:"version"` // Incremented on every update for optimistic locking
+	CreatedAt      int64          `gorm:"autoCreateTime:milli" json:"created_at"`
+	UpdatedAt      int64          `gorm:"autoUpdateTime:milli" json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"` // Soft delete support
 }
 
 // TableName specifies the table name for User
@@ -26,6 +56,51 @@ func (User) TableName() string {
 	return "users"
 }
 
+// BeforeCreate stores the blind index of the email when an index key is configured
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if index := fieldcrypt.BlindIndex(u.Email); index != "" {
+		u.EmailIndex = &index
+	}
+	return nil
+}
+
+// WhereEmail is a scope matching the user with an email. With an index key the blind
+// index is used, which also finds encrypted emails; users not yet indexed are
+// matched on the stored email.
+func WhereEmail(email string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if index := fieldcrypt.BlindIndex(email); index != "" {
+			return db.Where("(email_index = ? OR email = ?)", index, email)
+		}
+		return db.Where("email = ?", email)
+	}
+}
+
+// AfterFind derives the age from the date of birth
+func (u *User) AfterFind(tx *gorm.DB) error {
+	u.Age = nil
+	if u.DateOfBirth != nil {
+		age := u.DateOfBirth.YearsAt(time.Now())
+		u.Age = &age
+	}
+	return nil
+}
+
+// PasswordExpiresAt returns when the password expires under a maximum age. Passwords
+// of accounts from before changes were tracked count from the account's creation.
+func (u *User) PasswordExpiresAt(maxAge time.Duration) time.Time {
+	setAt := u.PasswordSetAt
+	if setAt == 0 {
+		setAt = u.CreatedAt
+	}
+	return time.UnixMilli(setAt).Add(maxAge)
+}
+
+// Suspended reports whether the account is suspended
+func (u *User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
+
 // Role represents a role in the system
 type Role struct {
 	ID        uint   `gorm:"primaryKey" json:"id"`
@@ -39,3 +114,13 @@ type Role struct {
 func (Role) TableName() string {
 	return "roles"
 }
+
+// Location returns the user's time zone for rendering times, defaulting to UTC
+func (u *User) Location() *time.Location {
+	if u.Timezone != "" {
+		if loc, err := time.LoadLocation(u.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
@@ -0,0 +1,204 @@
+// Package notify delivers real-time account notifications to the connections users
+// keep open: logins from new devices, password changes and granted roles. The Hub
+// tracks the connections of each user, so it can also tell who is online, and relays
+// notifications through Redis to the connections held by other instances. Notifiers
+// hands the same notifications to other channels, such as push notifications.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// Notification types
+const (
+	TypeNewDeviceLogin  = "new_device_login"
+	TypePasswordChanged = "password_changed"
+	TypeRoleGranted     = "role_granted"
+)
+
+// connectionBuffer is how many notifications a connection may fall behind before it
+// is dropped
+const connectionBuffer = 16
+
+// redisChannel relays notifications between the instances
+const redisChannel = "um:notify"
+
+// Notification tells a user about a change to their account
+type Notification struct {
+	Type      string         `json:"type"`
+	Details   map[string]any `json:"details,omitempty"`
+	CreatedAt int64          `json:"created_at"`
+}
+
+// Notifier delivers notifications to users
+type Notifier interface {
+	Notify(ctx context.Context, userID uint, notification Notification)
+}
+
+// Notifiers delivers notifications through each of several notifiers, e.g. the hub
+// and push notifications
+type Notifiers []Notifier
+
+// Notify hands the notification to every notifier
+func (ns Notifiers) Notify(ctx context.Context, userID uint, notification Notification) {
+	if notification.CreatedAt == 0 {
+		notification.CreatedAt = time.Now().UnixMilli()
+	}
+	for _, n := range ns {
+		n.Notify(ctx, userID, notification)
+	}
+}
+
+// message is a notification on its way to a user through Redis
+type message struct {
+	UserID       uint         `json:"user_id"`
+	Notification Notification `json:"notification"`
+}
+
+// Hub hands notifications to the connections of the users they are for
+type Hub struct {
+	redis *redis.Client
+
+	mu     sync.Mutex
+	conns  map[uint]map[chan Notification]struct{}
+	closed bool
+}
+
+// NewHub creates a hub. With a Redis client notifications are relayed between
+// instances; Run must then be running to receive them.
+func NewHub(client *redis.Client) *Hub {
+	return &Hub{redis: client, conns: make(map[uint]map[chan Notification]struct{})}
+}
+
+// Notify sends a notification to every connection of the user. Delivery is best
+// effort: users without a connection miss it, and a notification that can't be
+// relayed through Redis is logged and dropped.
+func (h *Hub) Notify(ctx context.Context, userID uint, notification Notification) {
+	if notification.CreatedAt == 0 {
+		notification.CreatedAt = time.Now().UnixMilli()
+	}
+	if h.redis == nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.deliverLocked(userID, notification)
+		return
+	}
+
+	data, err := json.Marshal(message{UserID: userID, Notification: notification})
+	if err == nil {
+		err = h.redis.Publish(context.WithoutCancel(ctx), redisChannel, data).Err()
+	}
+	if err != nil {
+		logging.Warn(ctx, "failed to publish notification", "type", notification.Type, "user_id", userID, "error", err)
+	}
+}
+
+// Run receives the notifications published by every instance through Redis until
+// ctx is cancelled. Without Redis it returns at once.
+func (h *Hub) Run(ctx context.Context) {
+	if h.redis == nil {
+		return
+	}
+	pubsub := h.redis.Subscribe(ctx, redisChannel)
+	defer pubsub.Close()
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var m message
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+				logging.Warn(ctx, "invalid notification received", "error", err)
+				continue
+			}
+			h.mu.Lock()
+			h.deliverLocked(m.UserID, m.Notification)
+			h.mu.Unlock()
+		}
+	}
+}
+
+// Connect registers a connection of the user and returns the channel receiving its
+// notifications. The channel is closed when the connection falls too far behind or
+// the hub closes; disconnect unregisters it.
+func (h *Hub) Connect(userID uint) (notifications <-chan Notification, disconnect func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Notification, connectionBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.conns[userID] == nil {
+		h.conns[userID] = make(map[chan Notification]struct{})
+	}
+	h.conns[userID][ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.removeLocked(userID, ch)
+	}
+}
+
+// Online reports whether the user has a connection to this instance
+func (h *Hub) Online(userID uint) bool {
+	return h.Connections(userID) > 0
+}
+
+// Connections returns the number of connections the user has to this instance
+func (h *Hub) Connections(userID uint) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.conns[userID])
+}
+
+// Close ends every connection, e.g. so a shutting-down server isn't held up by them
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for userID, conns := range h.conns {
+		for ch := range conns {
+			close(ch)
+		}
+		delete(h.conns, userID)
+	}
+}
+
+// deliverLocked hands a notification to the user's connections. Connections whose
+// buffer is full are dropped. h.mu must be held.
+func (h *Hub) deliverLocked(userID uint, notification Notification) {
+	for ch := range h.conns[userID] {
+		select {
+		case ch <- notification:
+		default:
+			h.removeLocked(userID, ch)
+		}
+	}
+}
+
+// removeLocked unregisters and closes a connection's channel if it is still
+// registered. h.mu must be held.
+func (h *Hub) removeLocked(userID uint, ch chan Notification) {
+	conns := h.conns[userID]
+	if _, ok := conns[ch]; !ok {
+		return
+	}
+	delete(conns, ch)
+	close(ch)
+	if len(conns) == 0 {
+		delete(h.conns, userID)
+	}
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+)
+
+// knownDeviceLogins is how many recent logins are searched for the user agent of a
+// new login; a user agent not among them makes the login one from a new device
+const knownDeviceLogins = 50
+
+// userRepository notifies users of password changes and logins from new devices
+type userRepository struct {
+	repository.UserRepository
+	notifier Notifier
+}
+
+// WrapUsers returns a user repository that also notifies users of password changes
+// and of logins from devices they haven't logged in from recently
+func WrapUsers(repo repository.UserRepository, notifier Notifier) repository.UserRepository {
+	return &userRepository{UserRepository: repo, notifier: notifier}
+}
+
+// ResetPassword sets the password and notifies the user
+func (r *userRepository) ResetPassword(ctx context.Context, user *models.User, password string) error {
+	if err := r.UserRepository.ResetPassword(ctx, user, password); err != nil {
+		return err
+	}
+	r.notifier.Notify(ctx, user.ID, Notification{Type: TypePasswordChanged})
+	return nil
+}
+
+// RecordLogin adds the login to the history and notifies the user when it came from
+// a new device. The first login of an account is not notified.
+func (r *userRepository) RecordLogin(ctx context.Context, event *models.LoginEvent) error {
+	newDevice := false
+	if event.Success {
+		history, _, err := r.UserRepository.LoginHistory(ctx, event.UserID, 0, knownDeviceLogins)
+		if err != nil {
+			logging.Warn(ctx, "failed to load login history for notification", "user_id", event.UserID, "error", err)
+		}
+		newDevice = err == nil && newUserAgent(history, event.UserAgent)
+	}
+
+	if err := r.UserRepository.RecordLogin(ctx, event); err != nil {
+		return err
+	}
+	if newDevice {
+		details := map[string]any{"ip": event.IP, "user_agent": event.UserAgent}
+		if event.Country != "" {
+			details["country"] = event.Country
+		}
+		r.notifier.Notify(ctx, event.UserID, Notification{Type: TypeNewDeviceLogin, Details: details, CreatedAt: event.CreatedAt})
+	}
+	return nil
+}
+
+// newUserAgent reports whether the successful logins of a history include some, but
+// none with the user agent
+func newUserAgent(history []models.LoginEvent, userAgent string) bool {
+	seen := false
+	for _, login := range history {
+		if !login.Success {
+			continue
+		}
+		if login.UserAgent == userAgent {
+			return false
+		}
+		seen = true
+	}
+	return seen
+}
+
+// roleRepository notifies users of the roles they are granted
+type roleRepository struct {
+	repository.RoleRepository
+	notifier Notifier
+}
+
+// WrapRoles returns a role repository that also notifies users of granted roles
+func WrapRoles(repo repository.RoleRepository, notifier Notifier) repository.RoleRepository {
+	return &roleRepository{RoleRepository: repo, notifier: notifier}
+}
+
+// Assign gives the user the role and notifies them
+func (r *roleRepository) Assign(ctx context.Context, user *models.User, role *models.Role) error {
+	if err := r.RoleRepository.Assign(ctx, user, role); err != nil {
+		return err
+	}
+	r.notifier.Notify(ctx, user.ID, Notification{Type: TypeRoleGranted, Details: map[string]any{"role": role.Name}})
+	return nil
+}
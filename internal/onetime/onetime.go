@@ -0,0 +1,107 @@
+// Package onetime issues the single-use tokens that flows such as email change
+// reverts mail to users. Only the token hashes are stored, each token is bound to a
+// purpose so it can't be replayed in another flow, and expired tokens are deleted by
+// Service.Run.
+package onetime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+)
+
+// ErrInvalid is returned for a token that is unknown, used, expired or issued for
+// another purpose
+var ErrInvalid = errors.New("invalid one-time token")
+
+// New generates a token for a purpose and the record to store for it, for flows that
+// store the record together with other changes. Issue generates and stores both.
+func New(purpose string, userID uint, ttl time.Duration, data models.Metadata) (string, *models.OneTimeToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if data == nil {
+		data = models.Metadata{}
+	}
+	return token, &models.OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: sessions.Hash(token),
+		Data:      data,
+		ExpiresAt: time.Now().Add(ttl).UnixMilli(),
+	}, nil
+}
+
+// Service issues and redeems one-time tokens
+type Service struct {
+	tokens repository.TokenRepository
+}
+
+// NewService creates a one-time token service
+func NewService(tokens repository.TokenRepository) *Service {
+	return &Service{tokens: tokens}
+}
+
+// Issue generates and stores a token for a purpose that expires after ttl, and
+// returns it with its record. data is handed back by Use.
+func (s *Service) Issue(ctx context.Context, purpose string, userID uint, ttl time.Duration, data models.Metadata) (string, *models.OneTimeToken, error) {
+	token, record, err := New(purpose, userID, ttl, data)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.tokens.CreateOneTimeToken(ctx, record); err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// Use redeems a token issued for a purpose and returns its record. Every token can be
+// used once; ErrInvalid is returned when it can't be used.
+func (s *Service) Use(ctx context.Context, purpose, token string) (*models.OneTimeToken, error) {
+	record, err := s.tokens.UseOneTimeToken(ctx, purpose, sessions.Hash(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalid
+	}
+	return record, err
+}
+
+// Cleanup deletes the tokens that expired before now and returns how many there were
+func (s *Service) Cleanup(ctx context.Context, now time.Time) (int64, error) {
+	return s.tokens.DeleteExpiredOneTimeTokens(ctx, now.UnixMilli())
+}
+
+// Run cleans up immediately and then every interval until ctx is cancelled. Failures
+// are logged and retried on the next cleanup.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	cleanup := func() {
+		deleted, err := s.Cleanup(ctx, time.Now())
+		if err != nil {
+			logging.Error(ctx, "failed to delete expired one-time tokens", "error", err)
+			return
+		}
+		if deleted > 0 {
+			logging.Info(ctx, "expired one-time tokens deleted", "count", deleted)
+		}
+	}
+
+	cleanup()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cleanup()
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package openapi
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed swagger.html
+var swaggerHTML string
+
+var swaggerTemplate = template.Must(template.New("swagger").Parse(swaggerHTML))
+
+// DocumentHandler serves the OpenAPI document for all routes registered on engine.
+// The document is built on first request, after every route has been mounted.
+func DocumentHandler(spec Spec, engine *gin.Engine) gin.HandlerFunc {
+	var (
+		once sync.Once
+		doc  *Document
+	)
+
+	return func(c *gin.Context) {
+		once.Do(func() {
+			var routes []Route
+			for _, r := range engine.Routes() {
+				routes = append(routes, Route{Method: r.Method, Path: r.Path})
+			}
+			doc = Build(spec, routes)
+		})
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// UIHandler serves a Swagger UI page that loads the document from specURL
+func UIHandler(title, specURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := swaggerTemplate.Execute(c.Writer, map[string]string{"Title": title, "SpecURL": specURL}); err != nil {
+			c.Error(err)
+		}
+	}
+}
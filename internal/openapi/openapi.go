@@ -0,0 +1,231 @@
+// Package openapi builds an OpenAPI 3 document from the registered Gin routes and
+// per-operation metadata, deriving JSON schemas from the Go request/response structs.
+package openapi
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operation describes one endpoint. Request and Response are zero values of the
+// JSON body types (nil when there is no body); Response becomes the "data" member
+// of the Spec's success envelope unless Unwrapped is set.
+type Operation struct {
+	Summary      string
+	Tags         []string
+	Auth         bool // Requires a bearer access token
+	Request      any
+	RequestType  string // Request media type, application/json when empty
+	Response     any
+	ResponseType string  // Response media type, application/json when empty; others are unwrapped
+	Unwrapped    bool    // Response is sent as-is, without the success envelope
+	Status       int     // Success status code, http.StatusOK when zero
+	Errors       []int   // Documented error status codes
+	Query        []Param // Query string parameters
+}
+
+// Param describes a query string parameter
+type Param struct {
+	Name        string
+	Description string
+	Type        string // string, integer, boolean
+	Required    bool
+}
+
+// Info holds the document metadata
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       Info                                   `json:"info"`
+	Paths      map[string]map[string]*OperationObject `json:"paths"`
+	Components Components                             `json:"components"`
+}
+
+// Components holds reusable schemas and security schemes
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]map[string]any `json:"securitySchemes"`
+}
+
+// OperationObject is a single operation on a path
+type OperationObject struct {
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []ParameterObject     `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// ParameterObject is a path or query parameter
+type ParameterObject struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes a JSON request body
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response describes a response for one status code
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType wraps a schema for a content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Route is the method and path of a registered route
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Spec holds everything about the API that cannot be read from the router
+type Spec struct {
+	Info Info
+	// Operations are keyed by "METHOD /path" in Gin path syntax (e.g. "GET /api/users/:id")
+	Operations map[string]Operation
+	// Envelope is a zero value of the success envelope type; its "data" property is
+	// replaced by each operation's response schema. Responses are unwrapped when nil.
+	Envelope any
+	// ErrorBody is a zero value of the error payload type used for error responses
+	ErrorBody any
+	// ErrorContentType is the media type of error responses
+	ErrorContentType string
+}
+
+// Build creates the document for routes. Routes without operation metadata are
+// still listed with a generic response.
+func Build(spec Spec, routes []Route) *Document {
+	gen := newGenerator()
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    spec.Info,
+		Paths:   make(map[string]map[string]*OperationObject),
+		Components: Components{
+			Schemas: gen.schemas,
+			SecuritySchemes: map[string]map[string]any{
+				"bearerAuth": {"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	for _, route := range routes {
+		op := spec.Operations[route.Method+" "+route.Path]
+		path, params := convertPath(route.Path)
+
+		item := &OperationObject{
+			Summary:    op.Summary,
+			Tags:       op.Tags,
+			Parameters: params,
+			Responses:  make(map[string]*Response),
+		}
+
+		for _, q := range op.Query {
+			typ := q.Type
+			if typ == "" {
+				typ = "string"
+			}
+			item.Parameters = append(item.Parameters, ParameterObject{
+				Name:        q.Name,
+				In:          "query",
+				Description: q.Description,
+				Required:    q.Required,
+				Schema:      &Schema{Type: typ},
+			})
+		}
+
+		if op.Request != nil {
+			requestType := op.RequestType
+			if requestType == "" {
+				requestType = "application/json"
+			}
+			item.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]*MediaType{requestType: {Schema: gen.schemaFor(op.Request)}},
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &Response{Description: http.StatusText(status)}
+		if op.Response != nil {
+			schema := gen.schemaFor(op.Response)
+			responseType := op.ResponseType
+			if responseType == "" {
+				responseType = "application/json"
+				if !op.Unwrapped && spec.Envelope != nil {
+					schema = gen.envelopeSchema(spec.Envelope, schema)
+				}
+			}
+			success.Content = map[string]*MediaType{responseType: {Schema: schema}}
+		}
+		item.Responses[strconv.Itoa(status)] = success
+
+		errorCodes := op.Errors
+		if op.Auth {
+			errorCodes = append([]int{http.StatusUnauthorized}, errorCodes...)
+			item.Security = []map[string][]string{{"bearerAuth": {}}}
+		}
+		for _, code := range errorCodes {
+			resp := &Response{Description: http.StatusText(code)}
+			if spec.ErrorBody != nil {
+				resp.Content = map[string]*MediaType{spec.ErrorContentType: {Schema: gen.schemaFor(spec.ErrorBody)}}
+			}
+			item.Responses[strconv.Itoa(code)] = resp
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*OperationObject)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = item
+	}
+
+	return doc
+}
+
+// convertPath turns Gin path parameters (:id, *file) into OpenAPI {id} templates
+func convertPath(ginPath string) (string, []ParameterObject) {
+	var params []ParameterObject
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if segment == "" || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+		name := segment[1:]
+		segments[i] = "{" + name + "}"
+		params = append(params, ParameterObject{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	return strings.Join(segments, "/"), params
+}
@@ -0,0 +1,55 @@
+// Package phone parses user-supplied phone numbers and normalizes them to E.164.
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// ErrInvalid is returned for values that are not a valid phone number
+var ErrInvalid = errors.New("invalid phone number")
+
+var (
+	mu            sync.RWMutex
+	defaultRegion = phonenumbers.UNKNOWN_REGION
+)
+
+// SetDefaultRegion sets the ISO 3166-1 region used for numbers written without a
+// "+" country code (e.g. "MK" turns "070 123 456" into "+38970123456"). An empty
+// region requires every number to carry its country code.
+func SetDefaultRegion(region string) error {
+	region = strings.ToUpper(region)
+	if region == "" {
+		region = phonenumbers.UNKNOWN_REGION
+	} else if !phonenumbers.GetSupportedRegions()[region] {
+		return fmt.Errorf("unsupported phone region %q", region)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	defaultRegion = region
+	return nil
+}
+
+// Normalize parses raw in the default region and returns it in E.164 format
+func Normalize(raw string) (string, error) {
+	mu.RLock()
+	region := defaultRegion
+	mu.RUnlock()
+
+	number, err := phonenumbers.Parse(raw, region)
+	if err != nil || !phonenumbers.IsValidNumber(number) {
+		return "", ErrInvalid
+	}
+	return phonenumbers.Format(number, phonenumbers.E164), nil
+}
+
+// Valid reports whether raw can be normalized
+func Valid(raw string) bool {
+	_, err := Normalize(raw)
+	return err == nil
+}
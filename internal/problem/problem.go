@@ -0,0 +1,112 @@
+// Package problem renders API errors as RFC 7807 application/problem+json documents.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/dbguard"
+	"github.com/ristep/um_starter_jwt_go/internal/i18n"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/requestid"
+)
+
+// ContentType is the media type of problem documents
+const ContentType = "application/problem+json"
+
+// typePrefix namespaces problem type URIs; the machine-readable code is appended
+const typePrefix = "urn:um-api:problem:"
+
+// Problem is an RFC 7807 problem details document with a machine-readable code
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// Errors lists per-field validation failures (extension member)
+	Errors []apperr.FieldError `json:"errors,omitempty"`
+}
+
+// FromError converts err into a problem. Errors outside the apperr catalog are
+// reported as internal errors so their messages never leak to clients, and errors
+// caused by a database outage or the request timeout as 503 whatever they were
+// wrapped in.
+func FromError(err error) Problem {
+	var appErr *apperr.Error
+	if errors.Is(err, dbguard.ErrUnavailable) {
+		appErr = apperr.ErrDatabaseUnavailable
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		appErr = apperr.ErrRequestTimeout
+	} else if !errors.As(err, &appErr) {
+		appErr = apperr.ErrInternal
+	}
+
+	return Problem{
+		Type:   typePrefix + appErr.Code,
+		Title:  appErr.Title,
+		Status: appErr.Status,
+		Detail: appErr.Detail,
+		Code:   appErr.Code,
+		Errors: appErr.Fields,
+	}
+}
+
+// Write sends the problem response for err, with the title in the language
+// negotiated for the request
+func Write(c *gin.Context, err error) {
+	p := FromError(err)
+	var unavailable *dbguard.UnavailableError
+	if errors.As(err, &unavailable) {
+		c.Header("Retry-After", strconv.Itoa(int(unavailable.RetryAfter.Seconds())+1))
+	}
+	if p.Status >= 500 {
+		logging.Error(c.Request.Context(), "request failed", "path", c.Request.URL.Path, "request_id", requestid.Get(c), "error", err)
+	}
+	if title, ok := i18n.Message(i18n.Language(c), "error."+p.Code); ok {
+		p.Title = title
+	}
+	Render(c, p)
+}
+
+// Abort sends the problem response for err and stops the handler chain; used by middleware
+func Abort(c *gin.Context, err error) {
+	Write(c, err)
+	c.Abort()
+}
+
+// Render sends p, filling in the request path as the instance
+func Render(c *gin.Context, p Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", ContentType)
+	c.JSON(p.Status, p)
+}
+
+// WriteHTTP is Write for plain net/http handlers, which have no negotiated language
+// or request ID in their context
+func WriteHTTP(w http.ResponseWriter, r *http.Request, err error) {
+	p := FromError(err)
+	var unavailable *dbguard.UnavailableError
+	if errors.As(err, &unavailable) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(unavailable.RetryAfter.Seconds())+1))
+	}
+	if p.Status >= 500 {
+		logging.Error(r.Context(), "request failed", "path", r.URL.Path, "error", err)
+	}
+	if title, ok := i18n.Message(i18n.Negotiate(r.Header.Get("Accept-Language")), "error."+p.Code); ok {
+		p.Title = title
+	}
+	p.Instance = r.URL.Path
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
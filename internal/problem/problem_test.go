@@ -0,0 +1,52 @@
+package problem_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/testutil"
+)
+
+func TestWriteRendersCatalogCode(t *testing.T) {
+	cause := errors.New("pq: relation users does not exist")
+	tests := []struct {
+		name   string
+		err    error
+		code   string
+		status int
+		detail string
+	}{
+		{"catalog error", apperr.ErrUserNotFound, "user_not_found", http.StatusNotFound, ""},
+		{"wrapped cause", apperr.ErrDatabase.WithDetail("Failed to load user").Wrap(cause), "database_error", http.StatusInternalServerError, "Failed to load user"},
+		{"wrapped by fmt", fmt.Errorf("assign role: %w", apperr.ErrRoleNotAssigned), "role_not_assigned", http.StatusBadRequest, ""},
+		{"outside the catalog", cause, "internal_error", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := testutil.Router()
+			router.GET("/fail", func(c *gin.Context) { problem.Write(c, tt.err) })
+
+			rec := testutil.Do(router, testutil.NewRequest(t, http.MethodGet, "/fail", nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			p := testutil.DecodeProblem(t, rec)
+			if p.Code != tt.code || p.Status != tt.status || p.Type != "urn:um-api:problem:"+tt.code {
+				t.Errorf("problem = %+v, want code %s and status %d", p, tt.code, tt.status)
+			}
+			if p.Detail != tt.detail {
+				t.Errorf("detail = %q, want %q", p.Detail, tt.detail)
+			}
+			if strings.Contains(rec.Body.String(), "relation users") {
+				t.Errorf("the cause leaked to the client: %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/notify"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+)
+
+// Alerter pushes the security alerts among account notifications, new device logins
+// and password changes, to the user's registered devices. It is a notify.Notifier.
+type Alerter struct {
+	devices repository.DeviceRepository
+	sender  Sender
+}
+
+// NewAlerter creates an alerter sending through sender
+func NewAlerter(devices repository.DeviceRepository, sender Sender) *Alerter {
+	return &Alerter{devices: devices, sender: sender}
+}
+
+// Notify pushes the notification to every device of the user if it is a security
+// alert. Failures are only logged.
+func (a *Alerter) Notify(ctx context.Context, userID uint, notification notify.Notification) {
+	msg, ok := alertMessage(notification)
+	if !ok {
+		return
+	}
+	devices, err := a.devices.List(ctx, userID)
+	if err != nil {
+		logging.Warn(ctx, "failed to load push devices", "user_id", userID, "error", err)
+		return
+	}
+	for _, device := range devices {
+		if err := a.sender.Send(ctx, device.Token, msg); err != nil {
+			logging.Warn(ctx, "failed to send push notification", "user_id", userID, "device_id", device.ID, "type", notification.Type, "error", err)
+		}
+	}
+}
+
+// alertMessage is the push message of a security alert; it reports false for other
+// notifications
+func alertMessage(notification notify.Notification) (Message, bool) {
+	data := map[string]string{
+		"type":       notification.Type,
+		"created_at": strconv.FormatInt(notification.CreatedAt, 10),
+	}
+	switch notification.Type {
+	case notify.TypeNewDeviceLogin:
+		body := "Someone signed in to your account from a new device."
+		if country, _ := notification.Details["country"].(string); country != "" {
+			body = fmt.Sprintf("Someone signed in to your account from a new device in %s.", country)
+		}
+		return Message{Title: "New sign-in", Body: body + " If this wasn't you, change your password.", Data: data}, true
+	case notify.TypePasswordChanged:
+		return Message{Title: "Password changed", Body: "Your password was changed. If this wasn't you, reset it now.", Data: data}, true
+	default:
+		return Message{}, false
+	}
+}
@@ -0,0 +1,132 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Hosts of the APNs provider API
+const (
+	apnsProduction  = "https://api.push.apple.com"
+	apnsDevelopment = "https://api.sandbox.push.apple.com"
+)
+
+// apnsTokenLifetime is how long a provider token is reused; Apple rejects tokens
+// older than an hour and throttles refreshing more than every 20 minutes
+const apnsTokenLifetime = 45 * time.Minute
+
+// APNsSender sends through the Apple Push Notification service, authenticated with a
+// token signing key (.p8) of the developer account
+type APNsSender struct {
+	KeyID  string
+	TeamID string
+	// Topic is the bundle ID of the app
+	Topic  string
+	Client *http.Client
+
+	host string
+	key  *ecdsa.PrivateKey
+
+	// mu guards the cached provider token
+	mu       sync.Mutex
+	jwt      string
+	issuedAt time.Time
+}
+
+// NewAPNsSender creates a sender from a PEM-encoded token signing key. Without
+// production, messages go to the development environment of apps built for it.
+func NewAPNsSender(key []byte, keyID, teamID, topic string, production bool, client *http.Client) (*APNsSender, error) {
+	signingKey, err := jwt.ParseECPrivateKeyFromPEM(key)
+	if err != nil {
+		return nil, fmt.Errorf("parse APNs key: %w", err)
+	}
+	host := apnsDevelopment
+	if production {
+		host = apnsProduction
+	}
+	return &APNsSender{KeyID: keyID, TeamID: teamID, Topic: topic, Client: client, host: host, key: signingKey}, nil
+}
+
+// Send sends an alert to a device token
+func (as *APNsSender) Send(ctx context.Context, token string, msg Message) error {
+	providerToken, err := as.providerToken()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]any{
+		"aps": map[string]any{
+			"alert": map[string]string{"title": msg.Title, "body": msg.Body},
+			"sound": "default",
+		},
+	}
+	for key, value := range msg.Data {
+		if key != "aps" {
+			payload[key] = value
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, as.host+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", as.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	resp, err := as.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("apns request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Reason string `json:"reason"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		switch {
+		case resp.StatusCode == http.StatusGone, apiErr.Reason == "BadDeviceToken", apiErr.Reason == "Unregistered":
+			return ErrInvalidToken
+		case apiErr.Reason == "ExpiredProviderToken":
+			as.mu.Lock()
+			as.jwt = ""
+			as.mu.Unlock()
+		}
+		return fmt.Errorf("apns returned status %d: %s", resp.StatusCode, apiErr.Reason)
+	}
+	return nil
+}
+
+// providerToken returns the signed provider token, signing a new one when the cached
+// one is due
+func (as *APNsSender) providerToken() (string, error) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.jwt != "" && time.Since(as.issuedAt) < apnsTokenLifetime {
+		return as.jwt, nil
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": as.TeamID, "iat": now.Unix()})
+	token.Header["kid"] = as.KeyID
+	signed, err := token.SignedString(as.key)
+	if err != nil {
+		return "", fmt.Errorf("sign APNs provider token: %w", err)
+	}
+	as.jwt, as.issuedAt = signed, now
+	return signed, nil
+}
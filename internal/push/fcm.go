@@ -0,0 +1,174 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fcmAPI is the base URL of the Firebase Cloud Messaging HTTP v1 API
+const fcmAPI = "https://fcm.googleapis.com/v1/projects/"
+
+// fcmScope is the OAuth scope of sending messages
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// FCMSender sends through the Firebase Cloud Messaging HTTP v1 API, authorized as a
+// service account of the Firebase project
+type FCMSender struct {
+	ProjectID string
+	Client    *http.Client
+
+	email    string
+	tokenURI string
+	key      *rsa.PrivateKey
+
+	// mu guards the cached OAuth access token
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCMSender creates a sender from a service account key file. projectID defaults to
+// the project of the service account.
+func NewFCMSender(credentials []byte, projectID string, client *http.Client) (*FCMSender, error) {
+	var account struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(credentials, &account); err != nil {
+		return nil, fmt.Errorf("parse FCM service account: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" || account.TokenURI == "" {
+		return nil, errors.New("FCM service account lacks client_email, private_key or token_uri")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("parse FCM service account key: %w", err)
+	}
+	if projectID == "" {
+		projectID = account.ProjectID
+	}
+	return &FCMSender{
+		ProjectID: projectID,
+		Client:    client,
+		email:     account.ClientEmail,
+		tokenURI:  account.TokenURI,
+		key:       key,
+	}, nil
+}
+
+// Send sends a message to a registration token
+func (fs *FCMSender) Send(ctx context.Context, token string, msg Message) error {
+	accessToken, err := fs.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]any{"message": map[string]any{
+		"token":        token,
+		"notification": map[string]string{"title": msg.Title, "body": msg.Body},
+		"data":         msg.Data,
+	}}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	endpoint := fcmAPI + url.PathEscape(fs.ProjectID) + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := fs.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fcm request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+				Details []struct {
+					ErrorCode string `json:"errorCode"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		for _, detail := range apiErr.Error.Details {
+			if detail.ErrorCode == "UNREGISTERED" {
+				return ErrInvalidToken
+			}
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return ErrInvalidToken
+		}
+		return fmt.Errorf("fcm returned status %d: %s %s", resp.StatusCode, apiErr.Error.Status, apiErr.Error.Message)
+	}
+	return nil
+}
+
+// token returns an OAuth access token of the service account, exchanging a signed
+// assertion for a new one shortly before the cached one expires
+func (fs *FCMSender) token(ctx context.Context) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.accessToken != "" && time.Until(fs.expiresAt) > time.Minute {
+		return fs.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   fs.email,
+		"scope": fcmScope,
+		"aud":   fs.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(fs.key)
+	if err != nil {
+		return "", fmt.Errorf("sign FCM token request: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fs.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := fs.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fcm token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode >= 300 || result.AccessToken == "" {
+		return "", fmt.Errorf("fcm token request returned status %d: %s", resp.StatusCode, result.Error)
+	}
+	fs.accessToken = result.AccessToken
+	fs.expiresAt = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return fs.accessToken, nil
+}
@@ -0,0 +1,88 @@
+// Package push sends push notifications, such as security alerts, to the app
+// installations users registered.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+)
+
+// ErrInvalidToken is returned when the provider no longer accepts a device token,
+// e.g. because the app was uninstalled
+var ErrInvalidToken = errors.New("device token is no longer valid")
+
+// Message is a push notification
+type Message struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	// Data is handed to the app with the notification
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// Sender delivers a message to a device token of the provider
+type Sender interface {
+	Send(ctx context.Context, token string, msg Message) error
+}
+
+// NewSender creates the sender selected by cfg.Provider
+func NewSender(cfg config.PushConfig) (Sender, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	switch cfg.Provider {
+	case "log":
+		return LogSender{}, nil
+	case "fcm":
+		credentials, err := os.ReadFile(cfg.FCMCredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("read FCM credentials: %w", err)
+		}
+		return NewFCMSender(credentials, cfg.FCMProjectID, client)
+	case "apns":
+		key, err := os.ReadFile(cfg.APNsKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read APNs key: %w", err)
+		}
+		return NewAPNsSender(key, cfg.APNsKeyID, cfg.APNsTeamID, cfg.APNsTopic, cfg.APNsProduction, client)
+	default:
+		return nil, fmt.Errorf("unknown push provider %q", cfg.Provider)
+	}
+}
+
+// LogSender writes messages to the application log instead of sending them.
+// It is meant for local development.
+type LogSender struct{}
+
+// Send logs the message
+func (LogSender) Send(ctx context.Context, token string, msg Message) error {
+	logging.Info(ctx, "push message", "token", token, "title", msg.Title, "body", msg.Body, "data", msg.Data)
+	return nil
+}
+
+// forgetfulSender drops the devices whose tokens the provider rejects
+type forgetfulSender struct {
+	Sender
+	devices repository.DeviceRepository
+}
+
+// ForgetInvalidTokens returns a sender that removes the device of a token the
+// provider no longer accepts instead of failing
+func ForgetInvalidTokens(sender Sender, devices repository.DeviceRepository) Sender {
+	return &forgetfulSender{Sender: sender, devices: devices}
+}
+
+// Send sends the message, removing the device if its token is invalid
+func (s *forgetfulSender) Send(ctx context.Context, token string, msg Message) error {
+	err := s.Sender.Send(ctx, token, msg)
+	if !errors.Is(err, ErrInvalidToken) {
+		return err
+	}
+	logging.Info(ctx, "removing push device with invalid token")
+	return s.devices.DeleteToken(ctx, token)
+}
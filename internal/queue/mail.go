@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ristep/um_starter_jwt_go/internal/mail"
+)
+
+// KindEmail is the kind of jobs that send an email
+const KindEmail = "email"
+
+// emailPayload is the payload of an email job
+type emailPayload struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// MailSender queues emails instead of sending them right away. Delivery errors
+// surface in the job, not to the caller.
+type MailSender struct {
+	queue *Queue
+}
+
+// NewMailSender creates a mail.Sender that queues emails as jobs
+func NewMailSender(q *Queue) *MailSender {
+	return &MailSender{queue: q}
+}
+
+// Send queues an email
+func (ms *MailSender) Send(ctx context.Context, to, subject, body string) error {
+	return ms.queue.Enqueue(ctx, KindEmail, emailPayload{To: to, Subject: subject, Body: body})
+}
+
+// HandleEmail returns the handler that sends queued emails with sender
+func HandleEmail(sender mail.Sender) Handler {
+	return func(ctx context.Context, payload []byte) error {
+		var email emailPayload
+		if err := json.Unmarshal(payload, &email); err != nil {
+			return err
+		}
+		return sender.Send(ctx, email.To, email.Subject, email.Body)
+	}
+}
@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ristep/um_starter_jwt_go/internal/push"
+)
+
+// KindPush is the kind of jobs that send a push notification
+const KindPush = "push"
+
+// pushPayload is the payload of a push job
+type pushPayload struct {
+	Token   string       `json:"token"`
+	Message push.Message `json:"message"`
+}
+
+// PushSender queues push notifications instead of sending them right away. Delivery
+// errors surface in the job, not to the caller.
+type PushSender struct {
+	queue *Queue
+}
+
+// NewPushSender creates a push.Sender that queues notifications as jobs
+func NewPushSender(q *Queue) *PushSender {
+	return &PushSender{queue: q}
+}
+
+// Send queues a push notification
+func (ps *PushSender) Send(ctx context.Context, token string, msg push.Message) error {
+	return ps.queue.Enqueue(ctx, KindPush, pushPayload{Token: token, Message: msg})
+}
+
+// HandlePush returns the handler that sends queued push notifications with sender
+func HandlePush(sender push.Sender) Handler {
+	return func(ctx context.Context, payload []byte) error {
+		var job pushPayload
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return err
+		}
+		return sender.Send(ctx, job.Token, job.Message)
+	}
+}
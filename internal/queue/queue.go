@@ -0,0 +1,252 @@
+// Package queue runs background jobs, such as sending emails, outside the request
+// that created them. Jobs are kept in the database, so every instance works on the
+// same queue and queued jobs survive restarts. A job runs at least once: failed
+// attempts are retried with backoff, and jobs out of attempts are kept as failed
+// for an admin to retry or discard.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// maxRetryDelay caps the backoff between attempts
+const maxRetryDelay = time.Hour
+
+// Errors returned by Retry and Discard
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobNotFailed = errors.New("job has not failed")
+)
+
+// Handler performs a job given its JSON payload
+type Handler func(ctx context.Context, payload []byte) error
+
+// Queue stores jobs and runs them with the handlers registered for their kind
+type Queue struct {
+	db       *gorm.DB
+	cfg      config.QueueConfig
+	handlers map[string]Handler
+	// wake tells idle workers of this instance about a new job
+	wake chan struct{}
+}
+
+// New creates a queue backed by the jobs table
+func New(db *gorm.DB, cfg config.QueueConfig) *Queue {
+	return &Queue{db: db, cfg: cfg, handlers: make(map[string]Handler), wake: make(chan struct{}, 1)}
+}
+
+// Handle registers the handler for jobs of a kind. Register every handler before Run.
+func (q *Queue) Handle(kind string, handler Handler) {
+	q.handlers[kind] = handler
+}
+
+// Enqueue stores a job of the given kind to run as soon as a worker is free
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode %s job: %w", kind, err)
+	}
+	job := models.Job{
+		Kind:        kind,
+		Payload:     string(data),
+		State:       models.JobPending,
+		MaxAttempts: q.cfg.MaxAttempts,
+		RunAt:       time.Now().UnixMilli(),
+	}
+	if err := q.db.WithContext(ctx).Create(&job).Error; err != nil {
+		return fmt.Errorf("enqueue %s job: %w", kind, err)
+	}
+
+	q.notify()
+	return nil
+}
+
+// notify wakes an idle worker of this instance, if any
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run starts the workers and blocks until ctx is cancelled and they have stopped.
+// A job being run when ctx is cancelled is allowed to finish.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range q.cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work runs jobs until ctx is cancelled, waiting for new ones whenever the queue is empty
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := q.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			logging.Error(ctx, "failed to claim job", "error", err)
+		}
+		if job != nil {
+			q.run(context.WithoutCancel(ctx), job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim takes the next due job and leases it for one attempt. Running jobs whose
+// lease ran out belong to a crashed worker and are taken over.
+func (q *Queue) claim(ctx context.Context) (*models.Job, error) {
+	now := time.Now()
+	var jobs []models.Job
+	err := q.db.WithContext(ctx).Raw(`UPDATE jobs SET state = ?, attempts = attempts + 1, run_at = ?, updated_at = ?
+		WHERE id = (
+			SELECT id FROM jobs WHERE state IN (?, ?) AND run_at <= ?
+			ORDER BY run_at LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		models.JobRunning, now.Add(q.cfg.JobTimeout).UnixMilli(), now.UnixMilli(),
+		models.JobPending, models.JobRunning, now.UnixMilli(),
+	).Scan(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// run performs one attempt of a claimed job and records the outcome
+func (q *Queue) run(ctx context.Context, job *models.Job) {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		q.fail(ctx, job, fmt.Errorf("no handler for %s jobs", job.Kind), true)
+		return
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, q.cfg.JobTimeout)
+	err := handler(attemptCtx, []byte(job.Payload))
+	cancel()
+	if err != nil {
+		q.fail(ctx, job, err, job.Attempts >= job.MaxAttempts)
+		return
+	}
+
+	// Only delete the job if its lease wasn't taken over meanwhile
+	err = q.db.WithContext(ctx).Where("id = ? AND state = ? AND attempts = ?", job.ID, models.JobRunning, job.Attempts).
+		Delete(&models.Job{}).Error
+	if err != nil {
+		logging.Error(ctx, "failed to delete finished job", "job_id", job.ID, "kind", job.Kind, "error", err)
+	}
+}
+
+// fail records a failed attempt and schedules a retry, or marks the job as failed
+// when final is set
+func (q *Queue) fail(ctx context.Context, job *models.Job, cause error, final bool) {
+	updates := map[string]any{"last_error": cause.Error()}
+	if final {
+		updates["state"] = models.JobFailed
+		logging.Error(ctx, "job failed", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "error", cause)
+	} else {
+		updates["state"] = models.JobPending
+		updates["run_at"] = time.Now().Add(q.retryDelay(job.Attempts)).UnixMilli()
+		logging.Warn(ctx, "job attempt failed", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "error", cause)
+	}
+
+	err := q.db.WithContext(ctx).Model(&models.Job{}).
+		Where("id = ? AND state = ? AND attempts = ?", job.ID, models.JobRunning, job.Attempts).
+		Updates(updates).Error
+	if err != nil {
+		logging.Error(ctx, "failed to record job failure", "job_id", job.ID, "kind", job.Kind, "error", err)
+	}
+}
+
+// retryDelay is the wait after the given number of attempts
+func (q *Queue) retryDelay(attempts int) time.Duration {
+	delay := q.cfg.RetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// List returns a page of the jobs in a state, of one kind unless kind is empty, newest
+// first, and the number of jobs matching
+func (q *Queue) List(ctx context.Context, state, kind string, offset, limit int) ([]models.Job, int64, error) {
+	filter := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("state = ?", state)
+		if kind != "" {
+			db = db.Where("kind = ?", kind)
+		}
+		return db
+	}
+
+	var total int64
+	if err := q.db.WithContext(ctx).Model(&models.Job{}).Scopes(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	jobs := []models.Job{}
+	err := q.db.WithContext(ctx).Scopes(filter).Order("id DESC").Offset(offset).Limit(limit).Find(&jobs).Error
+	return jobs, total, err
+}
+
+// Retry gives a failed job a fresh set of attempts
+func (q *Queue) Retry(ctx context.Context, id uint) error {
+	err := q.updateFailed(ctx, id, func(db *gorm.DB) error {
+		return db.Updates(map[string]any{
+			"state":    models.JobPending,
+			"attempts": 0,
+			"run_at":   time.Now().UnixMilli(),
+		}).Error
+	})
+	if err == nil {
+		q.notify()
+	}
+	return err
+}
+
+// Discard deletes a failed job
+func (q *Queue) Discard(ctx context.Context, id uint) error {
+	return q.updateFailed(ctx, id, func(db *gorm.DB) error {
+		return db.Delete(&models.Job{}).Error
+	})
+}
+
+// updateFailed applies change to the job if it has failed
+func (q *Queue) updateFailed(ctx context.Context, id uint, change func(*gorm.DB) error) error {
+	return q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var job models.Job
+		if err := tx.First(&job, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrJobNotFound
+			}
+			return err
+		}
+		if job.State != models.JobFailed {
+			return ErrJobNotFailed
+		}
+		return change(tx.Model(&models.Job{}).Where("id = ? AND state = ?", id, models.JobFailed))
+	})
+}
@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// FallbackStore counts in a shared store, usually Redis, and in a MemoryStore of its
+// own while the shared one fails. Limits then hold per instance during an outage
+// instead of being lifted.
+type FallbackStore struct {
+	shared Store
+	local  *MemoryStore
+}
+
+// NewFallbackStore creates a store falling back to in-process counts when shared fails
+func NewFallbackStore(shared Store) *FallbackStore {
+	return &FallbackStore{shared: shared, local: NewMemoryStore()}
+}
+
+// Hit counts a request for key
+func (fs *FallbackStore) Hit(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	count, reset, err := fs.shared.Hit(ctx, key, window)
+	if err == nil {
+		return count, reset, nil
+	}
+	logging.Warn(ctx, "shared rate limit store failed, counting locally", "key", key, "error", err)
+	return fs.local.Hit(ctx, key, window)
+}
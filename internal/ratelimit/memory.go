@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// counter is the count of one key in its current window
+type counter struct {
+	count   int64
+	resetAt time.Time
+}
+
+// MemoryStore is a Store kept by a single instance; each instance counts the requests
+// it serves on its own
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	// sweepAt is when finished windows are next dropped
+	sweepAt time.Time
+}
+
+// NewMemoryStore creates an in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]*counter)}
+}
+
+// Hit counts a request for key
+func (ms *MemoryStore) Hit(_ context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	if now.After(ms.sweepAt) {
+		for k, c := range ms.counters {
+			if !now.Before(c.resetAt) {
+				delete(ms.counters, k)
+			}
+		}
+		ms.sweepAt = now.Add(window)
+	}
+
+	c, ok := ms.counters[key]
+	if !ok || !now.Before(c.resetAt) {
+		c = &counter{resetAt: now.Add(window)}
+		ms.counters[key] = c
+	}
+	c.count++
+	return c.count, c.resetAt.Sub(now), nil
+}
@@ -0,0 +1,150 @@
+// Package ratelimit counts requests per caller in fixed windows. Callers belong to a
+// tier that sets their limit: anonymous callers by IP, signed-in users by their roles
+// and integrations by their API key. A Throttle counts actions such as sending emails
+// the same way.
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// Built-in tiers
+const (
+	TierAnonymous = "anonymous"
+	TierUser      = "user"
+)
+
+// Store counts requests per key
+type Store interface {
+	// Hit counts a request for key and returns the requests so far in the current
+	// window, and how long until the window ends
+	Hit(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+}
+
+// Caller is who a request counts against
+type Caller struct {
+	// Key identifies the caller within the store
+	Key  string
+	Tier string
+}
+
+// Result describes a caller's quota after a request
+type Result struct {
+	Limit     int64
+	Remaining int64
+	// Reset is how long until the quota is restored
+	Reset time.Duration
+}
+
+// Policy sets the limit of each tier
+type Policy struct {
+	// Enabled turns limiting on; a disabled policy lets every request through
+	Enabled bool
+	Window  time.Duration
+	// Limits allows Limits[tier] requests per window; tiers without a limit, or a
+	// limit of 0, are unlimited
+	Limits map[string]int64
+	// APIKeys maps SHA-256 hashes (hex) of API keys to their tier
+	APIKeys map[string]string
+}
+
+// Limiter enforces the limit of each tier. Store errors are logged and the request
+// allowed, so an outage never takes the API down.
+type Limiter struct {
+	store  Store
+	policy atomic.Pointer[Policy]
+}
+
+// NewLimiter creates a limiter counting requests in store according to policy
+func NewLimiter(store Store, policy Policy) *Limiter {
+	l := &Limiter{store: store}
+	l.Update(policy)
+	return l
+}
+
+// Update replaces the policy; in-flight requests keep the previous one. Counts carry
+// over, so a changed window applies once the current one ends.
+func (l *Limiter) Update(policy Policy) {
+	l.policy.Store(&policy)
+}
+
+// Enabled reports whether requests are being limited
+func (l *Limiter) Enabled() bool {
+	return l.policy.Load().Enabled
+}
+
+// Tiers returns the names of the configured tiers, sorted
+func (l *Limiter) Tiers() []string {
+	return slices.Sorted(maps.Keys(l.policy.Load().Limits))
+}
+
+// IP returns the anonymous caller with the given IP
+func (l *Limiter) IP(ip string) Caller {
+	return Caller{Key: "ip:" + ip, Tier: TierAnonymous}
+}
+
+// User returns the caller for a signed-in user. The tier is the most generous of
+// those named after the user's roles, and the user tier if there is none.
+func (l *Limiter) User(userID uint, roles []string) Caller {
+	limits := l.policy.Load().Limits
+	caller := Caller{Key: "user:" + strconv.FormatUint(uint64(userID), 10), Tier: TierUser}
+	for _, role := range roles {
+		limit, ok := limits[role]
+		if ok && moreGenerous(limits, limit, caller.Tier) {
+			caller.Tier = role
+		}
+	}
+	return caller
+}
+
+// APIKey returns the caller for an API key; ok is false for unknown keys
+func (l *Limiter) APIKey(key string) (caller Caller, ok bool) {
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+	tier, ok := l.policy.Load().APIKeys[hash]
+	if !ok {
+		return Caller{}, false
+	}
+	// A prefix of the hash is enough to tell keys apart
+	return Caller{Key: "key:" + hash[:16], Tier: tier}, true
+}
+
+// ManagedKey returns the caller for an API key kept in the database
+func (l *Limiter) ManagedKey(id uint, tier string) Caller {
+	return Caller{Key: "apikey:" + strconv.FormatUint(uint64(id), 10), Tier: tier}
+}
+
+// moreGenerous reports whether limit allows more than the limit of tier
+func moreGenerous(limits map[string]int64, limit int64, tier string) bool {
+	current, ok := limits[tier]
+	if !ok || current == 0 {
+		return false
+	}
+	return limit == 0 || limit > current
+}
+
+// Allow counts a request from caller and reports whether it is within the limit.
+// Unlimited callers, and every caller while the limiter is disabled, get a zero Result.
+func (l *Limiter) Allow(ctx context.Context, caller Caller) (Result, bool) {
+	policy := l.policy.Load()
+	limit := policy.Limits[caller.Tier]
+	if !policy.Enabled || limit == 0 {
+		return Result{}, true
+	}
+
+	count, reset, err := l.store.Hit(ctx, caller.Key, policy.Window)
+	if err != nil {
+		logging.Warn(ctx, "failed to count request for rate limiting", "caller", caller.Key, "error", err)
+		return Result{}, true
+	}
+	return Result{Limit: limit, Remaining: max(limit-count, 0), Reset: reset}, count <= limit
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix prefixes the Redis keys of request counts
+const keyPrefix = "um:ratelimit:"
+
+// hitScript increments a count, starting its window on the first request, and
+// returns the count and the milliseconds left in the window
+var hitScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {count, redis.call('PTTL', KEYS[1])}
+`)
+
+// RedisStore is a Store shared by all instances, so a caller's requests add up
+// whichever instance serves them
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a Redis-backed store
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Hit counts a request for key
+func (rs *RedisStore) Hit(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	values, err := hitScript.Run(ctx, rs.client, []string{keyPrefix + key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return values[0], time.Duration(max(values[1], 0)) * time.Millisecond, nil
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// Limit allows Count events per Window; a Count of 0 is unlimited
+type Limit struct {
+	Count  int64
+	Window time.Duration
+}
+
+// Throttle caps how often an action happens for a subject, e.g. how many emails are
+// sent to an account, under several limits at once. Like Limiter it allows the action
+// when the store fails.
+type Throttle struct {
+	store  Store
+	name   string
+	limits []Limit
+}
+
+// NewThrottle creates a throttle; name keeps its counts apart from those of other
+// throttles sharing the store
+func NewThrottle(store Store, name string, limits ...Limit) *Throttle {
+	return &Throttle{store: store, name: name, limits: limits}
+}
+
+// UserKey is the throttle key of a user
+func UserKey(userID uint) string {
+	return "user:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// IPKey is the throttle key of a client IP
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// EmailKey is the throttle key of an email address, for mail sent before there is an
+// account
+func EmailKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+// Allow counts the action against each key, e.g. the account and the client IP, and
+// reports whether every key is within every limit. When not, wait is how long until
+// the action is allowed again. A nil throttle allows everything.
+func (t *Throttle) Allow(ctx context.Context, keys ...string) (wait time.Duration, ok bool) {
+	if t == nil {
+		return 0, true
+	}
+	ok = true
+	for _, key := range keys {
+		for _, limit := range t.limits {
+			if limit.Count == 0 {
+				continue
+			}
+			count, reset, err := t.store.Hit(ctx, "throttle:"+t.name+":"+strconv.FormatInt(limit.Window.Milliseconds(), 10)+":"+key, limit.Window)
+			if err != nil {
+				logging.Warn(ctx, "failed to count action for throttling", "throttle", t.name, "key", key, "error", err)
+				continue
+			}
+			if count > limit.Count {
+				ok = false
+				wait = max(wait, reset)
+			}
+		}
+	}
+	return wait, ok
+}
@@ -0,0 +1,91 @@
+package redact
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+// Handler is a slog.Handler masking sensitive data in messages and attributes
+// before passing records on
+type Handler struct {
+	next slog.Handler
+	r    *Redactor
+}
+
+// NewHandler wraps next with redaction
+func NewHandler(next slog.Handler, r *Redactor) *Handler {
+	return &Handler{next: next, r: r}
+}
+
+// Enabled defers to the wrapped handler
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle redacts the record and passes it on
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, h.r.String(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+// WithAttrs redacts the attributes once, when they are added
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.attr(a)
+	}
+	return &Handler{next: h.next.WithAttrs(redacted), r: h.r}
+}
+
+// WithGroup defers to the wrapped handler
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name), r: h.r}
+}
+
+// attr masks an attribute: strings under sensitive keys whole, and sensitive data
+// in other strings, errors and values
+func (h *Handler) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		if sensitive(a.Key) {
+			return slog.String(a.Key, Mask)
+		}
+		return slog.String(a.Key, h.r.String(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = h.attr(member)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		switch value := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, h.r.String(value.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, h.r.String(value.String()))
+		case []byte:
+			return slog.String(a.Key, h.r.String(string(value)))
+		default:
+			// Values are logged as JSON, so look at what would be written
+			data, err := json.Marshal(value)
+			if err != nil {
+				return slog.Attr{Key: a.Key, Value: v}
+			}
+			if redacted := h.r.String(string(data)); redacted != string(data) {
+				if !json.Valid([]byte(redacted)) {
+					return slog.String(a.Key, redacted)
+				}
+				return slog.Any(a.Key, json.RawMessage(redacted))
+			}
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
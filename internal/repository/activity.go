@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// GormActivityRepository is an ActivityRepository backed by the activities table
+type GormActivityRepository struct {
+	db *gorm.DB
+}
+
+// NewGormActivityRepository creates a database-backed activity repository
+func NewGormActivityRepository(db *gorm.DB) *GormActivityRepository {
+	return &GormActivityRepository{db: db}
+}
+
+// Add records an event
+func (r *GormActivityRepository) Add(ctx context.Context, event *models.Activity) error {
+	if event.Details == nil {
+		event.Details = models.Metadata{}
+	}
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+// List returns a page of the user's events, newest first
+func (r *GormActivityRepository) List(ctx context.Context, userID uint, offset, limit int) ([]models.Activity, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.Activity{}).Where("user_id = ?", userID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	events := []models.Activity{}
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&events).Error
+	return events, total, err
+}
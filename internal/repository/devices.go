@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// MaxDevices is how many push devices a user keeps; registering another drops the
+// one registered or refreshed longest ago
+const MaxDevices = 20
+
+// GormDeviceRepository is a DeviceRepository backed by the push_devices table
+type GormDeviceRepository struct {
+	db *gorm.DB
+}
+
+// NewGormDeviceRepository creates a database-backed device repository
+func NewGormDeviceRepository(db *gorm.DB) *GormDeviceRepository {
+	return &GormDeviceRepository{db: db}
+}
+
+// Register stores a device, or takes over the one with the same token
+func (r *GormDeviceRepository) Register(ctx context.Context, device *models.PushDevice) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "token"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "name", "updated_at"}),
+		}).Create(device).Error
+		if err != nil {
+			return err
+		}
+		// Read back the registration time and ID of a device taken over
+		var stored models.PushDevice
+		if err := tx.Where("token = ?", device.Token).First(&stored).Error; err != nil {
+			return err
+		}
+		*device = stored
+
+		var stale []uint
+		if err := tx.Model(&models.PushDevice{}).Where("user_id = ?", device.UserID).
+			Order("updated_at DESC, id DESC").Offset(MaxDevices).Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+		return tx.Where("id IN ?", stale).Delete(&models.PushDevice{}).Error
+	})
+}
+
+// List returns the user's devices, most recently registered first
+func (r *GormDeviceRepository) List(ctx context.Context, userID uint) ([]models.PushDevice, error) {
+	devices := []models.PushDevice{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("updated_at DESC, id DESC").Find(&devices).Error
+	return devices, err
+}
+
+// Delete removes a device of the user; ErrNotFound is returned if there is none
+func (r *GormDeviceRepository) Delete(ctx context.Context, userID, deviceID uint) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", deviceID, userID).Delete(&models.PushDevice{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteToken removes the device with a token, if any
+func (r *GormDeviceRepository) DeleteToken(ctx context.Context, token string) error {
+	return r.db.WithContext(ctx).Where("token = ?", token).Delete(&models.PushDevice{}).Error
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// GormNoteRepository is a NoteRepository backed by the admin_notes table
+type GormNoteRepository struct {
+	db *gorm.DB
+}
+
+// NewGormNoteRepository creates a database-backed note repository
+func NewGormNoteRepository(db *gorm.DB) *GormNoteRepository {
+	return &GormNoteRepository{db: db}
+}
+
+// Create stores a note and fills in its author
+func (r *GormNoteRepository) Create(ctx context.Context, note *models.AdminNote) error {
+	if err := r.db.WithContext(ctx).Create(note).Error; err != nil {
+		return err
+	}
+	return r.withAuthors(ctx, []*models.AdminNote{note})
+}
+
+// List returns a page of the user's notes with their authors, newest first
+func (r *GormNoteRepository) List(ctx context.Context, userID uint, offset, limit int) ([]models.AdminNote, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.AdminNote{}).Where("user_id = ?", userID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	notes := []models.AdminNote{}
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&notes).Error; err != nil {
+		return nil, 0, err
+	}
+	refs := make([]*models.AdminNote, len(notes))
+	for i := range notes {
+		refs[i] = &notes[i]
+	}
+	return notes, total, r.withAuthors(ctx, refs)
+}
+
+// Delete removes a note of the user; ErrNotFound is returned if there is none
+func (r *GormNoteRepository) Delete(ctx context.Context, userID, noteID uint) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", noteID, userID).Delete(&models.AdminNote{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// withAuthors fills in the authors of notes, including deleted ones
+func (r *GormNoteRepository) withAuthors(ctx context.Context, notes []*models.AdminNote) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(notes))
+	for i, note := range notes {
+		ids[i] = note.AuthorID
+	}
+	var authors []models.NoteAuthor
+	if err := r.db.WithContext(ctx).Unscoped().Model(&models.User{}).
+		Select("id", "email", "name").Where("id IN ?", ids).Find(&authors).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]*models.NoteAuthor, len(authors))
+	for i := range authors {
+		byID[authors[i].ID] = &authors[i]
+	}
+	for _, note := range notes {
+		note.Author = byID[note.AuthorID]
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// Package repository holds the storage of users, roles and the short-lived tokens
+// and codes issued to them behind interfaces, so handlers and middleware don't embed
+// query logic and storage can be swapped or mocked. The Gorm implementations are the
+// ones the API uses.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ristep/um_starter_jwt_go/internal/filter"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// Errors returned by the repositories
+var (
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict means the record changed since it was read
+	ErrConflict = errors.New("record was modified concurrently")
+)
+
+// UserQuery selects a page of the user list
+type UserQuery struct {
+	// Metadata filters on metadata values, compared as text
+	Metadata []MetadataFilter
+	// Tags only matches users carrying every one of these tags
+	Tags []string
+	// Filter is a compiled filter expression, see UserFilterSchema
+	Filter *filter.Condition
+	Offset int
+	Limit  int
+}
+
+// TagCount is a tag in use and the number of users carrying it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Users int64  `json:"users"`
+}
+
+// MetadataFilter matches users whose metadata value at Path equals Value
+type MetadataFilter struct {
+	Path  []string // Keys leading to the value, e.g. address, city
+	Value string
+}
+
+// UserRepository stores users, their consents and their login history
+type UserRepository interface {
+	// FindByID loads a user with roles; ErrNotFound is returned for unknown IDs
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+	// FindByIDFromReplica is FindByID served by a read replica, for paths that
+	// tolerate replication lag
+	FindByIDFromReplica(ctx context.Context, id uint) (*models.User, error)
+	// FindByEmail loads the user with an email, with roles
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// FindByUsername loads the user with a (normalized) username, with roles
+	FindByUsername(ctx context.Context, username string) (*models.User, error)
+	// UsernameTaken reports whether a (normalized) username belongs to any account,
+	// including deleted ones
+	UsernameTaken(ctx context.Context, username string) (bool, error)
+	// List returns a page of users with roles, ordered by ID, and the number of
+	// users matching the query
+	List(ctx context.Context, query UserQuery) ([]models.User, int64, error)
+
+	// Create stores a new user with its roles, and the consents given at sign-up
+	Create(ctx context.Context, user *models.User, consents []models.Consent) error
+	// SaveProfile writes the editable profile fields and bumps the version. ErrConflict
+	// is returned if the user was updated since it was read.
+	SaveProfile(ctx context.Context, user *models.User) error
+	// SetAvatar records the URL and storage key of the user's avatar
+	SetAvatar(ctx context.Context, user *models.User, url, key string) error
+	// SetMetadata replaces the user's metadata
+	SetMetadata(ctx context.Context, user *models.User, metadata models.Metadata) error
+	// SetPreferences sets the user's time zone and locale
+	SetPreferences(ctx context.Context, user *models.User, timezone, locale string) error
+	// AddTag puts a tag on the user; tags already present are kept once
+	AddTag(ctx context.Context, user *models.User, tag string) error
+	// RemoveTag takes a tag off the user
+	RemoveTag(ctx context.Context, user *models.User, tag string) error
+	// TagCounts returns the tags on users, in name order, with how many users carry each
+	TagCounts(ctx context.Context) ([]TagCount, error)
+	// ResetPassword sets a new password and revokes the user's tokens
+	ResetPassword(ctx context.Context, user *models.User, password string) error
+	// Suspend blocks the user from logging in and revokes their tokens
+	Suspend(ctx context.Context, user *models.User, reason string) error
+	// Unsuspend lets the user log in again
+	Unsuspend(ctx context.Context, user *models.User) error
+	// Delete soft-deletes the user
+	Delete(ctx context.Context, user *models.User) error
+
+	// SetTOTPSecret stores a new authenticator secret, not yet enabled
+	SetTOTPSecret(ctx context.Context, userID uint, secret string) error
+	// SetTOTPEnabled turns two-factor authentication on or off; off forgets the secret
+	SetTOTPEnabled(ctx context.Context, userID uint, enabled bool) error
+	// UseTOTPStep records the time step of an accepted authenticator code. It reports
+	// false when that step or a later one was used already.
+	UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error)
+
+	// RecordActivity notes that the user just signed in or refreshed a session
+	RecordActivity(ctx context.Context, userID uint) error
+	// RecordLogin adds an entry to the user's login history
+	RecordLogin(ctx context.Context, event *models.LoginEvent) error
+	// LoginHistory returns a page of the user's login history, newest first, and the
+	// number of entries
+	LoginHistory(ctx context.Context, userID uint, offset, limit int) ([]models.LoginEvent, int64, error)
+	// Consents returns the user's consent history, newest first
+	Consents(ctx context.Context, userID uint) ([]models.Consent, error)
+	// AddConsent records the acceptance of a document version
+	AddConsent(ctx context.Context, record *models.Consent) error
+}
+
+// RoleRepository stores roles and their assignment to users
+type RoleRepository interface {
+	// FindOrCreate returns the role with a name, creating it if needed
+	FindOrCreate(ctx context.Context, name string) (*models.Role, error)
+	// Assign gives the user a role
+	Assign(ctx context.Context, user *models.User, role *models.Role) error
+	// Remove takes a role from the user
+	Remove(ctx context.Context, user *models.User, role *models.Role) error
+}
+
+// ActivityRepository stores the account activity feeds of users
+type ActivityRepository interface {
+	// Add records an event
+	Add(ctx context.Context, event *models.Activity) error
+	// List returns a page of the user's events, newest first, and the number of events
+	List(ctx context.Context, userID uint, offset, limit int) ([]models.Activity, int64, error)
+}
+
+// NoteRepository stores the notes admins attach to users
+type NoteRepository interface {
+	// Create stores a note and fills in its author
+	Create(ctx context.Context, note *models.AdminNote) error
+	// List returns a page of the user's notes with their authors, newest first, and
+	// the number of notes
+	List(ctx context.Context, userID uint, offset, limit int) ([]models.AdminNote, int64, error)
+	// Delete removes a note of the user; ErrNotFound is returned if there is none
+	Delete(ctx context.Context, userID, noteID uint) error
+}
+
+// DeviceRepository stores the app installations users registered for push notifications
+type DeviceRepository interface {
+	// Register stores a device, or updates the one with the same token, which then
+	// belongs to the user. Users keep their MaxDevices most recently registered devices.
+	Register(ctx context.Context, device *models.PushDevice) error
+	// List returns the user's devices, most recently registered first
+	List(ctx context.Context, userID uint) ([]models.PushDevice, error)
+	// Delete removes a device of the user; ErrNotFound is returned if there is none
+	Delete(ctx context.Context, userID, deviceID uint) error
+	// DeleteToken removes the device with a token, e.g. one the provider no longer
+	// accepts
+	DeleteToken(ctx context.Context, token string) error
+}
+
+// TokenRepository stores the one-time tokens and codes sent to users and revokes the
+// tokens issued to them. Refresh tokens live in a sessions.Store.
+type TokenRepository interface {
+	// RevokeAll invalidates every access and refresh token issued to the user
+	RevokeAll(ctx context.Context, user *models.User) error
+
+	// CountRecentLoginConfirmations counts the unconfirmed login confirmations
+	// requested for the user from an IP since a time (Unix ms)
+	CountRecentLoginConfirmations(ctx context.Context, userID uint, ip string, since int64) (int64, error)
+	// CreateLoginConfirmation stores a login confirmation, dropping the user's expired ones
+	CreateLoginConfirmation(ctx context.Context, confirmation *models.LoginConfirmation) error
+	// DeleteLoginConfirmation removes a login confirmation
+	DeleteLoginConfirmation(ctx context.Context, confirmation *models.LoginConfirmation) error
+	// ConfirmLogin marks the unexpired confirmation with a token hash confirmed and
+	// extends it to expiresAt. It reports false when no confirmation matches.
+	ConfirmLogin(ctx context.Context, tokenHash string, expiresAt int64) (bool, error)
+	// UseLoginConfirmation consumes a confirmed, unexpired confirmation of a login by
+	// the user from an IP, and reports whether there was one
+	UseLoginConfirmation(ctx context.Context, userID uint, ip string) (bool, error)
+
+	// CreateOneTimeToken stores a one-time token
+	CreateOneTimeToken(ctx context.Context, token *models.OneTimeToken) error
+	// UseOneTimeToken marks the unused, unexpired token with a purpose and hash used
+	// and returns it. ErrNotFound is returned when no token matches.
+	UseOneTimeToken(ctx context.Context, purpose, tokenHash string) (*models.OneTimeToken, error)
+	// DeleteExpiredOneTimeTokens removes the tokens that expired before a time (Unix
+	// ms), used or not, and returns how many there were
+	DeleteExpiredOneTimeTokens(ctx context.Context, before int64) (int64, error)
+
+	// ChangeEmail replaces the user's email with one the user confirmed, which is then
+	// verified, and stores the email_revert token the previous address can revert the
+	// change with, in one transaction. ErrConflict is returned if the user was updated since it was read.
+	ChangeEmail(ctx context.Context, user *models.User, email string, flagged bool, revert *models.OneTimeToken) error
+	// RevertEmailChange uses the email_revert token with a hash, restores the previous
+	// email it holds, unless another account took it meanwhile, and suspends the user
+	// with reason. The user's other revert tokens are dropped. ErrNotFound is returned
+	// when no token matches.
+	RevertEmailChange(ctx context.Context, tokenHash, reason string) (*models.OneTimeToken, error)
+
+	// PhoneVerification returns the user's pending phone verification code
+	PhoneVerification(ctx context.Context, userID uint) (*models.PhoneVerification, error)
+	// SavePhoneVerification stores a code, replacing the user's previous one
+	SavePhoneVerification(ctx context.Context, verification *models.PhoneVerification) error
+	// DeletePhoneVerification removes the user's pending code
+	DeletePhoneVerification(ctx context.Context, userID uint) error
+	// CountPhoneVerificationAttempt records a wrong guess of a code
+	CountPhoneVerificationAttempt(ctx context.Context, verification *models.PhoneVerification) error
+	// VerifyPhone uses up a code and marks the number it was sent to as verified,
+	// unless the user changed their number since
+	VerifyPhone(ctx context.Context, verification *models.PhoneVerification) error
+}
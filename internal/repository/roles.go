@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// GormRoleRepository is a RoleRepository backed by the roles and user_roles tables
+type GormRoleRepository struct {
+	db *gorm.DB
+}
+
+// NewGormRoleRepository creates a database-backed role repository
+func NewGormRoleRepository(db *gorm.DB) *GormRoleRepository {
+	return &GormRoleRepository{db: db}
+}
+
+// FindOrCreate returns the role with a name, creating it if needed
+func (r *GormRoleRepository) FindOrCreate(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.WithContext(ctx).FirstOrCreate(&role, models.Role{Name: name}).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Assign gives the user a role
+func (r *GormRoleRepository) Assign(ctx context.Context, user *models.User, role *models.Role) error {
+	return r.db.WithContext(ctx).Model(user).Association("Roles").Append(role)
+}
+
+// Remove takes a role from the user
+func (r *GormRoleRepository) Remove(ctx context.Context, user *models.User, role *models.Role) error {
+	return r.db.WithContext(ctx).Model(user).Association("Roles").Delete(role)
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ristep/um_starter_jwt_go/internal/accounts"
+	"github.com/ristep/um_starter_jwt_go/internal/fieldcrypt"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// GormTokenRepository is a TokenRepository backed by the login_confirmations,
+// one_time_tokens and phone_verifications tables
+type GormTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewGormTokenRepository creates a database-backed token repository
+func NewGormTokenRepository(db *gorm.DB) *GormTokenRepository {
+	return &GormTokenRepository{db: db}
+}
+
+// RevokeAll invalidates every access and refresh token issued to the user
+func (r *GormTokenRepository) RevokeAll(ctx context.Context, user *models.User) error {
+	return accounts.RevokeTokens(r.db.WithContext(ctx), user)
+}
+
+// CountRecentLoginConfirmations counts recent unconfirmed login confirmations
+func (r *GormTokenRepository) CountRecentLoginConfirmations(ctx context.Context, userID uint, ip string, since int64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.LoginConfirmation{}).
+		Where("user_id = ? AND ip = ? AND confirmed_at IS NULL AND created_at > ?", userID, ip, since).
+		Count(&count).Error
+	return count, err
+}
+
+// CreateLoginConfirmation stores a login confirmation
+func (r *GormTokenRepository) CreateLoginConfirmation(ctx context.Context, confirmation *models.LoginConfirmation) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Drop the user's expired confirmations along the way
+		if err := tx.Where("user_id = ? AND expires_at <= ?", confirmation.UserID, time.Now().UnixMilli()).
+			Delete(&models.LoginConfirmation{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(confirmation).Error
+	})
+}
+
+// DeleteLoginConfirmation removes a login confirmation
+func (r *GormTokenRepository) DeleteLoginConfirmation(ctx context.Context, confirmation *models.LoginConfirmation) error {
+	return r.db.WithContext(ctx).Delete(confirmation).Error
+}
+
+// ConfirmLogin marks the confirmation with a token hash confirmed
+func (r *GormTokenRepository) ConfirmLogin(ctx context.Context, tokenHash string, expiresAt int64) (bool, error) {
+	now := time.Now().UnixMilli()
+	result := r.db.WithContext(ctx).Model(&models.LoginConfirmation{}).
+		Where("token_hash = ? AND confirmed_at IS NULL AND expires_at > ?", tokenHash, now).
+		Updates(map[string]any{"confirmed_at": now, "expires_at": expiresAt})
+	return result.RowsAffected > 0, result.Error
+}
+
+// UseLoginConfirmation consumes a confirmed login confirmation
+func (r *GormTokenRepository) UseLoginConfirmation(ctx context.Context, userID uint, ip string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND ip = ? AND confirmed_at IS NOT NULL AND expires_at > ?", userID, ip, time.Now().UnixMilli()).
+		Delete(&models.LoginConfirmation{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateOneTimeToken stores a one-time token
+func (r *GormTokenRepository) CreateOneTimeToken(ctx context.Context, token *models.OneTimeToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// UseOneTimeToken marks a token used and returns it
+func (r *GormTokenRepository) UseOneTimeToken(ctx context.Context, purpose, tokenHash string) (*models.OneTimeToken, error) {
+	return useOneTimeToken(r.db.WithContext(ctx), purpose, tokenHash)
+}
+
+// useOneTimeToken marks a token used in one statement, so concurrent uses of the same
+// token can't both succeed
+func useOneTimeToken(db *gorm.DB, purpose, tokenHash string) (*models.OneTimeToken, error) {
+	var token models.OneTimeToken
+	now := time.Now().UnixMilli()
+	result := db.Model(&token).Clauses(clause.Returning{}).
+		Where("purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, tokenHash, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	return &token, nil
+}
+
+// DeleteExpiredOneTimeTokens removes expired tokens
+func (r *GormTokenRepository) DeleteExpiredOneTimeTokens(ctx context.Context, before int64) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at <= ?", before).Delete(&models.OneTimeToken{})
+	return result.RowsAffected, result.Error
+}
+
+// ChangeEmail replaces the user's email with a confirmed one if the version is still
+// the one read, and stores the revert token
+func (r *GormTokenRepository) ChangeEmail(ctx context.Context, user *models.User, email string, flagged bool, revert *models.OneTimeToken) error {
+	previous := *user
+	expected := user.Version
+	setEmail(user, email)
+	user.EmailVerified = true
+	user.EmailFlagged = flagged
+	user.Version++
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(user).Where("version = ?", expected).
+			Select("email", "email_index", "email_verified", "email_flagged", "version").Updates(user)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConflict
+		}
+		return tx.Create(revert).Error
+	})
+	if err != nil {
+		*user = previous
+	}
+	return err
+}
+
+// RevertEmailChange restores the previous email of a change, which the link proved to
+// be the user's, and suspends the user in one transaction
+func (r *GormTokenRepository) RevertEmailChange(ctx context.Context, tokenHash, reason string) (*models.OneTimeToken, error) {
+	var token *models.OneTimeToken
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = useOneTimeToken(tx, models.TokenPurposeEmailRevert, tokenHash)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, models.TokenPurposeEmailRevert).
+			Delete(&models.OneTimeToken{}).Error; err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, token.UserID).Error; err != nil {
+			return notFound(err)
+		}
+		oldEmail, _ := token.Data["old_email"].(string)
+		// The unique index also covers deleted accounts
+		var taken int64
+		err = tx.Unscoped().Model(&models.User{}).Scopes(models.WhereEmail(oldEmail)).
+			Where("id <> ?", user.ID).Count(&taken).Error
+		if err != nil {
+			return err
+		}
+		if oldEmail != "" && taken == 0 && user.Email != oldEmail {
+			setEmail(&user, oldEmail)
+			user.EmailVerified = true
+			if err := tx.Model(&user).Select("email", "email_index", "email_verified").Updates(&user).Error; err != nil {
+				return err
+			}
+		}
+		return accounts.Suspend(tx, &user, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// setEmail sets the user's email and its blind index, if an index key is configured
+func setEmail(user *models.User, email string) {
+	user.Email = email
+	user.EmailIndex = nil
+	if index := fieldcrypt.BlindIndex(email); index != "" {
+		user.EmailIndex = &index
+	}
+}
+
+// PhoneVerification returns the user's pending phone verification code
+func (r *GormTokenRepository) PhoneVerification(ctx context.Context, userID uint) (*models.PhoneVerification, error) {
+	var verification models.PhoneVerification
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&verification).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &verification, nil
+}
+
+// SavePhoneVerification stores a code, replacing the user's previous one
+func (r *GormTokenRepository) SavePhoneVerification(ctx context.Context, verification *models.PhoneVerification) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tel", "code_hash", "attempts", "created_at", "expires_at"}),
+	}).Create(verification).Error
+}
+
+// DeletePhoneVerification removes the user's pending code
+func (r *GormTokenRepository) DeletePhoneVerification(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.PhoneVerification{}).Error
+}
+
+// CountPhoneVerificationAttempt records a wrong guess of a code
+func (r *GormTokenRepository) CountPhoneVerificationAttempt(ctx context.Context, verification *models.PhoneVerification) error {
+	return r.db.WithContext(ctx).Model(verification).UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+// VerifyPhone uses up a code and marks the number as verified in one transaction
+func (r *GormTokenRepository) VerifyPhone(ctx context.Context, verification *models.PhoneVerification) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(verification).Error; err != nil {
+			return err
+		}
+		// The number may be stored encrypted, so it is compared after loading
+		var user models.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "tel").First(&user, verification.UserID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && user.Tel != verification.Tel) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]any{
+			"phone_verified": true,
+			"updated_at":     time.Now().UnixMilli(),
+			"version":        gorm.Expr("version + 1"),
+		}).Error
+	})
+}
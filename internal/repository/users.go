@@ -0,0 +1,338 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/accounts"
+	"github.com/ristep/um_starter_jwt_go/internal/consent"
+	"github.com/ristep/um_starter_jwt_go/internal/database"
+	"github.com/ristep/um_starter_jwt_go/internal/fieldcrypt"
+	"github.com/ristep/um_starter_jwt_go/internal/filter"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// profileColumns are the columns SaveProfile writes
+var profileColumns = []string{"name", "tel", "phone_verified", "date_of_birth", "address", "city", "country", "gender", "gender_description", "metadata", "version"}
+
+// userFilterSchema are the fields filter expressions on the user list may name.
+// metadata.<key> names a metadata value, compared as text, with dots for nested keys.
+// tel, address and date_of_birth may be encrypted, so they can't be filtered on.
+var userFilterSchema = filter.Schema{
+	Fields: map[string]filter.Field{
+		"id":             {Type: filter.Integer, Column: "id"},
+		"email":          {Type: filter.Text, Column: "email"},
+		"username":       {Type: filter.Text, Column: "username", Nullable: true},
+		"name":           {Type: filter.Text, Column: "name"},
+		"city":           {Type: filter.Text, Column: "city"},
+		"country":        {Type: filter.Text, Column: "country"},
+		"gender":         {Type: filter.Text, Column: "gender"},
+		"timezone":       {Type: filter.Text, Column: "timezone"},
+		"locale":         {Type: filter.Text, Column: "locale"},
+		"email_verified": {Type: filter.Bool, Column: "email_verified"},
+		"email_flagged":  {Type: filter.Bool, Column: "email_flagged"},
+		"phone_verified": {Type: filter.Bool, Column: "phone_verified"},
+		"totp_enabled":   {Type: filter.Bool, Column: "totp_enabled"},
+		"suspended":      {Type: filter.Bool, Column: "(suspended_at IS NOT NULL)"},
+		"created_at":     {Type: filter.Timestamp, Column: "created_at"},
+		"updated_at":     {Type: filter.Timestamp, Column: "updated_at"},
+		"last_active_at": {Type: filter.Timestamp, Column: "last_active_at"},
+		"role": {Type: filter.Text, Match: `EXISTS (SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+			WHERE user_roles.user_id = users.id AND roles.name = ?)`},
+		"tag": {Type: filter.Text, Match: "tags @> jsonb_build_array(?::text)"},
+	},
+	Dynamic: func(name string) (filter.Field, bool) {
+		path, ok := strings.CutPrefix(name, "metadata.")
+		if !ok {
+			return filter.Field{}, false
+		}
+		keys := strings.Split(path, ".")
+		for _, key := range keys {
+			if !metadataKeyPattern.MatchString(key) {
+				return filter.Field{}, false
+			}
+		}
+		return filter.Field{Type: filter.Text, Column: "metadata #>> ?", ColumnArgs: []any{"{" + strings.Join(keys, ",") + "}"}, Nullable: true}, true
+	},
+}
+
+// encryptedEmailField matches encrypted emails by their blind index, which only
+// supports eq and ne. Users not yet indexed are matched on the stored email.
+var encryptedEmailField = filter.Field{
+	Type:  filter.Text,
+	Match: "(COALESCE(email_index = ?, false) OR email = ?)",
+	MatchArgs: func(value any) []any {
+		return []any{fieldcrypt.BlindIndex(value.(string)), value}
+	},
+}
+
+// UserFilterSchema returns the fields filter expressions on the user list may name.
+// With ENCRYPTION_EMAIL emails are only compared by their blind index, so contains,
+// starts with and ends with are rejected.
+func UserFilterSchema() filter.Schema {
+	if !fieldcrypt.EncryptsEmail() {
+		return userFilterSchema
+	}
+	fields := maps.Clone(userFilterSchema.Fields)
+	fields["email"] = encryptedEmailField
+	return filter.Schema{Fields: fields, Dynamic: userFilterSchema.Dynamic}
+}
+
+// metadataKeyPattern restricts the keys of metadata filters
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// GormUserRepository is a UserRepository backed by the users table
+type GormUserRepository struct {
+	db *gorm.DB
+}
+
+// NewGormUserRepository creates a database-backed user repository
+func NewGormUserRepository(db *gorm.DB) *GormUserRepository {
+	return &GormUserRepository{db: db}
+}
+
+// FindByID loads a user with roles
+func (r *GormUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	return r.first(r.db.WithContext(ctx).Where("id = ?", id))
+}
+
+// FindByIDFromReplica loads a user with roles from a read replica
+func (r *GormUserRepository) FindByIDFromReplica(ctx context.Context, id uint) (*models.User, error) {
+	return r.first(r.db.WithContext(ctx).Scopes(database.ReadReplica).Where("id = ?", id))
+}
+
+// FindByEmail loads the user with an email
+func (r *GormUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.first(r.db.WithContext(ctx).Scopes(models.WhereEmail(email)))
+}
+
+// FindByUsername loads the user with a username
+func (r *GormUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.first(r.db.WithContext(ctx).Where("username = ?", username))
+}
+
+// first loads the first user matching query, with roles
+func (r *GormUserRepository) first(query *gorm.DB) (*models.User, error) {
+	var user models.User
+	if err := query.Preload("Roles").First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+// UsernameTaken reports whether a username belongs to any account; the unique index
+// still covers soft-deleted ones
+func (r *GormUserRepository) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&count).Error
+	return count > 0, err
+}
+
+// List returns a page of users from a read replica
+func (r *GormUserRepository) List(ctx context.Context, query UserQuery) ([]models.User, int64, error) {
+	filter := func(db *gorm.DB) *gorm.DB {
+		for _, f := range query.Metadata {
+			db = db.Where("metadata #>> ? = ?", "{"+strings.Join(f.Path, ",")+"}", f.Value)
+		}
+		if len(query.Tags) > 0 {
+			tags, _ := json.Marshal(query.Tags)
+			db = db.Where("tags @> ?::jsonb", string(tags))
+		}
+		if query.Filter != nil {
+			db = db.Where(query.Filter.SQL, query.Filter.Args...)
+		}
+		return db
+	}
+
+	var total int64
+	if err := r.db.WithContext(ctx).Model(&models.User{}).Scopes(database.ReadReplica, filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	users := []models.User{}
+	err := r.db.WithContext(ctx).Scopes(database.ReadReplica, filter).Preload("Roles").Order("id").
+		Offset(query.Offset).Limit(query.Limit).Find(&users).Error
+	return users, total, err
+}
+
+// Create stores a new user and its consents in one transaction
+func (r *GormUserRepository) Create(ctx context.Context, user *models.User, consents []models.Consent) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if len(consents) == 0 {
+			return nil
+		}
+		for i := range consents {
+			consents[i].UserID = user.ID
+		}
+		return tx.Create(&consents).Error
+	})
+}
+
+// SaveProfile writes the editable fields if the version is still the one read
+func (r *GormUserRepository) SaveProfile(ctx context.Context, user *models.User) error {
+	expected := user.Version
+	user.Version++
+	result := r.db.WithContext(ctx).Model(user).Where("version = ?", expected).
+		Select(profileColumns).Updates(user)
+	if result.Error != nil {
+		user.Version = expected
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		user.Version = expected
+		return ErrConflict
+	}
+	return nil
+}
+
+// SetAvatar records the user's avatar
+func (r *GormUserRepository) SetAvatar(ctx context.Context, user *models.User, url, key string) error {
+	return r.update(ctx, user, map[string]any{"avatar_url": url, "avatar_key": key})
+}
+
+// SetMetadata replaces the user's metadata
+func (r *GormUserRepository) SetMetadata(ctx context.Context, user *models.User, metadata models.Metadata) error {
+	return r.update(ctx, user, map[string]any{"metadata": metadata})
+}
+
+// SetPreferences sets the user's time zone and locale
+func (r *GormUserRepository) SetPreferences(ctx context.Context, user *models.User, timezone, locale string) error {
+	return r.update(ctx, user, map[string]any{"timezone": timezone, "locale": locale})
+}
+
+// AddTag appends the tag unless the user already carries it
+func (r *GormUserRepository) AddTag(ctx context.Context, user *models.User, tag string) error {
+	return r.update(ctx, user, map[string]any{
+		"tags": gorm.Expr("CASE WHEN tags @> jsonb_build_array(?::text) THEN tags ELSE tags || jsonb_build_array(?::text) END", tag, tag),
+	})
+}
+
+// RemoveTag deletes the tag from the user's tags
+func (r *GormUserRepository) RemoveTag(ctx context.Context, user *models.User, tag string) error {
+	return r.update(ctx, user, map[string]any{"tags": gorm.Expr("tags - ?::text", tag)})
+}
+
+// TagCounts counts the users of each tag, leaving out deleted users
+func (r *GormUserRepository) TagCounts(ctx context.Context) ([]TagCount, error) {
+	counts := []TagCount{}
+	err := r.db.WithContext(ctx).Scopes(database.ReadReplica).Raw(`SELECT tag, COUNT(*) AS users
+		FROM users, jsonb_array_elements_text(users.tags) AS tag
+		WHERE users.deleted_at IS NULL
+		GROUP BY tag ORDER BY tag`).Scan(&counts).Error
+	return counts, err
+}
+
+// update writes columns of the user and bumps its version
+func (r *GormUserRepository) update(ctx context.Context, user *models.User, columns map[string]any) error {
+	columns["updated_at"] = time.Now().UnixMilli()
+	columns["version"] = gorm.Expr("version + 1")
+	return r.db.WithContext(ctx).Model(user).Updates(columns).Error
+}
+
+// ResetPassword sets a new password and revokes the user's tokens
+func (r *GormUserRepository) ResetPassword(ctx context.Context, user *models.User, password string) error {
+	return accounts.ResetPassword(r.db.WithContext(ctx), user, password)
+}
+
+// Suspend blocks the user from logging in and revokes their tokens
+func (r *GormUserRepository) Suspend(ctx context.Context, user *models.User, reason string) error {
+	return accounts.Suspend(r.db.WithContext(ctx), user, reason)
+}
+
+// Unsuspend lets the user log in again
+func (r *GormUserRepository) Unsuspend(ctx context.Context, user *models.User) error {
+	return accounts.Unsuspend(r.db.WithContext(ctx), user)
+}
+
+// Delete soft-deletes the user
+func (r *GormUserRepository) Delete(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Delete(user).Error
+}
+
+// SetTOTPSecret stores a new authenticator secret
+func (r *GormUserRepository) SetTOTPSecret(ctx context.Context, userID uint, secret string) error {
+	return r.db.WithContext(ctx).Model(&models.User{ID: userID}).UpdateColumns(map[string]any{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error
+}
+
+// SetTOTPEnabled turns two-factor authentication on or off
+func (r *GormUserRepository) SetTOTPEnabled(ctx context.Context, userID uint, enabled bool) error {
+	columns := map[string]any{"totp_enabled": enabled}
+	if !enabled {
+		columns["totp_secret"] = ""
+		columns["totp_last_step"] = 0
+	}
+	return r.update(ctx, &models.User{ID: userID}, columns)
+}
+
+// UseTOTPStep records the step of an accepted authenticator code
+func (r *GormUserRepository) UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	// The condition makes concurrent uses of the same code fail
+	result := r.db.WithContext(ctx).Model(&models.User{ID: userID}).
+		Where("totp_last_step < ?", step).UpdateColumn("totp_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+// RecordActivity notes that the user just signed in or refreshed a session
+func (r *GormUserRepository) RecordActivity(ctx context.Context, userID uint) error {
+	return accounts.RecordActivity(r.db.WithContext(ctx), userID)
+}
+
+// RecordLogin adds an entry to the user's login history
+func (r *GormUserRepository) RecordLogin(ctx context.Context, event *models.LoginEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+// LoginHistory returns a page of the user's login history, newest first
+func (r *GormUserRepository) LoginHistory(ctx context.Context, userID uint, offset, limit int) ([]models.LoginEvent, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.LoginEvent{}).Where("user_id = ?", userID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	events := []models.LoginEvent{}
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&events).Error
+	return events, total, err
+}
+
+// Consents returns the user's consent history, newest first
+func (r *GormUserRepository) Consents(ctx context.Context, userID uint) ([]models.Consent, error) {
+	history := []models.Consent{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("accepted_at DESC, id DESC").Find(&history).Error
+	return history, err
+}
+
+// AddConsent records the acceptance and updates the user's accepted version of the
+// document in one transaction
+func (r *GormUserRepository) AddConsent(ctx context.Context, record *models.Consent) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", record.UserID).Updates(map[string]any{
+			consent.Column(record.Document): record.Version,
+			"updated_at":                    time.Now().UnixMilli(),
+			"version":                       gorm.Expr("version + 1"),
+		}).Error
+	})
+}
+
+// notFound translates GORM's missing record error
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
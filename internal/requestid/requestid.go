@@ -0,0 +1,50 @@
+// Package requestid assigns every request an identifier that is echoed to the client
+// and attached to logs and response metadata for correlation.
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header carries the request ID in both directions
+const Header = "X-Request-ID"
+
+// contextKey stores the request ID on the Gin context
+const contextKey = "request_id"
+
+// maxLength bounds client-supplied IDs so they cannot bloat logs
+const maxLength = 128
+
+// New returns a random 128-bit hex identifier
+func New() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether a client-supplied ID can be reused: non-empty, bounded and
+// made of printable ASCII without spaces
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Set stores the request ID for the request
+func Set(c *gin.Context, id string) {
+	c.Set(contextKey, id)
+}
+
+// Get returns the request ID, or an empty string when none was assigned
+func Get(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
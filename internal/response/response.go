@@ -0,0 +1,96 @@
+// Package response writes success responses in the shared envelope:
+// {"data": ..., "meta": {...}, "links": {...}}.
+package response
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/requestid"
+)
+
+// Envelope wraps every successful response body
+type Envelope struct {
+	Data  any   `json:"data"`
+	Meta  Meta  `json:"meta"`
+	Links Links `json:"links,omitempty"`
+}
+
+// Meta carries information about the response rather than the resource
+type Meta struct {
+	RequestID  string      `json:"request_id,omitempty"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination describes the page returned from a list endpoint
+type Pagination struct {
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// NewPagination computes the page count for total items split into perPage-sized pages
+func NewPagination(page, perPage int, total int64) *Pagination {
+	p := &Pagination{Page: page, PerPage: perPage, Total: total}
+	if perPage > 0 {
+		p.TotalPages = int((total + int64(perPage) - 1) / int64(perPage))
+	}
+	return p
+}
+
+// Links maps relation names (self, next, prev, ...) to URLs
+type Links map[string]string
+
+// Option adds optional metadata to an envelope
+type Option func(*Envelope)
+
+// WithPagination attaches pagination metadata
+func WithPagination(p *Pagination) Option {
+	return func(e *Envelope) {
+		e.Meta.Pagination = p
+	}
+}
+
+// WithLinks attaches related links; empty URLs are skipped
+func WithLinks(links Links) Option {
+	return func(e *Envelope) {
+		for rel, href := range links {
+			if href == "" {
+				continue
+			}
+			if e.Links == nil {
+				e.Links = make(Links)
+			}
+			e.Links[rel] = href
+		}
+	}
+}
+
+// JSON writes data wrapped in the envelope with the given status
+func JSON(c *gin.Context, status int, data any, opts ...Option) {
+	env := Envelope{
+		Data: data,
+		Meta: Meta{
+			RequestID: requestid.Get(c),
+			Timestamp: time.Now().UTC(),
+		},
+	}
+	for _, opt := range opts {
+		opt(&env)
+	}
+	c.JSON(status, env)
+}
+
+// OK writes a 200 response
+func OK(c *gin.Context, data any, opts ...Option) {
+	JSON(c, http.StatusOK, data, opts...)
+}
+
+// Created writes a 201 response
+func Created(c *gin.Context, data any, opts ...Option) {
+	JSON(c, http.StatusCreated, data, opts...)
+}
@@ -0,0 +1,195 @@
+// Package retention enforces how long personal data is kept. Account activity and
+// login history older than their retention period are deleted, and soft-deleted users
+// are erased for good with everything stored about them. A dry run only reports what
+// would be removed.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/storage"
+)
+
+// batchSize is how many rows are deleted per statement, keeping locks short
+const batchSize = 5000
+
+// userBatchSize is how many deleted users are loaded at a time
+const userBatchSize = 200
+
+// userTables hold rows about a user, keyed by user_id, erased with the user
+var userTables = []string{
+	"activities", "login_events", "login_confirmations", "one_time_tokens", "consents",
+	"admin_notes", "phone_verifications", "refresh_tokens", "opaque_tokens", "api_keys",
+	"push_devices", "user_roles",
+}
+
+// Report counts the rows a purge removed, or would remove in a dry run
+type Report struct {
+	Activities   int64 `json:"activities"`
+	LoginEvents  int64 `json:"login_events"`
+	DeletedUsers int64 `json:"deleted_users"`
+}
+
+// Empty reports whether nothing was removed
+func (r Report) Empty() bool {
+	return r.Activities == 0 && r.LoginEvents == 0 && r.DeletedUsers == 0
+}
+
+// Job purges data past its retention period
+type Job struct {
+	db    *gorm.DB
+	store storage.Storage
+	cfg   config.RetentionConfig
+}
+
+// NewJob creates a retention job. store, when not nil, is where avatars of erased users
+// are removed from.
+func NewJob(db *gorm.DB, store storage.Storage, cfg config.RetentionConfig) *Job {
+	return &Job{db: db, store: store, cfg: cfg}
+}
+
+// Run purges immediately and then every check interval until ctx is cancelled.
+// Failures are logged and retried on the next run.
+func (j *Job) Run(ctx context.Context) {
+	purge := func() {
+		report, err := j.Purge(ctx, time.Now(), j.cfg.DryRun)
+		if err != nil {
+			logging.Error(ctx, "failed to purge expired data", "error", err)
+			return
+		}
+		if j.cfg.DryRun {
+			logging.Info(ctx, "retention dry run", "activities", report.Activities, "login_events", report.LoginEvents, "deleted_users", report.DeletedUsers)
+		} else if !report.Empty() {
+			logging.Info(ctx, "expired data purged", "activities", report.Activities, "login_events", report.LoginEvents, "deleted_users", report.DeletedUsers)
+		}
+	}
+
+	purge()
+	ticker := time.NewTicker(j.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purge()
+		}
+	}
+}
+
+// Purge removes the data past its retention period at now, or with dryRun only counts
+// it. Rules with a period of 0 days are skipped.
+func (j *Job) Purge(ctx context.Context, now time.Time, dryRun bool) (Report, error) {
+	var report Report
+	var err error
+	if days := j.cfg.ActivityDays; days > 0 {
+		if report.Activities, err = j.purgeTable(ctx, "activities", cutoff(now, days), dryRun); err != nil {
+			return report, fmt.Errorf("purge account activity: %w", err)
+		}
+	}
+	if days := j.cfg.LoginHistoryDays; days > 0 {
+		if report.LoginEvents, err = j.purgeTable(ctx, "login_events", cutoff(now, days), dryRun); err != nil {
+			return report, fmt.Errorf("purge login history: %w", err)
+		}
+	}
+	if days := j.cfg.DeletedUserDays; days > 0 {
+		if report.DeletedUsers, err = j.eraseUsers(ctx, cutoff(now, days), dryRun); err != nil {
+			return report, fmt.Errorf("erase deleted users: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// cutoff is the time before which data kept for days has expired
+func cutoff(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days)
+}
+
+// purgeTable deletes the rows of a table created before the cutoff, in batches
+func (j *Job) purgeTable(ctx context.Context, table string, before time.Time, dryRun bool) (int64, error) {
+	db := j.db.WithContext(ctx)
+	if dryRun {
+		var count int64
+		err := db.Table(table).Where("created_at < ?", before.UnixMilli()).Count(&count).Error
+		return count, err
+	}
+
+	var total int64
+	for {
+		result := db.Exec("DELETE FROM "+table+" WHERE id IN (SELECT id FROM "+table+" WHERE created_at < ? LIMIT ?)", before.UnixMilli(), batchSize)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// eraseUsers removes users soft-deleted before the cutoff, with their data
+func (j *Job) eraseUsers(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	expired := func() *gorm.DB {
+		return j.db.WithContext(ctx).Unscoped().Model(&models.User{}).Where("deleted_at < ?", before)
+	}
+	if dryRun {
+		var count int64
+		err := expired().Count(&count).Error
+		return count, err
+	}
+
+	// Erased users drop out of the query, so each batch starts from the beginning
+	var erased int64
+	for {
+		var users []models.User
+		if err := expired().Select("id", "avatar_key").Order("id").Limit(userBatchSize).Find(&users).Error; err != nil {
+			return erased, err
+		}
+		for _, user := range users {
+			if err := ctx.Err(); err != nil {
+				return erased, err
+			}
+			if err := j.erase(ctx, user); err != nil {
+				return erased, fmt.Errorf("user %d: %w", user.ID, err)
+			}
+			erased++
+		}
+		if len(users) < userBatchSize {
+			return erased, nil
+		}
+	}
+}
+
+// erase deletes a user and the rows about them in one transaction. The avatar is
+// removed afterwards; a failure there only leaves an orphaned file.
+func (j *Job) erase(ctx context.Context, user models.User) error {
+	err := j.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM api_key_usages WHERE api_key_id IN (SELECT id FROM api_keys WHERE user_id = ?)", user.ID).Error; err != nil {
+			return err
+		}
+		for _, table := range userTables {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", user.ID).Error; err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+		}
+		return tx.Unscoped().Delete(&models.User{}, user.ID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if user.AvatarKey != "" && j.store != nil {
+		if err := j.store.Delete(ctx, user.AvatarKey); err != nil {
+			logging.Warn(ctx, "failed to delete avatar of erased user", "user_id", user.ID, "error", err)
+		}
+	}
+	logging.Info(ctx, "deleted user erased", "user_id", user.ID)
+	return nil
+}
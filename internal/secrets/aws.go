@@ -0,0 +1,104 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/awssig"
+)
+
+// AWSProvider reads secrets from an AWS Secrets Manager secret whose SecretString
+// is a JSON object keyed by secret name. Credentials come from the standard AWS env vars.
+type AWSProvider struct {
+	Region   string
+	SecretID string
+	Client   *http.Client
+}
+
+// GetSecret returns the value stored under name in the configured secret
+func (ap *AWSProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	values, err := ap.values(ctx)
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[name]
+	if !ok || value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// SetSecrets stores a new version of the secret with the values merged into its
+// keys. The secret must exist.
+func (ap *AWSProvider) SetSecrets(ctx context.Context, values map[string]string) error {
+	current, err := ap.values(ctx)
+	if err != nil {
+		return err
+	}
+	for name, value := range values {
+		if value == "" {
+			delete(current, name)
+		} else {
+			current[name] = value
+		}
+	}
+	secretString, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	return ap.call(ctx, "PutSecretValue", map[string]string{"SecretId": ap.SecretID, "SecretString": string(secretString)}, nil)
+}
+
+// values returns the keys of the secret
+func (ap *AWSProvider) values(ctx context.Context) (map[string]string, error) {
+	var result struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := ap.call(ctx, "GetSecretValue", map[string]string{"SecretId": ap.SecretID}, &result); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	if err := json.Unmarshal([]byte(result.SecretString), &values); err != nil {
+		return nil, fmt.Errorf("secret %s is not a JSON object: %w", ap.SecretID, err)
+	}
+	return values, nil
+}
+
+// call runs a Secrets Manager action and decodes its response into out, unless nil
+func (ap *AWSProvider) call(ctx context.Context, action string, payload, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", ap.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager."+action)
+	awssig.Sign(req, body, awssig.CredentialsFromEnv(), ap.Region, "secretsmanager", time.Now())
+
+	resp, err := ap.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("secrets manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("secrets manager returned status %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode secrets manager response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package secrets
+
+import (
+	"context"
+	"os"
+)
+
+// EnvProvider reads secrets from environment variables
+type EnvProvider struct{}
+
+// GetSecret returns the environment variable with the given name
+func (EnvProvider) GetSecret(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileProvider reads secrets from files in a directory, as mounted by Docker or
+// Kubernetes secrets. A secret named JWT_SECRET is read from JWT_SECRET or jwt_secret.
+type FileProvider struct {
+	Dir string
+}
+
+// GetSecret returns the trimmed contents of the secret's file
+func (fp FileProvider) GetSecret(_ context.Context, name string) (string, error) {
+	for _, candidate := range []string{name, strings.ToLower(name)} {
+		data, err := os.ReadFile(filepath.Join(fp.Dir, candidate))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", ErrNotFound
+}
+
+// SetSecrets writes each value to the secret's file, replacing it atomically so the
+// server never reads a partial secret. Empty values remove the file.
+func (fp FileProvider) SetSecrets(_ context.Context, values map[string]string) error {
+	for name, value := range values {
+		if value == "" {
+			for _, candidate := range []string{name, strings.ToLower(name)} {
+				if err := os.Remove(filepath.Join(fp.Dir, candidate)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return err
+				}
+			}
+			continue
+		}
+		path := fp.path(name)
+		tmp, err := os.CreateTemp(fp.Dir, "."+filepath.Base(path)+"-*")
+		if err != nil {
+			return err
+		}
+		_, err = tmp.WriteString(value + "\n")
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(tmp.Name(), 0o600)
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return nil
+}
+
+// path returns the file of a secret: the existing one of its candidates, or the
+// upper-case name for a new secret
+func (fp FileProvider) path(name string) string {
+	for _, candidate := range []string{name, strings.ToLower(name)} {
+		path := filepath.Join(fp.Dir, candidate)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(fp.Dir, name)
+}
@@ -0,0 +1,146 @@
+// Package secrets fetches sensitive settings such as JWT_SECRET and DB_DSN from an
+// external secret store instead of plain environment variables.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// Names of the secrets the service knows how to consume
+const (
+	JWTSecret     = "JWT_SECRET"
+	JWTPrevious   = "JWT_SECRET_PREVIOUS"
+	DBDSN         = "DB_DSN"
+	AdminPassword = "ADMIN_PASSWORD"
+	PasetoKey     = "PASETO_KEY"
+	SMTPPassword  = "SMTP_PASSWORD"
+	MasterKey     = "ENCRYPTION_MASTER_KEY"
+	LinkKey       = "LINK_SIGNING_KEY"
+)
+
+// ErrNotFound is returned when the store has no value for the requested secret
+var ErrNotFound = errors.New("secret not found")
+
+// Provider fetches named secrets from a secret store
+type Provider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// Writer is a Provider whose secrets can be changed, for storing and rotating keys
+// with umctl. The env provider can't be written.
+type Writer interface {
+	Provider
+	// SetSecrets stores the values under their names; an empty value removes the secret
+	SetSecrets(ctx context.Context, values map[string]string) error
+}
+
+// NewProvider creates the provider selected by cfg.Provider
+func NewProvider(cfg config.SecretsConfig) (Provider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	switch cfg.Provider {
+	case "env":
+		return EnvProvider{}, nil
+	case "file":
+		return FileProvider{Dir: cfg.FileDir}, nil
+	case "vault":
+		return &VaultProvider{Addr: cfg.VaultAddr, Token: cfg.VaultToken, Path: cfg.VaultPath, Client: client}, nil
+	case "aws":
+		return &AWSProvider{Region: cfg.AWSRegion, SecretID: cfg.AWSSecretID, Client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown secrets provider %q", cfg.Provider)
+	}
+}
+
+// Resolve fills the secret-backed fields of cfg from the provider.
+// Values missing from the store keep whatever the environment or config file provided.
+func Resolve(ctx context.Context, provider Provider, cfg *config.Config) error {
+	targets := map[string]*string{
+		JWTSecret:     &cfg.JWT.Secret,
+		JWTPrevious:   &cfg.JWT.PreviousSecret,
+		DBDSN:         &cfg.Database.DSN,
+		AdminPassword: &cfg.Admin.Password,
+		PasetoKey:     &cfg.JWT.PasetoKey,
+		SMTPPassword:  &cfg.Mail.SMTPPassword,
+		MasterKey:     &cfg.Encryption.MasterKey,
+		LinkKey:       &cfg.Links.SigningKey,
+	}
+
+	for name, target := range targets {
+		value, err := provider.GetSecret(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", name, err)
+		}
+		*target = value
+	}
+
+	if cfg.JWT.Secret == "" && cfg.JWT.Format == "jwt" {
+		return fmt.Errorf("%s is not set in the environment or the secret store", JWTSecret)
+	}
+	if cfg.JWT.PasetoKey == "" && cfg.JWT.Paseto() {
+		return fmt.Errorf("%s is not set in the environment or the secret store", PasetoKey)
+	}
+	if cfg.Database.DSN == "" {
+		return fmt.Errorf("%s is not set in the environment or the secret store", DBDSN)
+	}
+	return nil
+}
+
+// Refresh periodically re-fetches the JWT secret and the previous one accepted during a
+// rotation, and passes them to onJWTSecrets when either changed. A changed DB_DSN only
+// takes effect after a restart, which is logged. It blocks until ctx is cancelled.
+func Refresh(ctx context.Context, provider Provider, interval time.Duration, current *config.Config, onJWTSecrets func(secret, previous string)) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	jwtSecret, jwtPrevious, dsn := current.JWT.Secret, current.JWT.PreviousSecret, current.Database.DSN
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		rotated := false
+		for name, secret := range map[string]*string{JWTSecret: &jwtSecret, JWTPrevious: &jwtPrevious} {
+			value, err := provider.GetSecret(ctx, name)
+			if errors.Is(err, ErrNotFound) && name == JWTPrevious {
+				// Removing the previous secret ends the rotation
+				value, err = "", nil
+			}
+			if err != nil {
+				if !errors.Is(err, ErrNotFound) {
+					logging.Error(ctx, "failed to refresh secret", "name", name, "error", err)
+				}
+				continue
+			}
+			if value != *secret {
+				*secret = value
+				rotated = true
+				logging.Info(ctx, "secret rotated", "name", name)
+			}
+		}
+		if rotated {
+			onJWTSecrets(jwtSecret, jwtPrevious)
+		}
+
+		if value, err := provider.GetSecret(ctx, DBDSN); err == nil && value != dsn {
+			dsn = value
+			logging.Warn(ctx, "secret changed in store, restart required to apply it", "name", DBDSN)
+		}
+	}
+}
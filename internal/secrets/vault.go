@@ -0,0 +1,121 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// VaultProvider reads secrets from a HashiCorp Vault KV version 2 secret.
+// Path is the API path of the secret (e.g. "secret/data/um-api") and each
+// service secret is a key inside it.
+type VaultProvider struct {
+	Addr   string
+	Token  string
+	Path   string
+	Client *http.Client
+}
+
+// GetSecret returns the value stored under name in the configured Vault secret
+func (vp *VaultProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	data, _, err := vp.read(ctx)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[name].(string)
+	if !ok || value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// SetSecrets writes a new version of the Vault secret with the values merged into its
+// keys. The write fails when another version was written since the secret was read.
+func (vp *VaultProvider) SetSecrets(ctx context.Context, values map[string]string) error {
+	data, version, err := vp.read(ctx)
+	if errors.Is(err, ErrNotFound) {
+		data = make(map[string]any)
+	} else if err != nil {
+		return err
+	}
+	for name, value := range values {
+		if value == "" {
+			delete(data, name)
+		} else {
+			data[name] = value
+		}
+	}
+
+	body, err := json.Marshal(map[string]any{
+		// Check-and-set: version 0 only creates the secret
+		"options": map[string]int{"cas": version},
+		"data":    data,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, vp.url(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", vp.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := vp.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// read returns the keys of the Vault secret and its version, or ErrNotFound
+func (vp *VaultProvider) read(ctx context.Context) (map[string]any, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, vp.url(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("X-Vault-Token", vp.Token)
+
+	resp, err := vp.Client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, 0, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Data     map[string]any `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	if body.Data.Data == nil {
+		body.Data.Data = make(map[string]any)
+	}
+	return body.Data.Data, body.Data.Metadata.Version, nil
+}
+
+// url returns the API URL of the secret
+func (vp *VaultProvider) url() string {
+	return strings.TrimRight(vp.Addr, "/") + "/v1/" + strings.TrimLeft(vp.Path, "/")
+}
@@ -0,0 +1,178 @@
+// Package seed fills the database with realistic fake users for demos and load
+// testing. Generated accounts use example.com/.org/.net addresses so they can never
+// reach a real mailbox.
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/accounts"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// batchSize is the number of users inserted per statement
+const batchSize = 100
+
+// Options controls what FakeUsers generates
+type Options struct {
+	Users int
+	// Password is shared by all generated users; it is hashed once
+	Password string
+	// AdminRatio and VerifiedRatio are the fractions (0-1) of users given the admin
+	// role and a verified email
+	AdminRatio    float64
+	VerifiedRatio float64
+	// MaxLogins caps the login history generated per user
+	MaxLogins int
+	// Seed makes the output reproducible; 0 picks a random seed
+	Seed uint64
+}
+
+var (
+	timezones = []string{"", "UTC", "Europe/Skopje", "Europe/Berlin", "Europe/London", "America/New_York", "America/Los_Angeles", "Asia/Tokyo"}
+	locales   = []string{"", "en", "de", "mk"}
+	domains   = []string{"example.com", "example.org", "example.net"}
+)
+
+// FakeUsers inserts opts.Users fake users with roles, verification flags and login
+// history, and returns how many were created
+func FakeUsers(ctx context.Context, db *gorm.DB, opts Options) (int, error) {
+	if opts.Users <= 0 {
+		return 0, nil
+	}
+	if opts.AdminRatio < 0 || opts.AdminRatio > 1 || opts.VerifiedRatio < 0 || opts.VerifiedRatio > 1 {
+		return 0, errors.New("admin and verified ratios must be between 0 and 1")
+	}
+	hash, err := accounts.HashPassword(opts.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	db = db.WithContext(ctx)
+	var userRole, adminRole models.Role
+	if err := db.FirstOrCreate(&userRole, models.Role{Name: "user"}).Error; err != nil {
+		return 0, err
+	}
+	if err := db.FirstOrCreate(&adminRole, models.Role{Name: "admin"}).Error; err != nil {
+		return 0, err
+	}
+
+	// Numbering after the highest existing ID keeps emails and usernames unique
+	// across runs
+	var offset uint
+	if err := db.Unscoped().Model(&models.User{}).Select("COALESCE(MAX(id), 0)").Scan(&offset).Error; err != nil {
+		return 0, err
+	}
+
+	faker := gofakeit.New(opts.Seed)
+	now := time.Now()
+	created := 0
+	for created < opts.Users {
+		n := min(batchSize, opts.Users-created)
+		users := make([]models.User, n)
+		for i := range users {
+			users[i] = fakeUser(faker, hash, offset+uint(created+i+1), now, opts)
+			users[i].Roles = []models.Role{userRole}
+			if faker.Float64() < opts.AdminRatio {
+				users[i].Roles = append(users[i].Roles, adminRole)
+			}
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&users).Error; err != nil {
+				return err
+			}
+			var events []models.LoginEvent
+			for _, user := range users {
+				events = append(events, fakeLogins(faker, user, now, opts.MaxLogins)...)
+			}
+			if len(events) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(events, batchSize).Error
+		})
+		if err != nil {
+			return created, fmt.Errorf("insert fake users: %w", err)
+		}
+		created += n
+	}
+	return created, nil
+}
+
+// fakeUser builds the n-th generated user
+func fakeUser(f *gofakeit.Faker, hash string, n uint, now time.Time, opts Options) models.User {
+	first, last := f.FirstName(), f.LastName()
+	handle := fmt.Sprintf("%s.%s%d", asciiLower(first), asciiLower(last), n)
+
+	createdAt := f.DateRange(now.AddDate(-1, 0, 0), now)
+	dob := models.Date{Time: f.DateRange(now.AddDate(-80, 0, 0), now.AddDate(-18, 0, 0)).Truncate(24 * time.Hour)}
+
+	user := models.User{
+		Email:         handle + "@" + f.RandomString(domains),
+		Password:      hash,
+		Name:          first + " " + last,
+		DateOfBirth:   &dob,
+		Address:       f.Street(),
+		City:          f.City(),
+		Country:       f.CountryAbr(),
+		Gender:        f.Gender(),
+		EmailVerified: f.Float64() < opts.VerifiedRatio,
+		Timezone:      f.RandomString(timezones),
+		Locale:        f.RandomString(locales),
+		Metadata:      models.Metadata{"seeded": true},
+		CreatedAt:     createdAt.UnixMilli(),
+		UpdatedAt:     createdAt.UnixMilli(),
+	}
+	if len(handle) <= 32 && f.Bool() {
+		user.Username = &handle
+	}
+	return user
+}
+
+// fakeLogins generates up to max login attempts after the user was created, most of
+// them successful
+func fakeLogins(f *gofakeit.Faker, user models.User, now time.Time, max int) []models.LoginEvent {
+	if max <= 0 {
+		return nil
+	}
+	createdAt := time.UnixMilli(user.CreatedAt)
+	ip, agent := f.IPv4Address(), f.UserAgent()
+
+	events := make([]models.LoginEvent, f.IntRange(0, max))
+	for i := range events {
+		// Users mostly come back from the same device
+		if f.Float64() < 0.2 {
+			ip, agent = f.IPv4Address(), f.UserAgent()
+		}
+		events[i] = models.LoginEvent{
+			UserID:    user.ID,
+			Success:   f.Float64() < 0.9,
+			IP:        ip,
+			UserAgent: agent,
+			CreatedAt: f.DateRange(createdAt, now).UnixMilli(),
+		}
+	}
+	return events
+}
+
+// asciiLower keeps the ASCII letters of s, lower-cased, so generated handles pass
+// the username rule
+func asciiLower(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
@@ -0,0 +1,208 @@
+// Package selfcheck looks for configuration mistakes at startup that would otherwise
+// only show up at the first request running into them: weak signing secrets, an
+// unreachable database or mail server, and CORS origins that never match. Each
+// finding says what to change.
+package selfcheck
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+)
+
+// Modes of STARTUP_CHECKS
+const (
+	// ModeAuto is strict in production and warn elsewhere
+	ModeAuto = "auto"
+	// ModeStrict refuses to start while there are findings
+	ModeStrict = "strict"
+	// ModeWarn logs the findings and starts anyway
+	ModeWarn = "warn"
+	// ModeOff skips the checks
+	ModeOff = "off"
+)
+
+// dialTimeout bounds each connectivity check
+const dialTimeout = 5 * time.Second
+
+// minSecretLength is the shortest JWT secret accepted: HS256 keys should be at least
+// as long as the 256-bit hash
+const minSecretLength = 32
+
+// minSecretEntropy is the least estimated randomness, in bits, of a JWT secret
+const minSecretEntropy = 96
+
+// placeholders are parts of the example secrets shipped with the project
+var placeholders = []string{"change-this", "changeme", "your-super-secret"}
+
+// Finding is a problem a check found
+type Finding struct {
+	// Check names the check, e.g. "jwt_secret"
+	Check string
+	// Message says what is wrong and how to fix it
+	Message string
+}
+
+// String formats the finding for logs and errors
+func (f Finding) String() string {
+	return f.Check + ": " + f.Message
+}
+
+// Strict reports whether findings stop the service from starting
+func Strict(cfg *config.Config) bool {
+	return cfg.Startup.Checks == ModeStrict || (cfg.Startup.Checks == ModeAuto && cfg.IsProduction())
+}
+
+// Run runs every check. ping reaches the database.
+func Run(ctx context.Context, cfg *config.Config, ping func(context.Context) error) []Finding {
+	var findings []Finding
+	findings = append(findings, checkSecrets(cfg)...)
+	findings = append(findings, checkCORS(cfg)...)
+	findings = append(findings, checkDatabase(ctx, cfg, ping)...)
+	findings = append(findings, checkMail(ctx, cfg)...)
+	return findings
+}
+
+// checkSecrets checks the length and randomness of the JWT secrets
+func checkSecrets(cfg *config.Config) []Finding {
+	if cfg.JWT.Format != "jwt" {
+		return nil
+	}
+	var findings []Finding
+	for _, secret := range []struct{ name, value string }{
+		{"JWT_SECRET", cfg.JWT.Secret},
+		{"JWT_SECRET_PREVIOUS", cfg.JWT.PreviousSecret},
+	} {
+		if secret.value == "" {
+			continue
+		}
+		if problem := weakSecret(secret.value); problem != "" {
+			findings = append(findings, Finding{
+				Check:   "jwt_secret",
+				Message: fmt.Sprintf("%s %s; generate one with `umctl generate-secret`", secret.name, problem),
+			})
+		}
+	}
+	return findings
+}
+
+// weakSecret describes why a secret is weak, or returns "" for a strong one
+func weakSecret(secret string) string {
+	lower := strings.ToLower(secret)
+	for _, placeholder := range placeholders {
+		if strings.Contains(lower, placeholder) {
+			return "is the example value"
+		}
+	}
+	if len(secret) < minSecretLength {
+		return fmt.Sprintf("is %d characters long, at least %d are needed", len(secret), minSecretLength)
+	}
+	if bits := entropy(secret); bits < minSecretEntropy {
+		return fmt.Sprintf("repeats too few characters to be random (about %d bits, at least %d are needed)", int(bits), minSecretEntropy)
+	}
+	return ""
+}
+
+// entropy estimates the randomness of s in bits from the frequency of its bytes
+func entropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var perByte float64
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(len(s))
+			perByte -= p * math.Log2(p)
+		}
+	}
+	return perByte * float64(len(s))
+}
+
+// checkCORS checks that the allowed origins can match a browser's Origin header, and
+// that production doesn't allow any origin
+func checkCORS(cfg *config.Config) []Finding {
+	var findings []Finding
+	origins := cfg.CORS.AllowedOrigins
+	for _, origin := range origins {
+		if origin == "*" {
+			if cfg.IsProduction() {
+				findings = append(findings, Finding{
+					Check:   "cors",
+					Message: "CORS_ALLOWED_ORIGINS allows any origin; list the origins of your frontends instead",
+				})
+			}
+			if len(origins) > 1 {
+				findings = append(findings, Finding{
+					Check:   "cors",
+					Message: "CORS_ALLOWED_ORIGINS lists origins next to *, which allows any origin anyway",
+				})
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+			findings = append(findings, Finding{
+				Check:   "cors",
+				Message: fmt.Sprintf("CORS_ALLOWED_ORIGINS entry %q never matches; origins are scheme://host[:port], without a path or trailing slash", origin),
+			})
+		}
+	}
+	return findings
+}
+
+// checkDatabase checks that the database accepts connections
+func checkDatabase(ctx context.Context, cfg *config.Config, ping func(context.Context) error) []Finding {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	if err := ping(ctx); err != nil {
+		return []Finding{{
+			Check:   "database",
+			Message: fmt.Sprintf("cannot reach the database at %s: %v; check DB_DSN and that PostgreSQL accepts connections from this host", dsnHost(cfg.Database.DSN), err),
+		}}
+	}
+	return nil
+}
+
+// dsnHost returns the host and port of a URL or key=value DSN, without credentials
+func dsnHost(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host
+	}
+	host, port := "localhost", "5432"
+	for _, field := range strings.Fields(dsn) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "host":
+			host = value
+		case "port":
+			port = value
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// checkMail checks that the SMTP server accepts connections
+func checkMail(ctx context.Context, cfg *config.Config) []Finding {
+	if cfg.Mail.Provider != "smtp" {
+		return nil
+	}
+	addr := net.JoinHostPort(cfg.Mail.SMTPHost, strconv.Itoa(cfg.Mail.SMTPPort))
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return []Finding{{
+			Check:   "mail",
+			Message: fmt.Sprintf("cannot connect to the SMTP server at %s: %v; check SMTP_HOST and SMTP_PORT", addr, err),
+		}}
+	}
+	conn.Close()
+	return nil
+}
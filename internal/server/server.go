@@ -0,0 +1,131 @@
+// Package server runs the HTTP(S) listeners for the API router.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+)
+
+// Server serves the API over plain HTTP, HTTPS with a static certificate, or HTTPS
+// with certificates obtained from Let's Encrypt, plus an optional HTTP→HTTPS redirect listener.
+type Server struct {
+	cfg      config.TLSConfig
+	logger   *slog.Logger
+	api      *http.Server
+	redirect *http.Server
+	errs     chan error
+}
+
+// New creates a server for handler using the server and TLS configuration
+func New(serverCfg config.ServerConfig, tlsCfg config.TLSConfig, handler http.Handler, logger *slog.Logger) *Server {
+	srv := &Server{
+		cfg:    tlsCfg,
+		logger: logger,
+		api:    newHTTPServer(serverCfg, serverCfg.Port, handler),
+		errs:   make(chan error, 2),
+	}
+
+	var redirectHandler http.Handler = http.HandlerFunc(redirectToHTTPS)
+
+	if tlsCfg.AutocertEnabled() {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsCfg.AutocertDomains...),
+			Cache:      autocert.DirCache(tlsCfg.AutocertCacheDir),
+			Email:      tlsCfg.AutocertEmail,
+		}
+		srv.api.TLSConfig = manager.TLSConfig()
+		// The HTTP listener must also answer ACME http-01 challenges
+		redirectHandler = manager.HTTPHandler(redirectHandler)
+	}
+
+	if tlsCfg.Enabled() && (tlsCfg.RedirectHTTP || tlsCfg.AutocertEnabled()) {
+		srv.redirect = newHTTPServer(serverCfg, tlsCfg.HTTPPort, redirectHandler)
+	}
+
+	return srv
+}
+
+// newHTTPServer creates an http.Server with the configured timeouts and limits;
+// the zero values of http.Server leave all of them unbounded
+func newHTTPServer(cfg config.ServerConfig, port string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              net.JoinHostPort("", port),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// Start binds the listeners and serves in the background. Failing to bind is
+// returned; a listener failing later is reported on Err.
+func (s *Server) Start() error {
+	api, err := net.Listen("tcp", s.api.Addr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", s.api.Addr, err)
+	}
+	if s.redirect != nil {
+		redirect, err := net.Listen("tcp", s.redirect.Addr)
+		if err != nil {
+			api.Close()
+			return fmt.Errorf("listen on %s for the HTTP redirect: %w", s.redirect.Addr, err)
+		}
+		s.logger.Info("starting HTTP redirect listener", "addr", s.redirect.Addr)
+		go s.serve("HTTP redirect listener", func() error { return s.redirect.Serve(redirect) })
+	}
+
+	switch {
+	case s.cfg.AutocertEnabled():
+		s.logger.Info("starting HTTPS server", "addr", s.api.Addr, "autocert_domains", s.cfg.AutocertDomains)
+		go s.serve("server", func() error { return s.api.ServeTLS(api, "", "") })
+	case s.cfg.Enabled():
+		s.logger.Info("starting HTTPS server", "addr", s.api.Addr)
+		go s.serve("server", func() error { return s.api.ServeTLS(api, s.cfg.CertFile, s.cfg.KeyFile) })
+	default:
+		s.logger.Info("starting server", "addr", s.api.Addr)
+		go s.serve("server", func() error { return s.api.Serve(api) })
+	}
+	return nil
+}
+
+// Err reports listeners that stopped for a reason other than Shutdown
+func (s *Server) Err() <-chan error {
+	return s.errs
+}
+
+// serve runs a listener until it stops and reports why unless it was shut down
+func (s *Server) serve(name string, run func() error) {
+	if err := run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.errs <- fmt.Errorf("%s: %w", name, err)
+	}
+}
+
+// Shutdown gracefully stops all listeners, waiting for in-flight requests until ctx expires
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+	if s.redirect != nil {
+		errs = append(errs, s.redirect.Shutdown(ctx))
+	}
+	errs = append(errs, s.api.Shutdown(ctx))
+	return errors.Join(errs...)
+}
+
+// redirectToHTTPS permanently redirects a plain HTTP request to its HTTPS equivalent
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
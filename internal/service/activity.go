@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+)
+
+// recordActivity adds an event to the user's activity feed. Failures are only logged
+// so that the feed never blocks what it describes.
+func recordActivity(ctx context.Context, activity repository.ActivityRepository, event models.Activity) {
+	if err := activity.Add(ctx, &event); err != nil {
+		logging.Warn(ctx, "failed to record activity", "user_id", event.UserID, "type", event.Type, "error", err)
+	}
+}
+
+// actorOf returns the actor of a change to a user: nil when users change themselves
+func actorOf(actorID, userID uint) *uint {
+	if actorID == 0 || actorID == userID {
+		return nil
+	}
+	return &actorID
+}
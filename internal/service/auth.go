@@ -0,0 +1,471 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/consent"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/loginrisk"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+	"github.com/ristep/um_starter_jwt_go/internal/validation"
+)
+
+// AuthService registers users, checks their credentials and issues their sessions
+type AuthService struct {
+	users        repository.UserRepository
+	roles        repository.RoleRepository
+	tokenRepo    repository.TokenRepository
+	tokens       auth.TokenService
+	sessions     sessions.Store
+	activity     repository.ActivityRepository
+	registration RegistrationPolicy
+	sessionCfg   config.SessionConfig
+	authCfg      config.AuthConfig
+}
+
+// NewAuthService creates a new auth service
+func NewAuthService(users repository.UserRepository, roles repository.RoleRepository, tokenRepo repository.TokenRepository, tokens auth.TokenService, sessions sessions.Store, activity repository.ActivityRepository, registration RegistrationPolicy, sessionCfg config.SessionConfig, authCfg config.AuthConfig) *AuthService {
+	return &AuthService{
+		users:        users,
+		roles:        roles,
+		tokenRepo:    tokenRepo,
+		tokens:       tokens,
+		sessions:     sessions,
+		activity:     activity,
+		registration: registration,
+		sessionCfg:   sessionCfg,
+		authCfg:      authCfg,
+	}
+}
+
+// Registration holds the details of a new account, already validated
+type Registration struct {
+	Email string
+	// Username is optional; it is normalized before use
+	Username string
+	Password string
+	Name     string
+	// Tel is in E.164 form
+	Tel         string
+	DateOfBirth *models.Date
+	Gender      string
+	Address     string
+	City        string
+	Country     string
+	Metadata    models.Metadata
+	// GenderDescription is set when Gender is self_described
+	GenderDescription string
+}
+
+// Credentials identify and authenticate a user at login. Either Email or Username
+// identifies the account.
+type Credentials struct {
+	Email    string
+	Username string
+	Password string
+	// OTP is the authenticator code, required once two-factor authentication is enabled
+	OTP string
+}
+
+// RequiredConsents returns the document versions new users must accept
+func (s *AuthService) RequiredConsents() map[string]string {
+	return s.registration.Consent.Required()
+}
+
+// Register creates an account with the default role. The new user accepts the current
+// version of every required document.
+func (s *AuthService) Register(ctx context.Context, reg Registration, client Client) (*models.User, error) {
+	pending, err := s.prepareRegistration(ctx, reg, client)
+	if err != nil {
+		return nil, err
+	}
+	return s.createUser(ctx, pending, false)
+}
+
+// RequestRegistration checks a registration like Register, but instead of creating the
+// account stores it in confirm, the registration one-time token the caller mails to
+// the address, filling in its data; ConfirmRegistration creates it. When the email
+// already has an account nothing is stored and that user is returned, so the caller
+// can tell its owner instead and answer both cases alike.
+func (s *AuthService) RequestRegistration(ctx context.Context, reg Registration, confirm *models.OneTimeToken, client Client) (taken *models.User, err error) {
+	pending, err := s.prepareRegistration(ctx, reg, client)
+	if errors.Is(err, apperr.ErrEmailTaken) {
+		taken, err := s.users.FindByEmail(ctx, reg.Email)
+		if err != nil {
+			return nil, apperr.ErrDatabase.Wrap(err)
+		}
+		return taken, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return nil, apperr.ErrInternal.Wrap(err)
+	}
+	confirm.Data = models.Metadata{}
+	if err := json.Unmarshal(data, &confirm.Data); err != nil {
+		return nil, apperr.ErrInternal.Wrap(err)
+	}
+	if err := s.tokenRepo.CreateOneTimeToken(ctx, confirm); err != nil {
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	return nil, nil
+}
+
+// ConfirmRegistration redeems the registration token with a hash, which proves the
+// email is the registrant's, and creates the account it holds with a verified email
+func (s *AuthService) ConfirmRegistration(ctx context.Context, tokenHash string) (*models.User, error) {
+	token, err := s.tokenRepo.UseOneTimeToken(ctx, models.TokenPurposeRegistration, tokenHash)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, apperr.ErrInvalidRegistration
+	}
+	if err != nil {
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	data, err := json.Marshal(token.Data)
+	if err != nil {
+		return nil, apperr.ErrInternal.Wrap(err)
+	}
+	var pending pendingRegistration
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, apperr.ErrInvalidRegistration
+	}
+
+	// The address owner may have registered twice, or someone taken the username since
+	if _, err := s.users.FindByEmail(ctx, pending.Email); err == nil {
+		return nil, apperr.ErrEmailTaken
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	if err := s.usernameAvailable(ctx, pending.Username); err != nil {
+		return nil, err
+	}
+	return s.createUser(ctx, pending, true)
+}
+
+// pendingRegistration is a checked registration waiting to be stored
+type pendingRegistration struct {
+	Registration
+	// PasswordHash is the bcrypt hash of the password, which is not kept
+	PasswordHash string
+	Flagged      bool
+	// Consents are the versions of the documents the registrant accepted
+	Consents map[string]string
+	Client   Client
+}
+
+// prepareRegistration checks a registration and hashes its password. A taken email
+// fails with apperr.ErrEmailTaken after the username was checked and the password
+// hashed, so it answers like a free one.
+func (s *AuthService) prepareRegistration(ctx context.Context, reg Registration, client Client) (pendingRegistration, error) {
+	flagged, err := s.registration.check(reg.Email)
+	if err != nil {
+		return pendingRegistration{}, err
+	}
+
+	if reg.Username != "" {
+		reg.Username = validation.NormalizeUsername(reg.Username)
+		if err := s.usernameAvailable(ctx, reg.Username); err != nil {
+			return pendingRegistration{}, err
+		}
+	}
+
+	// Hash the password before looking for the email, so a taken email answers as
+	// slowly as a new one
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(reg.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return pendingRegistration{}, apperr.ErrInternal.WithDetail("Failed to process password")
+	}
+	reg.Password = ""
+
+	// Check if user already exists
+	if _, err := s.users.FindByEmail(ctx, reg.Email); err == nil {
+		return pendingRegistration{}, apperr.ErrEmailTaken
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return pendingRegistration{}, apperr.ErrDatabase.Wrap(err)
+	}
+
+	return pendingRegistration{
+		Registration: reg,
+		PasswordHash: string(hashedPassword),
+		Flagged:      flagged,
+		Consents:     s.RequiredConsents(),
+		Client:       client,
+	}, nil
+}
+
+// usernameAvailable fails with apperr.ErrUsernameTaken if a user has the normalized
+// username; an empty username is always available
+func (s *AuthService) usernameAvailable(ctx context.Context, username string) error {
+	if username == "" {
+		return nil
+	}
+	taken, err := s.users.UsernameTaken(ctx, username)
+	if err != nil {
+		return apperr.ErrDatabase.Wrap(err)
+	}
+	if taken {
+		return apperr.ErrUsernameTaken
+	}
+	return nil
+}
+
+// createUser stores a checked registration with the default role
+func (s *AuthService) createUser(ctx context.Context, pending pendingRegistration, verified bool) (*models.User, error) {
+	// Get or create the default "user" role
+	userRole, err := s.roles.FindOrCreate(ctx, "user")
+	if err != nil {
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+
+	var username *string
+	if pending.Username != "" {
+		username = &pending.Username
+	}
+	reg := pending.Registration
+	newUser := models.User{
+		Email:          reg.Email,
+		EmailVerified:  verified,
+		EmailFlagged:   pending.Flagged,
+		Username:       username,
+		Password:       pending.PasswordHash,
+		PasswordSetAt:  time.Now().UnixMilli(),
+		LastActiveAt:   time.Now().UnixMilli(),
+		Name:           reg.Name,
+		Tel:            reg.Tel,
+		DateOfBirth:    reg.DateOfBirth,
+		Gender:         reg.Gender,
+		GenderDesc:     reg.GenderDescription,
+		Address:        reg.Address,
+		City:           reg.City,
+		Country:        reg.Country,
+		Metadata:       reg.Metadata,
+		TermsVersion:   pending.Consents[consent.Terms],
+		PrivacyVersion: pending.Consents[consent.Privacy],
+		Roles:          []models.Role{*userRole},
+	}
+	if err := s.users.Create(ctx, &newUser, consentRecords(pending.Consents, pending.Client)); err != nil {
+		return nil, apperr.ErrDatabase.WithDetail("Failed to create user").Wrap(err)
+	}
+
+	// Load the user with roles
+	user, err := s.users.FindByID(ctx, newUser.ID)
+	if err != nil {
+		return nil, apperr.ErrDatabase.WithDetail("Failed to retrieve user").Wrap(err)
+	}
+	return user, nil
+}
+
+// consentRecords builds the records for a new user accepting every required document
+// at once; the user ID is set when the user is stored
+func consentRecords(required map[string]string, client Client) []models.Consent {
+	records := make([]models.Consent, 0, len(required))
+	for _, doc := range []string{consent.Terms, consent.Privacy} {
+		if version, ok := required[doc]; ok {
+			records = append(records, models.Consent{
+				Document:  doc,
+				Version:   version,
+				IP:        client.IP,
+				UserAgent: client.UserAgent,
+			})
+		}
+	}
+	return records
+}
+
+// Authenticate checks the credentials of a login and returns the user and how they
+// authenticated. Failed attempts by known users are recorded in their login history;
+// successful ones are left to the caller, which may still hold the login back.
+func (s *AuthService) Authenticate(ctx context.Context, creds Credentials, client Client) (*models.User, auth.Authentication, error) {
+	var user *models.User
+	var err error
+	if creds.Email != "" {
+		user, err = s.users.FindByEmail(ctx, creds.Email)
+	} else {
+		user, err = s.users.FindByUsername(ctx, validation.NormalizeUsername(creds.Username))
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Spend the time a password check takes, so unknown accounts don't answer faster
+			bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(creds.Password))
+			if s.authCfg.EnumerationProtection {
+				return nil, auth.Authentication{}, apperr.ErrInvalidCredentials
+			}
+			return nil, auth.Authentication{}, apperr.ErrAccountNotFound
+		}
+		return nil, auth.Authentication{}, apperr.ErrDatabase.Wrap(err)
+	}
+
+	if err := s.CheckPassword(ctx, user, creds.Password, client); err != nil {
+		return nil, auth.Authentication{}, err
+	}
+
+	// Only reveal the suspension to someone who knows the password
+	if user.Suspended() {
+		s.RecordLogin(ctx, user.ID, client, false, loginrisk.Assessment{})
+		return nil, auth.Authentication{}, apperr.ErrAccountSuspended
+	}
+
+	// Users with two-factor authentication also need a code from their authenticator
+	authn := auth.Authenticated(auth.MethodPassword)
+	if user.TOTPEnabled {
+		if creds.OTP == "" {
+			return nil, auth.Authentication{}, apperr.ErrTwoFactorRequired
+		}
+		ok, err := UseTOTPCode(ctx, s.users, user, creds.OTP)
+		if err != nil {
+			return nil, auth.Authentication{}, apperr.ErrDatabase.Wrap(err)
+		}
+		if !ok {
+			s.RecordLogin(ctx, user.ID, client, false, loginrisk.Assessment{})
+			return nil, auth.Authentication{}, apperr.ErrInvalidTwoFactorCode
+		}
+		authn.Methods = append(authn.Methods, auth.MethodOTP)
+	}
+	return user, authn, nil
+}
+
+// CheckPassword compares a password with the user's, recording a failed login when
+// it doesn't match
+func (s *AuthService) CheckPassword(ctx context.Context, user *models.User, password string, client Client) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		s.RecordLogin(ctx, user.ID, client, false, loginrisk.Assessment{})
+		return apperr.ErrInvalidCredentials
+	}
+	return nil
+}
+
+// TwoFactorSetupRequired reports whether the user's role requires two-factor
+// authentication they haven't set up yet
+func (s *AuthService) TwoFactorSetupRequired(user *models.User) bool {
+	return !user.TOTPEnabled && TwoFactorRequired(s.authCfg.TwoFactorRoles, user)
+}
+
+// dummyPasswordHash is compared against when there is no account, at the cost real
+// password hashes use
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// IssueTokens generates a token pair for the user and records the refresh token as a
+// session of the client. authn is how the user authenticated; previous is the session
+// being refreshed, nil after a login.
+func (s *AuthService) IssueTokens(ctx context.Context, user *models.User, authn auth.Authentication, previous *models.RefreshToken, client Client) (*auth.TokenPair, error) {
+	expiresAt := time.Now().Add(s.tokens.RefreshTTL())
+	if previous != nil && !s.sessionCfg.Sliding {
+		expiresAt = time.UnixMilli(previous.ExpiresAt)
+	}
+	if limit := authn.Time.Add(s.sessionCfg.MaxLifetime); s.sessionCfg.Sliding && expiresAt.After(limit) {
+		expiresAt = limit
+	}
+
+	tokenPair, err := s.tokens.GenerateTokenPairUntil(user, authn, expiresAt)
+	if err != nil {
+		return nil, apperr.ErrTokenGeneration
+	}
+
+	session := models.RefreshToken{
+		UserID:          user.ID,
+		TokenHash:       sessions.Hash(tokenPair.RefreshToken),
+		IP:              client.IP,
+		UserAgent:       client.UserAgent,
+		AuthenticatedAt: authn.Time.UnixMilli(),
+		AuthMethods:     strings.Join(authn.Methods, ","),
+		ExpiresAt:       tokenPair.RefreshExpiresAt.UnixMilli(),
+	}
+	if err := s.sessions.Create(ctx, &session); err != nil {
+		return nil, apperr.ErrDatabase.WithDetail("Failed to store session").Wrap(err)
+	}
+
+	if previous == nil {
+		recordActivity(ctx, s.activity, models.Activity{
+			UserID:    user.ID,
+			Type:      models.ActivitySessionCreated,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Details:   models.Metadata{"auth_methods": authn.Methods},
+		})
+	}
+
+	// Signing in and refreshing keep the account from expiring as inactive
+	if err := s.users.RecordActivity(ctx, user.ID); err != nil {
+		logging.Warn(ctx, "failed to record activity", "user_id", user.ID, "error", err)
+	}
+	return tokenPair, nil
+}
+
+// RecordLogin adds an entry to the user's login history. Failures are only logged so
+// that history problems never block a login.
+func (s *AuthService) RecordLogin(ctx context.Context, userID uint, client Client, success bool, assessment loginrisk.Assessment) {
+	event := models.LoginEvent{
+		UserID:      userID,
+		Success:     success,
+		IP:          client.IP,
+		UserAgent:   client.UserAgent,
+		Country:     assessment.Location.Country,
+		ASN:         assessment.Location.ASN,
+		Latitude:    assessment.Location.Latitude,
+		Longitude:   assessment.Location.Longitude,
+		Suspicious:  assessment.Suspicious(),
+		RiskReasons: strings.Join(assessment.Reasons, ","),
+	}
+	if err := s.users.RecordLogin(ctx, &event); err != nil {
+		logging.Warn(ctx, "failed to record login", "user_id", userID, "error", err)
+	}
+
+	activity := models.Activity{
+		UserID:    userID,
+		Type:      models.ActivityLogin,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   models.Metadata{},
+	}
+	if !success {
+		activity.Type = models.ActivityLoginFailed
+	}
+	if event.Country != "" {
+		activity.Details["country"] = event.Country
+	}
+	if event.Suspicious {
+		activity.Details["risk_reasons"] = assessment.Reasons
+	}
+	recordActivity(ctx, s.activity, activity)
+}
+
+// SessionUser loads the user a refresh token was issued to and checks they may still
+// use it. Sessions started before the user's role required two-factor authentication
+// end here; logging in again leads to the setup.
+func (s *AuthService) SessionUser(ctx context.Context, claims *auth.CustomClaims) (*models.User, error) {
+	user, err := s.users.FindByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperr.ErrTokenUserNotFound
+		}
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	if claims.TokenVersion != user.TokenVersion {
+		return nil, apperr.ErrTokenRevoked
+	}
+	if user.Suspended() {
+		return nil, apperr.ErrAccountSuspended
+	}
+	if s.TwoFactorSetupRequired(user) {
+		return nil, apperr.ErrTwoFactorEnrollmentRequired
+	}
+	return user, nil
+}
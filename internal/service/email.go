@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+)
+
+// EmailRevertReason is the suspension reason of accounts locked by reverting an email
+// change
+const EmailRevertReason = "Email change reverted from the previous address"
+
+// RequestEmailChange checks that a user may change their email address to email, and
+// stores the email_change token that confirms the change, filling in its user and
+// data. Nothing changes until the token, mailed to the new address, is redeemed with
+// ConfirmEmailChange. The user is returned.
+func (s *UserService) RequestEmailChange(ctx context.Context, userID uint, email string, confirm *models.OneTimeToken) (*models.User, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, userError(err)
+	}
+	if strings.EqualFold(email, user.Email) {
+		return nil, apperr.ErrEmailUnchanged
+	}
+	if _, err := s.emailAvailable(ctx, email); err != nil {
+		return nil, err
+	}
+
+	confirm.UserID = user.ID
+	confirm.Data = models.Metadata{"email": email}
+	if err := s.tokenRepo.CreateOneTimeToken(ctx, confirm); err != nil {
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	return user, nil
+}
+
+// ConfirmEmailChange redeems the email_change token with a hash, which proves the new
+// address is the user's, and replaces the user's email with it, verified. It returns
+// the updated user and the address it replaced. revert is the email_revert one-time
+// token sent to the previous address, with which it can undo the change; its user and
+// data are filled in.
+func (s *UserService) ConfirmEmailChange(ctx context.Context, tokenHash string, revert *models.OneTimeToken, client Client) (*models.User, string, error) {
+	confirm, err := s.tokenRepo.UseOneTimeToken(ctx, models.TokenPurposeEmailChange, tokenHash)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, "", apperr.ErrInvalidEmailChange
+	}
+	if err != nil {
+		return nil, "", apperr.ErrDatabase.Wrap(err)
+	}
+	email, _ := confirm.Data["email"].(string)
+	user, err := s.users.FindByID(ctx, confirm.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, "", apperr.ErrInvalidEmailChange
+	}
+	if err != nil {
+		return nil, "", apperr.ErrDatabase.Wrap(err)
+	}
+	if strings.EqualFold(email, user.Email) {
+		return nil, "", apperr.ErrEmailUnchanged
+	}
+
+	// Policies may have changed and the address been taken since the request
+	flagged, err := s.emailAvailable(ctx, email)
+	if err != nil {
+		return nil, "", err
+	}
+
+	previous := user.Email
+	revert.UserID = user.ID
+	revert.Data = models.Metadata{"old_email": previous}
+	if err := s.tokenRepo.ChangeEmail(ctx, user, email, flagged, revert); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return nil, "", apperr.ErrVersionConflict
+		}
+		return nil, "", apperr.ErrDatabase.WithDetail("Failed to change email").Wrap(err)
+	}
+	recordActivity(ctx, s.activity, models.Activity{
+		UserID:    user.ID,
+		Type:      models.ActivityEmailChanged,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+
+	user, err = s.reload(ctx, user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, previous, nil
+}
+
+// emailAvailable checks that email passes the registration policy and belongs to no
+// other user, and reports whether the policy flags it
+func (s *UserService) emailAvailable(ctx context.Context, email string) (flagged bool, err error) {
+	flagged, err = s.registration.check(email)
+	if err != nil {
+		return false, err
+	}
+	if _, err := s.users.FindByEmail(ctx, email); err == nil {
+		return false, apperr.ErrEmailTaken
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return false, apperr.ErrDatabase.Wrap(err)
+	}
+	return flagged, nil
+}
+
+// RevertEmailChange undoes an email change with the hash of the token sent to the
+// previous address, and locks the account: it is suspended and its tokens revoked
+// until an admin lifts the suspension
+func (s *UserService) RevertEmailChange(ctx context.Context, tokenHash string, client Client) error {
+	revert, err := s.tokenRepo.RevertEmailChange(ctx, tokenHash, EmailRevertReason)
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperr.ErrInvalidEmailRevert
+	}
+	if err != nil {
+		return apperr.ErrDatabase.Wrap(err)
+	}
+	if err := s.revokeAccessTokens(ctx, revert.UserID); err != nil {
+		return err
+	}
+	recordActivity(ctx, s.activity, models.Activity{
+		UserID:    revert.UserID,
+		Type:      models.ActivityEmailReverted,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+	return nil
+}
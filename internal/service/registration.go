@@ -0,0 +1,55 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/consent"
+	"github.com/ristep/um_starter_jwt_go/internal/disposable"
+)
+
+// RegistrationPolicy restricts which email addresses can register
+type RegistrationPolicy struct {
+	// AllowedDomains, when non-empty, are the only email domains accepted. An entry
+	// starting with "*." also accepts its subdomains.
+	AllowedDomains []string
+	// Disposable lists throwaway mailbox domains
+	Disposable *disposable.Blocklist
+	// DisposableMode is block, flag or off (see config.DisposableConfig)
+	DisposableMode string
+	// Consent holds the document versions new users accept
+	Consent *consent.Policy
+}
+
+// check returns an error if email may not register, and whether it should be flagged
+func (rp RegistrationPolicy) check(email string) (flagged bool, err error) {
+	_, domain, _ := strings.Cut(strings.ToLower(email), "@")
+	if len(rp.AllowedDomains) > 0 && !domainAllowed(domain, rp.AllowedDomains) {
+		return false, apperr.ErrEmailDomainNotAllowed
+	}
+
+	if rp.DisposableMode == "off" || rp.Disposable == nil || !rp.Disposable.IsDisposable(email) {
+		return false, nil
+	}
+	if rp.DisposableMode == "block" {
+		return false, apperr.ErrDisposableEmail
+	}
+	return true, nil
+}
+
+// domainAllowed reports whether domain matches one of the allowed entries
+func domainAllowed(domain string, allowed []string) bool {
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if parent, ok := strings.CutPrefix(entry, "*."); ok {
+			if domain == parent || strings.HasSuffix(domain, "."+parent) {
+				return true
+			}
+			continue
+		}
+		if domain == strings.TrimPrefix(entry, "@") {
+			return true
+		}
+	}
+	return false
+}
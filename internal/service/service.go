@@ -0,0 +1,50 @@
+// Package service holds the business rules of accounts: registering and signing in
+// users, issuing their sessions, and updating users and their roles. The HTTP
+// handlers are thin adapters over it, so other surfaces such as a CLI or gRPC can
+// apply the same rules. Errors are apperr errors, ready to be written as problems.
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/totp"
+)
+
+// Client describes the device a request comes from, as recorded in sessions, consents
+// and the login history
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// TwoFactorRequired reports whether one of the user's roles requires two-factor
+// authentication
+func TwoFactorRequired(roles []string, user *models.User) bool {
+	return slices.ContainsFunc(user.Roles, func(role models.Role) bool {
+		return slices.Contains(roles, role.Name)
+	})
+}
+
+// UseTOTPCode checks an authenticator code against the user's secret. Each code is
+// accepted once: the step it belongs to must be newer than the last accepted one.
+func UseTOTPCode(ctx context.Context, users repository.UserRepository, user *models.User, code string) (bool, error) {
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return false, nil
+	}
+	return users.UseTOTPStep(ctx, user.ID, step)
+}
+
+// userError maps repository errors of user lookups to API errors
+func userError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperr.ErrUserNotFound
+	}
+	return apperr.ErrDatabase.Wrap(err)
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+)
+
+// UserService updates users and their roles
+type UserService struct {
+	users     repository.UserRepository
+	roles     repository.RoleRepository
+	tokenRepo repository.TokenRepository
+	activity  repository.ActivityRepository
+	// revocations rejects access tokens checked without loading the user
+	revocations sessions.RevocationList
+	// registration also restricts the addresses users change their email to
+	registration RegistrationPolicy
+}
+
+// NewUserService creates a new user service
+func NewUserService(users repository.UserRepository, roles repository.RoleRepository, tokenRepo repository.TokenRepository, activity repository.ActivityRepository, revocations sessions.RevocationList, registration RegistrationPolicy) *UserService {
+	return &UserService{users: users, roles: roles, tokenRepo: tokenRepo, activity: activity, revocations: revocations, registration: registration}
+}
+
+// ProfileUpdate holds the profile fields to change; empty fields are left alone
+type ProfileUpdate struct {
+	Name string
+	// Tel is in E.164 form; changing it clears the verification
+	Tel         string
+	DateOfBirth *models.Date
+	Address     string
+	City        string
+	Country     string
+	// Gender replaces the gender together with GenderDescription, which is set when
+	// it is self_described
+	Gender            string
+	GenderDescription string
+	// Metadata keys are merged into the user's metadata
+	Metadata models.Metadata
+	// Version, when set, must equal the user's current version
+	Version *uint
+}
+
+// IsAdmin reports whether the user has the admin role
+func IsAdmin(user *models.User) bool {
+	return slices.ContainsFunc(user.Roles, func(role models.Role) bool {
+		return role.Name == "admin"
+	})
+}
+
+// Editable loads a user the actor may edit: users can edit themselves, admins anyone
+func (s *UserService) Editable(ctx context.Context, actor *models.User, id uint) (*models.User, error) {
+	if id != actor.ID && !IsAdmin(actor) {
+		return nil, apperr.ErrInsufficientPermissions
+	}
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		return nil, userError(err)
+	}
+	return user, nil
+}
+
+// Update applies an update by the actor (a user ID) to a user loaded with Editable and
+// returns the stored user. validate, when not nil, checks the merged metadata before
+// anything is written.
+func (s *UserService) Update(ctx context.Context, actorID uint, user *models.User, update ProfileUpdate, validate func(models.Metadata) error) (*models.User, error) {
+	var fields []string
+	if update.Name != "" {
+		user.Name = update.Name
+		fields = append(fields, "name")
+	}
+	if update.Tel != "" && update.Tel != user.Tel {
+		user.Tel = update.Tel
+		user.PhoneVerified = false
+		fields = append(fields, "tel")
+	}
+	if update.DateOfBirth != nil {
+		user.DateOfBirth = update.DateOfBirth
+		fields = append(fields, "date_of_birth")
+	}
+	if update.Address != "" {
+		user.Address = update.Address
+		fields = append(fields, "address")
+	}
+	if update.City != "" {
+		user.City = update.City
+		fields = append(fields, "city")
+	}
+	if update.Country != "" {
+		user.Country = update.Country
+		fields = append(fields, "country")
+	}
+	if update.Gender != "" {
+		user.Gender = update.Gender
+		user.GenderDesc = update.GenderDescription
+		fields = append(fields, "gender", "gender_description")
+	}
+
+	if len(update.Metadata) > 0 {
+		fields = append(fields, "metadata")
+		if user.Metadata == nil {
+			user.Metadata = models.Metadata{}
+		}
+		maps.Copy(user.Metadata, update.Metadata)
+		if validate != nil {
+			if err := validate(user.Metadata); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if update.Version != nil && *update.Version != user.Version {
+		return nil, apperr.ErrVersionConflict
+	}
+	if err := s.Save(ctx, actorID, user, fields); err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, user.ID)
+}
+
+// Save writes the user's editable profile fields and bumps its version, failing with
+// a version conflict if somebody else updated the user since it was read. fields
+// names the changed fields for the user's activity feed.
+func (s *UserService) Save(ctx context.Context, actorID uint, user *models.User, fields []string) error {
+	if err := s.users.SaveProfile(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return apperr.ErrVersionConflict
+		}
+		return apperr.ErrDatabase.WithDetail("Failed to update user").Wrap(err)
+	}
+	s.ProfileChanged(ctx, actorID, user.ID, fields...)
+	return nil
+}
+
+// ProfileChanged adds a change of profile fields by the actor to the user's activity
+// feed, for changes written outside Save
+func (s *UserService) ProfileChanged(ctx context.Context, actorID, userID uint, fields ...string) {
+	recordActivity(ctx, s.activity, models.Activity{
+		UserID:  userID,
+		Type:    models.ActivityProfileUpdated,
+		ActorID: actorOf(actorID, userID),
+		Details: models.Metadata{"fields": fields},
+	})
+}
+
+// AssignRole gives a user a role on behalf of the actor, creating the role if it
+// doesn't exist, and returns the updated user. Tokens carrying the old roles are
+// revoked.
+func (s *UserService) AssignRole(ctx context.Context, actorID, id uint, roleName string) (*models.User, error) {
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		return nil, userError(err)
+	}
+
+	role, err := s.roles.FindOrCreate(ctx, normalizeRole(roleName))
+	if err != nil {
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	for _, r := range user.Roles {
+		if r.ID == role.ID {
+			return nil, apperr.ErrRoleAlreadyAssigned
+		}
+	}
+
+	if err := s.roles.Assign(ctx, user, role); err != nil {
+		return nil, apperr.ErrDatabase.WithDetail("Failed to assign role").Wrap(err)
+	}
+	return s.rolesChanged(ctx, actorID, user, models.ActivityRoleAssigned, role.Name)
+}
+
+// RemoveRole takes a role from a user on behalf of the actor and returns the updated
+// user. Tokens carrying the old roles are revoked.
+func (s *UserService) RemoveRole(ctx context.Context, actorID, id uint, roleName string) (*models.User, error) {
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		return nil, userError(err)
+	}
+
+	roleName = normalizeRole(roleName)
+	i := slices.IndexFunc(user.Roles, func(role models.Role) bool {
+		return role.Name == roleName
+	})
+	if i < 0 {
+		return nil, apperr.ErrRoleNotAssigned
+	}
+
+	if err := s.roles.Remove(ctx, user, &user.Roles[i]); err != nil {
+		return nil, apperr.ErrDatabase.WithDetail("Failed to remove role").Wrap(err)
+	}
+	return s.rolesChanged(ctx, actorID, user, models.ActivityRoleRemoved, roleName)
+}
+
+// rolesChanged records the change in the user's activity feed, revokes the user's
+// tokens, which also bumps the version so the ETag changes, and reloads the user
+func (s *UserService) rolesChanged(ctx context.Context, actorID uint, user *models.User, activity, role string) (*models.User, error) {
+	recordActivity(ctx, s.activity, models.Activity{
+		UserID:  user.ID,
+		Type:    activity,
+		ActorID: actorOf(actorID, user.ID),
+		Details: models.Metadata{"role": role},
+	})
+	if err := s.tokenRepo.RevokeAll(ctx, user); err != nil {
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	if err := s.revokeAccessTokens(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, user.ID)
+}
+
+// RevokeTokens invalidates every access and refresh token issued to a user on behalf
+// of the actor, e.g. when the account was compromised, and returns the updated user.
+// Sessions and tokens kept server-side are ended by the caller.
+func (s *UserService) RevokeTokens(ctx context.Context, actorID, id uint, client Client) (*models.User, error) {
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		return nil, userError(err)
+	}
+	if err := s.tokenRepo.RevokeAll(ctx, user); err != nil {
+		return nil, apperr.ErrDatabase.WithDetail("Failed to revoke tokens").Wrap(err)
+	}
+	if err := s.revokeAccessTokens(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	recordActivity(ctx, s.activity, models.Activity{
+		UserID:    user.ID,
+		Type:      models.ActivityTokensRevoked,
+		ActorID:   actorOf(actorID, user.ID),
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+	return s.reload(ctx, user.ID)
+}
+
+// Suspend blocks a user from logging in and revokes their tokens
+func (s *UserService) Suspend(ctx context.Context, user *models.User, reason string) error {
+	if err := s.users.Suspend(ctx, user, reason); err != nil {
+		return apperr.ErrDatabase.WithDetail("Failed to suspend user").Wrap(err)
+	}
+	return s.revokeAccessTokens(ctx, user.ID)
+}
+
+// revokeAccessTokens rejects the access tokens issued to the user until now. Bumping
+// the token version is not enough for AUTH_MODE=claims, which doesn't load the user.
+func (s *UserService) revokeAccessTokens(ctx context.Context, userID uint) error {
+	users, ok := s.revocations.(sessions.UserRevocations)
+	if !ok {
+		return nil
+	}
+	if err := users.RevokeUser(ctx, userID, time.Now()); err != nil {
+		return apperr.ErrInternal.WithDetail("Failed to revoke tokens").Wrap(err)
+	}
+	return nil
+}
+
+// reload loads the stored user with roles
+func (s *UserService) reload(ctx context.Context, id uint) (*models.User, error) {
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		return nil, apperr.ErrDatabase.Wrap(err)
+	}
+	return user, nil
+}
+
+// normalizeRole lowercases and trims a role name
+func normalizeRole(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,260 @@
+package sessions
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// graceClaimTTL bounds how long a refresh holds its claim, and how long parallel
+// refreshes with the same token wait for its result
+const graceClaimTTL = 5 * time.Second
+
+// gracePollInterval is how often waiting refreshes check for the result
+const gracePollInterval = 50 * time.Millisecond
+
+// GraceStore keeps what refresh tokens were just exchanged for
+type GraceStore interface {
+	// Claim reserves the refresh with a token hash for ttl; false when another
+	// request holds the claim
+	Claim(ctx context.Context, hash string, ttl time.Duration) (bool, error)
+	// Release gives up a claim
+	Release(ctx context.Context, hash string) error
+	// Result returns what the token was exchanged for, or ErrNotFound
+	Result(ctx context.Context, hash string) ([]byte, error)
+	// SetResult stores what the token was exchanged for until ttl passes
+	SetResult(ctx context.Context, hash string, result []byte, ttl time.Duration) error
+}
+
+// Grace lets a refresh token be used again for a short period after its first use,
+// answering with the tokens the first use got. Clients such as single-page apps open
+// in several tabs often refresh with the same token at once; without the grace period
+// all but one of them would be signed out. Refreshes running in parallel wait for the
+// first one to finish instead of racing it.
+type Grace struct {
+	store  GraceStore
+	period time.Duration
+}
+
+// NewGrace creates a grace period of the given length; 0 disables it
+func NewGrace(store GraceStore, period time.Duration) *Grace {
+	return &Grace{store: store, period: period}
+}
+
+// Refresh runs refresh, which uses the token and returns what it was exchanged for,
+// unless the token was used within the grace period; the result of that use is then
+// returned instead. Results are stored encrypted with a key derived from the token,
+// so only its holder can read them. Store failures fall back to running refresh.
+func (g *Grace) Refresh(ctx context.Context, token string, refresh func() ([]byte, error)) ([]byte, error) {
+	if g == nil || g.period <= 0 {
+		return refresh()
+	}
+	hash := Hash(token)
+	deadline := time.Now().Add(graceClaimTTL)
+	for {
+		if sealed, err := g.store.Result(ctx, hash); err == nil {
+			if result, err := openGraceResult(token, sealed); err == nil {
+				return result, nil
+			}
+		} else if !errors.Is(err, ErrNotFound) {
+			logging.Warn(ctx, "refresh grace read failed", "error", err)
+			return refresh()
+		}
+
+		claimed, err := g.store.Claim(ctx, hash, graceClaimTTL)
+		if err != nil {
+			logging.Warn(ctx, "refresh grace claim failed", "error", err)
+			return refresh()
+		}
+		if claimed {
+			return g.claimedRefresh(ctx, token, hash, refresh)
+		}
+		// Another request is refreshing with the token; a failed one releases its
+		// claim without a result and the next attempt gets the same error
+		if time.Now().After(deadline) {
+			return refresh()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(gracePollInterval):
+		}
+	}
+}
+
+// claimedRefresh runs refresh holding the token's claim and keeps its result for the
+// grace period
+func (g *Grace) claimedRefresh(ctx context.Context, token, hash string, refresh func() ([]byte, error)) ([]byte, error) {
+	defer func() {
+		if err := g.store.Release(context.WithoutCancel(ctx), hash); err != nil {
+			logging.Warn(ctx, "refresh grace release failed", "error", err)
+		}
+	}()
+	result, err := refresh()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealGraceResult(token, result)
+	if err == nil {
+		err = g.store.SetResult(context.WithoutCancel(ctx), hash, sealed, g.period)
+	}
+	if err != nil {
+		logging.Warn(ctx, "refresh grace write failed", "error", err)
+	}
+	return result, nil
+}
+
+// graceAEAD is the cipher for the results of a token. The key is a hash of the token
+// distinct from the one it is stored under.
+func graceAEAD(token string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("refresh-grace:" + token))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealGraceResult encrypts a result, prefixed with its nonce
+func sealGraceResult(token string, result []byte) ([]byte, error) {
+	aead, err := graceAEAD(token)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, result, nil), nil
+}
+
+// openGraceResult decrypts a result sealed by sealGraceResult
+func openGraceResult(token string, sealed []byte) ([]byte, error) {
+	aead, err := graceAEAD(token)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed result too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+// graceEntry is a claim or result held by MemoryGraceStore
+type graceEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// MemoryGraceStore is a GraceStore kept by a single instance
+type MemoryGraceStore struct {
+	mu      sync.Mutex
+	claims  map[string]time.Time
+	results map[string]graceEntry
+}
+
+// NewMemoryGraceStore creates an in-process grace store
+func NewMemoryGraceStore() *MemoryGraceStore {
+	return &MemoryGraceStore{claims: make(map[string]time.Time), results: make(map[string]graceEntry)}
+}
+
+// Claim reserves the refresh with a token hash
+func (ms *MemoryGraceStore) Claim(_ context.Context, hash string, ttl time.Duration) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now()
+	if until, ok := ms.claims[hash]; ok && now.Before(until) {
+		return false, nil
+	}
+	ms.claims[hash] = now.Add(ttl)
+	return true, nil
+}
+
+// Release gives up a claim
+func (ms *MemoryGraceStore) Release(_ context.Context, hash string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.claims, hash)
+	return nil
+}
+
+// Result returns what the token was exchanged for
+func (ms *MemoryGraceStore) Result(_ context.Context, hash string) ([]byte, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	entry, ok := ms.results[hash]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, ErrNotFound
+	}
+	return entry.value, nil
+}
+
+// SetResult stores what the token was exchanged for
+func (ms *MemoryGraceStore) SetResult(_ context.Context, hash string, result []byte, ttl time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	// Forget expired results and abandoned claims
+	now := time.Now()
+	for h, entry := range ms.results {
+		if now.After(entry.expires) {
+			delete(ms.results, h)
+		}
+	}
+	for h, until := range ms.claims {
+		if now.After(until) {
+			delete(ms.claims, h)
+		}
+	}
+	ms.results[hash] = graceEntry{value: result, expires: now.Add(ttl)}
+	return nil
+}
+
+// Redis keys of refresh claims and results
+const (
+	graceClaimPrefix  = "um:refresh_claim:"
+	graceResultPrefix = "um:refresh_result:"
+)
+
+// RedisGraceStore is a GraceStore shared by all instances
+type RedisGraceStore struct {
+	client *redis.Client
+}
+
+// NewRedisGraceStore creates a Redis-backed grace store
+func NewRedisGraceStore(client *redis.Client) *RedisGraceStore {
+	return &RedisGraceStore{client: client}
+}
+
+// Claim reserves the refresh with a token hash
+func (rs *RedisGraceStore) Claim(ctx context.Context, hash string, ttl time.Duration) (bool, error) {
+	return rs.client.SetNX(ctx, graceClaimPrefix+hash, 1, ttl).Result()
+}
+
+// Release gives up a claim
+func (rs *RedisGraceStore) Release(ctx context.Context, hash string) error {
+	return rs.client.Del(ctx, graceClaimPrefix+hash).Err()
+}
+
+// Result returns what the token was exchanged for
+func (rs *RedisGraceStore) Result(ctx context.Context, hash string) ([]byte, error) {
+	result, err := rs.client.Get(ctx, graceResultPrefix+hash).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	return result, err
+}
+
+// SetResult stores what the token was exchanged for
+func (rs *RedisGraceStore) SetResult(ctx context.Context, hash string, result []byte, ttl time.Duration) error {
+	return rs.client.Set(ctx, graceResultPrefix+hash, result, ttl).Err()
+}
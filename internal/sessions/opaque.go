@@ -0,0 +1,154 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// GormOpaqueStore keeps opaque token claims in the opaque_tokens table
+type GormOpaqueStore struct {
+	db *gorm.DB
+}
+
+// NewGormOpaqueStore creates a database-backed opaque token store
+func NewGormOpaqueStore(db *gorm.DB) *GormOpaqueStore {
+	return &GormOpaqueStore{db: db}
+}
+
+// Save stores the claims of a new token
+func (gs *GormOpaqueStore) Save(ctx context.Context, hash string, claims *auth.CustomClaims) error {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	db := gs.db.WithContext(ctx)
+
+	// Each login clears the user's expired tokens so the table doesn't grow unbounded
+	now := time.Now().UnixMilli()
+	if err := db.Where("user_id = ? AND expires_at < ?", claims.UserID, now).Delete(&models.OpaqueToken{}).Error; err != nil {
+		return err
+	}
+	return db.Create(&models.OpaqueToken{
+		TokenHash: hash,
+		UserID:    claims.UserID,
+		Claims:    string(data),
+		ExpiresAt: claims.ExpiresAt.Time.UnixMilli(),
+	}).Error
+}
+
+// Load returns the claims of a token
+func (gs *GormOpaqueStore) Load(ctx context.Context, hash string) (*auth.CustomClaims, error) {
+	var token models.OpaqueToken
+	if err := gs.db.WithContext(ctx).Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, auth.ErrOpaqueTokenNotFound
+		}
+		return nil, err
+	}
+	var claims auth.CustomClaims
+	if err := json.Unmarshal([]byte(token.Claims), &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// Delete drops a token
+func (gs *GormOpaqueStore) Delete(ctx context.Context, hash string) error {
+	return gs.db.WithContext(ctx).Where("token_hash = ?", hash).Delete(&models.OpaqueToken{}).Error
+}
+
+// DeleteUser drops every token issued to the user
+func (gs *GormOpaqueStore) DeleteUser(ctx context.Context, userID uint) error {
+	return gs.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.OpaqueToken{}).Error
+}
+
+// Redis keys of opaque tokens: the claims per token hash, and a set of hashes per user
+const (
+	opaquePrefix     = "um:token:"
+	userTokensPrefix = "um:user_tokens:"
+)
+
+// RedisOpaqueStore keeps opaque token claims in Redis, expiring with the tokens
+type RedisOpaqueStore struct {
+	client *redis.Client
+}
+
+// NewRedisOpaqueStore creates a Redis-backed opaque token store
+func NewRedisOpaqueStore(client *redis.Client) *RedisOpaqueStore {
+	return &RedisOpaqueStore{client: client}
+}
+
+// Save stores the claims of a new token
+func (rs *RedisOpaqueStore) Save(ctx context.Context, hash string, claims *auth.CustomClaims) error {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(claims.ExpiresAt.Time)
+	userKey := userTokensKey(claims.UserID)
+	// The set lives as long as the longest-lived token
+	setTTL, err := rs.client.TTL(ctx, userKey).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, opaquePrefix+hash, data, ttl)
+		pipe.SAdd(ctx, userKey, hash)
+		if ttl > setTTL {
+			pipe.Expire(ctx, userKey, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Load returns the claims of a token
+func (rs *RedisOpaqueStore) Load(ctx context.Context, hash string) (*auth.CustomClaims, error) {
+	data, err := rs.client.Get(ctx, opaquePrefix+hash).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, auth.ErrOpaqueTokenNotFound
+		}
+		return nil, err
+	}
+	var claims auth.CustomClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// Delete drops a token. Its entry in the user's set goes when the set expires or the
+// user's tokens are deleted.
+func (rs *RedisOpaqueStore) Delete(ctx context.Context, hash string) error {
+	return rs.client.Del(ctx, opaquePrefix+hash).Err()
+}
+
+// DeleteUser drops every token issued to the user
+func (rs *RedisOpaqueStore) DeleteUser(ctx context.Context, userID uint) error {
+	userKey := userTokensKey(userID)
+	hashes, err := rs.client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{userKey}
+	for _, hash := range hashes {
+		keys = append(keys, opaquePrefix+hash)
+	}
+	return rs.client.Del(ctx, keys...).Err()
+}
+
+func userTokensKey(userID uint) string {
+	return userTokensPrefix + strconv.FormatUint(uint64(userID), 10)
+}
@@ -0,0 +1,177 @@
+package sessions
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// Redis key layout: one key per session holding its JSON, expiring with the refresh
+// token, and a hash per user mapping session IDs to token hashes
+const (
+	sessionPrefix = "um:session:"
+	userPrefix    = "um:user_sessions:"
+	idKey         = "um:session_id"
+)
+
+// RedisStore is a Store shared by all instances. Used and revoked sessions are
+// deleted rather than marked, and expired ones vanish with their key.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a Redis-backed session store
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Create records a newly issued refresh token
+func (rs *RedisStore) Create(ctx context.Context, session *models.RefreshToken) error {
+	id, err := rs.client.Incr(ctx, idKey).Uint64()
+	if err != nil {
+		return err
+	}
+	session.ID = uint(id)
+	session.CreatedAt = time.Now().UnixMilli()
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(time.UnixMilli(session.ExpiresAt))
+	userKey := userSessionsKey(session.UserID)
+	// The index lives as long as the longest-lived session
+	indexTTL, err := rs.client.TTL(ctx, userKey).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionPrefix+session.TokenHash, data, ttl)
+		pipe.HSet(ctx, userKey, strconv.FormatUint(id, 10), session.TokenHash)
+		if ttl > indexTTL {
+			pipe.Expire(ctx, userKey, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Use consumes the active session with the given token hash
+func (rs *RedisStore) Use(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	// GETDEL lets only one of several concurrent refreshes have the session
+	data, err := rs.client.GetDel(ctx, sessionPrefix+hash).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var session models.RefreshToken
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	if err := rs.client.HDel(ctx, userSessionsKey(session.UserID), strconv.FormatUint(uint64(session.ID), 10)).Err(); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// List returns the user's active sessions, newest first
+func (rs *RedisStore) List(ctx context.Context, userID uint) ([]models.RefreshToken, error) {
+	userKey := userSessionsKey(userID)
+	ids, err := rs.client.HGetAll(ctx, userKey).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(ids))
+	keys := make([]string, 0, len(ids))
+	for field, hash := range ids {
+		fields = append(fields, field)
+		keys = append(keys, sessionPrefix+hash)
+	}
+	values, err := rs.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []models.RefreshToken
+	var expired []string
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			expired = append(expired, fields[i])
+			continue
+		}
+		var session models.RefreshToken
+		if err := json.Unmarshal([]byte(data), &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	// Drop the index entries of sessions whose key has expired
+	if len(expired) > 0 {
+		rs.client.HDel(ctx, userKey, expired...)
+	}
+
+	slices.SortFunc(sessions, func(a, b models.RefreshToken) int {
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return sessions, nil
+}
+
+// Revoke ends one of the user's sessions
+func (rs *RedisStore) Revoke(ctx context.Context, userID, id uint) error {
+	userKey := userSessionsKey(userID)
+	field := strconv.FormatUint(uint64(id), 10)
+	hash, err := rs.client.HGet(ctx, userKey, field).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	var deleted *redis.IntCmd
+	_, err = rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.Del(ctx, sessionPrefix+hash)
+		pipe.HDel(ctx, userKey, field)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if deleted.Val() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeAll ends all of the user's sessions
+func (rs *RedisStore) RevokeAll(ctx context.Context, userID uint) error {
+	userKey := userSessionsKey(userID)
+	ids, err := rs.client.HGetAll(ctx, userKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{userKey}
+	for _, hash := range ids {
+		keys = append(keys, sessionPrefix+hash)
+	}
+	return rs.client.Del(ctx, keys...).Err()
+}
+
+func userSessionsKey(userID uint) string {
+	return userPrefix + strconv.FormatUint(uint64(userID), 10)
+}
@@ -0,0 +1,154 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// RevocationList holds the IDs (jti) of individual access tokens that were revoked
+// before they expire, such as the token used to log out
+type RevocationList interface {
+	// Revoke rejects the token with the given ID until it expires
+	Revoke(ctx context.Context, id string, expiresAt time.Time) error
+	// Revoked reports whether the token with the given ID was revoked
+	Revoked(ctx context.Context, id string) bool
+}
+
+// UserRevocations is implemented by revocation lists that can also reject every
+// access token issued to a user up to a point in time, for access tokens that are
+// checked without loading the user. Token issue times only have whole seconds, so a
+// revocation rejects the tokens issued before the second it happened in; those
+// issued within that second can't be told from the ones issued right after it, such
+// as the new pair of a password change, and are kept.
+type UserRevocations interface {
+	// RevokeUser rejects the user's tokens issued before the second of at
+	RevokeUser(ctx context.Context, userID uint, at time.Time) error
+	// UserRevoked reports whether a token of the user issued at issuedAt was revoked
+	UserRevoked(ctx context.Context, userID uint, issuedAt time.Time) bool
+}
+
+// maxAccessTokenTTL is the longest access token lifetime allowed; user revocations
+// are kept that long
+const maxAccessTokenTTL = 24 * time.Hour
+
+// MemoryRevocations is a RevocationList kept by a single instance
+type MemoryRevocations struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	users   map[uint]time.Time
+}
+
+// NewMemoryRevocations creates an in-process revocation list
+func NewMemoryRevocations() *MemoryRevocations {
+	return &MemoryRevocations{revoked: make(map[string]time.Time), users: make(map[uint]time.Time)}
+}
+
+// Revoke rejects the token until it expires
+func (mr *MemoryRevocations) Revoke(_ context.Context, id string, expiresAt time.Time) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	// Tokens past their expiry are rejected anyway, so forget them
+	now := time.Now()
+	for revokedID, until := range mr.revoked {
+		if now.After(until) {
+			delete(mr.revoked, revokedID)
+		}
+	}
+	mr.revoked[id] = expiresAt
+	return nil
+}
+
+// Revoked reports whether the token was revoked
+func (mr *MemoryRevocations) Revoked(_ context.Context, id string) bool {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	until, ok := mr.revoked[id]
+	return ok && time.Now().Before(until)
+}
+
+// RevokeUser rejects the user's tokens issued before the second of at
+func (mr *MemoryRevocations) RevokeUser(_ context.Context, userID uint, at time.Time) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	// Every token issued before a revocation has expired a day later
+	now := time.Now()
+	for id, revokedAt := range mr.users {
+		if now.Sub(revokedAt) > maxAccessTokenTTL {
+			delete(mr.users, id)
+		}
+	}
+	mr.users[userID] = at.Truncate(time.Second)
+	return nil
+}
+
+// UserRevoked reports whether a token of the user was revoked
+func (mr *MemoryRevocations) UserRevoked(_ context.Context, userID uint, issuedAt time.Time) bool {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	revokedAt, ok := mr.users[userID]
+	return ok && issuedAt.Truncate(time.Second).Before(revokedAt)
+}
+
+// Redis keys of revoked token IDs and of the time each user's tokens were revoked
+const (
+	revokedPrefix     = "um:revoked:"
+	revokedUserPrefix = "um:revoked_user:"
+)
+
+// RedisRevocations is a RevocationList shared by all instances. Read errors are
+// logged and the token is accepted, so an outage doesn't lock every user out.
+type RedisRevocations struct {
+	client *redis.Client
+}
+
+// NewRedisRevocations creates a Redis-backed revocation list
+func NewRedisRevocations(client *redis.Client) *RedisRevocations {
+	return &RedisRevocations{client: client}
+}
+
+// Revoke rejects the token until it expires
+func (rr *RedisRevocations) Revoke(ctx context.Context, id string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return rr.client.Set(ctx, revokedPrefix+id, 1, ttl).Err()
+}
+
+// Revoked reports whether the token was revoked
+func (rr *RedisRevocations) Revoked(ctx context.Context, id string) bool {
+	n, err := rr.client.Exists(ctx, revokedPrefix+id).Result()
+	if err != nil {
+		logging.Warn(ctx, "revocation list read failed", "token_id", id, "error", err)
+		return false
+	}
+	return n > 0
+}
+
+// RevokeUser rejects the user's tokens issued before the second of at
+func (rr *RedisRevocations) RevokeUser(ctx context.Context, userID uint, at time.Time) error {
+	key := revokedUserPrefix + strconv.FormatUint(uint64(userID), 10)
+	return rr.client.Set(ctx, key, at.Truncate(time.Second).UnixMilli(), maxAccessTokenTTL).Err()
+}
+
+// UserRevoked reports whether a token of the user was revoked
+func (rr *RedisRevocations) UserRevoked(ctx context.Context, userID uint, issuedAt time.Time) bool {
+	key := revokedUserPrefix + strconv.FormatUint(uint64(userID), 10)
+	revokedAt, err := rr.client.Get(ctx, key).Int64()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			logging.Warn(ctx, "revocation list read failed", "user_id", userID, "error", err)
+		}
+		return false
+	}
+	return issuedAt.Truncate(time.Second).UnixMilli() < revokedAt
+}
@@ -0,0 +1,40 @@
+package sessions_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+)
+
+func TestMemoryUserRevocationsUseWholeSeconds(t *testing.T) {
+	ctx := context.Background()
+	revokedAt := time.Date(2024, 6, 1, 12, 0, 0, 500*int(time.Millisecond), time.UTC)
+	revocations := sessions.NewMemoryRevocations()
+	if err := revocations.RevokeUser(ctx, 1, revokedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		revoked  bool
+	}{
+		{"second before", revokedAt.Add(-time.Second), true},
+		// iat drops the milliseconds, so a token issued right after the revocation
+		// looks like one issued at the start of its second
+		{"same second", revokedAt.Truncate(time.Second), false},
+		{"later", revokedAt.Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := revocations.UserRevoked(ctx, 1, tt.issuedAt); got != tt.revoked {
+				t.Errorf("UserRevoked() = %v, want %v", got, tt.revoked)
+			}
+		})
+	}
+	if revocations.UserRevoked(ctx, 2, revokedAt.Add(-time.Hour)) {
+		t.Error("another user's tokens were revoked")
+	}
+}
@@ -0,0 +1,104 @@
+// Package sessions keeps track of issued refresh tokens. Only SHA-256 hashes of the
+// tokens are stored, so a leaked table cannot be used to mint new access tokens, and
+// every token can be revoked on its own.
+package sessions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// ErrNotFound is returned when no active session matches
+var ErrNotFound = errors.New("session not found")
+
+// Store persists refresh token sessions
+type Store interface {
+	// Create records a newly issued refresh token
+	Create(ctx context.Context, session *models.RefreshToken) error
+	// Use consumes the active session with the given token hash so it cannot be used
+	// again, and returns it. ErrNotFound is returned for unknown, expired or revoked tokens.
+	Use(ctx context.Context, hash string) (*models.RefreshToken, error)
+	// List returns the user's active sessions, newest first
+	List(ctx context.Context, userID uint) ([]models.RefreshToken, error)
+	// Revoke ends one of the user's sessions
+	Revoke(ctx context.Context, userID, id uint) error
+	// RevokeAll ends all of the user's sessions
+	RevokeAll(ctx context.Context, userID uint) error
+}
+
+// Hash returns the hex-encoded SHA-256 hash a refresh token is stored under
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GormStore is a Store backed by the refresh_tokens table
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates a database-backed session store
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Create records a newly issued refresh token
+func (gs *GormStore) Create(ctx context.Context, session *models.RefreshToken) error {
+	return gs.db.WithContext(ctx).Create(session).Error
+}
+
+// Use consumes the active session with the given token hash
+func (gs *GormStore) Use(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	now := time.Now().UnixMilli()
+	var sessions []models.RefreshToken
+	// A single conditional update makes concurrent refreshes race safely: only one wins
+	result := gs.db.WithContext(ctx).Model(&sessions).Clauses(clause.Returning{}).
+		Where("token_hash = ? AND revoked_at IS NULL AND expires_at > ?", hash, now).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || len(sessions) == 0 {
+		return nil, ErrNotFound
+	}
+	return &sessions[0], nil
+}
+
+// List returns the user's active sessions, newest first
+func (gs *GormStore) List(ctx context.Context, userID uint) ([]models.RefreshToken, error) {
+	var sessions []models.RefreshToken
+	err := gs.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now().UnixMilli()).
+		Order("created_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke ends one of the user's sessions
+func (gs *GormStore) Revoke(ctx context.Context, userID, id uint) error {
+	result := gs.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now().UnixMilli())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeAll ends all of the user's sessions
+func (gs *GormStore) RevokeAll(ctx context.Context, userID uint) error {
+	return gs.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now().UnixMilli()).Error
+}
@@ -0,0 +1,44 @@
+// Package sms sends text messages such as phone verification codes.
+package sms
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+)
+
+// Sender delivers a text message to a phone number in E.164 format
+type Sender interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+// NewSender creates the sender selected by cfg.Provider
+func NewSender(cfg config.SMSConfig) (Sender, error) {
+	switch cfg.Provider {
+	case "log":
+		return LogSender{}, nil
+	case "twilio":
+		return &TwilioSender{
+			AccountSID: cfg.TwilioAccountSID,
+			AuthToken:  cfg.TwilioAuthToken,
+			From:       cfg.TwilioFrom,
+			Client:     &http.Client{Timeout: 15 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", cfg.Provider)
+	}
+}
+
+// LogSender writes messages to the application log instead of sending them.
+// It is meant for local development.
+type LogSender struct{}
+
+// Send logs the message
+func (LogSender) Send(ctx context.Context, to, body string) error {
+	logging.Info(ctx, "sms message", "to", to, "body", body)
+	return nil
+}
@@ -0,0 +1,55 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// twilioAPI is the base URL of the Twilio REST API
+const twilioAPI = "https://api.twilio.com/2010-04-01"
+
+// TwilioSender sends messages through the Twilio Messages API
+type TwilioSender struct {
+	AccountSID string
+	AuthToken  string
+	From       string // Sending number in E.164 format or a messaging service SID
+	Client     *http.Client
+}
+
+// Send creates a message resource
+func (ts *TwilioSender) Send(ctx context.Context, to, body string) error {
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(ts.From, "MG") {
+		form.Set("MessagingServiceSid", ts.From)
+	} else {
+		form.Set("From", ts.From)
+	}
+
+	endpoint := twilioAPI + "/Accounts/" + url.PathEscape(ts.AccountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(ts.AccountSID, ts.AuthToken)
+
+	resp, err := ts.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("twilio request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("twilio returned status %d: %d %s", resp.StatusCode, apiErr.Code, apiErr.Message)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package spa serves the build of a single-page frontend from the API server, so the
+// API and its frontend can ship as one deployment. Paths without a file get the app's
+// index.html, letting the app route on the client.
+package spa
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+)
+
+// immutableMaxAge is how long fingerprinted assets are cached
+const immutableMaxAge = 365 * 24 * time.Hour
+
+// Server serves a frontend build
+type Server struct {
+	files          fs.FS
+	immutablePaths []string
+	maxAge         time.Duration
+	// notFound answers requests the app doesn't handle
+	notFound gin.HandlerFunc
+}
+
+// New serves the build in cfg.Dir, which must contain an index.html. Requests for the
+// API, requests other than GET and HEAD, and missing assets are passed to notFound.
+func New(cfg config.StaticConfig, notFound gin.HandlerFunc) (*Server, error) {
+	files := os.DirFS(cfg.Dir)
+	if info, err := fs.Stat(files, "index.html"); err != nil || info.IsDir() {
+		return nil, fmt.Errorf("no index.html in STATIC_DIR %s", cfg.Dir)
+	}
+	return &Server{
+		files:          files,
+		immutablePaths: cfg.ImmutablePaths,
+		maxAge:         cfg.MaxAge,
+		notFound:       notFound,
+	}, nil
+}
+
+// Handler serves a file of the build, or index.html for paths of the app. Register
+// it as the router's NoRoute handler.
+func (s *Server) Handler(c *gin.Context) {
+	p := c.Request.URL.Path
+	if (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) ||
+		p == "/api" || strings.HasPrefix(p, "/api/") {
+		s.notFound(c)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name != "" && name != "index.html" {
+		err := s.serve(c, name)
+		if err == nil {
+			return
+		}
+		// A missing script or image is an error; the page would not help
+		if !errors.Is(err, fs.ErrNotExist) || path.Ext(name) != "" {
+			s.notFound(c)
+			return
+		}
+	}
+
+	// The page is revalidated every time so a new release is picked up at once
+	c.Header("Cache-Control", "no-cache")
+	if err := s.serveFile(c, "index.html"); err != nil {
+		s.notFound(c)
+	}
+}
+
+// serve sends a file of the build with its cache lifetime. Directories count as
+// missing.
+func (s *Server) serve(c *gin.Context, name string) error {
+	cacheControl := "public, max-age=" + seconds(s.maxAge)
+	for _, prefix := range s.immutablePaths {
+		if strings.HasPrefix("/"+name, prefix) {
+			cacheControl = "public, max-age=" + seconds(immutableMaxAge) + ", immutable"
+			break
+		}
+	}
+
+	if info, err := fs.Stat(s.files, name); err != nil {
+		return err
+	} else if info.IsDir() {
+		return fs.ErrNotExist
+	}
+	c.Header("Cache-Control", cacheControl)
+	return s.serveFile(c, name)
+}
+
+// serveFile sends a file, answering conditional and range requests
+func (s *Server) serveFile(c *gin.Context, name string) error {
+	f, err := s.files.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		return fmt.Errorf("%s is not seekable", name)
+	}
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), content)
+	return nil
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
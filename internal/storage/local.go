@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalStorage writes objects below Dir. When BaseURL is a path (e.g. /uploads)
+// the API serves Dir itself.
+type LocalStorage struct {
+	Dir     string
+	BaseURL string
+}
+
+// Put writes the object atomically so readers never see a partial file
+func (ls *LocalStorage) Put(_ context.Context, key string, data []byte, _ string) (string, error) {
+	path := filepath.Join(ls.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return ls.BaseURL + "/" + key, nil
+}
+
+// Delete removes the object file
+func (ls *LocalStorage) Delete(_ context.Context, key string) error {
+	err := os.Remove(filepath.Join(ls.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/awssig"
+)
+
+// S3Storage stores objects in an S3-compatible bucket (AWS S3, MinIO, ...) using
+// path-style URLs. Objects must be made publicly readable by a bucket policy.
+type S3Storage struct {
+	Endpoint    string
+	Bucket      string
+	Region      string
+	BaseURL     string
+	Credentials awssig.Credentials
+	Client      *http.Client
+}
+
+// Put uploads the object with a signed PUT request
+func (ss *S3Storage) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, ss.objectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if err := ss.do(req, data); err != nil {
+		return "", err
+	}
+	return ss.BaseURL + "/" + key, nil
+}
+
+// Delete removes the object with a signed DELETE request
+func (ss *S3Storage) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, ss.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	return ss.do(req, nil)
+}
+
+func (ss *S3Storage) objectURL(key string) string {
+	return ss.Endpoint + "/" + ss.Bucket + "/" + key
+}
+
+func (ss *S3Storage) do(req *http.Request, body []byte) error {
+	awssig.Sign(req, body, ss.Credentials, ss.Region, "s3", time.Now())
+
+	resp, err := ss.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("s3 %s request failed: %w", req.Method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("s3 %s %s returned status %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Package storage keeps uploaded files such as avatars on local disk or in an
+// S3-compatible object store and returns the URL they are served from.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ristep/um_starter_jwt_go/internal/awssig"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+)
+
+// Storage saves and removes objects by key (e.g. "avatars/12-3f9a.png")
+type Storage interface {
+	// Put stores data under key and returns its public URL
+	Put(ctx context.Context, key string, data []byte, contentType string) (string, error)
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewStorage creates the storage selected by cfg.Provider
+func NewStorage(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Provider {
+	case "local":
+		publicURL := cfg.PublicURL
+		if publicURL == "" {
+			publicURL = "/uploads"
+		}
+		return &LocalStorage{Dir: cfg.LocalDir, BaseURL: strings.TrimRight(publicURL, "/")}, nil
+	case "s3":
+		creds := awssig.Credentials{AccessKeyID: cfg.S3AccessKeyID, SecretAccessKey: cfg.S3SecretAccessKey}
+		if creds.AccessKeyID == "" {
+			creds = awssig.CredentialsFromEnv()
+		}
+		publicURL := cfg.PublicURL
+		if publicURL == "" {
+			publicURL = strings.TrimRight(cfg.S3Endpoint, "/") + "/" + cfg.S3Bucket
+		}
+		return &S3Storage{
+			Endpoint:    strings.TrimRight(cfg.S3Endpoint, "/"),
+			Bucket:      cfg.S3Bucket,
+			Region:      cfg.S3Region,
+			BaseURL:     strings.TrimRight(publicURL, "/"),
+			Credentials: creds,
+			Client:      &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage provider %q", cfg.Provider)
+	}
+}
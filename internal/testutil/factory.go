@@ -0,0 +1,173 @@
+// Package testutil helps writing handler and middleware tests: factories for users,
+// a database bootstrap, and HTTP helpers that sign valid tokens and decode the API's
+// envelopes and problems. Helpers take the test and fail it instead of panicking.
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+)
+
+// Password is the password of users built by the factories
+const Password = "password123"
+
+// passwordHash is Password hashed at the lowest cost, so factories stay fast; it is
+// hashed on first use
+var passwordHash = sync.OnceValues(func() ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(Password), bcrypt.MinCost)
+})
+
+// hashPassword hashes password at the lowest cost
+func hashPassword(t testing.TB, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	return string(hash)
+}
+
+// sequence numbers the users built by the factories
+var sequence atomic.Uint64
+
+// UserOption adjusts a user built by a factory
+type UserOption func(*models.User)
+
+// WithRoles gives the user roles, replacing the default user role
+func WithRoles(names ...string) UserOption {
+	return func(u *models.User) {
+		u.Roles = nil
+		for _, name := range names {
+			u.Roles = append(u.Roles, models.Role{Name: name})
+		}
+	}
+}
+
+// WithEmail sets the user's email
+func WithEmail(email string) UserOption {
+	return func(u *models.User) {
+		u.Email = email
+	}
+}
+
+// WithUsername sets the user's username
+func WithUsername(username string) UserOption {
+	return func(u *models.User) {
+		u.Username = &username
+	}
+}
+
+// WithPassword sets the user's password, hashed at the lowest cost
+func WithPassword(t testing.TB, password string) UserOption {
+	t.Helper()
+	hash := hashPassword(t, password)
+	return func(u *models.User) {
+		u.Password = hash
+	}
+}
+
+// WithMetadata sets the user's metadata
+func WithMetadata(metadata models.Metadata) UserOption {
+	return func(u *models.User) {
+		u.Metadata = metadata
+	}
+}
+
+// Verified marks the user's email and phone number as verified
+func Verified() UserOption {
+	return func(u *models.User) {
+		u.EmailVerified = true
+		u.Tel = "+38970123456"
+		u.PhoneVerified = true
+	}
+}
+
+// Suspended suspends the user
+func Suspended(reason string) UserOption {
+	return func(u *models.User) {
+		now := time.Now().UnixMilli()
+		u.SuspendedAt = &now
+		u.SuspendReason = reason
+	}
+}
+
+// NewUser builds an unsaved user with the user role, a unique email and Password
+func NewUser(t testing.TB, opts ...UserOption) *models.User {
+	t.Helper()
+	hash, err := passwordHash()
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	n := sequence.Add(1)
+	now := time.Now().UnixMilli()
+	user := &models.User{
+		Email:         fmt.Sprintf("user%d@example.com", n),
+		Name:          fmt.Sprintf("Test User %d", n),
+		Password:      string(hash),
+		PasswordSetAt: now,
+		LastActiveAt:  now,
+		Metadata:      models.Metadata{},
+		Roles:         []models.Role{{Name: "user"}},
+		Version:       1,
+	}
+	for _, opt := range opts {
+		opt(user)
+	}
+	return user
+}
+
+// NewVerifiedUser builds an unsaved user with a verified email and phone number
+func NewVerifiedUser(t testing.TB, opts ...UserOption) *models.User {
+	t.Helper()
+	return NewUser(t, append([]UserOption{Verified()}, opts...)...)
+}
+
+// NewAdmin builds an unsaved verified user with the user and admin roles
+func NewAdmin(t testing.TB, opts ...UserOption) *models.User {
+	t.Helper()
+	return NewUser(t, append([]UserOption{Verified(), WithRoles("user", "admin")}, opts...)...)
+}
+
+// CreateUser stores a user built with opts, creating its roles as needed, and
+// returns it as loaded back from users
+func CreateUser(t testing.TB, users repository.UserRepository, roles repository.RoleRepository, opts ...UserOption) *models.User {
+	t.Helper()
+	return Save(t, users, roles, NewUser(t, opts...))
+}
+
+// CreateAdmin stores an admin built with opts
+func CreateAdmin(t testing.TB, users repository.UserRepository, roles repository.RoleRepository, opts ...UserOption) *models.User {
+	t.Helper()
+	return Save(t, users, roles, NewAdmin(t, opts...))
+}
+
+// Save stores a user built by a factory, creating its roles as needed, and returns
+// it as loaded back from users
+func Save(t testing.TB, users repository.UserRepository, roles repository.RoleRepository, user *models.User) *models.User {
+	t.Helper()
+	ctx := context.Background()
+	for i, role := range user.Roles {
+		stored, err := roles.FindOrCreate(ctx, role.Name)
+		if err != nil {
+			t.Fatalf("create role %s: %v", role.Name, err)
+		}
+		user.Roles[i] = *stored
+	}
+	if err := users.Create(ctx, user, nil); err != nil {
+		t.Fatalf("create user %s: %v", user.Email, err)
+	}
+	stored, err := users.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("load user %d: %v", user.ID, err)
+	}
+	return stored
+}
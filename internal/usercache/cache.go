@@ -0,0 +1,124 @@
+// Package usercache keeps recently authenticated users, with their roles, so that
+// AuthMiddleware does not query the database on every request. Entries expire after
+// a short TTL and are dropped whenever the users table is written through GORM.
+package usercache
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// Cache stores users by ID
+type Cache interface {
+	// Get returns a copy of the cached user
+	Get(ctx context.Context, id uint) (*models.User, bool)
+	Set(ctx context.Context, user *models.User)
+	Invalidate(ctx context.Context, id uint)
+	// Purge drops every entry; used when a write cannot be tied to a single user
+	Purge(ctx context.Context)
+}
+
+// Memory is an in-process LRU cache. Other instances do not see its invalidations,
+// so multi-instance deployments should keep the TTL short or use Redis.
+type Memory struct {
+	lru *expirable.LRU[uint, models.User]
+}
+
+// NewMemory creates an LRU cache holding up to size users for ttl
+func NewMemory(size int, ttl time.Duration) *Memory {
+	return &Memory{lru: expirable.NewLRU[uint, models.User](size, nil, ttl)}
+}
+
+// Get returns a copy of the cached user
+func (m *Memory) Get(_ context.Context, id uint) (*models.User, bool) {
+	user, ok := m.lru.Get(id)
+	if !ok {
+		return nil, false
+	}
+	user.Roles = slices.Clone(user.Roles)
+	return &user, true
+}
+
+// Set caches a copy of the user
+func (m *Memory) Set(_ context.Context, user *models.User) {
+	cached := *user
+	cached.Roles = slices.Clone(user.Roles)
+	m.lru.Add(user.ID, cached)
+}
+
+// Invalidate drops the user
+func (m *Memory) Invalidate(_ context.Context, id uint) {
+	m.lru.Remove(id)
+}
+
+// Purge drops every user
+func (m *Memory) Purge(context.Context) {
+	m.lru.Purge()
+}
+
+// InvalidateOnWrite registers GORM callbacks that drop cached users after updates
+// and deletes of the users table, including role changes made through associations.
+// Writes whose model carries no ID (e.g. Where("id = ?", id).Updates(...)) purge the
+// whole cache.
+func InvalidateOnWrite(db *gorm.DB, cache Cache) error {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil || tx.Statement.Schema.Table != (models.User{}).TableName() {
+			return
+		}
+		ctx := tx.Statement.Context
+		ids, ok := userIDs(tx)
+		if !ok {
+			cache.Purge(ctx)
+			return
+		}
+		for _, id := range ids {
+			cache.Invalidate(ctx, id)
+		}
+	}
+
+	if err := db.Callback().Update().After("gorm:update").Register("usercache:invalidate", invalidate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("usercache:invalidate", invalidate)
+}
+
+// userIDs returns the primary keys of the statement's model values; ok is false when
+// any of them is unknown
+func userIDs(tx *gorm.DB) (ids []uint, ok bool) {
+	field := tx.Statement.Schema.PrioritizedPrimaryField
+	if field == nil {
+		return nil, false
+	}
+	ctx := tx.Statement.Context
+
+	add := func(value reflect.Value) bool {
+		v, zero := field.ValueOf(ctx, value)
+		id, isUint := v.(uint)
+		if zero || !isUint {
+			return false
+		}
+		ids = append(ids, id)
+		return true
+	}
+
+	value := reflect.Indirect(tx.Statement.ReflectValue)
+	switch value.Kind() {
+	case reflect.Struct:
+		return ids, add(value)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if !add(reflect.Indirect(value.Index(i))) {
+				return nil, false
+			}
+		}
+		return ids, len(ids) > 0
+	}
+	return nil, false
+}
@@ -0,0 +1,98 @@
+package usercache
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ristep/um_starter_jwt_go/internal/logging"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// keyPrefix namespaces the cache keys in Redis
+const keyPrefix = "um:user:"
+
+// Redis is a cache shared by all instances. Redis errors are logged and treated as
+// misses so an outage only costs database queries.
+type Redis struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedis creates a Redis-backed cache whose entries expire after ttl
+func NewRedis(client *redis.Client, ttl time.Duration) *Redis {
+	return &Redis{client: client, ttl: ttl}
+}
+
+// redisEntry is the stored form of a user. The password hash is deliberately left
+// out; the fields hidden from the API that authentication needs are kept.
+type redisEntry struct {
+	User         models.User `json:"user"`
+	TokenVersion uint        `json:"token_version"`
+	AvatarKey    string      `json:"avatar_key"`
+}
+
+// Get loads the user from Redis
+func (rc *Redis) Get(ctx context.Context, id uint) (*models.User, bool) {
+	data, err := rc.client.Get(ctx, key(id)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			logging.Warn(ctx, "user cache read failed", "user_id", id, "error", err)
+		}
+		return nil, false
+	}
+
+	var entry redisEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		logging.Warn(ctx, "user cache entry is corrupt", "user_id", id, "error", err)
+		return nil, false
+	}
+	entry.User.TokenVersion = entry.TokenVersion
+	entry.User.AvatarKey = entry.AvatarKey
+	// Age is derived on load, so recompute it as the database would
+	entry.User.AfterFind(nil)
+	return &entry.User, true
+}
+
+// Set stores the user in Redis
+func (rc *Redis) Set(ctx context.Context, user *models.User) {
+	data, err := json.Marshal(redisEntry{User: *user, TokenVersion: user.TokenVersion, AvatarKey: user.AvatarKey})
+	if err != nil {
+		return
+	}
+	if err := rc.client.Set(ctx, key(user.ID), data, rc.ttl).Err(); err != nil {
+		logging.Warn(ctx, "user cache write failed", "user_id", user.ID, "error", err)
+	}
+}
+
+// Invalidate deletes the user from Redis
+func (rc *Redis) Invalidate(ctx context.Context, id uint) {
+	if err := rc.client.Del(ctx, key(id)).Err(); err != nil {
+		logging.Warn(ctx, "user cache invalidation failed", "user_id", id, "error", err)
+	}
+}
+
+// Purge deletes every cached user
+func (rc *Redis) Purge(ctx context.Context) {
+	iter := rc.client.Scan(ctx, 0, keyPrefix+"*", 500).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		logging.Warn(ctx, "user cache purge failed", "error", err)
+		return
+	}
+	if len(keys) > 0 {
+		if err := rc.client.Unlink(ctx, keys...).Err(); err != nil {
+			logging.Warn(ctx, "user cache purge failed", "error", err)
+		}
+	}
+}
+
+func key(id uint) string {
+	return keyPrefix + strconv.FormatUint(uint64(id), 10)
+}
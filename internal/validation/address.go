@@ -0,0 +1,84 @@
+package validation
+
+import (
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// normalizeAddresses turns on the tidying of cities and addresses
+var normalizeAddresses atomic.Bool
+
+// SetAddressNormalization sets whether NormalizeCity and NormalizeAddress tidy their input
+func SetAddressNormalization(on bool) {
+	normalizeAddresses.Store(on)
+}
+
+// NormalizeCountry returns the ISO 3166-1 alpha-2 code of a country given by its
+// alpha-2 or alpha-3 code in any case, e.g. "MK" for "mkd". Replaced codes map to
+// their successor, e.g. "UK" to "GB".
+func NormalizeCountry(code string) (string, bool) {
+	if len(code) < 2 || len(code) > 3 || strings.IndexFunc(code, func(r rune) bool { return !isASCIILetter(r) }) >= 0 {
+		return "", false
+	}
+	region, err := language.ParseRegion(code)
+	if err != nil {
+		return "", false
+	}
+	region = region.Canonicalize()
+	if !region.IsCountry() {
+		return "", false
+	}
+	return region.String(), true
+}
+
+// NormalizeCity trims a city name, collapses its spaces and title-cases a name typed
+// all in upper or lower case, e.g. "NEW YORK" to "New York". It returns the name
+// unchanged when normalization is off.
+func NormalizeCity(city string) string {
+	if !normalizeAddresses.Load() {
+		return city
+	}
+	city = strings.Join(strings.Fields(city), " ")
+	if city == strings.ToLower(city) || city == strings.ToUpper(city) {
+		city = cases.Title(language.Und).String(city)
+	}
+	return city
+}
+
+// NormalizeAddress trims each line of an address, collapses its spaces and drops
+// empty lines. It returns the address unchanged when normalization is off.
+func NormalizeAddress(address string) string {
+	if !normalizeAddresses.Load() {
+		return address
+	}
+	var lines []string
+	for _, line := range strings.Split(address, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validateCountry implements the "country" binding rule
+func validateCountry(fl validator.FieldLevel) bool {
+	_, ok := NormalizeCountry(fl.Field().String())
+	return ok
+}
+
+// validatePrintable implements the "printable" binding rule: text without control
+// characters other than line breaks
+func validatePrintable(fl validator.FieldLevel) bool {
+	return strings.IndexFunc(fl.Field().String(), func(r rune) bool {
+		return r != '\n' && r != '\r' && unicode.IsControl(r) || r == unicode.ReplacementChar
+	}) < 0
+}
+
+func isASCIILetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
@@ -0,0 +1,45 @@
+package validation
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+)
+
+// ageLimits holds the accepted age range as [min, max]
+var ageLimits atomic.Pointer[[2]int]
+
+func init() {
+	ageLimits.Store(&[2]int{0, 130})
+}
+
+// SetAgeLimits sets the range of ages the "birthdate" rule accepts
+func SetAgeLimits(min, max int) {
+	ageLimits.Store(&[2]int{min, max})
+}
+
+// validateBirthdate implements the "birthdate" binding rule: a "2006-01-02" date in
+// the past giving an age within the configured limits
+func validateBirthdate(fl validator.FieldLevel) bool {
+	dob, err := models.ParseDate(fl.Field().String())
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	if dob.After(now) {
+		return false
+	}
+	limits := ageLimits.Load()
+	age := dob.YearsAt(now)
+	return age >= limits[0] && age <= limits[1]
+}
+
+// ageLimitVars returns the message variables of the "birthdate" rule
+func ageLimitVars() map[string]string {
+	limits := ageLimits.Load()
+	return map[string]string{"min": strconv.Itoa(limits[0]), "max": strconv.Itoa(limits[1])}
+}
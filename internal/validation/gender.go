@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// GenderSelfDescribed is the gender option whose description the user writes themselves
+const GenderSelfDescribed = "self_described"
+
+// genderOptions holds the genders the "gender" rule accepts besides GenderSelfDescribed
+var genderOptions atomic.Pointer[[]string]
+
+func init() {
+	genderOptions.Store(&[]string{"female", "male", "non_binary", "prefer_not_to_say"})
+}
+
+// SetGenderOptions sets the genders the "gender" rule accepts; GenderSelfDescribed
+// is always accepted
+func SetGenderOptions(options []string) {
+	genderOptions.Store(&options)
+}
+
+// validateGender implements the "gender" binding rule
+func validateGender(fl validator.FieldLevel) bool {
+	gender := fl.Field().String()
+	return gender == GenderSelfDescribed || slices.Contains(*genderOptions.Load(), gender)
+}
+
+// genderVars returns the message variables of the "gender" rule
+func genderVars() map[string]string {
+	options := append(slices.Clone(*genderOptions.Load()), GenderSelfDescribed)
+	return map[string]string{"options": strings.Join(options, ", ")}
+}
+
+// GenderDescription returns the description to store with a gender that passed the
+// "gender" rule. It is required for GenderSelfDescribed and dropped for other genders.
+func GenderDescription(c *gin.Context, gender, description string) (string, error) {
+	if gender != GenderSelfDescribed {
+		return "", nil
+	}
+	description = strings.TrimSpace(description)
+	if err := Var(c, "gender_description", description, "required,max=100,printable"); err != nil {
+		return "", err
+	}
+	return description, nil
+}
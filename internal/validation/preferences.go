@@ -0,0 +1,41 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
+)
+
+// NormalizeTimezone returns the canonical name of an IANA time zone, e.g. "Europe/Skopje"
+func NormalizeTimezone(name string) (string, bool) {
+	if name == "" || name == "Local" {
+		return "", false
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return "", false
+	}
+	return loc.String(), true
+}
+
+// NormalizeLocale returns the canonical form of a BCP 47 language tag, e.g. "de-CH"
+func NormalizeLocale(tag string) (string, bool) {
+	parsed, err := language.Parse(tag)
+	if err != nil {
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// validateTimezone implements the "timezone" binding rule
+func validateTimezone(fl validator.FieldLevel) bool {
+	_, ok := NormalizeTimezone(fl.Field().String())
+	return ok
+}
+
+// validateLocale implements the "locale" binding rule
+func validateLocale(fl validator.FieldLevel) bool {
+	_, ok := NormalizeLocale(fl.Field().String())
+	return ok
+}
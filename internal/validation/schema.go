@@ -0,0 +1,188 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/i18n"
+)
+
+// Field types supported by deployment-defined profile fields
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeNumber = "number"
+	TypeBool   = "bool"
+)
+
+// FieldSpec declares one additional profile field
+type FieldSpec struct {
+	Name     string
+	Type     string
+	Required bool
+	Rules    string // validator tags, e.g. "min=1,max=99999"
+}
+
+// FieldSchema validates deployment-defined profile fields stored in user metadata
+type FieldSchema struct {
+	fields   []FieldSpec
+	validate *validator.Validate
+}
+
+// ParseFieldSchema builds a schema from specs of the form
+// name:type[:required|optional[:rules]], where rules are validator tags separated
+// by ";" (e.g. "employee_id:int:required:min=1;max=99999")
+func ParseFieldSchema(specs []string) (*FieldSchema, error) {
+	schema := &FieldSchema{validate: validator.New()}
+	seen := make(map[string]bool)
+
+	for _, spec := range specs {
+		parts := strings.SplitN(strings.TrimSpace(spec), ":", 4)
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("profile field %q: expected name:type[:required|optional[:rules]]", spec)
+		}
+
+		field := FieldSpec{Name: parts[0], Type: parts[1]}
+		switch field.Type {
+		case TypeString, TypeInt, TypeNumber, TypeBool:
+		default:
+			return nil, fmt.Errorf("profile field %q: type must be one of string, int, number, bool", field.Name)
+		}
+		if len(parts) > 2 {
+			switch parts[2] {
+			case "required":
+				field.Required = true
+			case "optional", "":
+			default:
+				return nil, fmt.Errorf("profile field %q: expected required or optional, got %q", field.Name, parts[2])
+			}
+		}
+		if len(parts) > 3 {
+			field.Rules = strings.ReplaceAll(parts[3], ";", ",")
+		}
+		if seen[field.Name] {
+			return nil, fmt.Errorf("profile field %q is declared twice", field.Name)
+		}
+		seen[field.Name] = true
+
+		// Reject rules the validator does not know at startup instead of panicking per request
+		if field.Rules != "" {
+			if err := checkRules(schema.validate, field); err != nil {
+				return nil, err
+			}
+		}
+		schema.fields = append(schema.fields, field)
+	}
+	return schema, nil
+}
+
+func checkRules(v *validator.Validate, field FieldSpec) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("profile field %q: invalid rules %q: %v", field.Name, field.Rules, r)
+		}
+	}()
+	v.Var(zeroValue(field.Type), field.Rules)
+	return nil
+}
+
+func zeroValue(typ string) any {
+	switch typ {
+	case TypeInt:
+		return int64(0)
+	case TypeNumber:
+		return float64(0)
+	case TypeBool:
+		return false
+	default:
+		return ""
+	}
+}
+
+// Fields returns the declared fields
+func (fs *FieldSchema) Fields() []FieldSpec {
+	return fs.fields
+}
+
+// Validate checks the declared fields in values (a user's metadata), converting
+// whole JSON numbers of int fields to int64. Undeclared keys are left alone.
+// Failures are reported under "metadata.<name>".
+func (fs *FieldSchema) Validate(c *gin.Context, values map[string]any) error {
+	if fs == nil || len(fs.fields) == 0 {
+		return nil
+	}
+
+	lang := i18n.Language(c)
+	var errs []apperr.FieldError
+	for _, field := range fs.fields {
+		path := "metadata." + field.Name
+		value, present := values[field.Name]
+		if !present || value == nil {
+			if field.Required {
+				errs = append(errs, apperr.FieldError{Field: path, Rule: "required", Message: i18n.T(lang, "validation.required", nil)})
+			}
+			continue
+		}
+
+		converted, ok := convert(field.Type, value)
+		if !ok {
+			errs = append(errs, apperr.FieldError{
+				Field:   path,
+				Rule:    "type",
+				Param:   field.Type,
+				Message: i18n.T(lang, "validation.type", map[string]string{"param": field.Type}),
+			})
+			continue
+		}
+		values[field.Name] = converted
+
+		if field.Rules == "" {
+			continue
+		}
+		if err := fs.validate.Var(converted, field.Rules); err != nil {
+			if fieldErrs, ok := err.(validator.ValidationErrors); ok {
+				fe := fieldErrs[0]
+				errs = append(errs, apperr.FieldError{Field: path, Rule: fe.Tag(), Param: fe.Param(), Message: message(lang, fe)})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return apperr.ErrValidation.WithFields(errs)
+	}
+	return nil
+}
+
+// convert checks that a decoded JSON value matches typ
+func convert(typ string, value any) (any, bool) {
+	switch typ {
+	case TypeString:
+		s, ok := value.(string)
+		return s, ok
+	case TypeBool:
+		b, ok := value.(bool)
+		return b, ok
+	case TypeNumber:
+		switch n := value.(type) {
+		case float64:
+			return n, true
+		case int64:
+			return float64(n), true
+		}
+	case TypeInt:
+		switch n := value.(type) {
+		case float64:
+			if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+				return int64(n), true
+			}
+		case int64:
+			return n, true
+		}
+	}
+	return nil, false
+}
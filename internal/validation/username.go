@@ -0,0 +1,26 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// usernamePattern allows 3-32 characters: a letter followed by letters, digits, '_', '.' or '-'
+var usernamePattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{2,31}$`)
+
+// NormalizeUsername returns the canonical (trimmed, lower-case) form of a username
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// ValidUsername reports whether username is acceptable once normalized
+func ValidUsername(username string) bool {
+	return usernamePattern.MatchString(NormalizeUsername(username))
+}
+
+// validateUsername implements the "username" binding rule
+func validateUsername(fl validator.FieldLevel) bool {
+	return ValidUsername(fl.Field().String())
+}
@@ -0,0 +1,192 @@
+// Package validation turns request binding failures into structured, field-level API errors.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/i18n"
+	"github.com/ristep/um_starter_jwt_go/internal/phone"
+)
+
+// MessageFunc builds the human-readable message for a failed rule
+type MessageFunc func(fe validator.FieldError) string
+
+var (
+	mu       sync.RWMutex
+	messages = make(map[string]MessageFunc)
+)
+
+// RegisterMessage sets the message used for a validation rule. It takes precedence
+// over the i18n catalogs; to localise a custom rule add "validation.<rule>" keys to
+// the catalogs instead.
+func RegisterMessage(rule string, fn MessageFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	messages[rule] = fn
+}
+
+// Setup makes the Gin validator report JSON field names instead of Go struct field names.
+// Call it once at startup before serving requests.
+func Setup() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+		v.RegisterValidation("username", validateUsername)
+		v.RegisterValidation("phone", validatePhone)
+		v.RegisterValidation("birthdate", validateBirthdate)
+		v.RegisterValidation("timezone", validateTimezone)
+		v.RegisterValidation("locale", validateLocale)
+		v.RegisterValidation("country", validateCountry)
+		v.RegisterValidation("printable", validatePrintable)
+		v.RegisterValidation("gender", validateGender)
+	}
+}
+
+// validatePhone implements the "phone" binding rule; handlers store phone.Normalize's result
+func validatePhone(fl validator.FieldLevel) bool {
+	return phone.Valid(fl.Field().String())
+}
+
+// Translate converts an error returned by ShouldBindJSON into an API error, with
+// field messages in the language negotiated for the request
+func Translate(c *gin.Context, err error) error {
+	lang := i18n.Language(c)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return apperr.ErrRequestTooLarge
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]apperr.FieldError, len(validationErrs))
+		for i, fe := range validationErrs {
+			fields[i] = apperr.FieldError{
+				Field:   fieldPath(fe),
+				Rule:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: message(lang, fe),
+			}
+		}
+		return apperr.ErrValidation.WithFields(fields)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return apperr.ErrValidation.WithFields([]apperr.FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   typeErr.Type.String(),
+			Message: i18n.T(lang, "validation.type", map[string]string{"param": typeErr.Type.String()}),
+		}})
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return apperr.ErrInvalidInput.WithDetail(i18n.T(lang, "validation.invalid_json", nil))
+	}
+
+	return apperr.ErrInvalidInput.Wrap(err)
+}
+
+// Var checks a single value against validator tags and reports failures under field
+func Var(c *gin.Context, field string, value any, tag string) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return nil
+	}
+	err := v.Var(value, tag)
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+	lang := i18n.Language(c)
+	fe := validationErrs[0]
+	return apperr.ErrValidation.WithFields([]apperr.FieldError{{
+		Field:   field,
+		Rule:    fe.Tag(),
+		Param:   fe.Param(),
+		Message: message(lang, fe),
+	}})
+}
+
+// UnknownFields reports request members that do not exist on the resource
+func UnknownFields(c *gin.Context, names []string) error {
+	lang := i18n.Language(c)
+	fields := make([]apperr.FieldError, len(names))
+	for i, name := range names {
+		fields[i] = apperr.FieldError{
+			Field:   name,
+			Rule:    "unknown",
+			Message: i18n.T(lang, "validation.unknown", nil),
+		}
+	}
+	return apperr.ErrValidation.WithFields(fields)
+}
+
+// fieldPath returns the JSON path of the field without the top-level struct name
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if _, rest, ok := strings.Cut(ns, "."); ok {
+		return rest
+	}
+	return fe.Field()
+}
+
+// message resolves a rule's message: a registered MessageFunc first, then the
+// catalog key for the rule ("validation.min.string" for string lengths), then a
+// generic "is invalid"
+func message(lang string, fe validator.FieldError) string {
+	mu.RLock()
+	fn, ok := messages[fe.Tag()]
+	mu.RUnlock()
+	if ok {
+		return fn(fe)
+	}
+
+	param := fe.Param()
+	switch fe.Tag() {
+	case "oneof":
+		param = strings.Join(strings.Fields(param), ", ")
+	case "required_without":
+		// The param is a Go field name; the JSON names in this API are its lower-case form
+		param = strings.ToLower(param)
+	}
+	vars := map[string]string{"param": param}
+	switch fe.Tag() {
+	case "birthdate":
+		vars = ageLimitVars()
+	case "gender":
+		vars = genderVars()
+	}
+
+	key := "validation." + fe.Tag()
+	if fe.Kind() == reflect.String {
+		if _, ok := i18n.Message(lang, key+".string"); ok {
+			key += ".string"
+		}
+	}
+	if _, ok := i18n.Message(lang, key); !ok {
+		key = "validation.invalid"
+	}
+	return i18n.T(lang, key, vars)
+}
@@ -0,0 +1,372 @@
+// Package client is a Go client of the user management API, for sister services
+// that would otherwise hand-roll HTTP calls. It keeps the session of the signed-in
+// user, refreshing the access token before it expires or when the API reports it
+// expired, and retries requests that failed on the network or with 429, 502, 503 or
+// 504 with exponential backoff. Mutating requests carry an Idempotency-Key, so a
+// retry never applies them twice.
+//
+//	c := client.New("https://users.example.com")
+//	if _, err := c.Login(ctx, client.Credentials{Email: email, Password: password}); err != nil {
+//		...
+//	}
+//	page, err := c.ListUsers(ctx, client.ListUsersOptions{PerPage: 50})
+//
+// API errors are returned as *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshMargin is how long before its expiry an access token is refreshed
+const refreshMargin = 30 * time.Second
+
+// Client calls the user management API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	onTokens   func(Tokens)
+
+	mu     sync.Mutex
+	tokens Tokens
+	// refreshing serializes refreshes; refresh tokens are single use
+	refreshing sync.Mutex
+}
+
+// Tokens are the credentials of a signed-in session
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresAt is when the access token expires
+	ExpiresAt time.Time
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithRetries sets how often a failed request is retried and the range of the waits
+// between attempts, which double from min up to max. The default is 3 retries
+// between 200ms and 5s; 0 turns retries off.
+func WithRetries(retries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithTokens resumes a session, e.g. one saved from a token handler
+func WithTokens(tokens Tokens) Option {
+	return func(c *Client) {
+		c.tokens = tokens
+	}
+}
+
+// WithTokenHandler calls fn whenever the session's tokens change, so they can be
+// stored. Refresh tokens are rotated on every refresh.
+func WithTokenHandler(fn func(Tokens)) Option {
+	return func(c *Client) {
+		c.onTokens = fn
+	}
+}
+
+// New creates a client of the API at baseURL, e.g. "https://users.example.com". The
+// API routes are expected under /api.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    3,
+		minBackoff: 200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Tokens returns the session's current tokens
+func (c *Client) Tokens() Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// setTokens replaces the session's tokens
+func (c *Client) setTokens(tokens Tokens) {
+	c.mu.Lock()
+	c.tokens = tokens
+	c.mu.Unlock()
+	if c.onTokens != nil {
+		c.onTokens(tokens)
+	}
+}
+
+// Error is a problem reported by the API
+type Error struct {
+	// Status is the HTTP status code
+	Status int `json:"status"`
+	// Code identifies the problem, e.g. token_expired or user_not_found
+	Code   string `json:"code"`
+	Title  string `json:"title"`
+	Detail string `json:"detail,omitempty"`
+	// Errors lists the fields that failed validation
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a validation failure of one request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// IsCode reports whether err is an API error with the given code
+func IsCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// envelope is the body of successful responses
+type envelope struct {
+	Data json.RawMessage `json:"data"`
+	Meta struct {
+		Pagination *Pagination `json:"pagination"`
+	} `json:"meta"`
+}
+
+// request describes one API call
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	// authenticated calls send the access token, refreshing it when needed
+	authenticated bool
+}
+
+// do sends a request and decodes the data of the response into out, which may be
+// nil. The response's pagination, if any, is returned.
+func (c *Client) do(ctx context.Context, req request, out any) (*Pagination, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	var token string
+	if req.authenticated {
+		var err error
+		if token, err = c.accessToken(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.send(ctx, req, body, token)
+	if err != nil {
+		return nil, err
+	}
+	// An access token can expire on the way; refresh it once and try again
+	if req.authenticated && resp.StatusCode == http.StatusUnauthorized {
+		apiErr := decodeError(resp)
+		if apiErr.Code != "token_expired" || c.Tokens().RefreshToken == "" {
+			return nil, apiErr
+		}
+		if err := c.refresh(ctx, token); err != nil {
+			return nil, err
+		}
+		if resp, err = c.send(ctx, req, body, c.Tokens().AccessToken); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, decodeError(resp)
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	var env envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return nil, fmt.Errorf("decode response data: %w", err)
+		}
+	}
+	return env.Meta.Pagination, nil
+}
+
+// send performs a request, retrying network failures and overloaded or unavailable
+// responses with backoff. The caller closes the body of the returned response.
+func (c *Client) send(ctx context.Context, req request, body []byte, token string) (*http.Response, error) {
+	u := c.baseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	// One key for all attempts, so the API applies a mutating request only once
+	var idempotencyKey string
+	if req.method != http.MethodGet {
+		idempotencyKey = newIdempotencyKey()
+	}
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Accept", "application/json")
+		if body != nil {
+			httpReq.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		}
+		if idempotencyKey != "" {
+			httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+
+		resp, err := c.httpClient.Do(httpReq)
+		wait := c.backoff(attempt)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || attempt >= c.retries {
+				return nil, err
+			}
+		case retryable(resp.StatusCode) && attempt < c.retries:
+			// The API says when to come back; give up if that is too far off
+			if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+				if wait = time.Duration(seconds) * time.Second; wait > c.maxBackoff {
+					return resp, nil
+				}
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryable reports whether a response status may go away on its own
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the wait before the retry after an attempt: doubling from the
+// minimum, capped at the maximum, with up to half of it randomized
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.minBackoff << attempt
+	if wait <= 0 || wait > c.maxBackoff {
+		wait = c.maxBackoff
+	}
+	if half := int64(wait / 2); half > 0 {
+		wait = wait/2 + time.Duration(rand.Int64N(half+1))
+	}
+	return wait
+}
+
+// accessToken returns the session's access token, refreshed first if it is about to
+// expire
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	tokens := c.Tokens()
+	if tokens.AccessToken == "" {
+		return "", errors.New("client: not signed in")
+	}
+	if tokens.RefreshToken != "" && !tokens.ExpiresAt.IsZero() && time.Until(tokens.ExpiresAt) < refreshMargin {
+		if err := c.refresh(ctx, tokens.AccessToken); err != nil {
+			return "", err
+		}
+		return c.Tokens().AccessToken, nil
+	}
+	return tokens.AccessToken, nil
+}
+
+// refresh exchanges the refresh token for new tokens unless another call already
+// replaced the stale access token
+func (c *Client) refresh(ctx context.Context, stale string) error {
+	c.refreshing.Lock()
+	defer c.refreshing.Unlock()
+	tokens := c.Tokens()
+	if tokens.AccessToken != stale {
+		return nil
+	}
+
+	var resp tokenResponse
+	if _, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/auth/refresh",
+		body:   map[string]string{"refresh_token": tokens.RefreshToken},
+	}, &resp); err != nil {
+		return err
+	}
+	c.setTokens(resp.tokens())
+	return nil
+}
+
+// decodeError reads a problem response, falling back to the status when the body is
+// not a problem document
+func decodeError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	apiErr := &Error{}
+	if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Code == "" {
+		apiErr.Code = "http_" + strconv.Itoa(resp.StatusCode)
+		apiErr.Title = http.StatusText(resp.StatusCode)
+	}
+	apiErr.Status = resp.StatusCode
+	return apiErr
+}
+
+// newIdempotencyKey returns a random Idempotency-Key
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	crand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,352 @@
+// Package authtest provides test doubles of the token service, for downstream apps
+// and this repository's handler tests:
+//
+//   - Fake issues deterministic tokens ("access-1", "refresh-2", ...) and validates
+//     the ones it issued, with a controllable clock
+//   - Mock calls a function per method, for asserting calls or injecting failures
+//   - NewJWTService, NewPasetoService and the key helpers build real services with
+//     throwaway keys
+//
+// All of them implement usermgmt.TokenService.
+package authtest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/pkg/usermgmt"
+)
+
+// Issuer is the issuer of the tokens the helpers create
+const Issuer = "um-api-test"
+
+// Errors of the fake's token validation
+var (
+	// ErrUnknownToken is returned for tokens the fake did not issue
+	ErrUnknownToken = fmt.Errorf("authtest: unknown token: %w", jwt.ErrTokenMalformed)
+	// ErrWrongKind is returned when an access token is validated as a refresh token
+	// or the other way round
+	ErrWrongKind = fmt.Errorf("authtest: wrong kind of token: %w", jwt.ErrTokenInvalidClaims)
+)
+
+var _ usermgmt.TokenService = (*Fake)(nil)
+
+// issued is a token the fake handed out
+type issued struct {
+	claims  *usermgmt.Claims
+	refresh bool
+}
+
+// Fake is a TokenService with deterministic tokens. Tokens are numbered in the order
+// they are issued and only the fake can validate them. Expired tokens fail with an
+// error wrapping jwt.ErrTokenExpired, like real ones. The zero value is not usable;
+// create fakes with NewFake.
+type Fake struct {
+	// AccessTTL and RefreshTTLValue are the token lifetimes
+	AccessTTL       time.Duration
+	RefreshTTLValue time.Duration
+	// Now is the fake's clock; tests move it to expire tokens
+	Now func() time.Time
+	// Err, when set, makes every call that issues a token fail with it
+	Err error
+
+	mu     sync.Mutex
+	n      int
+	tokens map[string]issued
+}
+
+// NewFake creates a fake issuing 15 minute access and 7 day refresh tokens on the
+// real clock
+func NewFake() *Fake {
+	return &Fake{
+		AccessTTL:       15 * time.Minute,
+		RefreshTTLValue: 7 * 24 * time.Hour,
+		Now:             time.Now,
+		tokens:          make(map[string]issued),
+	}
+}
+
+// GenerateTokenPair issues an access and a refresh token for the user
+func (f *Fake) GenerateTokenPair(user *usermgmt.User, authn usermgmt.Authentication) (*usermgmt.TokenPair, error) {
+	return f.GenerateTokenPairUntil(user, authn, f.Now().Add(f.RefreshTTLValue))
+}
+
+// GenerateTokenPairUntil issues a token pair whose refresh token expires at
+// refreshExpiresAt
+func (f *Fake) GenerateTokenPairUntil(user *usermgmt.User, authn usermgmt.Authentication, refreshExpiresAt time.Time) (*usermgmt.TokenPair, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	access := f.issue("access", f.claims(user, authn, auth.TypeAccess, f.Now().Add(f.AccessTTL)), false)
+	refresh := f.issue("refresh", f.claims(user, authn, auth.TypeRefresh, refreshExpiresAt), true)
+	return &usermgmt.TokenPair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		ExpiresIn:        int64(f.AccessTTL / time.Second),
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// GenerateScopedToken issues an access token limited to scope, without a refresh token
+func (f *Fake) GenerateScopedToken(user *usermgmt.User, authn usermgmt.Authentication, scope string) (*usermgmt.TokenPair, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	claims := f.claims(user, authn, auth.TypeAccess, f.Now().Add(f.AccessTTL))
+	claims.Scope = scope
+	return &usermgmt.TokenPair{
+		AccessToken: f.issue("access", claims, false),
+		ExpiresIn:   int64(f.AccessTTL / time.Second),
+	}, nil
+}
+
+// IssueToken issues a token carrying exactly the given claims. It is an access token
+// unless the claims are typed as a refresh token; untyped claims are typed as access.
+func (f *Fake) IssueToken(claims *usermgmt.Claims) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	typed := *claims
+	if typed.Type == auth.TypeRefresh {
+		return f.issue("refresh", &typed, true), nil
+	}
+	typed.Type = auth.TypeAccess
+	return f.issue("access", &typed, false), nil
+}
+
+// ValidateToken returns the claims of an access token the fake issued
+func (f *Fake) ValidateToken(token string) (*usermgmt.Claims, error) {
+	return f.validate(token, false)
+}
+
+// ValidateRefreshToken returns the claims of a refresh token the fake issued
+func (f *Fake) ValidateRefreshToken(token string) (*usermgmt.Claims, error) {
+	return f.validate(token, true)
+}
+
+// RefreshTTL returns RefreshTTLValue
+func (f *Fake) RefreshTTL() time.Duration {
+	return f.RefreshTTLValue
+}
+
+// AccessToken issues an access token for a user with the given ID and roles,
+// authenticated with a password just now
+func (f *Fake) AccessToken(userID uint, roles ...string) string {
+	user := &usermgmt.User{ID: userID}
+	for _, role := range roles {
+		user.Roles = append(user.Roles, usermgmt.Role{Name: role})
+	}
+	authn := usermgmt.Authentication{Time: f.Now(), Methods: []string{auth.MethodPassword}}
+	pair, err := f.GenerateScopedToken(user, authn, "")
+	if err != nil {
+		panic(err)
+	}
+	return pair.AccessToken
+}
+
+// Claims returns the claims of a token the fake issued, expired or not
+func (f *Fake) Claims(token string) (*usermgmt.Claims, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.tokens[token]
+	return t.claims, ok
+}
+
+// Forget makes the fake reject a token as unknown, as if it had been tampered with
+func (f *Fake) Forget(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.tokens, token)
+}
+
+// issue records a token with the next number
+func (f *Fake) issue(kind string, claims *usermgmt.Claims, refresh bool) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n++
+	token := fmt.Sprintf("%s-%d", kind, f.n)
+	if claims.ID == "" {
+		claims.ID = fmt.Sprintf("token-%d", f.n)
+	}
+	f.tokens[token] = issued{claims: claims, refresh: refresh}
+	return token
+}
+
+// validate looks up an issued token of the right kind and checks its expiry
+func (f *Fake) validate(token string, refresh bool) (*usermgmt.Claims, error) {
+	f.mu.Lock()
+	t, ok := f.tokens[token]
+	f.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownToken
+	}
+	if t.refresh != refresh {
+		return nil, ErrWrongKind
+	}
+	if t.claims.ExpiresAt != nil && !f.Now().Before(t.claims.ExpiresAt.Time) {
+		return nil, fmt.Errorf("authtest: %w", jwt.ErrTokenExpired)
+	}
+	claims := *t.claims
+	return &claims, nil
+}
+
+// claims describes the user in a token of type typ expiring at expiresAt
+func (f *Fake) claims(user *usermgmt.User, authn usermgmt.Authentication, typ string, expiresAt time.Time) *usermgmt.Claims {
+	now := f.Now()
+	claims := &usermgmt.Claims{
+		UserID:       user.ID,
+		Email:        user.Email,
+		Name:         user.Name,
+		Locale:       user.Locale,
+		Type:         typ,
+		TokenVersion: user.TokenVersion,
+		AuthTime:     jwt.NewNumericDate(authn.Time),
+		AMR:          authn.Methods,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	if user.Username != nil {
+		claims.Username = *user.Username
+	}
+	for _, role := range user.Roles {
+		claims.Roles = append(claims.Roles, role.Name)
+	}
+	return claims
+}
+
+// ErrNotMocked is returned by Mock methods whose function is not set
+var ErrNotMocked = errors.New("authtest: method not mocked")
+
+var _ usermgmt.TokenService = (*Mock)(nil)
+
+// Mock is a TokenService whose methods call the function of the same name. Methods
+// whose function is nil fail with ErrNotMocked; RefreshTTL then returns 0.
+type Mock struct {
+	GenerateTokenPairFunc      func(user *usermgmt.User, authn usermgmt.Authentication) (*usermgmt.TokenPair, error)
+	GenerateTokenPairUntilFunc func(user *usermgmt.User, authn usermgmt.Authentication, refreshExpiresAt time.Time) (*usermgmt.TokenPair, error)
+	GenerateScopedTokenFunc    func(user *usermgmt.User, authn usermgmt.Authentication, scope string) (*usermgmt.TokenPair, error)
+	IssueTokenFunc             func(claims *usermgmt.Claims) (string, error)
+	ValidateTokenFunc          func(token string) (*usermgmt.Claims, error)
+	ValidateRefreshTokenFunc   func(token string) (*usermgmt.Claims, error)
+	RefreshTTLFunc             func() time.Duration
+}
+
+// GenerateTokenPair calls GenerateTokenPairFunc
+func (m *Mock) GenerateTokenPair(user *usermgmt.User, authn usermgmt.Authentication) (*usermgmt.TokenPair, error) {
+	if m.GenerateTokenPairFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GenerateTokenPairFunc(user, authn)
+}
+
+// GenerateTokenPairUntil calls GenerateTokenPairUntilFunc
+func (m *Mock) GenerateTokenPairUntil(user *usermgmt.User, authn usermgmt.Authentication, refreshExpiresAt time.Time) (*usermgmt.TokenPair, error) {
+	if m.GenerateTokenPairUntilFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GenerateTokenPairUntilFunc(user, authn, refreshExpiresAt)
+}
+
+// GenerateScopedToken calls GenerateScopedTokenFunc
+func (m *Mock) GenerateScopedToken(user *usermgmt.User, authn usermgmt.Authentication, scope string) (*usermgmt.TokenPair, error) {
+	if m.GenerateScopedTokenFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GenerateScopedTokenFunc(user, authn, scope)
+}
+
+// IssueToken calls IssueTokenFunc
+func (m *Mock) IssueToken(claims *usermgmt.Claims) (string, error) {
+	if m.IssueTokenFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.IssueTokenFunc(claims)
+}
+
+// ValidateToken calls ValidateTokenFunc
+func (m *Mock) ValidateToken(token string) (*usermgmt.Claims, error) {
+	if m.ValidateTokenFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ValidateTokenFunc(token)
+}
+
+// ValidateRefreshToken calls ValidateRefreshTokenFunc
+func (m *Mock) ValidateRefreshToken(token string) (*usermgmt.Claims, error) {
+	if m.ValidateRefreshTokenFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ValidateRefreshTokenFunc(token)
+}
+
+// RefreshTTL calls RefreshTTLFunc
+func (m *Mock) RefreshTTL() time.Duration {
+	if m.RefreshTTLFunc == nil {
+		return 0
+	}
+	return m.RefreshTTLFunc()
+}
+
+// JWTConfig returns a token configuration for tests: the given format, a fresh random
+// key, 15 minute access and 7 day refresh tokens, and Issuer
+func JWTConfig(format string) usermgmt.JWTConfig {
+	cfg := config.JWTConfig{
+		Format:     format,
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 7 * 24 * time.Hour,
+		Issuer:     Issuer,
+	}
+	switch format {
+	case "paseto-public":
+		cfg.PasetoKey, _ = MustKeyPair()
+	case "paseto-local":
+		cfg.PasetoKey = MustSecret(32)
+	default:
+		cfg.Secret = MustSecret(32)
+	}
+	return cfg
+}
+
+// NewJWTService creates a real JWT service with a random secret
+func NewJWTService() *usermgmt.JWTService {
+	return auth.NewJWTService(JWTConfig("jwt"))
+}
+
+// NewPasetoService creates a real paseto-public service with a fresh key pair; its
+// PublicKey verifies the tokens elsewhere
+func NewPasetoService() *usermgmt.PasetoService {
+	ps, err := auth.NewPasetoService(JWTConfig("paseto-public"))
+	if err != nil {
+		panic(err)
+	}
+	return ps
+}
+
+// MustSecret returns n random bytes, hex-encoded, for JWT_SECRET or a paseto-local key
+func MustSecret(n int) string {
+	secret, err := auth.GenerateSecret(n)
+	if err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// MustKeyPair returns a new Ed25519 key pair for paseto-public, hex-encoded: the seed
+// for PASETO_KEY and the public key
+func MustKeyPair() (seed, publicKey string) {
+	seed, publicKey, err := auth.GenerateKeyPair()
+	if err != nil {
+		panic(err)
+	}
+	return seed, publicKey
+}
@@ -0,0 +1,120 @@
+// Package httpauth protects net/http handlers with tokens issued by the user
+// management API, for services that don't use Gin. The middleware has the
+// func(http.Handler) http.Handler shape that chi's Router.Use takes as is and echo
+// adapts with echo.WrapMiddleware:
+//
+//	authn := httpauth.Authenticate(tokens, httpauth.Options{})
+//
+//	mux.Handle("/orders", authn(httpauth.RequireRole("user")(orders)))  // net/http
+//	r.With(authn, httpauth.RequireRole("user")).Get("/orders", listOrders) // chi
+//	e.GET("/orders", listOrders, echo.WrapMiddleware(authn))              // echo
+//
+// Rejected requests get the same problem+json responses as the API's own routes.
+package httpauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/ristep/um_starter_jwt_go/internal/apperr"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/problem"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/pkg/usermgmt"
+)
+
+// contextKey keys the request context values set by Authenticate
+type contextKey int
+
+const (
+	claimsKey contextKey = iota
+	userKey
+)
+
+// Options configure Authenticate
+type Options struct {
+	// Users, when set, loads the user of each request so that revoked tokens and
+	// suspended accounts are rejected right away. Otherwise the user is built from the
+	// token's claims.
+	Users usermgmt.UserRepository
+	// Revocations, when set, rejects access tokens revoked one by one, e.g. at logout
+	Revocations usermgmt.RevocationList
+}
+
+// Authenticate returns middleware that rejects requests without a valid access token
+// and puts the token's claims and user in the request context. Tokens scoped to
+// two-factor setup are only good for the API's own routes and are rejected.
+func Authenticate(tokens usermgmt.TokenService, opts Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			claims, err := middleware.Authenticate(ctx, r.Header.Get("Authorization"), tokens, opts.Revocations)
+			if err != nil {
+				problem.WriteHTTP(w, r, err)
+				return
+			}
+			if claims.Scope != "" {
+				problem.WriteHTTP(w, r, apperr.ErrTwoFactorEnrollmentRequired)
+				return
+			}
+
+			user := claims.User()
+			if opts.Users != nil {
+				user, err = opts.Users.FindByIDFromReplica(ctx, claims.UserID)
+				if err != nil {
+					if errors.Is(err, repository.ErrNotFound) {
+						err = apperr.ErrTokenUserNotFound
+					} else {
+						err = apperr.ErrDatabase.Wrap(err)
+					}
+					problem.WriteHTTP(w, r, err)
+					return
+				}
+				if err := middleware.CheckUser(claims, user); err != nil {
+					problem.WriteHTTP(w, r, err)
+					return
+				}
+			}
+
+			ctx = context.WithValue(ctx, claimsKey, claims)
+			ctx = context.WithValue(ctx, userKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireRole returns middleware that only lets users with one of the roles through.
+// Use it after Authenticate.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := User(r.Context())
+			if !ok {
+				problem.WriteHTTP(w, r, apperr.ErrUnauthorized)
+				return
+			}
+			if !slices.ContainsFunc(user.Roles, func(role usermgmt.Role) bool {
+				return slices.Contains(roles, role.Name)
+			}) {
+				problem.WriteHTTP(w, r, apperr.ErrInsufficientPermissions)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Claims returns the claims of the access token validated by Authenticate
+func Claims(ctx context.Context) (*usermgmt.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*usermgmt.Claims)
+	return claims, ok
+}
+
+// User returns the user authenticated by Authenticate. Without Options.Users only
+// the identity, roles, locale and token version are set.
+func User(ctx context.Context) (*usermgmt.User, bool) {
+	user, ok := ctx.Value(userKey).(*usermgmt.User)
+	return user, ok
+}
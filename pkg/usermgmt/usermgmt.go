@@ -0,0 +1,178 @@
+// Package usermgmt embeds the user management API in an existing Gin application.
+// Mount registers the auth, profile, user, API key and admin routes on one of the
+// host's router groups and returns a Module whose middleware protects the host's own
+// routes with the same tokens (services without Gin use the httpauth subpackage):
+//
+//	cfg, err := usermgmt.LoadConfig()
+//	...
+//	users, err := usermgmt.Mount(router.Group("/accounts"), usermgmt.Options{Config: cfg, DB: db})
+//	...
+//	users.Start()
+//	defer users.Stop()
+//	router.GET("/orders", users.RequireAuth(), usermgmt.RequireRole("user"), listOrders)
+//
+// The module is configured like the standalone server; see LoadConfig.
+package usermgmt
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/ristep/um_starter_jwt_go/internal/app"
+	"github.com/ristep/um_starter_jwt_go/internal/auth"
+	"github.com/ristep/um_starter_jwt_go/internal/config"
+	"github.com/ristep/um_starter_jwt_go/internal/middleware"
+	"github.com/ristep/um_starter_jwt_go/internal/models"
+	"github.com/ristep/um_starter_jwt_go/internal/repository"
+	"github.com/ristep/um_starter_jwt_go/internal/sessions"
+)
+
+type (
+	// Config is the configuration of the module, the same as the standalone server's
+	Config = config.Config
+	// JWTConfig configures the tokens the module issues
+	JWTConfig = config.JWTConfig
+	// TokenService issues and validates tokens
+	TokenService = auth.TokenService
+	// JWTService is the TokenService of the jwt format
+	JWTService = auth.JWTService
+	// PasetoService is the TokenService of the paseto-local and paseto-public formats
+	PasetoService = auth.PasetoService
+	// TokenPair is an access token with its refresh token
+	TokenPair = auth.TokenPair
+	// Authentication records when and how a user proved their identity
+	Authentication = auth.Authentication
+	// Claims are the claims of a validated token
+	Claims = auth.CustomClaims
+	// User is a stored user with its roles
+	User = models.User
+	// Role is a role users can have
+	Role = models.Role
+	// UserRepository reads and writes users
+	UserRepository = repository.UserRepository
+	// RevocationList holds individually revoked access tokens until they expire
+	RevocationList = sessions.RevocationList
+)
+
+// LoadConfig reads the configuration the way the standalone server does: defaults,
+// the YAML file named by CONFIG_FILE, .env and the environment
+func LoadConfig() (*Config, error) {
+	return config.Load()
+}
+
+// LoadConfigFile is like LoadConfig but reads the given YAML file instead of
+// CONFIG_FILE
+func LoadConfigFile(path string) (*Config, error) {
+	return config.LoadFile(path)
+}
+
+// NewJWTService creates a JWT service from the token configuration, for services
+// that only validate tokens issued by a user management instance
+func NewJWTService(cfg JWTConfig) *JWTService {
+	return auth.NewJWTService(cfg)
+}
+
+// Options configure Mount
+type Options struct {
+	// Config is required
+	Config *Config
+	// DB is the connection to store users in; when nil one is opened from
+	// Config.Database. The schema is migrated either way.
+	DB *gorm.DB
+	// Logger is used instead of a JSON logger on stdout; when set, the default slog
+	// logger is left alone
+	Logger *slog.Logger
+}
+
+// Module is the user management API mounted on a router
+type Module struct {
+	app *app.App
+}
+
+// Mount assembles the user management API and registers its routes on group. Nothing
+// runs in the background until Start.
+//
+// The group gets the module's request ID, locale, maintenance, body limit and
+// idempotency middleware; recovery, access logging, CORS and compression are left to
+// the host router. Health checks and API documentation are only served standalone.
+func Mount(group *gin.RouterGroup, opts Options) (*Module, error) {
+	if opts.Config == nil {
+		return nil, errors.New("usermgmt: Options.Config is required")
+	}
+	var appOpts []app.Option
+	if opts.DB != nil {
+		appOpts = append(appOpts, app.WithDB(opts.DB))
+	}
+	if opts.Logger != nil {
+		appOpts = append(appOpts, app.WithLogger(opts.Logger))
+	}
+
+	a, err := app.New(opts.Config, appOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Mount(group); err != nil {
+		a.StopJobs()
+		return nil, err
+	}
+	return &Module{app: a}, nil
+}
+
+// Start runs the module's background jobs: the email queue, secret and blocklist
+// refreshes, the inactivity job and API key usage metering
+func (m *Module) Start() {
+	m.app.StartJobs()
+}
+
+// Stop stops the background jobs, letting running ones finish, and closes the
+// module's Redis connection. A database opened by the module is left open.
+func (m *Module) Stop() {
+	m.app.StopJobs()
+}
+
+// Tokens returns the service issuing and validating the module's tokens
+func (m *Module) Tokens() TokenService {
+	return m.app.TokenService()
+}
+
+// Users returns the repository of the module's users
+func (m *Module) Users() UserRepository {
+	return m.app.Users
+}
+
+// Revocations returns the list of access tokens revoked at logout or from the session
+// list. Without Redis the list only lives in the module's process.
+func (m *Module) Revocations() RevocationList {
+	return m.app.Revocations()
+}
+
+// RequireAuth returns middleware that rejects requests without a valid access token
+// and makes the user and claims available to CurrentUser and CurrentClaims
+func (m *Module) RequireAuth() gin.HandlerFunc {
+	return m.app.Authenticate()
+}
+
+// RequireRole returns middleware that only lets users with one of the roles through.
+// Use it after RequireAuth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return middleware.RoleMiddleware(roles...)
+}
+
+// CurrentUser returns the user authenticated by RequireAuth. In claims-only mode the
+// user is loaded from the database on first use.
+func CurrentUser(c *gin.Context) (*User, error) {
+	return middleware.FullUser(c)
+}
+
+// CurrentClaims returns the claims of the access token validated by RequireAuth
+func CurrentClaims(c *gin.Context) (*Claims, bool) {
+	claims, ok := c.Get("claims")
+	if !ok {
+		return nil, false
+	}
+	typed, ok := claims.(*Claims)
+	return typed, ok
+}